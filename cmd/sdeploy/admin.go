@@ -0,0 +1,446 @@
+package main
+
+import (
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// BuildsPath is the HTTP path that lists recent builds
+const BuildsPath = "/builds"
+
+// BuildsPathPrefix is the HTTP path prefix for build administration endpoints
+const BuildsPathPrefix = "/builds/"
+
+// Page size of GET /builds: the default and the largest accepted limit
+const (
+	defaultBuildListLimit = 20
+	maxBuildListLimit     = 500
+)
+
+// Build results reported by GET /builds
+const (
+	BuildResultSuccess = "success"
+	BuildResultFail    = "fail"
+	BuildResultRunning = "running"
+)
+
+// ReloadPath is the HTTP path that triggers a validated config reload
+const ReloadPath = "/reload"
+
+// StatusPath is the HTTP path that reports per-project deployment state
+const StatusPath = "/status"
+
+// buildIDPattern matches IDs produced by newBuildID
+var buildIDPattern = regexp.MustCompile(`^\d{4}-\d{2}-\d{2}-\d{4}-[0-9a-f]{6}$`)
+
+// buildLogFilePattern splits a build log filename into the sanitized project
+// name, the build ID and the status suffix
+var buildLogFilePattern = regexp.MustCompile(`^(.+)-(\d{4}-\d{2}-\d{2}-\d{4}(?:-[0-9a-f]{6})?)([A-Za-z0-9._-]{1,32})\.log$`)
+
+// buildLogNamePattern matches the suffix of build log filenames written by BuildLogger:
+// -{yyyy-mm-dd}-{HHMM}[-{suffix}]{status suffix}.log. Status suffixes are
+// configurable (log_success_suffix) but limited to the same character set.
+var buildLogNamePattern = regexp.MustCompile(`-\d{4}-\d{2}-\d{2}-\d{4}(-[0-9a-f]{6})?[A-Za-z0-9._-]{1,32}\.log$`)
+
+// currentConfig returns the active configuration, supporting both hot reload and legacy modes
+func (h *WebhookHandler) currentConfig() *Config {
+	if h.configManager != nil {
+		return h.configManager.GetConfig()
+	}
+	return h.config
+}
+
+// logDir returns the directory build logs are written to
+func (h *WebhookHandler) logDir() string {
+	if h.logger != nil {
+		return h.logger.LogDir()
+	}
+	if cfg := h.currentConfig(); cfg != nil && cfg.LogPath != "" {
+		return cfg.LogPath
+	}
+	return defaultLogPath()
+}
+
+// logDirs returns every directory build logs may be in: the service log
+// directory followed by the projects' log_path overrides
+func (h *WebhookHandler) logDirs() []string {
+	dirs := []string{h.logDir()}
+	seen := map[string]bool{filepath.Clean(dirs[0]): true}
+	if cfg := h.currentConfig(); cfg != nil {
+		for _, project := range cfg.Projects {
+			if project.LogPath != "" && !seen[filepath.Clean(project.LogPath)] {
+				seen[filepath.Clean(project.LogPath)] = true
+				dirs = append(dirs, project.LogPath)
+			}
+		}
+	}
+	return dirs
+}
+
+// authorizeAdmin checks the request's bearer token against admin_token and
+// writes an error response if it does not match. Admin endpoints are
+// disabled (404) when no admin_token is configured.
+func (h *WebhookHandler) authorizeAdmin(w http.ResponseWriter, r *http.Request) bool {
+	cfg := h.currentConfig()
+	if cfg == nil || cfg.AdminToken == "" {
+		http.Error(w, "Not found", http.StatusNotFound)
+		return false
+	}
+
+	token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+	if !ok || !compareSecret(token, cfg.AdminToken) {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return false
+	}
+	return true
+}
+
+// serveBuilds routes requests under BuildsPathPrefix
+func (h *WebhookHandler) serveBuilds(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if !h.authorizeAdmin(w, r) {
+		return
+	}
+
+	if r.URL.Path == BuildsPath {
+		h.serveBuildList(w, r)
+		return
+	}
+
+	// Expect /builds/{id}/log
+	ref, ok := strings.CutSuffix(strings.TrimPrefix(r.URL.Path, BuildsPathPrefix), "/log")
+	if !ok || ref == "" || strings.Contains(ref, "/") {
+		http.Error(w, "Not found", http.StatusNotFound)
+		return
+	}
+
+	h.serveBuildLog(w, r, ref)
+}
+
+// serveBuildLog streams the build log identified by a build ID or build log filename
+func (h *WebhookHandler) serveBuildLog(w http.ResponseWriter, r *http.Request, ref string) {
+	var path string
+	for _, dir := range h.logDirs() {
+		if path = findBuildLog(dir, ref); path != "" {
+			break
+		}
+	}
+	if path == "" {
+		http.Error(w, "Not found", http.StatusNotFound)
+		return
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		http.Error(w, "Not found", http.StatusNotFound)
+		return
+	}
+	defer f.Close()
+
+	info, err := f.Stat()
+	if err != nil || !info.Mode().IsRegular() {
+		http.Error(w, "Not found", http.StatusNotFound)
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	http.ServeContent(w, r, info.Name(), info.ModTime(), f)
+}
+
+// findBuildLog resolves a build ID or build log filename to a file in logDir.
+// Anything that does not look like a name BuildLogger writes is rejected, so
+// the result can never point outside logDir. Returns "" if nothing matches.
+func findBuildLog(logDir, ref string) string {
+	if buildIDPattern.MatchString(ref) {
+		matches, _ := filepath.Glob(filepath.Join(logDir, "*-"+ref+"*.log"))
+		for _, m := range matches {
+			if buildLogNamePattern.MatchString(filepath.Base(m)) {
+				return m
+			}
+		}
+		return ""
+	}
+
+	if ref != filepath.Base(ref) || strings.ContainsAny(ref, `/\`) || strings.HasPrefix(ref, ".") {
+		return ""
+	}
+	if !buildLogNamePattern.MatchString(ref) {
+		return ""
+	}
+
+	path := filepath.Join(logDir, ref)
+	if _, err := os.Stat(path); err != nil {
+		return ""
+	}
+	return path
+}
+
+// buildsResponse is the JSON body returned by GET /builds
+type buildsResponse struct {
+	Builds []buildSummary `json:"builds"`
+}
+
+// buildSummary describes one build found in the build log directories.
+// UpdatedAt is the log's modification time, i.e. the end of finished builds.
+type buildSummary struct {
+	Project   string    `json:"project"`
+	BuildID   string    `json:"build_id"`
+	Result    string    `json:"result"`
+	UpdatedAt time.Time `json:"updated_at"`
+	LogURL    string    `json:"log_url"`
+}
+
+// serveBuildList handles GET /builds: list recent builds newest first, read
+// from the build log files. Optional query parameters: project (name), result
+// (success, fail or running) and limit.
+func (h *WebhookHandler) serveBuildList(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+
+	limit := defaultBuildListLimit
+	if v := query.Get("limit"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 1 || n > maxBuildListLimit {
+			writeJSON(w, http.StatusBadRequest, errorResponse{Error: "limit must be between 1 and " + strconv.Itoa(maxBuildListLimit)})
+			return
+		}
+		limit = n
+	}
+
+	result := query.Get("result")
+	switch result {
+	case "", BuildResultSuccess, BuildResultFail, BuildResultRunning:
+	default:
+		writeJSON(w, http.StatusBadRequest, errorResponse{Error: "result must be success, fail or running"})
+		return
+	}
+
+	// Map sanitized filename prefixes back to project names
+	cfg := h.currentConfig()
+	names := make(map[string]string)
+	for _, project := range cfg.Projects {
+		names[sanitizeProjectName(project.Name)] = project.Name
+	}
+
+	dirs := h.logDirs()
+	if name := query.Get("project"); name != "" {
+		project := cfg.FindProjectByName(name)
+		if project == nil {
+			writeJSON(w, http.StatusNotFound, errorResponse{Error: "unknown project: " + name})
+			return
+		}
+		names = map[string]string{sanitizeProjectName(project.Name): project.Name}
+		dirs = []string{h.logDir()}
+		if project.LogPath != "" {
+			dirs = []string{project.LogPath}
+		}
+	}
+
+	builds := h.listBuilds(dirs, names, query.Get("project") == "")
+	if result != "" {
+		filtered := builds[:0]
+		for _, b := range builds {
+			if b.Result == result {
+				filtered = append(filtered, b)
+			}
+		}
+		builds = filtered
+	}
+	sort.SliceStable(builds, func(i, j int) bool {
+		return builds[i].UpdatedAt.After(builds[j].UpdatedAt)
+	})
+	if len(builds) > limit {
+		builds = builds[:limit]
+	}
+
+	writeJSON(w, http.StatusOK, buildsResponse{Builds: builds})
+}
+
+// listBuilds reads the build logs in dirs. Logs of projects missing from names
+// (e.g. removed from the config) are included under their filename prefix
+// when includeUnknown is set. Files with other status suffixes are ignored.
+func (h *WebhookHandler) listBuilds(dirs []string, names map[string]string, includeUnknown bool) []buildSummary {
+	passSuffix, failSuffix := Defaults.LogSuccessSuffix, Defaults.LogFailSuffix
+	if h.logger != nil {
+		passSuffix, failSuffix = h.logger.buildLogSuffixes()
+	}
+	results := map[string]string{
+		passSuffix:       BuildResultSuccess,
+		failSuffix:       BuildResultFail,
+		pendingLogSuffix: BuildResultRunning,
+	}
+
+	builds := []buildSummary{}
+	for _, dir := range dirs {
+		entries, err := os.ReadDir(dir)
+		if err != nil {
+			continue
+		}
+		for _, entry := range entries {
+			m := buildLogFilePattern.FindStringSubmatch(entry.Name())
+			if m == nil || !entry.Type().IsRegular() {
+				continue
+			}
+			result, ok := results[m[3]]
+			if !ok {
+				continue
+			}
+			project, known := names[m[1]]
+			if !known {
+				if !includeUnknown {
+					continue
+				}
+				project = m[1]
+			}
+			info, err := entry.Info()
+			if err != nil {
+				continue
+			}
+			builds = append(builds, buildSummary{
+				Project:   project,
+				BuildID:   m[2],
+				Result:    result,
+				UpdatedAt: info.ModTime(),
+				LogURL:    BuildsPathPrefix + url.PathEscape(entry.Name()) + "/log",
+			})
+		}
+	}
+	return builds
+}
+
+// serveReload handles POST /reload: validate the config file and swap it in
+func (h *WebhookHandler) serveReload(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if !h.authorizeAdmin(w, r) {
+		return
+	}
+	if h.configManager == nil {
+		http.Error(w, "Not found", http.StatusNotFound)
+		return
+	}
+
+	buildsActive := h.deployer != nil && h.deployer.HasActiveBuilds()
+	result, err := h.configManager.ValidateAndReload(buildsActive)
+	if err != nil {
+		writeJSON(w, http.StatusBadRequest, errorResponse{Error: err.Error()})
+		return
+	}
+
+	status := http.StatusOK
+	if result.Deferred {
+		status = http.StatusAccepted
+	}
+	writeJSON(w, status, result)
+}
+
+// errorResponse is the JSON body for admin endpoint errors
+type errorResponse struct {
+	Error string `json:"error"`
+}
+
+// statusResponse is the JSON body returned by GET /status
+type statusResponse struct {
+	MaintenanceMode bool            `json:"maintenance_mode"`
+	Projects        []projectStatus `json:"projects"`
+}
+
+// projectStatus describes one project in the status report. Queue lists
+// running, waiting and debounced builds oldest first and is never null.
+// ConsecutiveFailures counts failed builds since the last success; BreakerOpen
+// is set while the circuit breaker holds back webhook builds, as decided by
+// Deployer.breakerState.
+type projectStatus struct {
+	Name                string        `json:"name"`
+	WebhookPath         string        `json:"webhook_path"`
+	Enabled             bool          `json:"enabled"`
+	Running             bool          `json:"running"`
+	Queued              int           `json:"queued"`
+	Queue               []queuedBuild `json:"queue"`
+	LastBuild           *lastBuild    `json:"last_build,omitempty"`
+	ConsecutiveFailures int           `json:"consecutive_failures"`
+	BreakerOpen         bool          `json:"breaker_open"`
+}
+
+// lastBuild summarizes the most recent completed deployment of a project
+type lastBuild struct {
+	BuildID   string    `json:"build_id"`
+	Success   bool      `json:"success"`
+	Error     string    `json:"error,omitempty"`
+	ErrorKind ErrorKind `json:"error_kind,omitempty"`
+	CommitSHA string    `json:"commit_sha,omitempty"`
+	StartTime time.Time `json:"start_time"`
+	EndTime   time.Time `json:"end_time"`
+}
+
+// serveStatus handles GET /status: report each project's state
+func (h *WebhookHandler) serveStatus(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if !h.authorizeAdmin(w, r) {
+		return
+	}
+
+	cfg := h.currentConfig()
+	resp := statusResponse{
+		MaintenanceMode: h.inMaintenance(),
+		Projects:        make([]projectStatus, 0, len(cfg.Projects)),
+	}
+	for i := range cfg.Projects {
+		project := &cfg.Projects[i]
+		status := projectStatus{
+			Name:        project.Name,
+			WebhookPath: project.WebhookPath,
+			Enabled:     project.IsEnabled(),
+			Queue:       h.debouncedBuilds(project),
+		}
+		if h.deployer != nil {
+			status.Queue = append(status.Queue, h.deployer.queue.snapshot(project)...)
+		}
+		sort.SliceStable(status.Queue, func(i, j int) bool {
+			return status.Queue[i].EnqueuedAt.Before(status.Queue[j].EnqueuedAt)
+		})
+		if status.Queue == nil {
+			status.Queue = []queuedBuild{}
+		}
+		for _, b := range status.Queue {
+			if b.State == QueueStateRunning {
+				status.Running = true
+			} else {
+				status.Queued++
+			}
+		}
+		if h.deployer != nil {
+			state := h.deployer.state.snapshot(project.DeployKey())
+			if state.HasLast {
+				status.LastBuild = &lastBuild{
+					BuildID:   state.Last.BuildID,
+					Success:   state.Last.Success,
+					Error:     state.Last.Error,
+					ErrorKind: state.Last.ErrorKind,
+					CommitSHA: state.Last.CommitSHA,
+					StartTime: state.Last.StartTime,
+					EndTime:   state.Last.EndTime,
+				}
+			}
+			status.ConsecutiveFailures = state.ConsecutiveFailures
+			status.BreakerOpen, _, _ = h.deployer.breakerState(project, h.deployer.clock.Now())
+		}
+		resp.Projects = append(resp.Projects, status)
+	}
+
+	writeJSON(w, http.StatusOK, resp)
+}
@@ -0,0 +1,490 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// newAdminTestHandler returns a handler whose logger writes build logs to logDir
+func newAdminTestHandler(logDir, adminToken string) *WebhookHandler {
+	cfg := &Config{
+		AdminToken: adminToken,
+		Projects: []ProjectConfig{
+			{
+				Name:           "Frontend",
+				WebhookPath:    "/hooks/frontend",
+				WebhookSecret:  "secret",
+				ExecuteCommand: "echo test",
+			},
+		},
+	}
+	var buf bytes.Buffer
+	return NewWebhookHandler(cfg, NewLogger(&buf, logDir, false))
+}
+
+// TestFindBuildLog tests lookup by build ID and filename, and rejection of unsafe names
+func TestFindBuildLog(t *testing.T) {
+	logDir := t.TempDir()
+	name := "Frontend-2024-01-15-1430-a1b2c3-success.log"
+	if err := os.WriteFile(filepath.Join(logDir, name), []byte("log"), 0644); err != nil {
+		t.Fatalf("Failed to write build log: %v", err)
+	}
+	if err := os.WriteFile(filepath.Join(logDir, "main.log"), []byte("log"), 0644); err != nil {
+		t.Fatalf("Failed to write main log: %v", err)
+	}
+
+	tests := []struct {
+		ref      string
+		expected string
+	}{
+		{"2024-01-15-1430-a1b2c3", name},
+		{name, name},
+		{"2024-01-15-1430-ffffff", ""},
+		{"main.log", ""},
+		{"../" + name, ""},
+		{"..%2F" + name, ""},
+		{"*", ""},
+		{"2024-01-15-1430-*", ""},
+	}
+
+	for _, tt := range tests {
+		got := findBuildLog(logDir, tt.ref)
+		if tt.expected == "" {
+			if got != "" {
+				t.Errorf("findBuildLog(%q) = %q, expected no match", tt.ref, got)
+			}
+			continue
+		}
+		if got != filepath.Join(logDir, tt.expected) {
+			t.Errorf("findBuildLog(%q) = %q, expected %q", tt.ref, got, tt.expected)
+		}
+	}
+}
+
+// TestBuildLogEndpoint tests authentication and content of /builds/{id}/log
+func TestBuildLogEndpoint(t *testing.T) {
+	logDir := t.TempDir()
+	name := "Frontend-2024-01-15-1430-a1b2c3-fail.log"
+	if err := os.WriteFile(filepath.Join(logDir, name), []byte("build output"), 0644); err != nil {
+		t.Fatalf("Failed to write build log: %v", err)
+	}
+
+	handler := newAdminTestHandler(logDir, "admin-secret")
+
+	tests := []struct {
+		name   string
+		method string
+		path   string
+		token  string
+		status int
+	}{
+		{"by build ID", "GET", "/builds/2024-01-15-1430-a1b2c3/log", "admin-secret", http.StatusOK},
+		{"by filename", "GET", "/builds/" + name + "/log", "admin-secret", http.StatusOK},
+		{"missing token", "GET", "/builds/2024-01-15-1430-a1b2c3/log", "", http.StatusUnauthorized},
+		{"wrong token", "GET", "/builds/2024-01-15-1430-a1b2c3/log", "nope", http.StatusUnauthorized},
+		{"unknown ID", "GET", "/builds/2024-01-15-1430-000000/log", "admin-secret", http.StatusNotFound},
+		{"traversal", "GET", "/builds/..%2Fmain.log/log", "admin-secret", http.StatusNotFound},
+		{"wrong method", "POST", "/builds/2024-01-15-1430-a1b2c3/log", "admin-secret", http.StatusMethodNotAllowed},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(tt.method, tt.path, nil)
+			if tt.token != "" {
+				req.Header.Set("Authorization", "Bearer "+tt.token)
+			}
+			rr := httptest.NewRecorder()
+			handler.ServeHTTP(rr, req)
+
+			if rr.Code != tt.status {
+				t.Fatalf("Expected status %d, got %d", tt.status, rr.Code)
+			}
+			if tt.status == http.StatusOK && rr.Body.String() != "build output" {
+				t.Errorf("Expected build log content, got %q", rr.Body.String())
+			}
+		})
+	}
+}
+
+// TestBuildListEndpoint tests listing, filtering and limiting GET /builds
+func TestBuildListEndpoint(t *testing.T) {
+	logDir := t.TempDir()
+	now := time.Now()
+	files := []struct {
+		name string
+		age  time.Duration
+	}{
+		{"Frontend-2024-01-15-1430-a1b2c3-success.log", 3 * time.Minute},
+		{"Frontend-2024-01-15-1431-d4e5f6-fail.log", 2 * time.Minute},
+		{"Frontend-2024-01-15-1432-0a1b2c-pending.log", time.Minute},
+		{"Removed-2024-01-15-1429-ffffff-success.log", 4 * time.Minute},
+		{"main.log", 0},
+	}
+	for _, f := range files {
+		path := filepath.Join(logDir, f.name)
+		if err := os.WriteFile(path, []byte("log"), 0644); err != nil {
+			t.Fatalf("Failed to write %s: %v", f.name, err)
+		}
+		if err := os.Chtimes(path, now.Add(-f.age), now.Add(-f.age)); err != nil {
+			t.Fatalf("Failed to set times of %s: %v", f.name, err)
+		}
+	}
+	handler := newAdminTestHandler(logDir, "admin-secret")
+
+	list := func(query string, status int) []buildSummary {
+		t.Helper()
+		req := httptest.NewRequest("GET", BuildsPath+query, nil)
+		req.Header.Set("Authorization", "Bearer admin-secret")
+		rr := httptest.NewRecorder()
+		handler.ServeHTTP(rr, req)
+		if rr.Code != status {
+			t.Fatalf("GET /builds%s: expected status %d, got %d: %s", query, status, rr.Code, rr.Body.String())
+		}
+		var resp buildsResponse
+		if status == http.StatusOK {
+			if err := json.Unmarshal(rr.Body.Bytes(), &resp); err != nil {
+				t.Fatalf("Failed to decode response: %v", err)
+			}
+		}
+		return resp.Builds
+	}
+	ids := func(builds []buildSummary) string {
+		var s []string
+		for _, b := range builds {
+			s = append(s, b.Project+"/"+b.BuildID+"/"+b.Result)
+		}
+		return strings.Join(s, ", ")
+	}
+
+	if got, want := ids(list("", http.StatusOK)), "Frontend/2024-01-15-1432-0a1b2c/running, Frontend/2024-01-15-1431-d4e5f6/fail, "+
+		"Frontend/2024-01-15-1430-a1b2c3/success, Removed/2024-01-15-1429-ffffff/success"; got != want {
+		t.Errorf("Expected all builds newest first:\n%s\ngot:\n%s", want, got)
+	}
+	if got, want := ids(list("?project=Frontend&limit=2", http.StatusOK)), "Frontend/2024-01-15-1432-0a1b2c/running, Frontend/2024-01-15-1431-d4e5f6/fail"; got != want {
+		t.Errorf("Expected limited project builds %s, got %s", want, got)
+	}
+	builds := list("?project=Frontend&result=success", http.StatusOK)
+	if got, want := ids(builds), "Frontend/2024-01-15-1430-a1b2c3/success"; got != want {
+		t.Errorf("Expected successful builds %s, got %s", want, got)
+	}
+	if len(builds) == 1 && builds[0].LogURL != "/builds/Frontend-2024-01-15-1430-a1b2c3-success.log/log" {
+		t.Errorf("Unexpected log_url %s", builds[0].LogURL)
+	}
+	if builds := list("?result=fail&project=Frontend&limit=5", http.StatusOK); len(builds) != 1 {
+		t.Errorf("Expected 1 failed build, got %d", len(builds))
+	}
+
+	list("?project=Unknown", http.StatusNotFound)
+	list("?limit=0", http.StatusBadRequest)
+	list("?result=skipped", http.StatusBadRequest)
+
+	req := httptest.NewRequest("GET", BuildsPath, nil)
+	rr := httptest.NewRecorder()
+	handler.ServeHTTP(rr, req)
+	if rr.Code != http.StatusUnauthorized {
+		t.Errorf("Expected 401 without token, got %d", rr.Code)
+	}
+}
+
+// TestBuildLogEndpointProjectLogPath tests that build logs in a project's log_path are served
+func TestBuildLogEndpointProjectLogPath(t *testing.T) {
+	logDir := t.TempDir()
+	projectLogDir := t.TempDir()
+	name := "Frontend-2024-01-15-1430-a1b2c3-success.log"
+	if err := os.WriteFile(filepath.Join(projectLogDir, name), []byte("isolated output"), 0644); err != nil {
+		t.Fatalf("Failed to write build log: %v", err)
+	}
+
+	handler := newAdminTestHandler(logDir, "admin-secret")
+	handler.config.Projects[0].LogPath = projectLogDir
+
+	req := httptest.NewRequest("GET", "/builds/2024-01-15-1430-a1b2c3/log", nil)
+	req.Header.Set("Authorization", "Bearer admin-secret")
+	rr := httptest.NewRecorder()
+	handler.ServeHTTP(rr, req)
+
+	if rr.Code != http.StatusOK || rr.Body.String() != "isolated output" {
+		t.Errorf("Expected build log from project log_path, got %d %q", rr.Code, rr.Body.String())
+	}
+}
+
+// TestBuildLogEndpointDisabledWithoutToken tests that admin endpoints 404 without admin_token
+func TestBuildLogEndpointDisabledWithoutToken(t *testing.T) {
+	handler := newAdminTestHandler(t.TempDir(), "")
+
+	req := httptest.NewRequest("GET", "/builds/2024-01-15-1430-a1b2c3/log", nil)
+	req.Header.Set("Authorization", "Bearer ")
+	rr := httptest.NewRecorder()
+	handler.ServeHTTP(rr, req)
+
+	if rr.Code != http.StatusNotFound {
+		t.Errorf("Expected status 404, got %d", rr.Code)
+	}
+}
+
+// TestReloadEndpoint tests authentication and responses of POST /reload
+func TestReloadEndpoint(t *testing.T) {
+	tmpDir := t.TempDir()
+	configPath := filepath.Join(tmpDir, "sdeploy.conf")
+	config := `
+admin_token: admin-secret
+projects:
+  - name: App
+    webhook_path: /hooks/app
+    webhook_secret: secret123
+    execute_command: echo v1
+`
+	if err := os.WriteFile(configPath, []byte(config), 0644); err != nil {
+		t.Fatalf("Failed to write config: %v", err)
+	}
+
+	cm, err := NewConfigManager(configPath, nil)
+	if err != nil {
+		t.Fatalf("NewConfigManager failed: %v", err)
+	}
+	defer cm.Stop()
+
+	handler := NewWebhookHandlerWithConfigManager(cm, nil)
+	handler.SetDeployer(NewDeployer(nil))
+
+	post := func(token string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest("POST", ReloadPath, nil)
+		if token != "" {
+			req.Header.Set("Authorization", "Bearer "+token)
+		}
+		rr := httptest.NewRecorder()
+		handler.ServeHTTP(rr, req)
+		return rr
+	}
+
+	if rr := post(""); rr.Code != http.StatusUnauthorized {
+		t.Errorf("Expected status 401 without token, got %d", rr.Code)
+	}
+
+	// Invalid config returns 400 with the validation error
+	if err := os.WriteFile(configPath, []byte("admin_token: admin-secret\nprojects:\n  - name: Broken\n"), 0644); err != nil {
+		t.Fatalf("Failed to write config: %v", err)
+	}
+	rr := post("admin-secret")
+	if rr.Code != http.StatusBadRequest || !strings.Contains(rr.Body.String(), "webhook_path is required") {
+		t.Errorf("Expected 400 with validation error, got %d: %s", rr.Code, rr.Body.String())
+	}
+
+	// Valid config is applied and the changes reported
+	if err := os.WriteFile(configPath, []byte(strings.Replace(config, "echo v1", "echo v2", 1)), 0644); err != nil {
+		t.Fatalf("Failed to write config: %v", err)
+	}
+	rr = post("admin-secret")
+	if rr.Code != http.StatusOK {
+		t.Fatalf("Expected status 200, got %d: %s", rr.Code, rr.Body.String())
+	}
+	var result ReloadResult
+	if err := json.Unmarshal(rr.Body.Bytes(), &result); err != nil {
+		t.Fatalf("Failed to decode response: %v", err)
+	}
+	if !result.Applied || len(result.Modified) != 1 || result.Modified[0] != "App" {
+		t.Errorf("Expected App to be reported as modified, got %+v", result)
+	}
+	if cm.GetProject("/hooks/app").ExecuteCommand != "echo v2" {
+		t.Error("Expected config to be reloaded")
+	}
+}
+
+// TestStatusEndpoint tests the enabled state and last build reported by GET /status
+func TestStatusEndpoint(t *testing.T) {
+	cfg := &Config{
+		AdminToken: "admin-secret",
+		Projects: []ProjectConfig{
+			{Name: "Live", WebhookPath: "/hooks/live", WebhookSecret: "secret", ExecuteCommand: "echo ok"},
+			{Name: "Paused", WebhookPath: "/hooks/paused", WebhookSecret: "secret", ExecuteCommand: "echo ok", Enabled: new(bool)},
+			{Name: "Failing", WebhookPath: "/hooks/failing", WebhookSecret: "secret", ExecuteCommand: "exit 1", FailureThreshold: 2, BreakerCooldown: 3600},
+		},
+	}
+	handler := NewWebhookHandler(cfg, nil)
+	deployer := NewDeployer(nil)
+	handler.SetDeployer(deployer)
+
+	result := deployer.Deploy(context.Background(), &cfg.Projects[0], "INTERNAL")
+	for i := 0; i < 2; i++ {
+		deployer.Deploy(context.Background(), &cfg.Projects[2], "INTERNAL")
+	}
+
+	req := httptest.NewRequest("GET", StatusPath, nil)
+	rr := httptest.NewRecorder()
+	handler.ServeHTTP(rr, req)
+	if rr.Code != http.StatusUnauthorized {
+		t.Errorf("Expected status 401 without token, got %d", rr.Code)
+	}
+
+	req = httptest.NewRequest("GET", StatusPath, nil)
+	req.Header.Set("Authorization", "Bearer admin-secret")
+	rr = httptest.NewRecorder()
+	handler.ServeHTTP(rr, req)
+	if rr.Code != http.StatusOK {
+		t.Fatalf("Expected status 200, got %d", rr.Code)
+	}
+
+	var status statusResponse
+	if err := json.Unmarshal(rr.Body.Bytes(), &status); err != nil {
+		t.Fatalf("Failed to decode response: %v", err)
+	}
+	if len(status.Projects) != 3 {
+		t.Fatalf("Expected 3 projects, got %d", len(status.Projects))
+	}
+	live, paused, failing := status.Projects[0], status.Projects[1], status.Projects[2]
+	if !live.Enabled || live.LastBuild == nil || live.LastBuild.BuildID != result.BuildID || !live.LastBuild.Success {
+		t.Errorf("Unexpected status for Live: %+v", live)
+	}
+	if paused.Enabled || paused.LastBuild != nil {
+		t.Errorf("Expected Paused to be disabled without builds, got %+v", paused)
+	}
+	if live.ConsecutiveFailures != 0 || live.BreakerOpen {
+		t.Errorf("Expected Live without failures, got %+v", live)
+	}
+	if failing.ConsecutiveFailures != 2 || !failing.BreakerOpen || failing.LastBuild == nil || failing.LastBuild.ErrorKind != ErrorKindCommandFailed {
+		t.Errorf("Expected Failing with an open breaker, got %+v", failing)
+	}
+}
+
+// TestStatusBreakerCooldownElapsed tests that breaker_open follows the
+// webhook path: closed once the cooldown has elapsed, open again while the
+// trial build it lets through runs
+func TestStatusBreakerCooldownElapsed(t *testing.T) {
+	cfg := &Config{
+		AdminToken: "admin-secret",
+		Projects: []ProjectConfig{
+			{Name: "Failing", WebhookPath: "/hooks/failing", WebhookSecret: "secret", ExecuteCommand: "exit 1", FailureThreshold: 1, BreakerCooldown: 60},
+		},
+	}
+	handler := NewWebhookHandler(cfg, nil)
+	clock := newFakeClock()
+	deployer := NewDeployer(nil)
+	deployer.SetClock(clock)
+	handler.SetDeployer(deployer)
+	project := &cfg.Projects[0]
+
+	breakerOpen := func() bool {
+		t.Helper()
+		req := httptest.NewRequest("GET", StatusPath, nil)
+		req.Header.Set("Authorization", "Bearer admin-secret")
+		rr := httptest.NewRecorder()
+		handler.ServeHTTP(rr, req)
+		var status statusResponse
+		if err := json.Unmarshal(rr.Body.Bytes(), &status); err != nil {
+			t.Fatalf("Failed to decode response: %v", err)
+		}
+		return status.Projects[0].BreakerOpen
+	}
+
+	deployer.Deploy(context.Background(), project, "INTERNAL")
+	if !breakerOpen() {
+		t.Error("Expected breaker_open during the cooldown")
+	}
+
+	clock.Advance(2 * time.Minute)
+	if breakerOpen() {
+		t.Error("Expected breaker_open false once the cooldown has elapsed")
+	}
+	// Reading the status must not use up the trial build
+	if open, _, trial := deployer.breakerOpen(project, clock.Now()); open || !trial {
+		t.Fatalf("Expected the webhook path to start a trial build, got open=%t trial=%t", open, trial)
+	}
+	if !breakerOpen() {
+		t.Error("Expected breaker_open while the trial build runs")
+	}
+}
+
+// TestStatusQueue tests that /status reports running, waiting and debounced builds
+func TestStatusQueue(t *testing.T) {
+	tmpDir := t.TempDir()
+	release := filepath.Join(tmpDir, "release")
+	cfg := &Config{
+		AdminToken: "admin-secret",
+		Projects: []ProjectConfig{
+			{
+				Name:            "Busy",
+				WebhookPath:     "/hooks/busy",
+				WebhookSecret:   "secret",
+				ExecuteCommand:  "while [ ! -f " + release + " ]; do sleep 0.05; done",
+				LockWaitSeconds: 30,
+			},
+			{
+				Name:            "Debounced",
+				WebhookPath:     "/hooks/debounced",
+				WebhookSecret:   "secret",
+				ExecuteCommand:  "echo ok",
+				DebounceSeconds: 60,
+			},
+		},
+	}
+	handler := NewWebhookHandler(cfg, nil)
+	deployer := NewDeployer(nil)
+	handler.SetDeployer(deployer)
+
+	var wg sync.WaitGroup
+	for _, id := range []string{"build-running", "build-waiting"} {
+		wg.Add(1)
+		go func(id string) {
+			defer wg.Done()
+			deployer.DeployWithOptions(context.Background(), &cfg.Projects[0], "INTERNAL", DeployOptions{BuildID: id})
+		}(id)
+		time.Sleep(100 * time.Millisecond)
+	}
+	defer wg.Wait()
+	defer os.WriteFile(release, []byte("done"), 0644)
+
+	req := httptest.NewRequest("POST", "/hooks/debounced?secret=secret", strings.NewReader(`{}`))
+	rr := httptest.NewRecorder()
+	handler.ServeHTTP(rr, req)
+	if rr.Code != http.StatusAccepted {
+		t.Fatalf("Expected status 202, got %d", rr.Code)
+	}
+	defer func() {
+		handler.debounceMu.Lock()
+		for _, pending := range handler.debounced {
+			pending.timer.Stop()
+		}
+		handler.debounceMu.Unlock()
+	}()
+
+	var status statusResponse
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		req := httptest.NewRequest("GET", StatusPath, nil)
+		req.Header.Set("Authorization", "Bearer admin-secret")
+		rr := httptest.NewRecorder()
+		handler.ServeHTTP(rr, req)
+		if err := json.Unmarshal(rr.Body.Bytes(), &status); err != nil {
+			t.Fatalf("Failed to decode response: %v", err)
+		}
+		if status.Projects[0].Running && status.Projects[0].Queued == 1 || time.Now().After(deadline) {
+			break
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+
+	busy := status.Projects[0]
+	if !busy.Running || busy.Queued != 1 || len(busy.Queue) != 2 {
+		t.Fatalf("Expected one running and one waiting build, got %+v", busy)
+	}
+	if busy.Queue[0].BuildID != "build-running" || busy.Queue[0].State != QueueStateRunning || busy.Queue[0].StartedAt == nil {
+		t.Errorf("Unexpected running entry: %+v", busy.Queue[0])
+	}
+	if busy.Queue[1].BuildID != "build-waiting" || busy.Queue[1].State != QueueStateWaiting || busy.Queue[1].TriggerSource != "INTERNAL" {
+		t.Errorf("Unexpected waiting entry: %+v", busy.Queue[1])
+	}
+
+	debounced := status.Projects[1]
+	if debounced.Running || debounced.Queued != 1 || len(debounced.Queue) != 1 || debounced.Queue[0].State != QueueStateDebounced {
+		t.Errorf("Expected one debounced build, got %+v", debounced)
+	}
+}
@@ -0,0 +1,24 @@
+package main
+
+import "time"
+
+// clock is the time source for timing decisions: build start and end times,
+// min_build_interval_seconds, the circuit breaker cooldown, debounce timers,
+// queue times and the lock_wait_seconds deadline. Tests swap in a fake to move time forward without sleeping.
+type clock interface {
+	Now() time.Time
+	AfterFunc(d time.Duration, f func()) clockTimer
+}
+
+// clockTimer is the part of *time.Timer that debouncing uses
+type clockTimer interface {
+	Stop() bool
+	Reset(d time.Duration) bool
+}
+
+// realClock is the wall clock
+type realClock struct{}
+
+func (realClock) Now() time.Time { return time.Now() }
+
+func (realClock) AfterFunc(d time.Duration, f func()) clockTimer { return time.AfterFunc(d, f) }
@@ -0,0 +1,105 @@
+package main
+
+import (
+	"sort"
+	"sync"
+	"testing"
+	"time"
+)
+
+// fakeClock is a manually advanced clock for tests. Timers fire
+// synchronously from Advance, in the order they are due.
+type fakeClock struct {
+	mu     sync.Mutex
+	now    time.Time
+	timers []*fakeTimer
+}
+
+type fakeTimer struct {
+	clock  *fakeClock
+	when   time.Time
+	f      func()
+	active bool
+}
+
+func newFakeClock() *fakeClock {
+	return &fakeClock{now: time.Date(2024, 1, 15, 14, 30, 0, 0, time.UTC)}
+}
+
+func (c *fakeClock) Now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.now
+}
+
+func (c *fakeClock) AfterFunc(d time.Duration, f func()) clockTimer {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	t := &fakeTimer{clock: c, when: c.now.Add(d), f: f, active: true}
+	c.timers = append(c.timers, t)
+	return t
+}
+
+// Advance moves the clock forward and runs the timers that became due
+func (c *fakeClock) Advance(d time.Duration) {
+	c.mu.Lock()
+	c.now = c.now.Add(d)
+	var due []*fakeTimer
+	for _, t := range c.timers {
+		if t.active && !t.when.After(c.now) {
+			t.active = false
+			due = append(due, t)
+		}
+	}
+	c.mu.Unlock()
+
+	sort.SliceStable(due, func(i, j int) bool { return due[i].when.Before(due[j].when) })
+	for _, t := range due {
+		t.f()
+	}
+}
+
+func (t *fakeTimer) Stop() bool {
+	t.clock.mu.Lock()
+	defer t.clock.mu.Unlock()
+	wasActive := t.active
+	t.active = false
+	return wasActive
+}
+
+func (t *fakeTimer) Reset(d time.Duration) bool {
+	t.clock.mu.Lock()
+	defer t.clock.mu.Unlock()
+	wasActive := t.active
+	t.active = true
+	t.when = t.clock.now.Add(d)
+	return wasActive
+}
+
+// TestFakeClock tests the fake clock's timer semantics match time.Timer
+func TestFakeClock(t *testing.T) {
+	c := newFakeClock()
+	start := c.Now()
+	var fired []string
+	a := c.AfterFunc(time.Second, func() { fired = append(fired, "a") })
+	c.AfterFunc(2*time.Second, func() { fired = append(fired, "b") })
+
+	c.Advance(500 * time.Millisecond)
+	if len(fired) != 0 {
+		t.Fatalf("Expected no timers before they are due, got %v", fired)
+	}
+	if !a.Stop() || a.Stop() {
+		t.Error("Expected Stop to report true only for an active timer")
+	}
+	if a.Reset(2 * time.Second) {
+		t.Error("Expected Reset of a stopped timer to report false")
+	}
+
+	c.Advance(2 * time.Second)
+	if len(fired) != 2 || fired[0] != "b" || fired[1] != "a" {
+		t.Errorf("Expected b then a, got %v", fired)
+	}
+	if got := c.Now().Sub(start); got != 2500*time.Millisecond {
+		t.Errorf("Expected 2.5s to have passed, got %v", got)
+	}
+}
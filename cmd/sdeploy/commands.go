@@ -0,0 +1,533 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"crypto/tls"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+	"unicode"
+)
+
+// Exit codes for --once
+const (
+	onceExitSuccess = 0
+	onceExitFailure = 1
+	onceExitSkipped = 3
+)
+
+// onceTriggerSource is the trigger source recorded for --once deployments
+// without --source
+const onceTriggerSource = "INTERNAL (once)"
+
+// maxSourceLabelLength bounds --source labels
+const maxSourceLabelLength = 64
+
+// validateSourceLabel checks a --source label: non-empty, at most
+// maxSourceLabelLength characters and free of control characters, since it
+// ends up in logs, emails and SDEPLOY_TRIGGER_SOURCE
+func validateSourceLabel(label string) error {
+	if strings.TrimSpace(label) == "" {
+		return fmt.Errorf("--source label cannot be empty")
+	}
+	if len([]rune(label)) > maxSourceLabelLength {
+		return fmt.Errorf("--source label is longer than %d characters", maxSourceLabelLength)
+	}
+	for _, r := range label {
+		if unicode.IsControl(r) {
+			return fmt.Errorf("--source label contains a control character")
+		}
+	}
+	return nil
+}
+
+// onceTriggerSourceFor returns the trigger source for a --once deployment:
+// INTERNAL (<label>), or onceTriggerSource without a label
+func onceTriggerSourceFor(label string) string {
+	if label == "" {
+		return onceTriggerSource
+	}
+	return "INTERNAL (" + strings.TrimSpace(label) + ")"
+}
+
+// runSubcommand dispatches CLI subcommands and returns the process exit code
+func runSubcommand(cfg *Config, args []string, out io.Writer) int {
+	switch args[0] {
+	case "test-email":
+		if len(args) != 2 {
+			fmt.Fprintln(out, "Usage: sdeploy [-c <path>] test-email <project-name>")
+			return 2
+		}
+		return runTestEmail(cfg, args[1], out)
+	case "doctor":
+		if len(args) != 1 {
+			fmt.Fprintln(out, "Usage: sdeploy [-c <path>] doctor")
+			return 2
+		}
+		return runDoctor(cfg, out)
+	case "rollback":
+		if len(args) != 2 {
+			fmt.Fprintln(out, "Usage: sdeploy [-c <path>] rollback <project-name>")
+			return 2
+		}
+		return runRollbackWithLogger(cfg, args[1], out)
+	case "test-webhook":
+		return runTestWebhook(cfg, args[1:], out)
+	default:
+		fmt.Fprintf(out, "Unknown command: %s\n", args[0])
+		fmt.Fprintln(out, "Run 'sdeploy -h' for usage.")
+		return 2
+	}
+}
+
+// testWebhookTriggeredBy labels test-webhook requests; the daemon logs them
+// as WEBHOOK (test-webhook) and, like a git host push, skips the build when
+// the branch has no new commits
+const testWebhookTriggeredBy = "test-webhook"
+
+// testWebhookTimeout bounds the request to the daemon
+const testWebhookTimeout = 30 * time.Second
+
+// runTestWebhook sends a signed push webhook for a project to the local
+// daemon, so signature checks, routing and branch matching can be verified
+// without a git host. Returns 0 if the daemon answered with a 2xx status.
+func runTestWebhook(cfg *Config, args []string, out io.Writer) int {
+	const usage = "Usage: sdeploy [-c <path>] test-webhook <project-name> [--branch <name>] [--insecure]"
+	fs := flag.NewFlagSet("test-webhook", flag.ContinueOnError)
+	fs.SetOutput(io.Discard)
+	branch := fs.String("branch", "", "Branch to send in the payload (default: git_branch)")
+	insecure := fs.Bool("insecure", false, "Skip TLS certificate verification for a non-loopback listen_addr")
+
+	// Accept flags before or after the project name
+	if err := fs.Parse(args); err != nil || fs.NArg() == 0 {
+		fmt.Fprintln(out, usage)
+		return 2
+	}
+	projectName := fs.Arg(0)
+	if err := fs.Parse(fs.Args()[1:]); err != nil || fs.NArg() != 0 {
+		fmt.Fprintln(out, usage)
+		return 2
+	}
+
+	project := cfg.FindProjectByName(projectName)
+	if project == nil {
+		fmt.Fprintf(out, "Error: project %q not found in config\n", projectName)
+		return 1
+	}
+	if *branch == "" {
+		*branch = project.GitBranch
+	}
+	if err := validateGitBranch(*branch); err != nil {
+		fmt.Fprintf(out, "Error: --branch: %v\n", err)
+		return 1
+	}
+
+	payload := map[string]any{
+		"ref":          "refs/heads/" + *branch,
+		"triggered_by": testWebhookTriggeredBy,
+		"head_commit":  map[string]string{"message": "Test webhook sent by sdeploy test-webhook"},
+	}
+	if project.MatchRepo != "" {
+		payload["repository"] = map[string]string{"full_name": project.MatchRepo}
+	}
+	body, err := json.Marshal(payload)
+	if err != nil {
+		fmt.Fprintf(out, "Error: %v\n", err)
+		return 1
+	}
+
+	host := daemonHost(cfg)
+	url := daemonURL(cfg) + project.WebhookPath
+	req, err := http.NewRequest(http.MethodPost, url, bytes.NewReader(body))
+	if err != nil {
+		fmt.Fprintf(out, "Error: %v\n", err)
+		return 1
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("X-GitHub-Event", "push")
+	header, prefix := project.SignatureScheme()
+	mac := hmac.New(sha256.New, []byte(project.WebhookSecret))
+	mac.Write(body)
+	req.Header.Set(header, prefix+hex.EncodeToString(mac.Sum(nil)))
+	if project.AuthBearerToken != "" {
+		req.Header.Set("Authorization", "Bearer "+project.AuthBearerToken)
+	}
+
+	// The daemon's certificate is issued for its public name, so it cannot
+	// match a loopback address; any other host is verified unless --insecure
+	client := &http.Client{
+		Timeout:   testWebhookTimeout,
+		Transport: &http.Transport{TLSClientConfig: &tls.Config{InsecureSkipVerify: *insecure || isLoopbackHost(host)}},
+	}
+	fmt.Fprintf(out, "POST %s (branch %s)\n", url, *branch)
+	fmt.Fprintf(out, "Note: an accepted request runs a real deploy of %s when %s has new commits\n", project.Name, *branch)
+	resp, err := client.Do(req)
+	if err != nil {
+		fmt.Fprintf(out, "Request failed: %v (is the daemon running?)\n", err)
+		return 1
+	}
+	defer resp.Body.Close()
+	respBody, _ := io.ReadAll(io.LimitReader(resp.Body, 64<<10))
+
+	fmt.Fprintf(out, "HTTP %s\n", resp.Status)
+	if text := strings.TrimSpace(string(respBody)); text != "" {
+		fmt.Fprintln(out, text)
+	}
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return 1
+	}
+	return 0
+}
+
+// daemonHost returns the host the local daemon is reached on: listen_addr,
+// or the loopback address when it listens on all interfaces
+func daemonHost(cfg *Config) string {
+	host := cfg.ListenAddr
+	if ip := net.ParseIP(host); host == "" || ip != nil && ip.IsUnspecified() {
+		host = "127.0.0.1"
+	}
+	return host
+}
+
+// daemonURL returns the base URL of the local daemon
+func daemonURL(cfg *Config) string {
+	return webhookScheme(cfg) + "://" + net.JoinHostPort(daemonHost(cfg), strconv.Itoa(cfg.ListenPort))
+}
+
+// isLoopbackHost reports whether host is localhost or a loopback address
+func isLoopbackHost(host string) bool {
+	if host == "localhost" {
+		return true
+	}
+	ip := net.ParseIP(host)
+	return ip != nil && ip.IsLoopback()
+}
+
+// runTestEmail sends a sample success notification to a project's recipients
+func runTestEmail(cfg *Config, projectName string, out io.Writer) int {
+	project := cfg.FindProjectByName(projectName)
+	if project == nil {
+		fmt.Fprintf(out, "Error: project %q not found in config\n", projectName)
+		return 1
+	}
+
+	if !IsEmailConfigValid(cfg.EmailConfig) {
+		fmt.Fprintln(out, "Error: email notifications are not configured.")
+		fmt.Fprintln(out, "email_config must set smtp_host, smtp_port, smtp_user, smtp_pass and email_sender.")
+		return 1
+	}
+
+	if len(project.EmailRecipients) == 0 {
+		fmt.Fprintf(out, "Error: project %q has no email_recipients configured\n", project.Name)
+		return 1
+	}
+
+	now := time.Now()
+	result := &DeployResult{
+		Success:   true,
+		Output:    "This is a test notification from SDeploy. No deployment was run.",
+		StartTime: now,
+		EndTime:   now,
+	}
+
+	fmt.Fprintf(out, "Sending test email via %s:%d to %s...\n",
+		cfg.EmailConfig.SMTPHost, cfg.EmailConfig.SMTPPort, strings.Join(project.EmailRecipients, ", "))
+
+	notifier := NewEmailNotifier(cfg.EmailConfig, nil)
+	if err := notifier.SendNotification(project, result, "TEST"); err != nil {
+		fmt.Fprintf(out, "Failed to send test email: %v\n", err)
+		return 1
+	}
+
+	fmt.Fprintln(out, "Test email sent successfully")
+	return 0
+}
+
+// runDoctor checks the environment SDeploy needs (git, the shell, writable
+// log and checkout directories, SSH keys) and prints a pass/fail report.
+// Returns 1 if any check failed.
+func runDoctor(cfg *Config, out io.Writer) int {
+	failed := 0
+	report := func(name string, err error, detail string) {
+		if err != nil {
+			failed++
+			fmt.Fprintf(out, "[FAIL] %s: %v\n", name, err)
+			return
+		}
+		fmt.Fprintf(out, "[PASS] %s: %s\n", name, detail)
+	}
+
+	// git must be on PATH for every project with git_repo
+	version, err := exec.Command("git", "--version").Output()
+	if err != nil {
+		err = fmt.Errorf("git is not installed or not on PATH: %v", err)
+	}
+	report("git", err, strings.TrimSpace(string(version)))
+
+	shell := getShellPath()
+	if cfg.Shell != "" {
+		shell = cfg.Shell
+	}
+	path, err := lookPathShell(shell)
+	report("shell", err, path)
+	// A project-level shell replaces the global one for that project
+	for _, project := range cfg.Projects {
+		if project.Shell != "" && project.Shell != shell {
+			path, err := lookPathShell(project.Shell)
+			report(project.Name+": shell", err, path)
+		}
+	}
+
+	logDirs := []string{cfg.LogPath}
+	if cfg.LogPath == "" {
+		logDirs[0] = defaultLogPath()
+	}
+	for _, project := range cfg.Projects {
+		if project.LogPath != "" {
+			logDirs = append(logDirs, project.LogPath)
+		}
+	}
+	seen := make(map[string]bool)
+	for _, dir := range logDirs {
+		if seen[filepath.Clean(dir)] {
+			continue
+		}
+		seen[filepath.Clean(dir)] = true
+		// Like local_path, a missing log directory is created on first use;
+		// doctor only checks it could be and never changes the system
+		existing, err := nearestExistingDir(dir)
+		if err == nil {
+			err = checkWritable(existing)
+		}
+		detail := "writable"
+		if filepath.Clean(existing) != filepath.Clean(dir) {
+			detail = "does not exist yet, " + existing + " is writable"
+		}
+		report("log directory "+dir, err, detail)
+	}
+
+	for _, project := range cfg.Projects {
+		if project.GitSSHKeyPath != "" {
+			report(project.Name+": git_ssh_key_path", validateSSHKeyPath(project.GitSSHKeyPath), project.GitSSHKeyPath)
+		}
+		if project.LocalPath != "" && !project.CreatesDirs() {
+			// Preflight will not create it, so it has to exist already
+			err := ensureProjectDir(&project, project.LocalPath, nil)
+			if err == nil {
+				err = checkWritable(project.LocalPath)
+			}
+			report(project.Name+": local_path", err, project.LocalPath+" is writable")
+		} else if project.LocalPath != "" {
+			dir, err := nearestExistingDir(project.LocalPath)
+			if err == nil {
+				err = checkWritable(dir)
+			}
+			report(project.Name+": local_path", err, dir+" is writable")
+		}
+	}
+
+	if failed > 0 {
+		fmt.Fprintf(out, "%d check(s) failed\n", failed)
+		return 1
+	}
+	fmt.Fprintln(out, "All checks passed")
+	return 0
+}
+
+// lookPathShell resolves shell like exec does, for doctor's report
+func lookPathShell(shell string) (string, error) {
+	path, err := exec.LookPath(shell)
+	if err != nil {
+		return "", fmt.Errorf("%s not found: %v", shell, err)
+	}
+	return path, nil
+}
+
+// nearestExistingDir returns path if it exists, otherwise its closest existing
+// ancestor: the directory SDeploy has to write to when creating path
+func nearestExistingDir(path string) (string, error) {
+	for {
+		info, err := os.Stat(path)
+		if err == nil {
+			if !info.IsDir() {
+				return "", fmt.Errorf("%s is not a directory", path)
+			}
+			return path, nil
+		}
+		// ENOTDIR means an ancestor is a file; keep walking up to report it
+		if !errors.Is(err, os.ErrNotExist) && !errors.Is(err, syscall.ENOTDIR) {
+			return "", err
+		}
+		parent := filepath.Dir(path)
+		if parent == path {
+			return "", err
+		}
+		path = parent
+	}
+}
+
+// checkWritable creates and removes a temporary file in dir to check that the
+// current user can write there
+func checkWritable(dir string) error {
+	f, err := os.CreateTemp(dir, ".sdeploy-doctor-*")
+	if err != nil {
+		return fmt.Errorf("not writable: %v", err)
+	}
+	f.Close()
+	return os.Remove(f.Name())
+}
+
+// rollbackTriggerSource is the trigger source recorded for sdeploy rollback
+const rollbackTriggerSource = "INTERNAL (rollback)"
+
+// runRollback redeploys the commit of the previous successful deploy
+// (previousRef in the checkout) and runs execute_command again, under the
+// same deploy lock, logs and notifications as any other build. Returns 0 on
+// success and 1 on failure or when there is nothing to roll back to.
+func runRollback(cfg *Config, projectName string, deployer *Deployer, out io.Writer) int {
+	project := cfg.FindProjectByName(projectName)
+	if project == nil {
+		fmt.Fprintf(out, "Error: project %q not found in config\n", projectName)
+		return 1
+	}
+	if !project.IsEnabled() {
+		fmt.Fprintf(out, "Error: project %q is disabled (enabled: false); not rolling back\n", project.Name)
+		return 1
+	}
+	if project.GitRepo == "" {
+		fmt.Fprintf(out, "Error: project %q has no git_repo; rollback needs recorded commits\n", project.Name)
+		return 1
+	}
+
+	commit, err := resolveRef(context.Background(), project.LocalPath, previousRef)
+	if err != nil {
+		fmt.Fprintf(out, "Error: no previous successful deploy recorded for %q\n", project.Name)
+		return 1
+	}
+	fmt.Fprintf(out, "Rolling back %s to commit %s...\n", project.Name, truncateSHA(commit, deployer.shaLength))
+
+	// Check out the recorded commit the way deploy_exact_commit does
+	target := *project
+	target.GitUpdate = true
+	target.DeployExactCommit = true
+	result := deployer.DeployWithOptions(context.Background(), &target, rollbackTriggerSource, DeployOptions{Commit: commit, Force: true})
+
+	switch {
+	case result.Skipped:
+		fmt.Fprintf(out, "Rollback skipped: %s (build %s): another build holds the deploy lock\n", project.Name, result.BuildID)
+		return 1
+	case result.Success:
+		fmt.Fprintf(out, "Rollback succeeded: %s (build %s, %v)\n", project.Name, result.BuildID, result.Duration().Round(time.Millisecond))
+		return 0
+	default:
+		fmt.Fprintf(out, "Rollback failed: %s (build %s): %s\n", project.Name, result.BuildID, result.Error)
+		return 1
+	}
+}
+
+// onceJSONResult is the result of --once printed with --json
+type onceJSONResult struct {
+	Project      string    `json:"project"`
+	BuildID      string    `json:"build_id"`
+	Success      bool      `json:"success"`
+	Skipped      bool      `json:"skipped"`
+	Error        string    `json:"error"`
+	ErrorKind    ErrorKind `json:"error_kind"`
+	DurationMs   int64     `json:"duration_ms"`
+	Output       string    `json:"output"`
+	CommitSHA    string    `json:"commit_sha"`
+	BuildLogPath string    `json:"build_log_path"`
+}
+
+// writeOnceJSON prints a --once result as a single line of JSON
+func writeOnceJSON(out io.Writer, result onceJSONResult) {
+	data, err := json.Marshal(result)
+	if err != nil {
+		fmt.Fprintf(out, `{"project":%q,"success":false,"error":"failed to encode result"}`+"\n", result.Project)
+		return
+	}
+	fmt.Fprintln(out, string(data))
+}
+
+// onceError reports a problem that kept --once from deploying
+func onceError(out io.Writer, jsonOutput bool, projectName, message string) int {
+	if jsonOutput {
+		writeOnceJSON(out, onceJSONResult{Project: projectName, Error: message})
+	} else {
+		fmt.Fprintf(out, "Error: %s\n", message)
+	}
+	return onceExitFailure
+}
+
+// runOnce deploys a single project in the foreground and returns an exit code
+// reflecting the result: 0 success, 1 failure, 3 skipped. With jsonOutput the
+// result is printed as JSON instead of a summary line. A non-empty branch
+// deploys that branch instead of git_branch for this run only.
+func runOnce(cfg *Config, projectName, triggerSource, branch string, jsonOutput bool, deployer *Deployer, out io.Writer) int {
+	project := cfg.FindProjectByName(projectName)
+	if project == nil {
+		return onceError(out, jsonOutput, projectName, fmt.Sprintf("project %q not found in config", projectName))
+	}
+	if !project.IsEnabled() {
+		return onceError(out, jsonOutput, project.Name, fmt.Sprintf("project %q is disabled (enabled: false); not deploying", project.Name))
+	}
+
+	if branch != "" {
+		// A branch with its own branch_deploys entry deploys to that entry's path
+		if variant := project.ForBranch(branch); variant != nil {
+			project = variant
+		} else {
+			project = project.WithBranch(branch)
+		}
+	}
+
+	result := deployer.Deploy(context.Background(), project, triggerSource)
+
+	if jsonOutput {
+		writeOnceJSON(out, onceJSONResult{
+			Project:      project.Name,
+			BuildID:      result.BuildID,
+			Success:      result.Success,
+			Skipped:      result.Skipped,
+			Error:        result.Error,
+			ErrorKind:    result.ErrorKind,
+			DurationMs:   result.Duration().Milliseconds(),
+			Output:       result.Output,
+			CommitSHA:    result.CommitSHA,
+			BuildLogPath: result.BuildLogPath,
+		})
+	}
+
+	switch {
+	case result.Skipped:
+		if !jsonOutput {
+			fmt.Fprintf(out, "Deployment skipped: %s (build %s)\n", project.Name, result.BuildID)
+		}
+		return onceExitSkipped
+	case result.Success:
+		if !jsonOutput {
+			fmt.Fprintf(out, "Deployment succeeded: %s (build %s, %v)\n", project.Name, result.BuildID, result.Duration().Round(time.Millisecond))
+		}
+		return onceExitSuccess
+	default:
+		if !jsonOutput {
+			fmt.Fprintf(out, "Deployment failed: %s (build %s, %v): %s\n", project.Name, result.BuildID, result.Duration().Round(time.Millisecond), result.Error)
+		}
+		return onceExitFailure
+	}
+}
@@ -0,0 +1,512 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+// testEmailConfig returns a complete email config for CLI tests
+func testEmailConfig() *EmailConfig {
+	return &EmailConfig{
+		SMTPHost:    "127.0.0.1",
+		SMTPPort:    1,
+		SMTPUser:    "user",
+		SMTPPass:    "pass",
+		EmailSender: "sdeploy@example.com",
+	}
+}
+
+// TestRunSubcommandUnknown tests that unknown commands fail with usage guidance
+func TestRunSubcommandUnknown(t *testing.T) {
+	var out bytes.Buffer
+	code := runSubcommand(&Config{}, []string{"bogus"}, &out)
+	if code != 2 {
+		t.Errorf("Expected exit code 2, got %d", code)
+	}
+	if !strings.Contains(out.String(), "Unknown command: bogus") {
+		t.Errorf("Expected unknown command message, got: %s", out.String())
+	}
+}
+
+// TestRunTestEmailUsage tests that test-email requires a project name
+func TestRunTestEmailUsage(t *testing.T) {
+	var out bytes.Buffer
+	if code := runSubcommand(&Config{}, []string{"test-email"}, &out); code != 2 {
+		t.Errorf("Expected exit code 2, got %d", code)
+	}
+	if !strings.Contains(out.String(), "Usage:") {
+		t.Errorf("Expected usage message, got: %s", out.String())
+	}
+}
+
+// TestRunTestEmailShortCircuits tests the checks performed before any SMTP connection
+func TestRunTestEmailShortCircuits(t *testing.T) {
+	tests := []struct {
+		name     string
+		cfg      *Config
+		expected string
+	}{
+		{
+			name:     "unknown project",
+			cfg:      &Config{EmailConfig: testEmailConfig()},
+			expected: `project "Frontend" not found`,
+		},
+		{
+			name: "email not configured",
+			cfg: &Config{
+				Projects: []ProjectConfig{{Name: "Frontend", EmailRecipients: []string{"a@example.com"}}},
+			},
+			expected: "email notifications are not configured",
+		},
+		{
+			name: "no recipients",
+			cfg: &Config{
+				EmailConfig: testEmailConfig(),
+				Projects:    []ProjectConfig{{Name: "Frontend"}},
+			},
+			expected: "has no email_recipients configured",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var out bytes.Buffer
+			if code := runTestEmail(tt.cfg, "Frontend", &out); code != 1 {
+				t.Errorf("Expected exit code 1, got %d", code)
+			}
+			if !strings.Contains(out.String(), tt.expected) {
+				t.Errorf("Expected output to contain %q, got: %s", tt.expected, out.String())
+			}
+		})
+	}
+}
+
+// TestRunTestEmailReportsSMTPError tests that send failures are printed
+func TestRunTestEmailReportsSMTPError(t *testing.T) {
+	cfg := &Config{
+		EmailConfig: testEmailConfig(),
+		Projects:    []ProjectConfig{{Name: "Frontend", EmailRecipients: []string{"a@example.com"}}},
+	}
+
+	var out bytes.Buffer
+	if code := runTestEmail(cfg, "Frontend", &out); code != 1 {
+		t.Errorf("Expected exit code 1 for unreachable SMTP server, got %d", code)
+	}
+	if !strings.Contains(out.String(), "Failed to send test email") {
+		t.Errorf("Expected SMTP failure message, got: %s", out.String())
+	}
+}
+
+// TestRunDoctor tests that doctor passes on a usable setup and fails when a
+// project's local_path cannot be created
+func TestRunDoctor(t *testing.T) {
+	dir := t.TempDir()
+	cfg := &Config{
+		LogPath:  dir + "/logs",
+		Projects: []ProjectConfig{{Name: "Frontend", LocalPath: dir + "/apps/frontend"}},
+	}
+
+	var out bytes.Buffer
+	if code := runDoctor(cfg, &out); code != 0 {
+		t.Fatalf("Expected exit code 0, got %d: %s", code, out.String())
+	}
+	for _, want := range []string{"[PASS] git: git version", "[PASS] shell:", "[PASS] log directory " + dir + "/logs: does not exist yet, " + dir + " is writable", "[PASS] Frontend: local_path: " + dir + " is writable", "All checks passed"} {
+		if !strings.Contains(out.String(), want) {
+			t.Errorf("Expected %q in report, got: %s", want, out.String())
+		}
+	}
+	// Doctor only inspects; it must not create the directories it checks
+	if _, err := os.Stat(dir + "/logs"); !os.IsNotExist(err) {
+		t.Errorf("Expected doctor not to create the log directory, got %v", err)
+	}
+
+	// A project shell that does not exist fails even if the global one is fine
+	cfg.Projects[0].Shell = dir + "/no-such-shell"
+	out.Reset()
+	if code := runDoctor(cfg, &out); code != 1 || !strings.Contains(out.String(), "[FAIL] Frontend: shell: "+dir+"/no-such-shell not found") {
+		t.Errorf("Expected the project shell to fail, got %d: %s", code, out.String())
+	}
+	cfg.Projects[0].Shell = ""
+
+	// A regular file where a parent directory should be
+	if err := os.WriteFile(dir+"/apps", nil, 0644); err != nil {
+		t.Fatal(err)
+	}
+	out.Reset()
+	if code := runDoctor(cfg, &out); code != 1 {
+		t.Errorf("Expected exit code 1, got %d: %s", code, out.String())
+	}
+	if !strings.Contains(out.String(), "[FAIL] Frontend: local_path: "+dir+"/apps is not a directory") {
+		t.Errorf("Expected local_path failure, got: %s", out.String())
+	}
+	if !strings.Contains(out.String(), "1 check(s) failed") {
+		t.Errorf("Expected failure count, got: %s", out.String())
+	}
+}
+
+// TestRunOnce tests --once exit codes and output
+func TestRunOnce(t *testing.T) {
+	cfg := &Config{
+		Projects: []ProjectConfig{
+			{Name: "Good", WebhookPath: "/hooks/good", ExecuteCommand: "echo ok"},
+			{Name: "Bad", WebhookPath: "/hooks/bad", ExecuteCommand: "exit 1"},
+			{Name: "Paused", WebhookPath: "/hooks/paused", ExecuteCommand: "echo ok", Enabled: new(bool)},
+		},
+	}
+
+	tests := []struct {
+		project  string
+		code     int
+		expected string
+	}{
+		{"Good", onceExitSuccess, "Deployment succeeded: Good"},
+		{"Bad", onceExitFailure, "Deployment failed: Bad"},
+		{"Missing", onceExitFailure, `project "Missing" not found`},
+		{"Paused", onceExitFailure, `project "Paused" is disabled`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.project, func(t *testing.T) {
+			var out bytes.Buffer
+			if code := runOnce(cfg, tt.project, onceTriggerSource, "", false, NewDeployer(nil), &out); code != tt.code {
+				t.Errorf("Expected exit code %d, got %d", tt.code, code)
+			}
+			if !strings.Contains(out.String(), tt.expected) {
+				t.Errorf("Expected output to contain %q, got: %s", tt.expected, out.String())
+			}
+		})
+	}
+}
+
+// TestRunOnceJSON tests the --json output of --once
+func TestRunOnceJSON(t *testing.T) {
+	remoteDir, _, targetPath, branch := setupTestRemote(t)
+	cfg := &Config{
+		Projects: []ProjectConfig{
+			{
+				Name:           "Good",
+				WebhookPath:    "/hooks/good",
+				GitRepo:        "file://" + remoteDir,
+				LocalPath:      targetPath,
+				GitBranch:      branch,
+				ExecuteCommand: "echo ok",
+			},
+			{Name: "Bad", WebhookPath: "/hooks/bad", ExecuteCommand: "exit 1"},
+		},
+	}
+	logger := NewLogger(nil, t.TempDir(), false)
+	defer logger.Close()
+	deployer := NewDeployer(logger)
+
+	tests := []struct {
+		project string
+		code    int
+		success bool
+	}{
+		{"Good", onceExitSuccess, true},
+		{"Bad", onceExitFailure, false},
+		{"Missing", onceExitFailure, false},
+	}
+
+	for _, tt := range tests {
+		var out bytes.Buffer
+		if code := runOnce(cfg, tt.project, onceTriggerSource, "", true, deployer, &out); code != tt.code {
+			t.Errorf("%s: expected exit code %d, got %d", tt.project, tt.code, code)
+		}
+		var result onceJSONResult
+		if err := json.Unmarshal(out.Bytes(), &result); err != nil {
+			t.Fatalf("%s: expected JSON output, got %q: %v", tt.project, out.String(), err)
+		}
+		if result.Project != tt.project || result.Success != tt.success {
+			t.Errorf("%s: unexpected result %+v", tt.project, result)
+		}
+		if tt.project == "Missing" {
+			if !strings.Contains(result.Error, "not found") {
+				t.Errorf("Expected not found error, got %q", result.Error)
+			}
+			continue
+		}
+		if result.BuildID == "" || result.BuildLogPath == "" {
+			t.Errorf("%s: expected build ID and log path, got %+v", tt.project, result)
+		}
+		if _, err := os.Stat(result.BuildLogPath); err != nil {
+			t.Errorf("%s: expected build log at %s: %v", tt.project, result.BuildLogPath, err)
+		}
+	}
+
+	var out bytes.Buffer
+	runOnce(cfg, "Good", onceTriggerSource, "", true, deployer, &out)
+	var result onceJSONResult
+	if err := json.Unmarshal(out.Bytes(), &result); err != nil {
+		t.Fatalf("Expected JSON output: %v", err)
+	}
+	if want := runTestGit(t, targetPath, "rev-parse", "HEAD"); result.CommitSHA != want || result.Output != "ok\n" {
+		t.Errorf("Expected commit %s and output, got %+v", want, result)
+	}
+}
+
+// TestRunOnceTriggerSource tests that --once deploys with the INTERNAL (once) trigger
+func TestRunOnceTriggerSource(t *testing.T) {
+	cfg := &Config{
+		Projects: []ProjectConfig{
+			{Name: "Env", WebhookPath: "/hooks/env", ExecuteCommand: `test "$SDEPLOY_TRIGGER_SOURCE" = "INTERNAL (once)"`},
+		},
+	}
+
+	var out bytes.Buffer
+	if code := runOnce(cfg, "Env", onceTriggerSource, "", false, NewDeployer(nil), &out); code != onceExitSuccess {
+		t.Fatalf("Expected success, got %d: %s", code, out.String())
+	}
+}
+
+// TestRunOnceSourceLabel tests that a --source label becomes the trigger source
+func TestRunOnceSourceLabel(t *testing.T) {
+	cfg := &Config{
+		Projects: []ProjectConfig{
+			{Name: "Env", WebhookPath: "/hooks/env", ExecuteCommand: `test "$SDEPLOY_TRIGGER_SOURCE" = "INTERNAL (nightly cron)"`},
+		},
+	}
+
+	var out bytes.Buffer
+	if code := runOnce(cfg, "Env", onceTriggerSourceFor("nightly cron"), "", false, NewDeployer(nil), &out); code != onceExitSuccess {
+		t.Fatalf("Expected success, got %d: %s", code, out.String())
+	}
+	if got := onceTriggerSourceFor(""); got != onceTriggerSource {
+		t.Errorf("Expected %q without a label, got %q", onceTriggerSource, got)
+	}
+}
+
+// TestRunOnceBranchOverride tests that --branch deploys another branch once
+// without changing the project's configured git_branch
+func TestRunOnceBranchOverride(t *testing.T) {
+	remoteDir, workDir, targetPath, branch := setupTestRemote(t)
+	runTestGit(t, workDir, "checkout", "-b", "hotfix")
+	pushTestCommit(t, workDir, "hotfix.txt", "fix")
+
+	cfg := &Config{
+		Projects: []ProjectConfig{{
+			Name:           "App",
+			WebhookPath:    "/hooks/app",
+			GitRepo:        "file://" + remoteDir,
+			LocalPath:      targetPath,
+			GitBranch:      branch,
+			GitUpdate:      true,
+			ExecuteCommand: "test -f hotfix.txt",
+		}},
+	}
+
+	var out bytes.Buffer
+	if code := runOnce(cfg, "App", onceTriggerSource, "hotfix", false, NewDeployer(nil), &out); code != onceExitSuccess {
+		t.Fatalf("Expected success, got %d: %s", code, out.String())
+	}
+	if got := runTestGit(t, targetPath, "rev-parse", "--abbrev-ref", "HEAD"); got != "hotfix" {
+		t.Errorf("Expected checkout on hotfix, got %s", got)
+	}
+	if cfg.Projects[0].GitBranch != branch {
+		t.Errorf("Expected git_branch to stay %s, got %s", branch, cfg.Projects[0].GitBranch)
+	}
+
+	// The next deploy without --branch switches back
+	out.Reset()
+	cfg.Projects[0].ExecuteCommand = "test ! -f hotfix.txt"
+	if code := runOnce(cfg, "App", onceTriggerSource, "", false, NewDeployer(nil), &out); code != onceExitSuccess {
+		t.Fatalf("Expected success, got %d: %s", code, out.String())
+	}
+	if got := runTestGit(t, targetPath, "rev-parse", "--abbrev-ref", "HEAD"); got != branch {
+		t.Errorf("Expected checkout back on %s, got %s", branch, got)
+	}
+}
+
+// TestRunRollback tests redeploying the commit of the previous successful deploy
+func TestRunRollback(t *testing.T) {
+	remoteDir, workDir, targetPath, branch := setupTestRemote(t)
+	live := filepath.Join(t.TempDir(), "live.txt")
+
+	cfg := &Config{
+		Projects: []ProjectConfig{{
+			Name:           "App",
+			WebhookPath:    "/hooks/app",
+			GitRepo:        "file://" + remoteDir,
+			LocalPath:      targetPath,
+			GitBranch:      branch,
+			GitUpdate:      true,
+			ExecuteCommand: "cp test.txt " + live,
+		}},
+	}
+	project := &cfg.Projects[0]
+	deployer := NewDeployer(nil)
+	assertLive := func(want string) {
+		t.Helper()
+		if data, _ := os.ReadFile(live); string(data) != want {
+			t.Errorf("Expected live content %q, got %q", want, data)
+		}
+	}
+
+	var out bytes.Buffer
+	if code := runRollback(cfg, "App", deployer, &out); code != 1 || !strings.Contains(out.String(), "no previous successful deploy") {
+		t.Errorf("Expected rollback without history to fail, got %d: %s", code, out.String())
+	}
+
+	if result := deployer.Deploy(context.Background(), project, "INTERNAL"); !result.Success {
+		t.Fatalf("First deploy failed: %s", result.Error)
+	}
+	first := runTestGit(t, targetPath, "rev-parse", "HEAD")
+	pushTestCommit(t, workDir, "test.txt", "v2")
+	if result := deployer.Deploy(context.Background(), project, "INTERNAL"); !result.Success {
+		t.Fatalf("Second deploy failed: %s", result.Error)
+	}
+	assertLive("v2")
+
+	// A failed build is not recorded, so it does not shift the rollback target
+	pushTestCommit(t, workDir, "test.txt", "v3")
+	project.ExecuteCommand = "false"
+	deployer.Deploy(context.Background(), project, "INTERNAL")
+	project.ExecuteCommand = "cp test.txt " + live
+
+	out.Reset()
+	if code := runRollback(cfg, "App", deployer, &out); code != 0 {
+		t.Fatalf("Expected rollback to succeed, got %d: %s", code, out.String())
+	}
+	assertLive("test")
+	if got := runTestGit(t, targetPath, "rev-parse", "HEAD"); got != first {
+		t.Errorf("Expected checkout at %s, got %s", first, got)
+	}
+
+	// Rolling back again stays on the good commit instead of returning to v2
+	out.Reset()
+	if code := runRollback(cfg, "App", deployer, &out); code != 0 {
+		t.Fatalf("Expected second rollback to succeed, got %d: %s", code, out.String())
+	}
+	assertLive("test")
+	if got := runTestGit(t, targetPath, "rev-parse", "HEAD"); got != first {
+		t.Errorf("Expected second rollback to keep %s checked out, got %s", first, got)
+	}
+
+	// The next regular deploy returns to the branch head
+	if result := deployer.Deploy(context.Background(), project, "INTERNAL"); !result.Success {
+		t.Fatalf("Deploy after rollback failed: %s", result.Error)
+	}
+	assertLive("v3")
+}
+
+// TestValidateSourceLabel tests --source label validation
+func TestValidateSourceLabel(t *testing.T) {
+	tests := []struct {
+		label   string
+		wantErr bool
+	}{
+		{"cron", false},
+		{"GitLab CI #42", false},
+		{"déploiement", false},
+		{"", true},
+		{"   ", true},
+		{"line\nbreak", true},
+		{"tab\there", true},
+		{"esc\x1b[31m", true},
+		{strings.Repeat("a", maxSourceLabelLength), false},
+		{strings.Repeat("a", maxSourceLabelLength+1), true},
+	}
+
+	for _, tt := range tests {
+		if err := validateSourceLabel(tt.label); (err != nil) != tt.wantErr {
+			t.Errorf("validateSourceLabel(%q) error = %v, wantErr %v", tt.label, err, tt.wantErr)
+		}
+	}
+}
+
+// TestRunTestWebhook tests that test-webhook sends a signed push the daemon
+// accepts, for the configured or a given branch
+func TestRunTestWebhook(t *testing.T) {
+	tmpDir := t.TempDir()
+	outFile := filepath.Join(tmpDir, "trigger")
+	cfg := &Config{
+		ListenAddr: "0.0.0.0",
+		Projects: []ProjectConfig{
+			{
+				Name:            "Site",
+				WebhookPath:     "/hooks/site",
+				WebhookSecret:   "mysecret",
+				GitBranch:       "main",
+				SignatureHeader: "X-Site-Signature",
+				ExecuteCommand:  `echo "$SDEPLOY_TRIGGER_SOURCE" > ` + outFile,
+			},
+		},
+	}
+	var buf syncBuffer
+	logger := NewLogger(&buf, tmpDir, false)
+	deployer := NewDeployer(logger)
+	handler := NewWebhookHandler(cfg, logger)
+	handler.SetDeployer(deployer)
+	server := httptest.NewServer(handler)
+	defer server.Close()
+	_, port, _ := net.SplitHostPort(server.Listener.Addr().String())
+	cfg.ListenPort, _ = strconv.Atoi(port)
+
+	var out bytes.Buffer
+	if code := runSubcommand(cfg, []string{"test-webhook", "Site"}, &out); code != 0 {
+		t.Fatalf("Expected exit code 0, got %d: %s", code, out.String())
+	}
+	if !strings.Contains(out.String(), "runs a real deploy of Site") {
+		t.Errorf("Expected a real deploy warning, got: %s", out.String())
+	}
+	if !strings.Contains(out.String(), "HTTP 202 Accepted") || !strings.Contains(out.String(), "build_id") {
+		t.Errorf("Expected the daemon's response, got: %s", out.String())
+	}
+	data := waitForFile(t, outFile, 5*time.Second)
+	deployer.WaitForActiveBuilds(5 * time.Second)
+	if got := strings.TrimSpace(string(data)); got != "WEBHOOK (test-webhook)" {
+		t.Errorf("Expected trigger WEBHOOK (test-webhook), got %q", got)
+	}
+
+	out.Reset()
+	if code := runSubcommand(cfg, []string{"test-webhook", "--branch", "develop", "Site"}, &out); code != 0 {
+		t.Fatalf("Expected exit code 0, got %d: %s", code, out.String())
+	}
+	if !strings.Contains(out.String(), "(branch develop)") || !strings.Contains(out.String(), "branch mismatch") {
+		t.Errorf("Expected a branch mismatch for develop, got: %s", out.String())
+	}
+
+	// A secret the daemon does not have surfaces as its 401
+	cliCfg := *cfg
+	cliCfg.Projects = []ProjectConfig{cfg.Projects[0]}
+	cliCfg.Projects[0].WebhookSecret = "wrong"
+	out.Reset()
+	if code := runSubcommand(&cliCfg, []string{"test-webhook", "Site"}, &out); code != 1 || !strings.Contains(out.String(), "HTTP 401") {
+		t.Errorf("Expected exit code 1 with HTTP 401, got %d: %s", code, out.String())
+	}
+
+	for _, args := range [][]string{{"test-webhook"}, {"test-webhook", "Site", "extra"}, {"test-webhook", "--bogus", "Site"}} {
+		out.Reset()
+		if code := runSubcommand(cfg, args, &out); code != 2 || !strings.Contains(out.String(), "Usage: sdeploy") {
+			t.Errorf("%v: expected usage and exit code 2, got %d: %s", args, code, out.String())
+		}
+	}
+}
+
+// TestIsLoopbackHost tests which daemon hosts test-webhook trusts without
+// certificate verification
+func TestIsLoopbackHost(t *testing.T) {
+	for host, want := range map[string]bool{
+		"localhost":      true,
+		"127.0.0.1":      true,
+		"::1":            true,
+		"10.0.0.5":       false,
+		"deploy.example": false,
+	} {
+		if got := isLoopbackHost(host); got != want {
+			t.Errorf("isLoopbackHost(%q) = %v, expected %v", host, got, want)
+		}
+	}
+	if got := daemonHost(&Config{ListenAddr: "::"}); got != "127.0.0.1" {
+		t.Errorf("Expected the loopback address for an unspecified listen_addr, got %q", got)
+	}
+}
@@ -1,8 +1,22 @@
 package main
 
 import (
+	"crypto/tls"
 	"fmt"
+	"net"
+	"net/url"
 	"os"
+	"os/exec"
+	"os/user"
+	"path/filepath"
+	"regexp"
+	"runtime"
+	"sort"
+	"strconv"
+	"strings"
+	"text/template"
+	"time"
+	"unicode"
 
 	"gopkg.in/yaml.v3"
 )
@@ -10,15 +24,119 @@ import (
 // Defaults holds all default configuration values in a single struct
 // Access via: Defaults.Port, Defaults.LogPath, etc.
 var Defaults = struct {
-	Port      int
-	LogPath   string
-	GitBranch string
+	Port                 int
+	LogPath              string
+	PIDFile              string
+	GitBranch            string
+	ShutdownGraceSeconds int
+	NotifyOn             string
+	GitHubEvents         []string
+	MaxPayloadBytes      int64
+	Umask                string
+	DirMode              string
+	NotifyRetryCount     int
+	NotifyRetryBaseMS    int
+	SHALength            int
+	LogTimestampFormat   string
+	LogSuccessSuffix     string
+	LogFailSuffix        string
+	LogColor             string
+	BreakerCooldown      int
+	TimeoutGrace         int
+	GitRetryDelay        int
+	SignatureHeader      string
+	SignaturePrefix      string
 }{
-	Port:      8080,
-	LogPath:   "/var/log/sdeploy",
-	GitBranch: "main",
+	Port:                 8080,
+	LogPath:              "/var/log/sdeploy", // root only; see defaultLogPath
+	PIDFile:              "/run/sdeploy.pid",
+	GitBranch:            "main",
+	ShutdownGraceSeconds: 30,
+	NotifyOn:             NotifyAlways,
+	GitHubEvents:         []string{"push"},
+	MaxPayloadBytes:      5 << 20, // 5 MiB
+	Umask:                "0022",
+	DirMode:              "0755",
+	NotifyRetryCount:     3,
+	NotifyRetryBaseMS:    1000,
+	SHALength:            8,
+	LogTimestampFormat:   "2006-01-02 15:04:05",
+	LogSuccessSuffix:     "-success",
+	LogFailSuffix:        "-fail",
+	LogColor:             LogColorAuto,
+	BreakerCooldown:      300,
+	TimeoutGrace:         5,
+	GitRetryDelay:        5,
+	SignatureHeader:      "X-Hub-Signature-256",
+	SignaturePrefix:      "sha256=",
 }
 
+// defaultLogPath returns the log directory used when log_path is unset.
+// Root gets Defaults.LogPath; other users get a directory they can write to,
+// $XDG_STATE_HOME/sdeploy or ~/.local/state/sdeploy.
+func defaultLogPath() string {
+	return defaultLogPathFor(os.Geteuid())
+}
+
+func defaultLogPathFor(euid int) string {
+	if euid == 0 {
+		return Defaults.LogPath
+	}
+	if state := os.Getenv("XDG_STATE_HOME"); filepath.IsAbs(state) {
+		return filepath.Join(state, "sdeploy")
+	}
+	if home, err := os.UserHomeDir(); err == nil {
+		return filepath.Join(home, ".local", "state", "sdeploy")
+	}
+	return Defaults.LogPath
+}
+
+// Notification policies accepted by notify_on
+const (
+	NotifyAlways  = "always"  // notify for every completed build
+	NotifyFailure = "failure" // notify only when a build fails
+	NotifyChange  = "change"  // notify only when a build actually ran
+)
+
+// Actions for require_clean_tree when the working tree is dirty (dirty_tree_action)
+const (
+	DirtyTreeFail  = "fail"  // fail the deployment
+	DirtyTreeStash = "stash" // stash the changes, including untracked files, and continue
+)
+
+// Deploy strategies accepted by deploy_strategy
+const (
+	DeployStrategyInPlace = "inplace" // build in the local_path checkout
+	DeployStrategyAtomic  = "atomic"  // build in a fresh worktree and switch the execute_path symlink
+)
+
+// Console color modes accepted by log_color
+const (
+	LogColorAuto   = "auto"   // colorize when stderr is a terminal
+	LogColorAlways = "always" // colorize even when stderr is redirected
+	LogColorNever  = "never"  // never colorize
+)
+
+// UmaskNone disables the umask wrapper around project commands
+const UmaskNone = "none"
+
+// PIDFileNone disables the daemon PID file
+const PIDFileNone = "none"
+
+// headerNamePattern matches HTTP header names accepted for signature_header
+var headerNamePattern = regexp.MustCompile(`^[A-Za-z0-9-]+$`)
+
+// logSuffixPattern matches the filesystem-safe build log filename suffixes
+// accepted by log_success_suffix and log_fail_suffix
+var logSuffixPattern = regexp.MustCompile(`^[A-Za-z0-9._-]{1,32}$`)
+
+// umaskPattern matches the octal values accepted by umask
+var umaskPattern = regexp.MustCompile(`^0?[0-7]{3}$`)
+
+// dirModePattern matches the octal values accepted by dir_mode, including the
+// setuid/setgid/sticky digit (e.g. 2775)
+var dirModePattern = regexp.MustCompile(`^0?[0-7]{3,4}$`)
+
 // ConfigSearchPaths defines the search order for config files
 var ConfigSearchPaths = []string{
 	"/etc/sdeploy.conf",
@@ -32,31 +150,301 @@ type EmailConfig struct {
 	SMTPUser    string `yaml:"smtp_user"`
 	SMTPPass    string `yaml:"smtp_pass"`
 	EmailSender string `yaml:"email_sender"`
+	SMTPTLS     string `yaml:"smtp_tls"`
+	// SubjectTemplate and BodyTemplate replace the built-in subject and
+	// body with text/template output (see emailTemplateData)
+	SubjectTemplate string `yaml:"email_subject_template"`
+	BodyTemplate    string `yaml:"email_body_template"`
+
+	// Parsed at load by validateEmailConfig
+	subjectTmpl *template.Template
+	bodyTmpl    *template.Template
+}
+
+// TeamsConfig holds the Microsoft Teams incoming webhook used for
+// notifications. The URL embeds its own credentials and is redacted like a
+// password.
+type TeamsConfig struct {
+	WebhookURL string `yaml:"webhook_url"`
 }
 
+// SMTP connection security modes accepted by smtp_tls
+const (
+	SMTPTLSStartTLS = "starttls" // plaintext connect, then upgrade with STARTTLS
+	SMTPTLSImplicit = "tls"      // TLS from the first byte (usually port 465)
+	SMTPTLSNone     = "none"     // no encryption
+)
+
+// smtpImplicitTLSPort is the well-known port for SMTP over implicit TLS
+const smtpImplicitTLSPort = 465
+
 // ProjectConfig holds configuration for a single project
 type ProjectConfig struct {
-	Name            string   `yaml:"name"`
-	WebhookPath     string   `yaml:"webhook_path"`
-	WebhookSecret   string   `yaml:"webhook_secret"`
-	GitRepo         string   `yaml:"git_repo"`
-	LocalPath       string   `yaml:"local_path"`
-	ExecutePath     string   `yaml:"execute_path"`
-	GitBranch       string   `yaml:"git_branch"`
-	ExecuteCommand  string   `yaml:"execute_command"`
-	EnvVariables    []string `yaml:"env_variables"`
-	GitUpdate       bool     `yaml:"git_update"`
-	GitSSHKeyPath   string   `yaml:"git_ssh_key_path"`
-	TimeoutSeconds  int      `yaml:"timeout_seconds"`
-	EmailRecipients []string `yaml:"email_recipients"`
+	Name              string            `yaml:"name"`
+	WebhookPath       string            `yaml:"webhook_path"`
+	WebhookSecret     string            `yaml:"webhook_secret"`
+	GitRepo           string            `yaml:"git_repo"`
+	LocalPath         string            `yaml:"local_path"`
+	ExecutePath       string            `yaml:"execute_path"`
+	GitBranch         string            `yaml:"git_branch"`
+	ExecuteCommand    string            `yaml:"execute_command"`
+	EnvVariables      []string          `yaml:"env_variables"`
+	GitUpdate         bool              `yaml:"git_update"`
+	GitSSHKeyPath     string            `yaml:"git_ssh_key_path"`
+	GitKnownHostsPath string            `yaml:"git_known_hosts_path"`
+	GitToken          string            `yaml:"git_token"`
+	GitTokenFile      string            `yaml:"git_token_file"`
+	TimeoutSeconds    int               `yaml:"timeout_seconds"`
+	GitTimeoutSeconds int               `yaml:"git_timeout_seconds"`
+	LockWaitSeconds   int               `yaml:"lock_wait_seconds"`
+	EmailRecipients   []string          `yaml:"email_recipients"`
+	DeployOnNoChange  bool              `yaml:"deploy_on_no_change"`
+	ResultHookCommand string            `yaml:"result_hook_command"`
+	NotifyOn          string            `yaml:"notify_on"`
+	GitHubEvents      []string          `yaml:"github_events"`
+	BranchDeploys     []BranchDeploy    `yaml:"branch_deploys"`
+	BranchCommands    map[string]string `yaml:"branch_commands"`
+	DebounceSeconds   int               `yaml:"debounce_seconds"`
+	Shell             string            `yaml:"shell"`
+	Umask             string            `yaml:"umask"`
+	DirMode           string            `yaml:"dir_mode"`
+	RequireCleanTree  bool              `yaml:"require_clean_tree"`
+	DirtyTreeAction   string            `yaml:"dirty_tree_action"`
+	DeployExactCommit bool              `yaml:"deploy_exact_commit"`
+	Enabled           *bool             `yaml:"enabled"`
+	BuildPaths        []string          `yaml:"build_paths"`
+	IgnorePaths       []string          `yaml:"ignore_paths"`
+	TriggerFiles      []string          `yaml:"trigger_files"`
+	MinBuildInterval  int               `yaml:"min_build_interval_seconds"`
+	LogPath           string            `yaml:"log_path"`
+	GitCloneArgs      []string          `yaml:"git_clone_args"`
+	GitPullArgs       []string          `yaml:"git_pull_args"`
+	LogPayloads       *bool             `yaml:"log_payloads"`
+	RunAsUser         string            `yaml:"run_as_user"`
+	FailureThreshold  int               `yaml:"failure_threshold"`
+	BreakerCooldown   int               `yaml:"breaker_cooldown_seconds"`
+	SignatureHeader   string            `yaml:"signature_header"`
+	SignaturePrefix   string            `yaml:"signature_prefix"`
+	DeployTimeout     int               `yaml:"deploy_timeout_seconds"`
+	AuthBearerToken   string            `yaml:"auth_bearer_token"`
+	AutoRecover       bool              `yaml:"auto_recover"`
+	DependentProjects []string          `yaml:"dependent_projects"`
+	RequireOutput     bool              `yaml:"require_output"`
+	ChownTo           string            `yaml:"chown_to"`
+	GitMaintenance    int               `yaml:"git_maintenance"`
+	TimeoutGrace      int               `yaml:"timeout_grace_seconds"`
+	DeployStrategy    string            `yaml:"deploy_strategy"`
+	CreateDirs        *bool             `yaml:"create_dirs"`
+	AllowedTriggers   []string          `yaml:"allowed_triggers"`
+	MatchRepo         string            `yaml:"match_repo"`
+	GitRetryCount     int               `yaml:"git_retry_count"`
+	GitRetryDelay     int               `yaml:"git_retry_delay_seconds"`
+
+	// ExecuteSteps holds a list-form execute_command (see UnmarshalYAML)
+	ExecuteSteps []CommandStep `yaml:"-"`
+
+	// deployKey overrides WebhookPath as the deploy identity (set for branch_deploys entries)
+	deployKey string
+	// remoteBranch is set when git_branch was omitted: GitBranch holds the
+	// fallback and the remote's default branch is used once it is known
+	remoteBranch bool
+}
+
+// BranchDeploy deploys an additional branch of a project to its own path
+type BranchDeploy struct {
+	GitBranch      string `yaml:"git_branch"`
+	LocalPath      string `yaml:"local_path"`
+	ExecutePath    string `yaml:"execute_path"`
+	ExecuteCommand string `yaml:"execute_command"`
+}
+
+// ForBranch returns the project settings to deploy for a pushed branch.
+// The top-level fields are the default entry and are returned for an empty
+// branch or git_branch itself. A branch_commands key yields a copy that checks
+// that branch out in the same local_path and runs its command; a matching
+// branch_deploys entry yields a copy with that entry's overrides. Returns nil
+// if nothing matches.
+func (p *ProjectConfig) ForBranch(branch string) *ProjectConfig {
+	if command, ok := p.BranchCommands[branch]; ok && branch != "" {
+		variant := *p
+		variant.ExecuteCommand = command
+		variant.ExecuteSteps = nil
+		if branch != p.GitBranch {
+			variant.GitBranch = branch
+			variant.remoteBranch = false
+			variant.deployKey = p.DeployKey() + "@" + branch
+		}
+		return &variant
+	}
+	if branch == "" || branch == p.GitBranch {
+		return p
+	}
+	for _, bd := range p.BranchDeploys {
+		if bd.GitBranch != branch {
+			continue
+		}
+		variant := *p
+		variant.GitBranch = bd.GitBranch
+		variant.LocalPath = bd.LocalPath
+		variant.ExecutePath = bd.ExecutePath
+		if bd.ExecuteCommand != "" {
+			variant.ExecuteCommand = bd.ExecuteCommand
+			variant.ExecuteSteps = nil
+		}
+		variant.BranchDeploys = nil
+		variant.remoteBranch = false
+		variant.deployKey = p.DeployKey() + "@" + bd.GitBranch
+		return &variant
+	}
+	return nil
+}
+
+// WithBranch returns a copy of the project that deploys branch into the same
+// checkout, under the same deploy lock. Used for one-off deploys of a branch
+// other than git_branch; the project itself is not changed.
+func (p *ProjectConfig) WithBranch(branch string) *ProjectConfig {
+	variant := *p
+	variant.GitBranch = branch
+	variant.remoteBranch = false
+	return &variant
+}
+
+// IsEnabled reports whether the project deploys. Projects are enabled unless
+// they set enabled: false.
+func (p *ProjectConfig) IsEnabled() bool {
+	return p.Enabled == nil || *p.Enabled
+}
+
+// CreatesDirs reports whether preflight creates missing local_path and
+// execute_path directories. It does unless the project sets create_dirs: false.
+func (p *ProjectConfig) CreatesDirs() bool {
+	return p.CreateDirs == nil || *p.CreateDirs
+}
+
+// AllowsTrigger reports whether a deploy from triggerSource may run. An
+// allowed_triggers entry matches the full source, e.g. "WEBHOOK (Github)", or
+// its kind, so "WEBHOOK" matches every webhook. An empty list allows all.
+func (p *ProjectConfig) AllowsTrigger(triggerSource string) bool {
+	if len(p.AllowedTriggers) == 0 {
+		return true
+	}
+	kind, _, _ := strings.Cut(triggerSource, " (")
+	for _, allowed := range p.AllowedTriggers {
+		if allowed == triggerSource || allowed == kind {
+			return true
+		}
+	}
+	return false
+}
+
+// SignatureScheme returns the header carrying the project's HMAC-SHA256
+// signature and the prefix in front of its hex digest. Without
+// signature_header this is GitHub's X-Hub-Signature-256 with "sha256=";
+// signature_prefix is then only needed to change the prefix.
+func (p *ProjectConfig) SignatureScheme() (header, prefix string) {
+	if p.SignatureHeader != "" {
+		return p.SignatureHeader, p.SignaturePrefix
+	}
+	if p.SignaturePrefix != "" {
+		return Defaults.SignatureHeader, p.SignaturePrefix
+	}
+	return Defaults.SignatureHeader, Defaults.SignaturePrefix
+}
+
+// TimeoutGracePeriod returns how long a timed-out execute_command gets to
+// exit after SIGTERM before SIGKILL (timeout_grace_seconds, Defaults.TimeoutGrace
+// if unset)
+func (p *ProjectConfig) TimeoutGracePeriod() time.Duration {
+	if p.TimeoutGrace > 0 {
+		return time.Duration(p.TimeoutGrace) * time.Second
+	}
+	return time.Duration(Defaults.TimeoutGrace) * time.Second
+}
+
+// GitRetryBaseDelay returns the wait before the first retry of a git step
+// that failed with a network error (git_retry_delay_seconds,
+// Defaults.GitRetryDelay if unset); it doubles for each further retry
+func (p *ProjectConfig) GitRetryBaseDelay() time.Duration {
+	if p.GitRetryDelay > 0 {
+		return time.Duration(p.GitRetryDelay) * time.Second
+	}
+	return time.Duration(Defaults.GitRetryDelay) * time.Second
+}
+
+// LogsPayloads reports whether received webhook payloads are written to the
+// service log (log_payloads, off by default)
+func (p *ProjectConfig) LogsPayloads() bool {
+	return p.LogPayloads != nil && *p.LogPayloads
+}
+
+// DeployKey identifies the project, or one of its branch_deploys entries,
+// for per-deployment state such as debouncing. Projects sharing a
+// webhook_path are told apart by their match_repo.
+func (p *ProjectConfig) DeployKey() string {
+	if p.deployKey != "" {
+		return p.deployKey
+	}
+	if p.MatchRepo != "" {
+		return p.WebhookPath + "#" + strings.ToLower(p.MatchRepo)
+	}
+	return p.WebhookPath
+}
+
+// LockKey returns the key that serializes deployments. Deployments that share
+// a local_path serialize with each other, even across projects; without a
+// local_path the project's DeployKey is used.
+func (p *ProjectConfig) LockKey() string {
+	if p.LocalPath != "" {
+		return "path:" + filepath.Clean(p.LocalPath)
+	}
+	return "webhook:" + p.DeployKey()
 }
 
 // Config holds the complete SDeploy configuration
 type Config struct {
-	ListenPort  int             `yaml:"listen_port"`
-	LogPath     string          `yaml:"log_path"`
-	EmailConfig *EmailConfig    `yaml:"email_config"`
-	Projects    []ProjectConfig `yaml:"projects"`
+	ListenPort            int             `yaml:"listen_port"`
+	ListenAddr            string          `yaml:"listen_addr"`
+	TrustProxy            bool            `yaml:"trust_proxy"`
+	TLSCertFile           string          `yaml:"tls_cert_file"`
+	TLSKeyFile            string          `yaml:"tls_key_file"`
+	LogPath               string          `yaml:"log_path"`
+	PIDFile               string          `yaml:"pid_file"`
+	ShutdownGraceSeconds  int             `yaml:"shutdown_grace_seconds"`
+	NotifyOn              string          `yaml:"notify_on"`
+	DefaultTimeoutSeconds int             `yaml:"default_timeout_seconds"`
+	MaxTimeoutSeconds     int             `yaml:"max_timeout_seconds"`
+	AdminToken            string          `yaml:"admin_token"`
+	MaxPayloadBytes       int64           `yaml:"max_payload_bytes"`
+	Shell                 string          `yaml:"shell"`
+	NotifyRetryCount      int             `yaml:"notify_retry_count"`
+	NotifyRetryBaseMS     int             `yaml:"notify_retry_base_ms"`
+	SHALength             int             `yaml:"sha_length"`
+	LogTimestampFormat    string          `yaml:"log_timestamp_format"`
+	LogSuccessSuffix      string          `yaml:"log_success_suffix"`
+	LogFailSuffix         string          `yaml:"log_fail_suffix"`
+	LogColor              string          `yaml:"log_color"`
+	BuildLogMaxBytes      int64           `yaml:"build_log_max_bytes"`
+	WebhookPrefix         string          `yaml:"webhook_prefix"`
+	MaintenanceMode       bool            `yaml:"maintenance_mode"`
+	LogPayloads           bool            `yaml:"log_payloads"`
+	AllowRelativePaths    bool            `yaml:"allow_relative_paths"`
+	StrictPaths           bool            `yaml:"strict_paths"`
+	StrictPerms           bool            `yaml:"strict_perms"`
+	RedactPatterns        []string        `yaml:"redact_patterns"`
+	EmailConfig           *EmailConfig    `yaml:"email_config"`
+	TeamsConfig           *TeamsConfig    `yaml:"teams_config"`
+	Include               []string        `yaml:"include"`
+	Projects              []ProjectConfig `yaml:"projects"`
+
+	// includedFiles lists the files merged in via include, in load order
+	includedFiles []string
+	// redactRegexps holds the compiled redact_patterns
+	redactRegexps []*regexp.Regexp
+}
+
+// includeFile holds the schema accepted by files referenced from include
+type includeFile struct {
+	Projects []ProjectConfig `yaml:"projects"`
 }
 
 // LoadConfig loads and validates a configuration from the specified file path
@@ -71,11 +459,62 @@ func LoadConfig(path string) (*Config, error) {
 		return nil, fmt.Errorf("failed to parse config YAML: %w", err)
 	}
 
+	// Merge projects from included files
+	if err := loadIncludes(&cfg, filepath.Dir(path)); err != nil {
+		return nil, err
+	}
+
 	// Set default listen port if not specified in config
 	if cfg.ListenPort == 0 {
 		cfg.ListenPort = Defaults.Port
 	}
 
+	// Set default PID file if not specified in config
+	if cfg.PIDFile == "" {
+		cfg.PIDFile = Defaults.PIDFile
+	}
+
+	// Set default shutdown grace period if not specified in config
+	if cfg.ShutdownGraceSeconds == 0 {
+		cfg.ShutdownGraceSeconds = Defaults.ShutdownGraceSeconds
+	}
+
+	// Set default webhook payload limit if not specified in config
+	if cfg.MaxPayloadBytes == 0 {
+		cfg.MaxPayloadBytes = Defaults.MaxPayloadBytes
+	}
+
+	// Set default notification retry policy if not specified in config
+	if cfg.NotifyRetryCount == 0 {
+		cfg.NotifyRetryCount = Defaults.NotifyRetryCount
+	}
+	if cfg.NotifyRetryBaseMS == 0 {
+		cfg.NotifyRetryBaseMS = Defaults.NotifyRetryBaseMS
+	}
+
+	// Set default short commit SHA length if not specified in config
+	if cfg.SHALength == 0 {
+		cfg.SHALength = Defaults.SHALength
+	}
+
+	// Set default log timestamp format if not specified in config
+	if cfg.LogTimestampFormat == "" {
+		cfg.LogTimestampFormat = Defaults.LogTimestampFormat
+	}
+
+	// Set default console color mode if not specified in config
+	if cfg.LogColor == "" {
+		cfg.LogColor = Defaults.LogColor
+	}
+
+	// Set default build log filename suffixes if not specified in config
+	if cfg.LogSuccessSuffix == "" {
+		cfg.LogSuccessSuffix = Defaults.LogSuccessSuffix
+	}
+	if cfg.LogFailSuffix == "" {
+		cfg.LogFailSuffix = Defaults.LogFailSuffix
+	}
+
 	// Validate the configuration
 	if err := validateConfig(&cfg); err != nil {
 		return nil, err
@@ -84,10 +523,172 @@ func LoadConfig(path string) (*Config, error) {
 	return &cfg, nil
 }
 
+// FindProjectByName returns the project with the given name, or nil if none matches
+func (c *Config) FindProjectByName(name string) *ProjectConfig {
+	for i := range c.Projects {
+		if c.Projects[i].Name == name {
+			return &c.Projects[i]
+		}
+	}
+	return nil
+}
+
+// loadIncludes expands the include glob patterns and appends the projects
+// from each matched file. Relative patterns resolve against baseDir.
+func loadIncludes(cfg *Config, baseDir string) error {
+	for _, pattern := range cfg.Include {
+		if !filepath.IsAbs(pattern) {
+			pattern = filepath.Join(baseDir, pattern)
+		}
+
+		matches, err := filepath.Glob(pattern)
+		if err != nil {
+			return fmt.Errorf("invalid include pattern %q: %w", pattern, err)
+		}
+		// A literal path must exist; an unmatched glob is allowed (e.g. an empty conf.d)
+		if len(matches) == 0 && !hasGlobMeta(pattern) {
+			return fmt.Errorf("include file does not exist: %s", pattern)
+		}
+		sort.Strings(matches)
+
+		for _, match := range matches {
+			data, err := os.ReadFile(match)
+			if err != nil {
+				return fmt.Errorf("failed to read include file %s: %w", match, err)
+			}
+
+			var inc includeFile
+			if err := yaml.Unmarshal(data, &inc); err != nil {
+				return fmt.Errorf("failed to parse include file %s: %w", match, err)
+			}
+
+			cfg.Projects = append(cfg.Projects, inc.Projects...)
+			cfg.includedFiles = append(cfg.includedFiles, match)
+		}
+	}
+
+	return nil
+}
+
+// hasGlobMeta reports whether the pattern contains glob metacharacters
+func hasGlobMeta(pattern string) bool {
+	return strings.ContainsAny(pattern, "*?[")
+}
+
+// IncludedFiles returns the files merged into this configuration via include
+func (c *Config) IncludedFiles() []string {
+	return c.includedFiles
+}
+
 // validateConfig performs validation checks on the configuration
 func validateConfig(cfg *Config) error {
+	if cfg.ShutdownGraceSeconds < 0 {
+		return fmt.Errorf("shutdown_grace_seconds cannot be negative")
+	}
+
+	if cfg.MaxPayloadBytes < 0 {
+		return fmt.Errorf("max_payload_bytes cannot be negative")
+	}
+	if cfg.BuildLogMaxBytes < 0 {
+		return fmt.Errorf("build_log_max_bytes cannot be negative")
+	}
+	if cfg.DefaultTimeoutSeconds < 0 {
+		return fmt.Errorf("default_timeout_seconds cannot be negative")
+	}
+	if cfg.MaxTimeoutSeconds < 0 {
+		return fmt.Errorf("max_timeout_seconds cannot be negative")
+	}
+	if cfg.NotifyRetryCount < 0 {
+		return fmt.Errorf("notify_retry_count cannot be negative")
+	}
+	if cfg.NotifyRetryBaseMS < 0 {
+		return fmt.Errorf("notify_retry_base_ms cannot be negative")
+	}
+	if cfg.SHALength != 0 && (cfg.SHALength < 4 || cfg.SHALength > 40) {
+		return fmt.Errorf("sha_length must be between 4 and 40, got %d", cfg.SHALength)
+	}
+	if cfg.LogTimestampFormat != "" {
+		if err := validateTimestampFormat(cfg.LogTimestampFormat); err != nil {
+			return fmt.Errorf("invalid log_timestamp_format %q: %v", cfg.LogTimestampFormat, err)
+		}
+	}
+	switch cfg.LogColor {
+	case LogColorAuto, LogColorAlways, LogColorNever:
+	default:
+		return fmt.Errorf("invalid log_color %q: must be %s, %s or %s", cfg.LogColor, LogColorAuto, LogColorAlways, LogColorNever)
+	}
+	for _, suffix := range []struct{ key, value string }{
+		{"log_success_suffix", cfg.LogSuccessSuffix},
+		{"log_fail_suffix", cfg.LogFailSuffix},
+	} {
+		if suffix.value != "" && !logSuffixPattern.MatchString(suffix.value) {
+			return fmt.Errorf("%s %q must be 1-32 letters, digits, '.', '_' or '-'", suffix.key, suffix.value)
+		}
+		if suffix.value == pendingLogSuffix {
+			return fmt.Errorf("%s cannot be %q (used for builds in progress)", suffix.key, pendingLogSuffix)
+		}
+	}
+	if cfg.LogSuccessSuffix != "" && cfg.LogSuccessSuffix == cfg.LogFailSuffix {
+		return fmt.Errorf("log_success_suffix and log_fail_suffix must differ")
+	}
+
+	if err := validateEmailConfig(cfg.EmailConfig); err != nil {
+		return err
+	}
+
+	if err := validateTeamsConfig(cfg.TeamsConfig); err != nil {
+		return err
+	}
+
+	// Default notify_on globally, then let projects inherit it
+	if cfg.NotifyOn == "" {
+		cfg.NotifyOn = Defaults.NotifyOn
+	}
+	if err := validateNotifyOn(cfg.NotifyOn); err != nil {
+		return err
+	}
+
+	if cfg.Shell != "" {
+		if err := validateShell(cfg.Shell); err != nil {
+			return err
+		}
+	}
+
+	if cfg.ListenAddr != "" {
+		if err := validateListenAddr(cfg.ListenAddr); err != nil {
+			return err
+		}
+		cfg.ListenAddr = strings.TrimSuffix(strings.TrimPrefix(cfg.ListenAddr, "["), "]")
+	}
+
+	if (cfg.TLSCertFile == "") != (cfg.TLSKeyFile == "") {
+		return fmt.Errorf("tls_cert_file and tls_key_file must be set together")
+	}
+	if cfg.TLSEnabled() {
+		if _, err := tls.LoadX509KeyPair(cfg.TLSCertFile, cfg.TLSKeyFile); err != nil {
+			return fmt.Errorf("failed to load TLS certificate: %v", err)
+		}
+	}
+
+	if cfg.WebhookPrefix != "" {
+		if !strings.HasPrefix(cfg.WebhookPrefix, "/") || strings.TrimRight(cfg.WebhookPrefix, "/") == "" {
+			return fmt.Errorf("webhook_prefix must start with / and name a path, got %q", cfg.WebhookPrefix)
+		}
+		cfg.WebhookPrefix = strings.TrimRight(cfg.WebhookPrefix, "/")
+	}
+
+	cfg.redactRegexps = nil
+	for _, pattern := range cfg.RedactPatterns {
+		re, err := regexp.Compile(pattern)
+		if err != nil {
+			return fmt.Errorf("invalid redact_patterns entry %q: %v", pattern, err)
+		}
+		cfg.redactRegexps = append(cfg.redactRegexps, re)
+	}
+
 	// Check for at least one project (optional, but need to validate projects if present)
-	webhookPaths := make(map[string]bool)
+	webhookPaths := make(map[string]*ProjectConfig)
+	matchRepos := make(map[string]bool)
 
 	// Note: Using pointer to project (not range value) to allow modification of slice elements
 	for i := range cfg.Projects {
@@ -102,19 +703,83 @@ func validateConfig(cfg *Config) error {
 			return fmt.Errorf("project %d (%s): webhook_secret is required", i+1, project.Name)
 		}
 
-		if project.ExecuteCommand == "" {
+		if project.ExecuteCommand == "" && len(project.ExecuteSteps) == 0 {
 			return fmt.Errorf("project %d (%s): execute_command is required", i+1, project.Name)
 		}
+		if err := validateExecuteSteps(project.ExecuteSteps); err != nil {
+			return fmt.Errorf("project %d (%s): %v", i+1, project.Name, err)
+		}
+
+		if project.TimeoutSeconds < 0 {
+			return fmt.Errorf("project %d (%s): timeout_seconds cannot be negative", i+1, project.Name)
+		}
+		project.TimeoutSeconds = resolveTimeout(project.TimeoutSeconds, cfg.DefaultTimeoutSeconds, cfg.MaxTimeoutSeconds)
+
+		if project.TimeoutGrace < 0 {
+			return fmt.Errorf("project %d (%s): timeout_grace_seconds cannot be negative", i+1, project.Name)
+		}
+		if project.GitRetryCount < 0 {
+			return fmt.Errorf("project %d (%s): git_retry_count cannot be negative", i+1, project.Name)
+		}
+		if project.GitRetryDelay < 0 {
+			return fmt.Errorf("project %d (%s): git_retry_delay_seconds cannot be negative", i+1, project.Name)
+		}
+		if project.DeployTimeout < 0 {
+			return fmt.Errorf("project %d (%s): deploy_timeout_seconds cannot be negative", i+1, project.Name)
+		}
+		if project.GitTimeoutSeconds < 0 {
+			return fmt.Errorf("project %d (%s): git_timeout_seconds cannot be negative", i+1, project.Name)
+		}
+		project.GitTimeoutSeconds = resolveTimeout(project.GitTimeoutSeconds, project.TimeoutSeconds, cfg.MaxTimeoutSeconds)
 
-		// Check for duplicate webhook paths
-		if webhookPaths[project.WebhookPath] {
+		if project.DebounceSeconds < 0 {
+			return fmt.Errorf("project %d (%s): debounce_seconds cannot be negative", i+1, project.Name)
+		}
+		if project.MinBuildInterval < 0 {
+			return fmt.Errorf("project %d (%s): min_build_interval_seconds cannot be negative", i+1, project.Name)
+		}
+		if project.FailureThreshold < 0 {
+			return fmt.Errorf("project %d (%s): failure_threshold cannot be negative", i+1, project.Name)
+		}
+		if project.BreakerCooldown < 0 {
+			return fmt.Errorf("project %d (%s): breaker_cooldown_seconds cannot be negative", i+1, project.Name)
+		}
+		if project.FailureThreshold > 0 && project.BreakerCooldown == 0 {
+			project.BreakerCooldown = Defaults.BreakerCooldown
+		}
+
+		if project.GitMaintenance < 0 {
+			return fmt.Errorf("project %d (%s): git_maintenance cannot be negative", i+1, project.Name)
+		}
+
+		if project.LockWaitSeconds < 0 {
+			return fmt.Errorf("project %d (%s): lock_wait_seconds cannot be negative", i+1, project.Name)
+		}
+
+		project.WebhookPath = prefixWebhookPath(cfg.WebhookPrefix, project.WebhookPath)
+
+		if err := validateMatchRepo(project.MatchRepo); err != nil {
+			return fmt.Errorf("project %d (%s): %v", i+1, project.Name, err)
+		}
+
+		// Check for duplicate webhook paths; projects that each set match_repo
+		// may share one and are told apart by the payload's repository
+		if other, ok := webhookPaths[project.WebhookPath]; ok && (other.MatchRepo == "" || project.MatchRepo == "") {
 			return fmt.Errorf("duplicate webhook_path: %s", project.WebhookPath)
 		}
-		webhookPaths[project.WebhookPath] = true
+		webhookPaths[project.WebhookPath] = project
+		if project.MatchRepo != "" {
+			if matchRepos[project.DeployKey()] {
+				return fmt.Errorf("project %d (%s): duplicate match_repo %s on webhook_path %s", i+1, project.Name, project.MatchRepo, project.WebhookPath)
+			}
+			matchRepos[project.DeployKey()] = true
+		}
 
-		// Default git_branch to Defaults.GitBranch if not set
+		// Default git_branch to Defaults.GitBranch if not set; deploys follow
+		// the remote's default branch when it can be queried
 		if project.GitBranch == "" {
 			project.GitBranch = Defaults.GitBranch
+			project.remoteBranch = true
 		}
 
 		// Validate git_branch format (basic validation to prevent command injection)
@@ -122,17 +787,451 @@ func validateConfig(cfg *Config) error {
 			return fmt.Errorf("project %d (%s): %v", i+1, project.Name, err)
 		}
 
+		if err := validateBranchDeploys(project); err != nil {
+			return fmt.Errorf("project %d (%s): %v", i+1, project.Name, err)
+		}
+
+		if err := validateBranchCommands(project); err != nil {
+			return fmt.Errorf("project %d (%s): %v", i+1, project.Name, err)
+		}
+		if err := validateAllowedTriggers(project.AllowedTriggers); err != nil {
+			return fmt.Errorf("project %d (%s): %v", i+1, project.Name, err)
+		}
+		if project.DeployStrategy == "" {
+			project.DeployStrategy = DeployStrategyInPlace
+		}
+		if err := validateDeployStrategy(project); err != nil {
+			return fmt.Errorf("project %d (%s): %v", i+1, project.Name, err)
+		}
+
+		if project.NotifyOn == "" {
+			project.NotifyOn = cfg.NotifyOn
+		}
+		if err := validateNotifyOn(project.NotifyOn); err != nil {
+			return fmt.Errorf("project %d (%s): %v", i+1, project.Name, err)
+		}
+
+		// Inherit the global log_payloads unless the project sets its own
+		if project.LogPayloads == nil {
+			logPayloads := cfg.LogPayloads
+			project.LogPayloads = &logPayloads
+		}
+
+		// Inherit the global shell; an explicit project shell is validated on its own
+		if project.Shell == "" {
+			project.Shell = cfg.Shell
+		} else if err := validateShell(project.Shell); err != nil {
+			return fmt.Errorf("project %d (%s): %v", i+1, project.Name, err)
+		}
+
+		if project.SignatureHeader != "" && !headerNamePattern.MatchString(project.SignatureHeader) {
+			return fmt.Errorf("project %d (%s): invalid signature_header: %s", i+1, project.Name, project.SignatureHeader)
+		}
+
+		if project.RunAsUser != "" {
+			if err := validateRunAsUser(project.RunAsUser); err != nil {
+				return fmt.Errorf("project %d (%s): %v", i+1, project.Name, err)
+			}
+		}
+
+		if project.ChownTo != "" {
+			if project.GitRepo == "" {
+				return fmt.Errorf("project %d (%s): chown_to requires git_repo", i+1, project.Name)
+			}
+			if _, _, err := lookupOwner(project.ChownTo); err != nil {
+				return fmt.Errorf("project %d (%s): %v", i+1, project.Name, err)
+			}
+		}
+
+		if project.Umask == "" {
+			project.Umask = Defaults.Umask
+		}
+		if err := validateUmask(project.Umask); err != nil {
+			return fmt.Errorf("project %d (%s): %v", i+1, project.Name, err)
+		}
+		if project.DirMode == "" {
+			project.DirMode = Defaults.DirMode
+		}
+		if _, err := parseDirMode(project.DirMode); err != nil {
+			return fmt.Errorf("project %d (%s): %v", i+1, project.Name, err)
+		}
+
+		if project.DirtyTreeAction == "" {
+			project.DirtyTreeAction = DirtyTreeFail
+		}
+		if project.DirtyTreeAction != DirtyTreeFail && project.DirtyTreeAction != DirtyTreeStash {
+			return fmt.Errorf("project %d (%s): invalid dirty_tree_action: %s (must be %s or %s)",
+				i+1, project.Name, project.DirtyTreeAction, DirtyTreeFail, DirtyTreeStash)
+		}
+
+		// Relative paths would resolve against the daemon's working directory
+		fields := []string{"local_path", "execute_path", "git_ssh_key_path"}
+		paths := []string{project.LocalPath, project.ExecutePath, project.GitSSHKeyPath}
+		for j, bd := range project.BranchDeploys {
+			fields = append(fields, fmt.Sprintf("branch_deploys[%d].local_path", j), fmt.Sprintf("branch_deploys[%d].execute_path", j))
+			paths = append(paths, bd.LocalPath, bd.ExecutePath)
+		}
+		for k, path := range paths {
+			if err := validateAbsolutePath(fields[k], path, cfg.AllowRelativePaths); err != nil {
+				return fmt.Errorf("project %d (%s): %v", i+1, project.Name, err)
+			}
+		}
+
 		// Validate git_ssh_key_path if provided
 		if project.GitSSHKeyPath != "" {
 			if err := validateSSHKeyPath(project.GitSSHKeyPath); err != nil {
 				return fmt.Errorf("project %d (%s): %v", i+1, project.Name, err)
 			}
 		}
+
+		// Validate git_known_hosts_path if provided
+		if project.GitKnownHostsPath != "" {
+			if err := validateKnownHostsPath(project.GitKnownHostsPath); err != nil {
+				return fmt.Errorf("project %d (%s): %v", i+1, project.Name, err)
+			}
+		}
+
+		// Validate git_token / git_token_file if provided
+		if project.GitToken != "" || project.GitTokenFile != "" {
+			if project.GitToken != "" && project.GitTokenFile != "" {
+				return fmt.Errorf("project %d (%s): git_token and git_token_file are mutually exclusive", i+1, project.Name)
+			}
+			if !strings.HasPrefix(project.GitRepo, "https://") {
+				return fmt.Errorf("project %d (%s): git_token requires an https:// git_repo", i+1, project.Name)
+			}
+			if _, err := project.gitToken(); err != nil {
+				return fmt.Errorf("project %d (%s): %v", i+1, project.Name, err)
+			}
+		}
+
+		// Validate extra git arguments
+		if err := validateGitArgs("git_clone_args", project.GitCloneArgs); err != nil {
+			return fmt.Errorf("project %d (%s): %v", i+1, project.Name, err)
+		}
+		if err := validateGitArgs("git_pull_args", project.GitPullArgs); err != nil {
+			return fmt.Errorf("project %d (%s): %v", i+1, project.Name, err)
+		}
+
+		// Validate build_paths / ignore_paths patterns
+		if err := validatePathPatterns("build_paths", project.BuildPaths); err != nil {
+			return fmt.Errorf("project %d (%s): %v", i+1, project.Name, err)
+		}
+		if err := validatePathPatterns("ignore_paths", project.IgnorePaths); err != nil {
+			return fmt.Errorf("project %d (%s): %v", i+1, project.Name, err)
+		}
+		if err := validateTriggerFiles(project); err != nil {
+			return fmt.Errorf("project %d (%s): %v", i+1, project.Name, err)
+		}
+	}
+
+	return validateDependentProjects(cfg)
+}
+
+// validateDependentProjects checks that dependent_projects name other,
+// uniquely named projects and that following them never leads back to a
+// project already in the chain
+func validateDependentProjects(cfg *Config) error {
+	names := make(map[string]int)
+	for _, project := range cfg.Projects {
+		names[project.Name]++
+	}
+	for i, project := range cfg.Projects {
+		seen := make(map[string]bool)
+		for _, name := range project.DependentProjects {
+			switch {
+			case name == project.Name:
+				return fmt.Errorf("project %d (%s): dependent_projects cannot include the project itself", i+1, project.Name)
+			case names[name] == 0:
+				return fmt.Errorf("project %d (%s): dependent_projects: unknown project %q", i+1, project.Name, name)
+			case names[name] > 1:
+				return fmt.Errorf("project %d (%s): dependent_projects: project name %q is not unique", i+1, project.Name, name)
+			case seen[name]:
+				return fmt.Errorf("project %d (%s): dependent_projects: %q listed twice", i+1, project.Name, name)
+			}
+			seen[name] = true
+		}
+	}
+
+	// Depth-first search; reaching a project still on the stack is a cycle
+	const visiting, done = 1, 2
+	state := make(map[string]int)
+	var visit func(name string, chain []string) error
+	visit = func(name string, chain []string) error {
+		chain = append(chain, name)
+		switch state[name] {
+		case visiting:
+			return fmt.Errorf("dependent_projects cycle: %s", strings.Join(chain, " -> "))
+		case done:
+			return nil
+		}
+		state[name] = visiting
+		for _, dep := range cfg.FindProjectByName(name).DependentProjects {
+			if err := visit(dep, chain); err != nil {
+				return err
+			}
+		}
+		state[name] = done
+		return nil
+	}
+	for _, project := range cfg.Projects {
+		if err := visit(project.Name, nil); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// prefixWebhookPath places a webhook_path under webhook_prefix. Paths that are
+// already under the prefix are returned unchanged, so configs written with
+// full paths keep working when a prefix is added.
+func prefixWebhookPath(prefix, path string) string {
+	if prefix == "" || path == prefix || strings.HasPrefix(path, prefix+"/") {
+		return path
+	}
+	if !strings.HasPrefix(path, "/") {
+		path = "/" + path
+	}
+	return prefix + path
+}
+
+// validateBranchDeploys checks branch_deploys entries. Each entry needs its own
+// branch and local_path so concurrent branch deploys never share a checkout.
+func validateBranchDeploys(project *ProjectConfig) error {
+	branches := map[string]bool{project.GitBranch: true}
+	paths := map[string]bool{}
+	if project.LocalPath != "" {
+		paths[project.LocalPath] = true
+	}
+
+	for j, bd := range project.BranchDeploys {
+		if err := validateGitBranch(bd.GitBranch); err != nil {
+			return fmt.Errorf("branch_deploys[%d]: %v", j, err)
+		}
+		if branches[bd.GitBranch] {
+			return fmt.Errorf("branch_deploys[%d]: duplicate git_branch %s", j, bd.GitBranch)
+		}
+		branches[bd.GitBranch] = true
+
+		if bd.LocalPath == "" {
+			return fmt.Errorf("branch_deploys[%d] (%s): local_path is required", j, bd.GitBranch)
+		}
+		if paths[bd.LocalPath] {
+			return fmt.Errorf("branch_deploys[%d] (%s): local_path %s is already used by another branch", j, bd.GitBranch, bd.LocalPath)
+		}
+		paths[bd.LocalPath] = true
+	}
+	return nil
+}
+
+// validateBranchCommands checks branch_commands. Its branches share the
+// project's checkout, so they need git_repo to switch branches and must not
+// also have their own branch_deploys entry.
+func validateBranchCommands(project *ProjectConfig) error {
+	if len(project.BranchCommands) == 0 {
+		return nil
+	}
+	if project.GitRepo == "" {
+		return fmt.Errorf("branch_commands requires git_repo")
+	}
+
+	branches := make([]string, 0, len(project.BranchCommands))
+	for branch := range project.BranchCommands {
+		branches = append(branches, branch)
+	}
+	sort.Strings(branches)
+	for _, branch := range branches {
+		if err := validateGitBranch(branch); err != nil {
+			return fmt.Errorf("branch_commands: %v", err)
+		}
+		if strings.TrimSpace(project.BranchCommands[branch]) == "" {
+			return fmt.Errorf("branch_commands: empty command for branch %s", branch)
+		}
+		for _, bd := range project.BranchDeploys {
+			if bd.GitBranch == branch {
+				return fmt.Errorf("branch_commands: branch %s also has a branch_deploys entry", branch)
+			}
+		}
+	}
+	return nil
+}
+
+// validateMatchRepo checks that match_repo, if set, is a repository full
+// name such as "myorg/app"
+func validateMatchRepo(repo string) error {
+	if repo == "" {
+		return nil
+	}
+	if strings.HasPrefix(repo, "/") || strings.HasSuffix(repo, "/") || !strings.Contains(repo, "/") || strings.ContainsFunc(repo, unicode.IsSpace) {
+		return fmt.Errorf("invalid match_repo %q: expected owner/name", repo)
+	}
+	return nil
+}
+
+// ProjectForRepo returns the project on webhookPath whose match_repo is the
+// repository full name repo, compared case-insensitively, or nil if none is
+func (c *Config) ProjectForRepo(webhookPath, repo string) *ProjectConfig {
+	if repo == "" {
+		return nil
+	}
+	for i := range c.Projects {
+		project := &c.Projects[i]
+		if project.WebhookPath == webhookPath && strings.EqualFold(project.MatchRepo, repo) {
+			return project
+		}
+	}
+	return nil
+}
+
+// validateAllowedTriggers checks that each allowed_triggers entry is a
+// trigger kind (WEBHOOK, INTERNAL) or a full source of one such as
+// "INTERNAL (once)"
+func validateAllowedTriggers(triggers []string) error {
+	for _, trigger := range triggers {
+		kind, detail, hasDetail := strings.Cut(trigger, " (")
+		if kind != string(TriggerWebhook) && kind != string(TriggerInternal) {
+			return fmt.Errorf("invalid allowed_triggers entry %q: must start with %s or %s", trigger, TriggerWebhook, TriggerInternal)
+		}
+		if hasDetail && (len(detail) < 2 || !strings.HasSuffix(detail, ")")) {
+			return fmt.Errorf("invalid allowed_triggers entry %q: expected %s (<source>)", trigger, kind)
+		}
+	}
+	return nil
+}
+
+// validateDeployStrategy checks deploy_strategy. An atomic deploy switches
+// the execute_path symlink between worktrees of the local_path checkout, so it
+// needs git_repo and, for the project and each branch_deploys entry, an
+// execute_path outside local_path.
+func validateDeployStrategy(project *ProjectConfig) error {
+	switch project.DeployStrategy {
+	case DeployStrategyInPlace:
+		return nil
+	case DeployStrategyAtomic:
+	default:
+		return fmt.Errorf("invalid deploy_strategy %q: must be %s or %s", project.DeployStrategy, DeployStrategyInPlace, DeployStrategyAtomic)
 	}
 
+	if project.GitRepo == "" {
+		return fmt.Errorf("deploy_strategy atomic requires git_repo")
+	}
+	// Both act on local_path, which atomic deploys never serve
+	if project.ChownTo != "" {
+		return fmt.Errorf("deploy_strategy atomic does not support chown_to")
+	}
+	if len(project.BranchCommands) > 0 {
+		return fmt.Errorf("deploy_strategy atomic does not support branch_commands")
+	}
+
+	check := func(field, localPath, executePath string) error {
+		if executePath == "" {
+			return fmt.Errorf("deploy_strategy atomic requires %s (the symlink to switch)", field)
+		}
+		if isWithinPath(localPath, executePath) {
+			return fmt.Errorf("deploy_strategy atomic requires %s outside local_path", field)
+		}
+		return nil
+	}
+	if err := check("execute_path", project.LocalPath, project.ExecutePath); err != nil {
+		return err
+	}
+	for j, bd := range project.BranchDeploys {
+		if err := check(fmt.Sprintf("branch_deploys[%d].execute_path", j), bd.LocalPath, bd.ExecutePath); err != nil {
+			return err
+		}
+	}
 	return nil
 }
 
+// resolveTimeout applies the global default and cap to a project's
+// timeout_seconds. A cap also bounds projects that would otherwise run
+// without a timeout.
+func resolveTimeout(timeout, defaultTimeout, maxTimeout int) int {
+	if timeout == 0 {
+		timeout = defaultTimeout
+	}
+	if maxTimeout > 0 && (timeout == 0 || timeout > maxTimeout) {
+		timeout = maxTimeout
+	}
+	return timeout
+}
+
+// defaultSMTPTLS returns the smtp_tls mode used when none is configured:
+// implicit TLS on port 465, STARTTLS everywhere else
+func defaultSMTPTLS(port int) string {
+	if port == smtpImplicitTLSPort {
+		return SMTPTLSImplicit
+	}
+	return SMTPTLSStartTLS
+}
+
+// validateEmailConfig defaults smtp_tls and rejects mode/port combinations
+// that cannot work
+func validateEmailConfig(ec *EmailConfig) error {
+	if ec == nil {
+		return nil
+	}
+
+	if ec.SMTPTLS == "" {
+		ec.SMTPTLS = defaultSMTPTLS(ec.SMTPPort)
+	}
+
+	switch ec.SMTPTLS {
+	case SMTPTLSStartTLS, SMTPTLSNone:
+		if ec.SMTPPort == smtpImplicitTLSPort {
+			return fmt.Errorf("email_config: smtp_port %d expects implicit TLS; set smtp_tls: %s", ec.SMTPPort, SMTPTLSImplicit)
+		}
+	case SMTPTLSImplicit:
+	default:
+		return fmt.Errorf("email_config: invalid smtp_tls %q: must be %s, %s or %s", ec.SMTPTLS, SMTPTLSStartTLS, SMTPTLSImplicit, SMTPTLSNone)
+	}
+
+	var err error
+	if ec.SubjectTemplate != "" {
+		if ec.subjectTmpl, err = parseEmailTemplate("email_subject_template", ec.SubjectTemplate); err != nil {
+			return fmt.Errorf("email_config: invalid email_subject_template: %v", err)
+		}
+	}
+	if ec.BodyTemplate != "" {
+		if ec.bodyTmpl, err = parseEmailTemplate("email_body_template", ec.BodyTemplate); err != nil {
+			return fmt.Errorf("email_config: invalid email_body_template: %v", err)
+		}
+	}
+
+	return nil
+}
+
+// validateTeamsConfig requires an absolute http(s) webhook_url when
+// teams_config is present
+func validateTeamsConfig(tc *TeamsConfig) error {
+	if tc == nil {
+		return nil
+	}
+	u, err := url.Parse(tc.WebhookURL)
+	if err != nil || (u.Scheme != "https" && u.Scheme != "http") || u.Host == "" {
+		return fmt.Errorf("teams_config: webhook_url must be an http(s) URL")
+	}
+	return nil
+}
+
+// validateAbsolutePath rejects a relative path unless allow_relative_paths is
+// set. Empty paths are left to the field's own checks.
+func validateAbsolutePath(field, path string, allowRelative bool) error {
+	if path == "" || allowRelative || filepath.IsAbs(path) {
+		return nil
+	}
+	return fmt.Errorf("%s must be an absolute path, got %q (relative paths resolve against the daemon's working directory; set allow_relative_paths: true to allow them)", field, path)
+}
+
+// validateNotifyOn validates a notify_on policy value
+func validateNotifyOn(policy string) error {
+	switch policy {
+	case NotifyAlways, NotifyFailure, NotifyChange:
+		return nil
+	default:
+		return fmt.Errorf("invalid notify_on %q: must be %s, %s or %s", policy, NotifyAlways, NotifyFailure, NotifyChange)
+	}
+}
+
 // validateGitBranch validates that a git branch name is safe to use
 func validateGitBranch(branch string) error {
 	if branch == "" {
@@ -180,6 +1279,253 @@ func validateSSHKeyPath(keyPath string) error {
 	return nil
 }
 
+// ListenAddress returns the address the HTTP server binds to: listen_addr
+// and listen_port, or all interfaces when listen_addr is unset
+func (c *Config) ListenAddress() string {
+	return net.JoinHostPort(c.ListenAddr, strconv.Itoa(c.ListenPort))
+}
+
+// TLSEnabled reports whether the listener serves HTTPS
+func (c *Config) TLSEnabled() bool {
+	return c.TLSCertFile != "" && c.TLSKeyFile != ""
+}
+
+// RedactSecrets returns the global secret values masked in build logs
+func (c *Config) RedactSecrets() []string {
+	secrets := []string{c.AdminToken}
+	if c.EmailConfig != nil {
+		secrets = append(secrets, c.EmailConfig.SMTPPass)
+	}
+	if c.TeamsConfig != nil {
+		secrets = append(secrets, c.TeamsConfig.WebhookURL)
+	}
+	return secrets
+}
+
+// PathWarnings returns an advisory message for each project (and
+// branch_deploys entry) whose execute_path is neither local_path nor inside
+// it. Only reported with strict_paths; some setups build elsewhere on purpose.
+func (c *Config) PathWarnings() []string {
+	if !c.StrictPaths {
+		return nil
+	}
+	var warnings []string
+	check := func(name, localPath, executePath string) {
+		if localPath == "" || executePath == "" || isWithinPath(localPath, executePath) {
+			return
+		}
+		warnings = append(warnings, fmt.Sprintf("%s: execute_path %s is outside local_path %s", name, executePath, localPath))
+	}
+	for _, project := range c.Projects {
+		// Atomic deploys serve execute_path from worktrees outside local_path
+		if project.DeployStrategy == DeployStrategyAtomic {
+			continue
+		}
+		check(project.Name, project.LocalPath, project.ExecutePath)
+		for _, bd := range project.BranchDeploys {
+			check(project.Name+" (branch "+bd.GitBranch+")", bd.LocalPath, bd.ExecutePath)
+		}
+	}
+	return warnings
+}
+
+// PermissionWarnings returns a message for the config file at path and each
+// included file that group or others can access. They hold webhook secrets
+// and the commands SDeploy runs, so like SSH key files they should be mode
+// 0600. Mode bits are not checked on Windows.
+func (c *Config) PermissionWarnings(path string) []string {
+	if runtime.GOOS == "windows" {
+		return nil
+	}
+	var warnings []string
+	for _, file := range append([]string{path}, c.includedFiles...) {
+		info, err := os.Stat(file)
+		if err != nil {
+			continue
+		}
+		if mode := info.Mode().Perm(); mode&0077 != 0 {
+			warnings = append(warnings, fmt.Sprintf("config file %s is accessible by group or others (mode %04o); run chmod 600 %s", file, mode, file))
+		}
+	}
+	return warnings
+}
+
+// isWithinPath reports whether path is root or below it, comparing the
+// cleaned paths without resolving symlinks
+func isWithinPath(root, path string) bool {
+	rel, err := filepath.Rel(filepath.Clean(root), filepath.Clean(path))
+	return err == nil && rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator))
+}
+
+// RedactRegexps returns the built-in token patterns followed by redact_patterns
+func (c *Config) RedactRegexps() []*regexp.Regexp {
+	return append(append([]*regexp.Regexp{}, defaultRedactPatterns...), c.redactRegexps...)
+}
+
+// gitToken returns the HTTPS access token from git_token or git_token_file.
+// The file is read on every call so a rotated token is picked up without a
+// reload. Returns "" if neither is configured.
+func (p *ProjectConfig) gitToken() (string, error) {
+	if p.GitTokenFile == "" {
+		return p.GitToken, nil
+	}
+	data, err := os.ReadFile(p.GitTokenFile)
+	if err != nil {
+		return "", fmt.Errorf("git_token_file is not readable: %v", err)
+	}
+	token := strings.TrimSpace(string(data))
+	if token == "" {
+		return "", fmt.Errorf("git_token_file is empty: %s", p.GitTokenFile)
+	}
+	return token, nil
+}
+
+// validateListenAddr accepts an IP address (IPv6 optionally in brackets) or
+// localhost; the port belongs in listen_port
+func validateListenAddr(addr string) error {
+	host := strings.TrimSuffix(strings.TrimPrefix(addr, "["), "]")
+	if host == "localhost" || net.ParseIP(host) != nil {
+		return nil
+	}
+	return fmt.Errorf("invalid listen_addr %q: must be an IP address such as 127.0.0.1 or ::1, or localhost (set the port with listen_port)", addr)
+}
+
+// validateShell validates that the shell exists and is executable. Bare names
+// are looked up in PATH.
+func validateShell(shell string) error {
+	if _, err := exec.LookPath(shell); err != nil {
+		return fmt.Errorf("shell is not an executable file: %s", shell)
+	}
+	return nil
+}
+
+// validateRunAsUser validates that the run_as_user account exists
+func validateRunAsUser(name string) error {
+	if _, err := user.Lookup(name); err != nil {
+		return fmt.Errorf("run_as_user: unknown user %s", name)
+	}
+	return nil
+}
+
+// lookupOwner resolves a chown_to value, "user:group" or "user" (the user's
+// primary group), to numeric ids. Names and numeric ids are both accepted.
+func lookupOwner(owner string) (uid, gid int, err error) {
+	userName, groupName, hasGroup := strings.Cut(owner, ":")
+	if userName == "" || (hasGroup && groupName == "") {
+		return 0, 0, fmt.Errorf("chown_to: expected user:group, got %q", owner)
+	}
+
+	u, err := user.Lookup(userName)
+	if err != nil {
+		if u, err = user.LookupId(userName); err != nil {
+			return 0, 0, fmt.Errorf("chown_to: unknown user %s", userName)
+		}
+	}
+	if uid, err = strconv.Atoi(u.Uid); err != nil {
+		return 0, 0, fmt.Errorf("chown_to: invalid uid %s for user %s", u.Uid, userName)
+	}
+
+	gidStr := u.Gid
+	if hasGroup {
+		g, err := user.LookupGroup(groupName)
+		if err != nil {
+			if g, err = user.LookupGroupId(groupName); err != nil {
+				return 0, 0, fmt.Errorf("chown_to: unknown group %s", groupName)
+			}
+		}
+		gidStr = g.Gid
+	}
+	if gid, err = strconv.Atoi(gidStr); err != nil {
+		return 0, 0, fmt.Errorf("chown_to: invalid gid %s", gidStr)
+	}
+	return uid, gid, nil
+}
+
+// parseDirMode converts a dir_mode value such as 0755 or 2775 to a FileMode.
+// The owner needs full access for SDeploy to work in the directory.
+func parseDirMode(value string) (os.FileMode, error) {
+	if !dirModePattern.MatchString(value) {
+		return 0, fmt.Errorf("invalid dir_mode: %s (must be an octal value like 0755 or 2775)", value)
+	}
+	bits, _ := strconv.ParseUint(value, 8, 32)
+	if bits&0700 != 0700 {
+		return 0, fmt.Errorf("invalid dir_mode: %s (the owner needs rwx, e.g. 0755)", value)
+	}
+	mode := os.FileMode(bits & 0777)
+	if bits&04000 != 0 {
+		mode |= os.ModeSetuid
+	}
+	if bits&02000 != 0 {
+		mode |= os.ModeSetgid
+	}
+	if bits&01000 != 0 {
+		mode |= os.ModeSticky
+	}
+	return mode, nil
+}
+
+// DirPerm returns the mode directories are created with (dir_mode,
+// Defaults.DirMode if unset)
+func (p *ProjectConfig) DirPerm() os.FileMode {
+	if mode, err := parseDirMode(p.DirMode); err == nil {
+		return mode
+	}
+	mode, _ := parseDirMode(Defaults.DirMode)
+	return mode
+}
+
+// validateUmask validates a umask value: an octal mode or UmaskNone
+func validateUmask(umask string) error {
+	if umask == UmaskNone || umaskPattern.MatchString(umask) {
+		return nil
+	}
+	return fmt.Errorf("invalid umask: %s (must be an octal value like 0022, or %q)", umask, UmaskNone)
+}
+
+// validateGitArgs checks git_clone_args / git_pull_args. The arguments are
+// passed to git without a shell, so only empty entries and control
+// characters (which would corrupt the build log line) are rejected.
+func validateGitArgs(field string, args []string) error {
+	for _, arg := range args {
+		if arg == "" {
+			return fmt.Errorf("%s entries cannot be empty", field)
+		}
+		if strings.ContainsFunc(arg, unicode.IsControl) {
+			return fmt.Errorf("%s entry contains control characters: %q", field, arg)
+		}
+	}
+	return nil
+}
+
+// validateTimestampFormat checks that layout is a Go time layout (reference
+// time Mon Jan 2 15:04:05 MST 2006) that formats and parses back
+func validateTimestampFormat(layout string) error {
+	ref := time.Date(2001, time.February, 3, 4, 5, 6, 0, time.UTC)
+	formatted := ref.Format(layout)
+	if formatted == layout {
+		return fmt.Errorf("layout contains no date or time fields (use Go reference time 2006-01-02 15:04:05)")
+	}
+	if _, err := time.Parse(layout, formatted); err != nil {
+		return err
+	}
+	return nil
+}
+
+// validateKnownHostsPath validates that the known_hosts file exists and is a regular file
+func validateKnownHostsPath(path string) error {
+	info, err := os.Stat(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return fmt.Errorf("git_known_hosts_path file does not exist: %s", path)
+		}
+		return fmt.Errorf("git_known_hosts_path file error: %v", err)
+	}
+	if info.IsDir() {
+		return fmt.Errorf("git_known_hosts_path must be a file, not a directory: %s", path)
+	}
+	return nil
+}
+
 // FindConfigFile finds a config file based on the search order:
 // 1. Explicit path from -c flag
 // 2. Paths in ConfigSearchPaths (e.g., /etc/sdeploy.conf, ./sdeploy.conf)
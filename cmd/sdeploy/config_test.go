@@ -1,11 +1,19 @@
 package main
 
 import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
 	"fmt"
+	"math/big"
 	"os"
 	"path/filepath"
 	"strings"
 	"testing"
+	"time"
 )
 
 // TestLoadConfigValidFile tests loading a valid YAML config file
@@ -153,6 +161,58 @@ projects:
 	}
 }
 
+// TestLoadConfigSharedWebhookPath tests that projects may share a
+// webhook_path only when each sets a distinct match_repo
+func TestLoadConfigSharedWebhookPath(t *testing.T) {
+	tmpDir := t.TempDir()
+	configPath := filepath.Join(tmpDir, "sdeploy.conf")
+
+	tests := []struct {
+		name    string
+		repo1   string
+		repo2   string
+		wantErr string
+	}{
+		{"distinct repos", "myorg/frontend", "myorg/backend", ""},
+		{"one without match_repo", "myorg/frontend", "", "duplicate webhook_path: /hooks/ci"},
+		{"same repo", "myorg/app", "MyOrg/App", "duplicate match_repo MyOrg/App on webhook_path /hooks/ci"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			config := `
+projects:
+  - name: First
+    webhook_path: /hooks/ci
+    webhook_secret: secret1
+    match_repo: '` + tt.repo1 + `'
+    execute_command: echo first
+  - name: Second
+    webhook_path: /hooks/ci
+    webhook_secret: secret2
+    match_repo: '` + tt.repo2 + `'
+    execute_command: echo second
+`
+			if err := os.WriteFile(configPath, []byte(config), 0644); err != nil {
+				t.Fatalf("Failed to create test config file: %v", err)
+			}
+			cfg, err := LoadConfig(configPath)
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Fatalf("LoadConfig failed: %v", err)
+				}
+				if got := cfg.ProjectForRepo("/hooks/ci", "MYORG/BACKEND"); got == nil || got.Name != "Second" {
+					t.Errorf("Expected Second for myorg/backend, got %v", got)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("Expected error containing %q, got %v", tt.wantErr, err)
+			}
+		})
+	}
+}
+
 // TestLoadConfigDefaultPort tests default listen port
 func TestLoadConfigDefaultPort(t *testing.T) {
 	tmpDir := t.TempDir()
@@ -374,6 +434,9 @@ projects:
 	if cfg.Projects[0].GitBranch != Defaults.GitBranch {
 		t.Errorf("Expected default GitBranch '%s', got '%s'", Defaults.GitBranch, cfg.Projects[0].GitBranch)
 	}
+	if !cfg.Projects[0].remoteBranch {
+		t.Error("Expected an omitted git_branch to follow the remote default branch")
+	}
 }
 
 // TestGitBranchNotOverwritten tests that a set git_branch is not overwritten
@@ -405,6 +468,9 @@ projects:
 	if cfg.Projects[0].GitBranch != "develop" {
 		t.Errorf("Expected GitBranch 'develop', got '%s'", cfg.Projects[0].GitBranch)
 	}
+	if cfg.Projects[0].remoteBranch {
+		t.Error("Expected a configured git_branch not to follow the remote default branch")
+	}
 }
 
 // TestLoadConfigWithGitSSHKeyPath tests loading config with git_ssh_key_path
@@ -666,3 +732,1544 @@ projects:
 		t.Errorf("Expected third env_variable to be 'VITE_API_BASE_URL=https://api.example.com/', got '%s'", project.EnvVariables[2])
 	}
 }
+
+// TestLoadConfigInclude tests merging projects from included files
+func TestLoadConfigInclude(t *testing.T) {
+	tmpDir := t.TempDir()
+	configPath := filepath.Join(tmpDir, "sdeploy.conf")
+	confDir := filepath.Join(tmpDir, "conf.d")
+	if err := os.MkdirAll(confDir, 0755); err != nil {
+		t.Fatalf("Failed to create include dir: %v", err)
+	}
+
+	mainConfig := `
+include:
+  - conf.d/*.conf
+projects:
+  - name: Main
+    webhook_path: /hooks/main
+    webhook_secret: secret0
+    execute_command: echo main
+`
+	teamA := `
+projects:
+  - name: TeamA
+    webhook_path: /hooks/team-a
+    webhook_secret: secretA
+    execute_command: echo a
+`
+	teamB := `
+projects:
+  - name: TeamB
+    webhook_path: /hooks/team-b
+    webhook_secret: secretB
+    execute_command: echo b
+`
+
+	if err := os.WriteFile(configPath, []byte(mainConfig), 0644); err != nil {
+		t.Fatalf("Failed to create test config file: %v", err)
+	}
+	if err := os.WriteFile(filepath.Join(confDir, "a.conf"), []byte(teamA), 0644); err != nil {
+		t.Fatalf("Failed to create include file: %v", err)
+	}
+	if err := os.WriteFile(filepath.Join(confDir, "b.conf"), []byte(teamB), 0644); err != nil {
+		t.Fatalf("Failed to create include file: %v", err)
+	}
+
+	cfg, err := LoadConfig(configPath)
+	if err != nil {
+		t.Fatalf("LoadConfig failed: %v", err)
+	}
+
+	if len(cfg.Projects) != 3 {
+		t.Fatalf("Expected 3 projects, got %d", len(cfg.Projects))
+	}
+	names := []string{cfg.Projects[0].Name, cfg.Projects[1].Name, cfg.Projects[2].Name}
+	if strings.Join(names, ",") != "Main,TeamA,TeamB" {
+		t.Errorf("Expected projects Main,TeamA,TeamB in order, got %v", names)
+	}
+
+	// Included projects get the same defaults as the main file
+	if cfg.Projects[1].GitBranch != Defaults.GitBranch {
+		t.Errorf("Expected included project to default git_branch to %s, got %s", Defaults.GitBranch, cfg.Projects[1].GitBranch)
+	}
+
+	if len(cfg.IncludedFiles()) != 2 {
+		t.Errorf("Expected 2 included files, got %v", cfg.IncludedFiles())
+	}
+}
+
+// TestLoadConfigIncludeDuplicateWebhookPath tests duplicate detection across included files
+func TestLoadConfigIncludeDuplicateWebhookPath(t *testing.T) {
+	tmpDir := t.TempDir()
+	configPath := filepath.Join(tmpDir, "sdeploy.conf")
+
+	mainConfig := `
+include:
+  - team.conf
+projects:
+  - name: Main
+    webhook_path: /hooks/shared
+    webhook_secret: secret0
+    execute_command: echo main
+`
+	team := `
+projects:
+  - name: Team
+    webhook_path: /hooks/shared
+    webhook_secret: secret1
+    execute_command: echo team
+`
+
+	if err := os.WriteFile(configPath, []byte(mainConfig), 0644); err != nil {
+		t.Fatalf("Failed to create test config file: %v", err)
+	}
+	if err := os.WriteFile(filepath.Join(tmpDir, "team.conf"), []byte(team), 0644); err != nil {
+		t.Fatalf("Failed to create include file: %v", err)
+	}
+
+	_, err := LoadConfig(configPath)
+	if err == nil || !strings.Contains(err.Error(), "duplicate webhook_path") {
+		t.Errorf("Expected duplicate webhook_path error, got %v", err)
+	}
+}
+
+// TestLoadConfigIncludeMissingFile tests that a missing literal include path fails
+func TestLoadConfigIncludeMissingFile(t *testing.T) {
+	tmpDir := t.TempDir()
+	configPath := filepath.Join(tmpDir, "sdeploy.conf")
+
+	mainConfig := `
+include:
+  - missing.conf
+  - conf.d/*.conf
+projects: []
+`
+	if err := os.WriteFile(configPath, []byte(mainConfig), 0644); err != nil {
+		t.Fatalf("Failed to create test config file: %v", err)
+	}
+
+	_, err := LoadConfig(configPath)
+	if err == nil || !strings.Contains(err.Error(), "missing.conf") {
+		t.Errorf("Expected error about missing include file, got %v", err)
+	}
+}
+
+// TestLoadConfigShutdownGraceSeconds tests the shutdown grace default and validation
+func TestLoadConfigShutdownGraceSeconds(t *testing.T) {
+	tmpDir := t.TempDir()
+	configPath := filepath.Join(tmpDir, "sdeploy.conf")
+
+	if err := os.WriteFile(configPath, []byte("projects: []\n"), 0644); err != nil {
+		t.Fatalf("Failed to create test config file: %v", err)
+	}
+	cfg, err := LoadConfig(configPath)
+	if err != nil {
+		t.Fatalf("LoadConfig failed: %v", err)
+	}
+	if cfg.ShutdownGraceSeconds != Defaults.ShutdownGraceSeconds {
+		t.Errorf("Expected default shutdown grace %d, got %d", Defaults.ShutdownGraceSeconds, cfg.ShutdownGraceSeconds)
+	}
+
+	if err := os.WriteFile(configPath, []byte("shutdown_grace_seconds: 120\nprojects: []\n"), 0644); err != nil {
+		t.Fatalf("Failed to create test config file: %v", err)
+	}
+	cfg, err = LoadConfig(configPath)
+	if err != nil {
+		t.Fatalf("LoadConfig failed: %v", err)
+	}
+	if cfg.ShutdownGraceSeconds != 120 {
+		t.Errorf("Expected shutdown grace 120, got %d", cfg.ShutdownGraceSeconds)
+	}
+
+	if err := os.WriteFile(configPath, []byte("shutdown_grace_seconds: -1\nprojects: []\n"), 0644); err != nil {
+		t.Fatalf("Failed to create test config file: %v", err)
+	}
+	if _, err := LoadConfig(configPath); err == nil {
+		t.Error("Expected error for negative shutdown_grace_seconds")
+	}
+}
+
+// TestLoadConfigKnownHostsPath tests validation of git_known_hosts_path
+func TestLoadConfigKnownHostsPath(t *testing.T) {
+	tmpDir := t.TempDir()
+	configPath := filepath.Join(tmpDir, "sdeploy.conf")
+	knownHosts := filepath.Join(tmpDir, "known_hosts")
+	if err := os.WriteFile(knownHosts, []byte("github.com ssh-ed25519 AAAA\n"), 0644); err != nil {
+		t.Fatalf("Failed to create known_hosts: %v", err)
+	}
+
+	config := fmt.Sprintf(`
+projects:
+  - name: Pinned
+    webhook_path: /hooks/pinned
+    webhook_secret: secret
+    execute_command: echo test
+    git_known_hosts_path: %s
+`, knownHosts)
+	if err := os.WriteFile(configPath, []byte(config), 0644); err != nil {
+		t.Fatalf("Failed to create test config file: %v", err)
+	}
+	cfg, err := LoadConfig(configPath)
+	if err != nil {
+		t.Fatalf("LoadConfig failed: %v", err)
+	}
+	if cfg.Projects[0].GitKnownHostsPath != knownHosts {
+		t.Errorf("Expected known hosts path %s, got %s", knownHosts, cfg.Projects[0].GitKnownHostsPath)
+	}
+
+	config = strings.Replace(config, knownHosts, filepath.Join(tmpDir, "missing"), 1)
+	if err := os.WriteFile(configPath, []byte(config), 0644); err != nil {
+		t.Fatalf("Failed to create test config file: %v", err)
+	}
+	if _, err := LoadConfig(configPath); err == nil || !strings.Contains(err.Error(), "git_known_hosts_path") {
+		t.Errorf("Expected git_known_hosts_path error, got %v", err)
+	}
+}
+
+// TestLoadConfigNotifyOn tests the global default and per-project override of notify_on
+func TestLoadConfigNotifyOn(t *testing.T) {
+	tmpDir := t.TempDir()
+	configPath := filepath.Join(tmpDir, "sdeploy.conf")
+
+	config := `
+notify_on: failure
+projects:
+  - name: Inherits
+    webhook_path: /hooks/inherits
+    webhook_secret: secret
+    execute_command: echo test
+  - name: Overrides
+    webhook_path: /hooks/overrides
+    webhook_secret: secret
+    execute_command: echo test
+    notify_on: always
+`
+	if err := os.WriteFile(configPath, []byte(config), 0644); err != nil {
+		t.Fatalf("Failed to create test config file: %v", err)
+	}
+	cfg, err := LoadConfig(configPath)
+	if err != nil {
+		t.Fatalf("LoadConfig failed: %v", err)
+	}
+	if cfg.Projects[0].NotifyOn != NotifyFailure {
+		t.Errorf("Expected inherited notify_on %q, got %q", NotifyFailure, cfg.Projects[0].NotifyOn)
+	}
+	if cfg.Projects[1].NotifyOn != NotifyAlways {
+		t.Errorf("Expected project notify_on %q, got %q", NotifyAlways, cfg.Projects[1].NotifyOn)
+	}
+
+	if err := os.WriteFile(configPath, []byte("projects: []\n"), 0644); err != nil {
+		t.Fatalf("Failed to create test config file: %v", err)
+	}
+	cfg, err = LoadConfig(configPath)
+	if err != nil {
+		t.Fatalf("LoadConfig failed: %v", err)
+	}
+	if cfg.NotifyOn != NotifyAlways {
+		t.Errorf("Expected default notify_on %q, got %q", NotifyAlways, cfg.NotifyOn)
+	}
+
+	if err := os.WriteFile(configPath, []byte("notify_on: sometimes\nprojects: []\n"), 0644); err != nil {
+		t.Fatalf("Failed to create test config file: %v", err)
+	}
+	if _, err := LoadConfig(configPath); err == nil {
+		t.Error("Expected error for invalid notify_on")
+	}
+}
+
+// TestValidateEmailConfigSMTPTLS tests smtp_tls defaults and validation
+func TestValidateEmailConfigSMTPTLS(t *testing.T) {
+	tests := []struct {
+		name     string
+		port     int
+		mode     string
+		expected string
+		wantErr  bool
+	}{
+		{"default on 587", 587, "", SMTPTLSStartTLS, false},
+		{"default on 465", 465, "", SMTPTLSImplicit, false},
+		{"explicit tls", 2465, SMTPTLSImplicit, SMTPTLSImplicit, false},
+		{"none", 25, SMTPTLSNone, SMTPTLSNone, false},
+		{"starttls on 465", 465, SMTPTLSStartTLS, "", true},
+		{"invalid mode", 587, "ssl", "", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ec := &EmailConfig{SMTPPort: tt.port, SMTPTLS: tt.mode}
+			err := validateEmailConfig(ec)
+			if tt.wantErr {
+				if err == nil {
+					t.Error("Expected validation error")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			if ec.SMTPTLS != tt.expected {
+				t.Errorf("Expected smtp_tls %q, got %q", tt.expected, ec.SMTPTLS)
+			}
+		})
+	}
+}
+
+// TestResolveTimeout tests the global default and cap for timeout_seconds
+func TestResolveTimeout(t *testing.T) {
+	tests := []struct {
+		name                    string
+		timeout, defaultT, maxT int
+		expected                int
+	}{
+		{"no globals", 0, 0, 0, 0},
+		{"project value kept", 60, 300, 0, 60},
+		{"default applied", 0, 300, 0, 300},
+		{"capped", 900, 0, 600, 600},
+		{"default capped", 0, 900, 600, 600},
+		{"unbounded capped", 0, 0, 600, 600},
+		{"under cap", 120, 0, 600, 120},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := resolveTimeout(tt.timeout, tt.defaultT, tt.maxT); got != tt.expected {
+				t.Errorf("Expected %d, got %d", tt.expected, got)
+			}
+		})
+	}
+}
+
+// TestLoadConfigTimeoutDefaults tests that default and max timeouts reach projects
+func TestLoadConfigTimeoutDefaults(t *testing.T) {
+	tmpDir := t.TempDir()
+	configPath := filepath.Join(tmpDir, "sdeploy.conf")
+
+	config := `
+default_timeout_seconds: 300
+max_timeout_seconds: 600
+projects:
+  - name: Default
+    webhook_path: /hooks/default
+    webhook_secret: secret
+    execute_command: echo test
+  - name: Long
+    webhook_path: /hooks/long
+    webhook_secret: secret
+    execute_command: echo test
+    timeout_seconds: 3600
+  - name: Git
+    webhook_path: /hooks/git
+    webhook_secret: secret
+    execute_command: echo test
+    git_timeout_seconds: 60
+`
+	if err := os.WriteFile(configPath, []byte(config), 0644); err != nil {
+		t.Fatalf("Failed to create test config file: %v", err)
+	}
+	cfg, err := LoadConfig(configPath)
+	if err != nil {
+		t.Fatalf("LoadConfig failed: %v", err)
+	}
+	if cfg.Projects[0].TimeoutSeconds != 300 {
+		t.Errorf("Expected default timeout 300, got %d", cfg.Projects[0].TimeoutSeconds)
+	}
+	if cfg.Projects[1].TimeoutSeconds != 600 {
+		t.Errorf("Expected capped timeout 600, got %d", cfg.Projects[1].TimeoutSeconds)
+	}
+	if cfg.Projects[0].GitTimeoutSeconds != 300 {
+		t.Errorf("Expected git timeout to follow timeout_seconds (300), got %d", cfg.Projects[0].GitTimeoutSeconds)
+	}
+	if cfg.Projects[2].GitTimeoutSeconds != 60 {
+		t.Errorf("Expected git timeout 60, got %d", cfg.Projects[2].GitTimeoutSeconds)
+	}
+
+	if err := os.WriteFile(configPath, []byte("max_timeout_seconds: -1\nprojects: []\n"), 0644); err != nil {
+		t.Fatalf("Failed to create test config file: %v", err)
+	}
+	if _, err := LoadConfig(configPath); err == nil {
+		t.Error("Expected error for negative max_timeout_seconds")
+	}
+}
+
+// TestLoadConfigMaxPayloadBytes tests the default and validation of max_payload_bytes
+func TestLoadConfigMaxPayloadBytes(t *testing.T) {
+	tmpDir := t.TempDir()
+	configPath := filepath.Join(tmpDir, "sdeploy.conf")
+
+	if err := os.WriteFile(configPath, []byte("projects: []\n"), 0644); err != nil {
+		t.Fatalf("Failed to create test config file: %v", err)
+	}
+	cfg, err := LoadConfig(configPath)
+	if err != nil {
+		t.Fatalf("LoadConfig failed: %v", err)
+	}
+	if cfg.MaxPayloadBytes != Defaults.MaxPayloadBytes {
+		t.Errorf("Expected default max payload %d, got %d", Defaults.MaxPayloadBytes, cfg.MaxPayloadBytes)
+	}
+
+	if err := os.WriteFile(configPath, []byte("max_payload_bytes: -1\nprojects: []\n"), 0644); err != nil {
+		t.Fatalf("Failed to create test config file: %v", err)
+	}
+	if _, err := LoadConfig(configPath); err == nil {
+		t.Error("Expected error for negative max_payload_bytes")
+	}
+}
+
+// TestProjectForBranch tests selection of branch_deploys entries
+func TestProjectForBranch(t *testing.T) {
+	project := &ProjectConfig{
+		Name:           "Site",
+		WebhookPath:    "/hooks/site",
+		GitBranch:      "main",
+		LocalPath:      "/var/www/prod",
+		ExecutePath:    "/var/www/prod/app",
+		ExecuteCommand: "make deploy",
+		BranchDeploys: []BranchDeploy{
+			{GitBranch: "staging", LocalPath: "/var/www/staging"},
+			{GitBranch: "preview", LocalPath: "/var/www/preview", ExecuteCommand: "make preview"},
+		},
+	}
+
+	if got := project.ForBranch("main"); got != project {
+		t.Error("Expected the default branch to return the project itself")
+	}
+	if got := project.ForBranch(""); got != project {
+		t.Error("Expected an empty branch to return the project itself")
+	}
+	if got := project.ForBranch("feature"); got != nil {
+		t.Errorf("Expected nil for an unknown branch, got %+v", got)
+	}
+
+	staging := project.ForBranch("staging")
+	if staging == nil {
+		t.Fatal("Expected staging entry")
+	}
+	if staging.GitBranch != "staging" || staging.LocalPath != "/var/www/staging" || staging.ExecutePath != "" {
+		t.Errorf("Unexpected staging settings: %+v", staging)
+	}
+	if staging.ExecuteCommand != "make deploy" {
+		t.Errorf("Expected staging to inherit execute_command, got %q", staging.ExecuteCommand)
+	}
+	if staging.LockKey() == project.LockKey() {
+		t.Error("Expected branch deploys to use their own lock")
+	}
+	if staging.DeployKey() == project.DeployKey() {
+		t.Error("Expected branch deploys to have their own deploy key")
+	}
+
+	if preview := project.ForBranch("preview"); preview.ExecuteCommand != "make preview" {
+		t.Errorf("Expected preview execute_command override, got %q", preview.ExecuteCommand)
+	}
+	if project.GitBranch != "main" || project.LocalPath != "/var/www/prod" {
+		t.Error("Expected ForBranch not to modify the project")
+	}
+}
+
+// TestProjectForBranchCommands tests branch_commands selection in the shared checkout
+func TestProjectForBranchCommands(t *testing.T) {
+	project := &ProjectConfig{
+		Name:           "Site",
+		WebhookPath:    "/hooks/site",
+		GitBranch:      "main",
+		LocalPath:      "/var/www/app",
+		ExecuteCommand: "make deploy",
+		BranchCommands: map[string]string{"main": "make prod", "develop": "make staging"},
+	}
+
+	prod := project.ForBranch("main")
+	if prod.ExecuteCommand != "make prod" || prod.GitBranch != "main" || prod.DeployKey() != project.DeployKey() {
+		t.Errorf("Unexpected main settings: %+v", prod)
+	}
+
+	develop := project.ForBranch("develop")
+	if develop == nil {
+		t.Fatal("Expected develop to deploy")
+	}
+	if develop.ExecuteCommand != "make staging" || develop.GitBranch != "develop" || develop.LocalPath != "/var/www/app" {
+		t.Errorf("Unexpected develop settings: %+v", develop)
+	}
+	if develop.LockKey() != project.LockKey() {
+		t.Error("Expected branch_commands to share the checkout's lock")
+	}
+	if develop.DeployKey() == project.DeployKey() {
+		t.Error("Expected branch_commands to track their own results")
+	}
+
+	if project.ExecuteCommand != "make deploy" || project.GitBranch != "main" {
+		t.Error("Expected ForBranch not to modify the project")
+	}
+}
+
+// TestLoadConfigBranchDeploysValidation tests rejection of invalid branch_deploys entries
+func TestLoadConfigBranchDeploysValidation(t *testing.T) {
+	tests := []struct {
+		name    string
+		entries string
+	}{
+		{"duplicate of default branch", "      - git_branch: main\n        local_path: /var/www/other\n"},
+		{"missing local_path", "      - git_branch: staging\n"},
+		{"shared local_path", "      - git_branch: staging\n        local_path: /var/www/prod\n"},
+		{"invalid branch", "      - git_branch: \"bad branch\"\n        local_path: /var/www/staging\n"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			configPath := filepath.Join(t.TempDir(), "sdeploy.conf")
+			config := `
+projects:
+  - name: Site
+    webhook_path: /hooks/site
+    webhook_secret: secret
+    local_path: /var/www/prod
+    execute_command: make deploy
+    branch_deploys:
+` + tt.entries
+			if err := os.WriteFile(configPath, []byte(config), 0644); err != nil {
+				t.Fatalf("Failed to create test config file: %v", err)
+			}
+			if _, err := LoadConfig(configPath); err == nil {
+				t.Error("Expected validation error")
+			}
+		})
+	}
+}
+
+// TestLoadConfigShell tests shell inheritance and validation
+func TestLoadConfigShell(t *testing.T) {
+	tmpDir := t.TempDir()
+	configPath := filepath.Join(tmpDir, "sdeploy.conf")
+
+	globalShell := filepath.Join(tmpDir, "global-sh")
+	projectShell := filepath.Join(tmpDir, "project-sh")
+	notExecutable := filepath.Join(tmpDir, "not-executable")
+	for _, path := range []string{globalShell, projectShell} {
+		if err := os.WriteFile(path, []byte("#!/bin/sh\n"), 0755); err != nil {
+			t.Fatalf("Failed to create shell: %v", err)
+		}
+	}
+	if err := os.WriteFile(notExecutable, []byte("#!/bin/sh\n"), 0644); err != nil {
+		t.Fatalf("Failed to create shell: %v", err)
+	}
+
+	config := `
+shell: ` + globalShell + `
+projects:
+  - name: Inherit
+    webhook_path: /hooks/inherit
+    webhook_secret: secret
+    execute_command: echo test
+  - name: Override
+    webhook_path: /hooks/override
+    webhook_secret: secret
+    execute_command: echo test
+    shell: ` + projectShell + `
+`
+	if err := os.WriteFile(configPath, []byte(config), 0644); err != nil {
+		t.Fatalf("Failed to create test config file: %v", err)
+	}
+	cfg, err := LoadConfig(configPath)
+	if err != nil {
+		t.Fatalf("LoadConfig failed: %v", err)
+	}
+	if cfg.Projects[0].Shell != globalShell {
+		t.Errorf("Expected inherited shell %s, got %s", globalShell, cfg.Projects[0].Shell)
+	}
+	if cfg.Projects[1].Shell != projectShell {
+		t.Errorf("Expected project shell %s, got %s", projectShell, cfg.Projects[1].Shell)
+	}
+
+	tests := []struct {
+		name   string
+		config string
+	}{
+		{"missing global shell", "shell: " + filepath.Join(tmpDir, "missing") + "\nprojects: []\n"},
+		{"non-executable global shell", "shell: " + notExecutable + "\nprojects: []\n"},
+		{"directory as shell", "shell: " + tmpDir + "\nprojects: []\n"},
+		{"non-executable project shell", `
+projects:
+  - name: Broken
+    webhook_path: /hooks/broken
+    webhook_secret: secret
+    execute_command: echo test
+    shell: ` + notExecutable + `
+`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := os.WriteFile(configPath, []byte(tt.config), 0644); err != nil {
+				t.Fatalf("Failed to create test config file: %v", err)
+			}
+			_, err := LoadConfig(configPath)
+			if err == nil || !strings.Contains(err.Error(), "shell") {
+				t.Errorf("Expected shell validation error, got %v", err)
+			}
+		})
+	}
+}
+
+// TestLoadConfigUmask tests the umask default and validation
+func TestLoadConfigUmask(t *testing.T) {
+	tmpDir := t.TempDir()
+	configPath := filepath.Join(tmpDir, "sdeploy.conf")
+
+	tests := []struct {
+		umask     string
+		expected  string
+		expectErr bool
+	}{
+		{"", Defaults.Umask, false},
+		{"0027", "0027", false},
+		{"077", "077", false},
+		{`"none"`, UmaskNone, false},
+		{"0999", "", true},
+		{"22", "", true},
+		{"always", "", true},
+	}
+
+	for _, tt := range tests {
+		config := `
+projects:
+  - name: App
+    webhook_path: /hooks/app
+    webhook_secret: secret
+    execute_command: echo test
+`
+		if tt.umask != "" {
+			config += "    umask: " + tt.umask + "\n"
+		}
+		if err := os.WriteFile(configPath, []byte(config), 0644); err != nil {
+			t.Fatalf("Failed to create test config file: %v", err)
+		}
+
+		cfg, err := LoadConfig(configPath)
+		if tt.expectErr {
+			if err == nil {
+				t.Errorf("umask %s: expected error", tt.umask)
+			}
+			continue
+		}
+		if err != nil {
+			t.Fatalf("umask %s: LoadConfig failed: %v", tt.umask, err)
+		}
+		if cfg.Projects[0].Umask != tt.expected {
+			t.Errorf("umask %s: expected %q, got %q", tt.umask, tt.expected, cfg.Projects[0].Umask)
+		}
+	}
+}
+
+// TestLoadConfigNotifyRetry tests defaults and validation of the notification retry settings
+func TestLoadConfigNotifyRetry(t *testing.T) {
+	tmpDir := t.TempDir()
+	configPath := filepath.Join(tmpDir, "sdeploy.conf")
+
+	if err := os.WriteFile(configPath, []byte("projects: []\n"), 0644); err != nil {
+		t.Fatalf("Failed to create test config file: %v", err)
+	}
+	cfg, err := LoadConfig(configPath)
+	if err != nil {
+		t.Fatalf("LoadConfig failed: %v", err)
+	}
+	if cfg.NotifyRetryCount != Defaults.NotifyRetryCount || cfg.NotifyRetryBaseMS != Defaults.NotifyRetryBaseMS {
+		t.Errorf("Expected default retry policy, got count=%d base=%d", cfg.NotifyRetryCount, cfg.NotifyRetryBaseMS)
+	}
+
+	for _, config := range []string{"notify_retry_count: -1\nprojects: []\n", "notify_retry_base_ms: -1\nprojects: []\n"} {
+		if err := os.WriteFile(configPath, []byte(config), 0644); err != nil {
+			t.Fatalf("Failed to create test config file: %v", err)
+		}
+		if _, err := LoadConfig(configPath); err == nil {
+			t.Errorf("Expected error for %q", config)
+		}
+	}
+}
+
+// TestLoadConfigSHALength tests the default and range validation of sha_length
+func TestLoadConfigSHALength(t *testing.T) {
+	tmpDir := t.TempDir()
+	configPath := filepath.Join(tmpDir, "sdeploy.conf")
+
+	tests := []struct {
+		config    string
+		expected  int
+		expectErr bool
+	}{
+		{"projects: []\n", Defaults.SHALength, false},
+		{"sha_length: 12\nprojects: []\n", 12, false},
+		{"sha_length: 4\nprojects: []\n", 4, false},
+		{"sha_length: 40\nprojects: []\n", 40, false},
+		{"sha_length: 3\nprojects: []\n", 0, true},
+		{"sha_length: 41\nprojects: []\n", 0, true},
+		{"sha_length: -1\nprojects: []\n", 0, true},
+	}
+
+	for _, tt := range tests {
+		if err := os.WriteFile(configPath, []byte(tt.config), 0644); err != nil {
+			t.Fatalf("Failed to create test config file: %v", err)
+		}
+		cfg, err := LoadConfig(configPath)
+		if tt.expectErr {
+			if err == nil {
+				t.Errorf("Expected error for %q", tt.config)
+			}
+			continue
+		}
+		if err != nil {
+			t.Fatalf("LoadConfig(%q) failed: %v", tt.config, err)
+		}
+		if cfg.SHALength != tt.expected {
+			t.Errorf("Expected sha_length %d, got %d", tt.expected, cfg.SHALength)
+		}
+	}
+}
+
+// TestPrefixWebhookPath tests placing webhook paths under webhook_prefix
+func TestPrefixWebhookPath(t *testing.T) {
+	tests := []struct {
+		prefix   string
+		path     string
+		expected string
+	}{
+		{"", "/hooks/app", "/hooks/app"},
+		{"/webhooks", "/hooks/app", "/webhooks/hooks/app"},
+		{"/webhooks", "hooks/app", "/webhooks/hooks/app"},
+		{"/webhooks", "/metrics", "/webhooks/metrics"},
+		{"/webhooks", "/webhooks/app", "/webhooks/app"},
+		{"/webhooks", "/webhooks", "/webhooks"},
+		{"/webhooks", "/webhooksapp", "/webhooks/webhooksapp"},
+	}
+
+	for _, tt := range tests {
+		if got := prefixWebhookPath(tt.prefix, tt.path); got != tt.expected {
+			t.Errorf("prefixWebhookPath(%q, %q) = %q, expected %q", tt.prefix, tt.path, got, tt.expected)
+		}
+	}
+}
+
+// TestLoadConfigWebhookPrefix tests that webhook_prefix is applied to projects and validated
+func TestLoadConfigWebhookPrefix(t *testing.T) {
+	tmpDir := t.TempDir()
+	configPath := filepath.Join(tmpDir, "sdeploy.conf")
+
+	config := `
+webhook_prefix: /webhooks/
+projects:
+  - name: App
+    webhook_path: /hooks/app
+    webhook_secret: secret
+    execute_command: echo test
+  - name: Existing
+    webhook_path: /webhooks/existing
+    webhook_secret: secret
+    execute_command: echo test
+`
+	if err := os.WriteFile(configPath, []byte(config), 0644); err != nil {
+		t.Fatalf("Failed to create test config file: %v", err)
+	}
+	cfg, err := LoadConfig(configPath)
+	if err != nil {
+		t.Fatalf("LoadConfig failed: %v", err)
+	}
+	if cfg.WebhookPrefix != "/webhooks" {
+		t.Errorf("Expected trailing slash to be trimmed, got %q", cfg.WebhookPrefix)
+	}
+	if cfg.Projects[0].WebhookPath != "/webhooks/hooks/app" {
+		t.Errorf("Expected prefixed path, got %q", cfg.Projects[0].WebhookPath)
+	}
+	if cfg.Projects[1].WebhookPath != "/webhooks/existing" {
+		t.Errorf("Expected already-prefixed path to be unchanged, got %q", cfg.Projects[1].WebhookPath)
+	}
+
+	// A short and a full path resolving to the same endpoint are duplicates
+	duplicate := strings.Replace(config, "/webhooks/existing", "/webhooks/hooks/app", 1)
+	if err := os.WriteFile(configPath, []byte(duplicate), 0644); err != nil {
+		t.Fatalf("Failed to create test config file: %v", err)
+	}
+	if _, err := LoadConfig(configPath); err == nil || !strings.Contains(err.Error(), "duplicate webhook_path") {
+		t.Errorf("Expected duplicate webhook_path error, got %v", err)
+	}
+
+	for _, prefix := range []string{"webhooks", "/"} {
+		if err := os.WriteFile(configPath, []byte("webhook_prefix: "+prefix+"\nprojects: []\n"), 0644); err != nil {
+			t.Fatalf("Failed to create test config file: %v", err)
+		}
+		if _, err := LoadConfig(configPath); err == nil {
+			t.Errorf("Expected error for webhook_prefix %q", prefix)
+		}
+	}
+}
+
+// TestLoadConfigDirtyTreeAction tests the default and validation of dirty_tree_action
+func TestLoadConfigDirtyTreeAction(t *testing.T) {
+	tmpDir := t.TempDir()
+	configPath := filepath.Join(tmpDir, "sdeploy.conf")
+
+	base := `
+projects:
+  - name: App
+    webhook_path: /hooks/app
+    webhook_secret: secret
+    execute_command: echo test
+    require_clean_tree: true
+`
+	if err := os.WriteFile(configPath, []byte(base), 0644); err != nil {
+		t.Fatalf("Failed to create test config file: %v", err)
+	}
+	cfg, err := LoadConfig(configPath)
+	if err != nil {
+		t.Fatalf("LoadConfig failed: %v", err)
+	}
+	if !cfg.Projects[0].RequireCleanTree || cfg.Projects[0].DirtyTreeAction != DirtyTreeFail {
+		t.Errorf("Expected require_clean_tree with default action fail, got %+v", cfg.Projects[0])
+	}
+
+	if err := os.WriteFile(configPath, []byte(base+"    dirty_tree_action: reset\n"), 0644); err != nil {
+		t.Fatalf("Failed to create test config file: %v", err)
+	}
+	if _, err := LoadConfig(configPath); err == nil || !strings.Contains(err.Error(), "dirty_tree_action") {
+		t.Errorf("Expected dirty_tree_action error, got %v", err)
+	}
+}
+
+// TestLoadConfigEnabled tests that projects are enabled unless enabled: false is set
+func TestLoadConfigEnabled(t *testing.T) {
+	tmpDir := t.TempDir()
+	configPath := filepath.Join(tmpDir, "sdeploy.conf")
+
+	config := `
+projects:
+  - name: Default
+    webhook_path: /hooks/default
+    webhook_secret: secret
+    execute_command: echo test
+  - name: Enabled
+    webhook_path: /hooks/enabled
+    webhook_secret: secret
+    execute_command: echo test
+    enabled: true
+  - name: Disabled
+    webhook_path: /hooks/disabled
+    webhook_secret: secret
+    execute_command: echo test
+    enabled: false
+`
+	if err := os.WriteFile(configPath, []byte(config), 0644); err != nil {
+		t.Fatalf("Failed to create test config file: %v", err)
+	}
+	cfg, err := LoadConfig(configPath)
+	if err != nil {
+		t.Fatalf("LoadConfig failed: %v", err)
+	}
+
+	expected := []bool{true, true, false}
+	for i, want := range expected {
+		if got := cfg.Projects[i].IsEnabled(); got != want {
+			t.Errorf("Project %s: expected enabled=%v, got %v", cfg.Projects[i].Name, want, got)
+		}
+	}
+}
+
+// TestLoadConfigGitToken tests validation of git_token and git_token_file
+func TestLoadConfigGitToken(t *testing.T) {
+	tmpDir := t.TempDir()
+	configPath := filepath.Join(tmpDir, "sdeploy.conf")
+	tokenFile := filepath.Join(tmpDir, "token")
+	if err := os.WriteFile(tokenFile, []byte("abc123\n"), 0600); err != nil {
+		t.Fatalf("Failed to create token file: %v", err)
+	}
+	emptyFile := filepath.Join(tmpDir, "empty")
+	if err := os.WriteFile(emptyFile, nil, 0600); err != nil {
+		t.Fatalf("Failed to create token file: %v", err)
+	}
+
+	tests := []struct {
+		name    string
+		fields  string
+		wantErr string
+	}{
+		{"token", "git_repo: https://github.com/org/repo.git\n    git_token: abc123", ""},
+		{"token file", "git_repo: https://github.com/org/repo.git\n    git_token_file: " + tokenFile, ""},
+		{"both", "git_repo: https://github.com/org/repo.git\n    git_token: abc123\n    git_token_file: " + tokenFile, "mutually exclusive"},
+		{"ssh repo", "git_repo: git@github.com:org/repo.git\n    git_token: abc123", "requires an https://"},
+		{"missing file", "git_repo: https://github.com/org/repo.git\n    git_token_file: " + filepath.Join(tmpDir, "missing"), "not readable"},
+		{"empty file", "git_repo: https://github.com/org/repo.git\n    git_token_file: " + emptyFile, "is empty"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			config := `
+projects:
+  - name: Private
+    webhook_path: /hooks/private
+    webhook_secret: secret
+    execute_command: echo test
+    ` + tt.fields + "\n"
+			if err := os.WriteFile(configPath, []byte(config), 0644); err != nil {
+				t.Fatalf("Failed to create test config file: %v", err)
+			}
+			cfg, err := LoadConfig(configPath)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("Expected error containing %q, got %v", tt.wantErr, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("LoadConfig failed: %v", err)
+			}
+			if token, err := cfg.Projects[0].gitToken(); err != nil || token != "abc123" {
+				t.Errorf("Expected token abc123, got %q (%v)", token, err)
+			}
+		})
+	}
+}
+
+// TestLoadConfigRedactPatterns tests that redact_patterns are compiled after the built-in patterns
+func TestLoadConfigRedactPatterns(t *testing.T) {
+	tmpDir := t.TempDir()
+	configPath := filepath.Join(tmpDir, "sdeploy.conf")
+
+	config := `
+admin_token: admin-token-value
+redact_patterns:
+  - 'internal-[0-9]+'
+email_config:
+  smtp_host: smtp.example.com
+  smtp_port: 587
+  smtp_user: user
+  smtp_pass: smtp-pass-value
+  email_sender: sdeploy@example.com
+projects: []
+`
+	if err := os.WriteFile(configPath, []byte(config), 0644); err != nil {
+		t.Fatalf("Failed to create test config file: %v", err)
+	}
+	cfg, err := LoadConfig(configPath)
+	if err != nil {
+		t.Fatalf("LoadConfig failed: %v", err)
+	}
+	if got := len(cfg.RedactRegexps()); got != len(defaultRedactPatterns)+1 {
+		t.Errorf("Expected %d patterns, got %d", len(defaultRedactPatterns)+1, got)
+	}
+	r := newRedactor(cfg.RedactSecrets(), cfg.RedactRegexps())
+	if got := r.Redact("admin-token-value smtp-pass-value internal-7"); got != "*** *** ***" {
+		t.Errorf("Expected all values redacted, got %q", got)
+	}
+
+	if err := os.WriteFile(configPath, []byte("redact_patterns:\n  - '('\nprojects: []\n"), 0644); err != nil {
+		t.Fatalf("Failed to create test config file: %v", err)
+	}
+	if _, err := LoadConfig(configPath); err == nil || !strings.Contains(err.Error(), "redact_patterns") {
+		t.Errorf("Expected redact_patterns error, got %v", err)
+	}
+}
+
+// TestLoadConfigListenAddr tests listen_addr validation and the resulting bind address
+func TestLoadConfigListenAddr(t *testing.T) {
+	tmpDir := t.TempDir()
+	configPath := filepath.Join(tmpDir, "sdeploy.conf")
+
+	tests := []struct {
+		name     string
+		addr     string
+		expected string
+		wantErr  bool
+	}{
+		{"unset binds all interfaces", "", ":8080", false},
+		{"ipv4 loopback", "127.0.0.1", "127.0.0.1:8080", false},
+		{"ipv6 loopback", "::1", "[::1]:8080", false},
+		{"bracketed ipv6", "'[::1]'", "[::1]:8080", false},
+		{"localhost", "localhost", "localhost:8080", false},
+		{"with port", "127.0.0.1:9000", "", true},
+		{"hostname", "example.com", "", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			config := "listen_port: 8080\nprojects: []\n"
+			if tt.addr != "" {
+				config = "listen_addr: " + tt.addr + "\n" + config
+			}
+			if err := os.WriteFile(configPath, []byte(config), 0644); err != nil {
+				t.Fatalf("Failed to create test config file: %v", err)
+			}
+			cfg, err := LoadConfig(configPath)
+			if tt.wantErr {
+				if err == nil || !strings.Contains(err.Error(), "listen_addr") {
+					t.Errorf("Expected listen_addr error, got %v", err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("LoadConfig failed: %v", err)
+			}
+			if got := cfg.ListenAddress(); got != tt.expected {
+				t.Errorf("Expected %q, got %q", tt.expected, got)
+			}
+		})
+	}
+}
+
+// writeTestCert writes a self-signed certificate and its key to dir
+func writeTestCert(t *testing.T, dir string) (certFile, keyFile string) {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("Failed to generate key: %v", err)
+	}
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "localhost"},
+		DNSNames:     []string{"localhost"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatalf("Failed to create certificate: %v", err)
+	}
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatalf("Failed to marshal key: %v", err)
+	}
+
+	certFile = filepath.Join(dir, "cert.pem")
+	keyFile = filepath.Join(dir, "key.pem")
+	if err := os.WriteFile(certFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0644); err != nil {
+		t.Fatalf("Failed to write certificate: %v", err)
+	}
+	if err := os.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER}), 0600); err != nil {
+		t.Fatalf("Failed to write key: %v", err)
+	}
+	return certFile, keyFile
+}
+
+// TestLoadConfigTLS tests validation of tls_cert_file and tls_key_file
+func TestLoadConfigTLS(t *testing.T) {
+	tmpDir := t.TempDir()
+	configPath := filepath.Join(tmpDir, "sdeploy.conf")
+	certFile, keyFile := writeTestCert(t, tmpDir)
+
+	tests := []struct {
+		name    string
+		config  string
+		enabled bool
+		wantErr string
+	}{
+		{"disabled", "projects: []\n", false, ""},
+		{"enabled", fmt.Sprintf("tls_cert_file: %s\ntls_key_file: %s\nprojects: []\n", certFile, keyFile), true, ""},
+		{"cert only", fmt.Sprintf("tls_cert_file: %s\nprojects: []\n", certFile), false, "must be set together"},
+		{"missing key", fmt.Sprintf("tls_cert_file: %s\ntls_key_file: %s\nprojects: []\n", certFile, filepath.Join(tmpDir, "missing.pem")), false, "failed to load TLS certificate"},
+		{"mismatched files", fmt.Sprintf("tls_cert_file: %s\ntls_key_file: %s\nprojects: []\n", keyFile, certFile), false, "failed to load TLS certificate"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := os.WriteFile(configPath, []byte(tt.config), 0644); err != nil {
+				t.Fatalf("Failed to create test config file: %v", err)
+			}
+			cfg, err := LoadConfig(configPath)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Errorf("Expected error containing %q, got %v", tt.wantErr, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("LoadConfig failed: %v", err)
+			}
+			if cfg.TLSEnabled() != tt.enabled {
+				t.Errorf("Expected TLSEnabled %v, got %v", tt.enabled, cfg.TLSEnabled())
+			}
+			if got := webhookScheme(cfg); tt.enabled != (got == "https") {
+				t.Errorf("Unexpected webhook scheme %q", got)
+			}
+		})
+	}
+}
+
+// TestLoadConfigPathFilters tests validation of build_paths, ignore_paths, extra git
+// arguments, run_as_user, the circuit breaker, signature_header,
+// deploy_timeout_seconds, timeout_grace_seconds, chown_to, branch_commands,
+// deploy_strategy, allowed_triggers, match_repo, git retries, dir_mode and
+// trigger_files
+func TestLoadConfigPathFilters(t *testing.T) {
+	tmpDir := t.TempDir()
+	configPath := filepath.Join(tmpDir, "sdeploy.conf")
+
+	tests := []struct {
+		name    string
+		fields  string
+		wantErr string
+	}{
+		{"build and ignore", "build_paths: [src/, go.mod]\n    ignore_paths: ['*.md', docs/]", ""},
+		{"empty entry", "ignore_paths: ['']", "ignore_paths entries cannot be empty"},
+		{"negated", "build_paths: ['!docs/']", "does not support negated patterns"},
+		{"git args", "git_clone_args: [--recurse-submodules, --filter=blob:none]\n    git_pull_args: [-c, http.version=HTTP/1.1]", ""},
+		{"empty git arg", "git_pull_args: ['']", "git_pull_args entries cannot be empty"},
+		{"control char git arg", `git_clone_args: ["--depth=1\n"]`, "control characters"},
+		{"run_as_user", "run_as_user: root", ""},
+		{"unknown run_as_user", "run_as_user: sdeploy-no-such-user", "unknown user sdeploy-no-such-user"},
+		{"negative failure_threshold", "failure_threshold: -1", "failure_threshold cannot be negative"},
+		{"negative breaker cooldown", "breaker_cooldown_seconds: -1", "breaker_cooldown_seconds cannot be negative"},
+		{"signature header", "signature_header: X-MyCompany-Signature", ""},
+		{"negative deploy timeout", "deploy_timeout_seconds: -1", "deploy_timeout_seconds cannot be negative"},
+		{"negative timeout grace", "timeout_grace_seconds: -1", "timeout_grace_seconds cannot be negative"},
+		{"invalid signature header", "signature_header: 'X Signature:'", "invalid signature_header"},
+		{"chown_to", "git_repo: https://example.com/app.git\n    chown_to: root:0", ""},
+		{"chown_to without git_repo", "chown_to: root", "chown_to requires git_repo"},
+		{"chown_to unknown group", "git_repo: https://example.com/app.git\n    chown_to: root:sdeploy-no-such-group", "unknown group sdeploy-no-such-group"},
+		{"chown_to empty group", "git_repo: https://example.com/app.git\n    chown_to: 'root:'", "expected user:group"},
+		{"branch_commands", "git_repo: https://example.com/app.git\n    branch_commands: {develop: make staging, main: make prod}", ""},
+		{"branch_commands without git_repo", "branch_commands: {develop: make staging}", "branch_commands requires git_repo"},
+		{"branch_commands bad branch", "git_repo: https://example.com/app.git\n    branch_commands: {'my branch': make}", "invalid character ' '"},
+		{"branch_commands empty command", "git_repo: https://example.com/app.git\n    branch_commands: {develop: ''}", "empty command for branch develop"},
+		{"branch_commands and branch_deploys", "git_repo: https://example.com/app.git\n    branch_commands: {develop: make}\n    branch_deploys: [{git_branch: develop, local_path: /srv/dev}]", "also has a branch_deploys entry"},
+		{"atomic", "git_repo: https://example.com/app.git\n    local_path: /srv/app/repo\n    execute_path: /srv/app/current\n    deploy_strategy: atomic", ""},
+		{"unknown deploy_strategy", "deploy_strategy: bluegreen", `invalid deploy_strategy "bluegreen"`},
+		{"atomic without git_repo", "local_path: /srv/app/repo\n    execute_path: /srv/app/current\n    deploy_strategy: atomic", "atomic requires git_repo"},
+		{"atomic without execute_path", "git_repo: https://example.com/app.git\n    local_path: /srv/app/repo\n    deploy_strategy: atomic", "atomic requires execute_path"},
+		{"atomic execute_path inside local_path", "git_repo: https://example.com/app.git\n    local_path: /srv/app\n    execute_path: /srv/app/current\n    deploy_strategy: atomic", "execute_path outside local_path"},
+		{"atomic branch deploy without execute_path", "git_repo: https://example.com/app.git\n    local_path: /srv/app/repo\n    execute_path: /srv/app/current\n    deploy_strategy: atomic\n    branch_deploys: [{git_branch: staging, local_path: /srv/staging/repo}]", "requires branch_deploys[0].execute_path"},
+		{"atomic with chown_to", "git_repo: https://example.com/app.git\n    local_path: /srv/app/repo\n    execute_path: /srv/app/current\n    deploy_strategy: atomic\n    chown_to: root", "does not support chown_to"},
+		{"allowed_triggers", "allowed_triggers: [WEBHOOK (Github), INTERNAL (once)]", ""},
+		{"allowed_triggers kind", "allowed_triggers: [WEBHOOK]", ""},
+		{"allowed_triggers unknown kind", "allowed_triggers: [CLI]", `invalid allowed_triggers entry "CLI"`},
+		{"allowed_triggers bad source", "allowed_triggers: ['WEBHOOK (Github']", "expected WEBHOOK (<source>)"},
+		{"match_repo", "match_repo: myorg/app", ""},
+		{"match_repo without owner", "match_repo: app", `invalid match_repo "app"`},
+		{"dir_mode", "dir_mode: '2775'", ""},
+		{"invalid dir_mode", "dir_mode: '0855'", "invalid dir_mode: 0855"},
+		{"dir_mode without owner access", "dir_mode: '0644'", "the owner needs rwx"},
+		{"trigger_files", "trigger_files: [package.json, /VERSION]", ""},
+		{"trigger_files with build_paths", "trigger_files: [package.json]\n    build_paths: [src/]", "cannot be combined with build_paths"},
+		{"trigger_files directory", "trigger_files: [docs/]", `invalid trigger_files entry "docs/"`},
+		{"trigger_files outside repo", "trigger_files: [../package.json]", "clean path inside the repository"},
+		{"git retries", "git_retry_count: 3\n    git_retry_delay_seconds: 2", ""},
+		{"negative git_retry_count", "git_retry_count: -1", "git_retry_count cannot be negative"},
+		{"negative git_retry_delay_seconds", "git_retry_delay_seconds: -1", "git_retry_delay_seconds cannot be negative"},
+		{"match_repo with space", "match_repo: 'myorg/my app'", `invalid match_repo "myorg/my app"`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			config := `
+projects:
+  - name: Filtered
+    webhook_path: /hooks/filtered
+    webhook_secret: secret
+    execute_command: echo test
+    ` + tt.fields + "\n"
+			if err := os.WriteFile(configPath, []byte(config), 0644); err != nil {
+				t.Fatalf("Failed to create test config file: %v", err)
+			}
+			_, err := LoadConfig(configPath)
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Fatalf("LoadConfig failed: %v", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Fatalf("Expected error containing %q, got %v", tt.wantErr, err)
+			}
+		})
+	}
+}
+
+// TestLoadConfigAbsolutePaths tests that project paths must be absolute
+// unless allow_relative_paths is set
+func TestLoadConfigAbsolutePaths(t *testing.T) {
+	tmpDir := t.TempDir()
+	configPath := filepath.Join(tmpDir, "sdeploy.conf")
+
+	tests := []struct {
+		name    string
+		global  string
+		fields  string
+		wantErr string
+	}{
+		{"absolute", "", "local_path: /srv/app\n    execute_path: /srv/app/web", ""},
+		{"relative local_path", "", "local_path: srv/app", `local_path must be an absolute path, got "srv/app"`},
+		{"dot execute_path", "", "local_path: /srv/app\n    execute_path: ./web", "execute_path must be an absolute path"},
+		{"relative ssh key", "", "git_ssh_key_path: keys/deploy", "git_ssh_key_path must be an absolute path"},
+		{"relative branch deploy", "", "local_path: /srv/app\n    branch_deploys:\n      - git_branch: staging\n        local_path: staging",
+			"branch_deploys[0].local_path must be an absolute path"},
+		{"allowed", "allow_relative_paths: true\n", "local_path: srv/app\n    execute_path: ./web", ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			config := tt.global + `
+projects:
+  - name: Paths
+    webhook_path: /hooks/paths
+    webhook_secret: secret
+    execute_command: echo test
+    ` + tt.fields + "\n"
+			if err := os.WriteFile(configPath, []byte(config), 0644); err != nil {
+				t.Fatalf("Failed to create test config file: %v", err)
+			}
+			_, err := LoadConfig(configPath)
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Fatalf("LoadConfig failed: %v", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Fatalf("Expected error containing %q, got %v", tt.wantErr, err)
+			}
+		})
+	}
+}
+
+// TestLoadConfigPIDFile tests the pid_file default and override
+func TestLoadConfigPIDFile(t *testing.T) {
+	tmpDir := t.TempDir()
+	configPath := filepath.Join(tmpDir, "sdeploy.conf")
+
+	tests := []struct {
+		config string
+		want   string
+	}{
+		{"projects: []\n", Defaults.PIDFile},
+		{"pid_file: /tmp/sdeploy-test.pid\nprojects: []\n", "/tmp/sdeploy-test.pid"},
+		{"pid_file: none\nprojects: []\n", PIDFileNone},
+	}
+
+	for _, tt := range tests {
+		if err := os.WriteFile(configPath, []byte(tt.config), 0644); err != nil {
+			t.Fatalf("Failed to create test config file: %v", err)
+		}
+		cfg, err := LoadConfig(configPath)
+		if err != nil {
+			t.Fatalf("LoadConfig failed: %v", err)
+		}
+		if cfg.PIDFile != tt.want {
+			t.Errorf("Expected pid_file %q, got %q", tt.want, cfg.PIDFile)
+		}
+	}
+}
+
+// TestLoadConfigLogTimestampFormat tests the log_timestamp_format default and validation
+func TestLoadConfigLogTimestampFormat(t *testing.T) {
+	tmpDir := t.TempDir()
+	configPath := filepath.Join(tmpDir, "sdeploy.conf")
+
+	tests := []struct {
+		name    string
+		value   string
+		want    string
+		wantErr string
+	}{
+		{"default", "", Defaults.LogTimestampFormat, ""},
+		{"rfc3339", `"2006-01-02T15:04:05Z07:00"`, "2006-01-02T15:04:05Z07:00", ""},
+		{"no fields", "timestamp", "", "contains no date or time fields"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			config := "projects: []\n"
+			if tt.value != "" {
+				config = "log_timestamp_format: " + tt.value + "\n" + config
+			}
+			if err := os.WriteFile(configPath, []byte(config), 0644); err != nil {
+				t.Fatalf("Failed to create test config file: %v", err)
+			}
+			cfg, err := LoadConfig(configPath)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("Expected error containing %q, got %v", tt.wantErr, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("LoadConfig failed: %v", err)
+			}
+			if cfg.LogTimestampFormat != tt.want {
+				t.Errorf("Expected log_timestamp_format %q, got %q", tt.want, cfg.LogTimestampFormat)
+			}
+		})
+	}
+}
+
+// TestLoadConfigLogColor tests the log_color default and validation
+func TestLoadConfigLogColor(t *testing.T) {
+	tmpDir := t.TempDir()
+	configPath := filepath.Join(tmpDir, "sdeploy.conf")
+
+	tests := []struct {
+		value   string
+		want    string
+		wantErr string
+	}{
+		{"", LogColorAuto, ""},
+		{"never", LogColorNever, ""},
+		{"rainbow", "", `invalid log_color "rainbow"`},
+	}
+
+	for _, tt := range tests {
+		config := "projects: []\n"
+		if tt.value != "" {
+			config = "log_color: " + tt.value + "\n" + config
+		}
+		if err := os.WriteFile(configPath, []byte(config), 0644); err != nil {
+			t.Fatalf("Failed to create test config file: %v", err)
+		}
+		cfg, err := LoadConfig(configPath)
+		if tt.wantErr != "" {
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("log_color %q: expected error containing %q, got %v", tt.value, tt.wantErr, err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Fatalf("LoadConfig failed: %v", err)
+		}
+		if cfg.LogColor != tt.want {
+			t.Errorf("Expected log_color %q, got %q", tt.want, cfg.LogColor)
+		}
+	}
+}
+
+// TestLoadConfigLogSuffixes tests the build log filename suffix defaults and validation
+func TestLoadConfigLogSuffixes(t *testing.T) {
+	tmpDir := t.TempDir()
+	configPath := filepath.Join(tmpDir, "sdeploy.conf")
+
+	tests := []struct {
+		name     string
+		config   string
+		wantPass string
+		wantFail string
+		wantErr  string
+	}{
+		{"default", "", Defaults.LogSuccessSuffix, Defaults.LogFailSuffix, ""},
+		{"custom", "log_success_suffix: .ok\nlog_fail_suffix: _FAILED\n", ".ok", "_FAILED", ""},
+		{"path separator", "log_success_suffix: /ok\n", "", "", "log_success_suffix"},
+		{"pending", "log_fail_suffix: -pending\n", "", "", "builds in progress"},
+		{"same", "log_success_suffix: -done\nlog_fail_suffix: -done\n", "", "", "must differ"},
+		{"same as default", "log_fail_suffix: -success\n", "", "", "must differ"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := os.WriteFile(configPath, []byte(tt.config+"projects: []\n"), 0644); err != nil {
+				t.Fatalf("Failed to create test config file: %v", err)
+			}
+			cfg, err := LoadConfig(configPath)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("Expected error containing %q, got %v", tt.wantErr, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("LoadConfig failed: %v", err)
+			}
+			if cfg.LogSuccessSuffix != tt.wantPass || cfg.LogFailSuffix != tt.wantFail {
+				t.Errorf("Expected suffixes %q/%q, got %q/%q", tt.wantPass, tt.wantFail, cfg.LogSuccessSuffix, cfg.LogFailSuffix)
+			}
+		})
+	}
+}
+
+// TestLoadConfigDependentProjects tests dependent_projects validation
+func TestLoadConfigDependentProjects(t *testing.T) {
+	tmpDir := t.TempDir()
+	configPath := filepath.Join(tmpDir, "sdeploy.conf")
+
+	project := func(name, deps string) string {
+		return "  - name: " + name + "\n    webhook_path: /hooks/" + strings.ToLower(name) +
+			"\n    webhook_secret: s\n    execute_command: \"true\"\n    dependent_projects: " + deps + "\n"
+	}
+	tests := []struct {
+		name     string
+		projects string
+		wantErr  string
+	}{
+		{"chain", project("A", "[B, C]") + project("B", "[C]") + project("C", "[]"), ""},
+		{"unknown", project("A", "[X]"), `unknown project "X"`},
+		{"self", project("A", "[A]"), "the project itself"},
+		{"twice", project("A", "[B, B]") + project("B", "[]"), "listed twice"},
+		{"cycle", project("A", "[B]") + project("B", "[C]") + project("C", "[A]"), "cycle: A -> B -> C -> A"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := os.WriteFile(configPath, []byte("projects:\n"+tt.projects), 0644); err != nil {
+				t.Fatalf("Failed to create test config file: %v", err)
+			}
+			_, err := LoadConfig(configPath)
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Fatalf("LoadConfig failed: %v", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Fatalf("Expected error containing %q, got %v", tt.wantErr, err)
+			}
+		})
+	}
+}
+
+// TestLoadConfigLogPayloads tests that projects inherit the global log_payloads
+// and can override it
+func TestLoadConfigLogPayloads(t *testing.T) {
+	tmpDir := t.TempDir()
+	configPath := filepath.Join(tmpDir, "sdeploy.conf")
+
+	tests := []struct {
+		global  string
+		project string
+		want    bool
+	}{
+		{"", "", false},
+		{"log_payloads: true\n", "", true},
+		{"log_payloads: true\n", "    log_payloads: false\n", false},
+		{"", "    log_payloads: true\n", true},
+	}
+
+	for _, tt := range tests {
+		config := tt.global + "projects:\n  - name: Frontend\n    webhook_path: /hooks/frontend\n    webhook_secret: secret_token_123\n    execute_command: sh deploy.sh\n" + tt.project
+		if err := os.WriteFile(configPath, []byte(config), 0644); err != nil {
+			t.Fatalf("Failed to create test config file: %v", err)
+		}
+		cfg, err := LoadConfig(configPath)
+		if err != nil {
+			t.Fatalf("LoadConfig failed: %v", err)
+		}
+		if got := cfg.Projects[0].LogsPayloads(); got != tt.want {
+			t.Errorf("global %q, project %q: expected log_payloads %t, got %t", tt.global, tt.project, tt.want, got)
+		}
+	}
+}
+
+// TestLoadConfigBreakerCooldown tests that failure_threshold enables the default cooldown
+func TestLoadConfigBreakerCooldown(t *testing.T) {
+	tmpDir := t.TempDir()
+	configPath := filepath.Join(tmpDir, "sdeploy.conf")
+
+	tests := []struct {
+		project string
+		want    int
+	}{
+		{"", 0},
+		{"    failure_threshold: 3\n", Defaults.BreakerCooldown},
+		{"    failure_threshold: 3\n    breaker_cooldown_seconds: 60\n", 60},
+	}
+
+	for _, tt := range tests {
+		config := "projects:\n  - name: Frontend\n    webhook_path: /hooks/frontend\n    webhook_secret: secret_token_123\n    execute_command: sh deploy.sh\n" + tt.project
+		if err := os.WriteFile(configPath, []byte(config), 0644); err != nil {
+			t.Fatalf("Failed to create test config file: %v", err)
+		}
+		cfg, err := LoadConfig(configPath)
+		if err != nil {
+			t.Fatalf("LoadConfig failed: %v", err)
+		}
+		if got := cfg.Projects[0].BreakerCooldown; got != tt.want {
+			t.Errorf("project %q: expected breaker_cooldown_seconds %d, got %d", tt.project, tt.want, got)
+		}
+	}
+}
+
+// TestDefaultLogPath tests the log_path fallback for root and other users
+func TestDefaultLogPath(t *testing.T) {
+	if got := defaultLogPathFor(0); got != Defaults.LogPath {
+		t.Errorf("Expected %s for root, got %s", Defaults.LogPath, got)
+	}
+
+	t.Setenv("XDG_STATE_HOME", "/srv/state")
+	if got := defaultLogPathFor(1000); got != "/srv/state/sdeploy" {
+		t.Errorf("Expected XDG_STATE_HOME/sdeploy, got %s", got)
+	}
+
+	// A relative XDG_STATE_HOME is ignored, as the XDG spec requires
+	t.Setenv("XDG_STATE_HOME", "state")
+	t.Setenv("HOME", "/home/deploy")
+	if got := defaultLogPathFor(1000); got != "/home/deploy/.local/state/sdeploy" {
+		t.Errorf("Expected ~/.local/state/sdeploy, got %s", got)
+	}
+}
+
+// TestConfigPathWarnings tests that strict_paths flags execute_path outside local_path
+func TestConfigPathWarnings(t *testing.T) {
+	cfg := &Config{
+		Projects: []ProjectConfig{
+			{Name: "Same", LocalPath: "/var/www/app", ExecutePath: "/var/www/app/"},
+			{Name: "Inside", LocalPath: "/var/www/app", ExecutePath: "/var/www/app/frontend"},
+			{Name: "Default", LocalPath: "/var/www/app"},
+			{Name: "Sibling", LocalPath: "/var/www/app", ExecutePath: "/var/www/app2"},
+			{Name: "Parent", LocalPath: "/var/www/app", ExecutePath: "/var/www", BranchDeploys: []BranchDeploy{
+				{GitBranch: "staging", LocalPath: "/var/www/staging", ExecutePath: "/srv/build"},
+			}},
+		},
+	}
+
+	if warnings := cfg.PathWarnings(); warnings != nil {
+		t.Errorf("Expected no warnings without strict_paths, got %v", warnings)
+	}
+
+	cfg.StrictPaths = true
+	expected := []string{
+		"Sibling: execute_path /var/www/app2 is outside local_path /var/www/app",
+		"Parent: execute_path /var/www is outside local_path /var/www/app",
+		"Parent (branch staging): execute_path /srv/build is outside local_path /var/www/staging",
+	}
+	if got := cfg.PathWarnings(); strings.Join(got, "\n") != strings.Join(expected, "\n") {
+		t.Errorf("Expected %v, got %v", expected, got)
+	}
+}
+
+// TestConfigPermissionWarnings tests that config and include files accessible
+// by group or others are reported
+func TestConfigPermissionWarnings(t *testing.T) {
+	tmpDir := t.TempDir()
+	configPath := filepath.Join(tmpDir, "sdeploy.conf")
+	includePath := filepath.Join(tmpDir, "app.conf")
+	config := "include: [app.conf]\nprojects: []\n"
+	include := "projects:\n  - name: App\n    webhook_path: /hooks/app\n    webhook_secret: secret\n    execute_command: echo test\n"
+	if err := os.WriteFile(configPath, []byte(config), 0600); err != nil {
+		t.Fatalf("Failed to create test config file: %v", err)
+	}
+	if err := os.WriteFile(includePath, []byte(include), 0600); err != nil {
+		t.Fatalf("Failed to create include file: %v", err)
+	}
+
+	cfg, err := LoadConfig(configPath)
+	if err != nil {
+		t.Fatalf("LoadConfig failed: %v", err)
+	}
+	if warnings := cfg.PermissionWarnings(configPath); warnings != nil {
+		t.Errorf("Expected no warnings for mode 0600, got %v", warnings)
+	}
+
+	if err := os.Chmod(configPath, 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chmod(includePath, 0640); err != nil {
+		t.Fatal(err)
+	}
+	expected := []string{
+		"config file " + configPath + " is accessible by group or others (mode 0644); run chmod 600 " + configPath,
+		"config file " + includePath + " is accessible by group or others (mode 0640); run chmod 600 " + includePath,
+	}
+	if got := cfg.PermissionWarnings(configPath); strings.Join(got, "\n") != strings.Join(expected, "\n") {
+		t.Errorf("Expected %v, got %v", expected, got)
+	}
+
+	// Write access alone lets others change the commands SDeploy runs
+	if err := os.Chmod(configPath, 0620); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chmod(includePath, 0600); err != nil {
+		t.Fatal(err)
+	}
+	if got := cfg.PermissionWarnings(configPath); len(got) != 1 || !strings.Contains(got[0], "(mode 0620)") {
+		t.Errorf("Expected a warning for mode 0620, got %v", got)
+	}
+}
@@ -3,24 +3,43 @@ package main
 import (
 	"bytes"
 	"context"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
 	"fmt"
+	"net/url"
 	"os"
 	"os/exec"
 	"path/filepath"
+	"regexp"
+	"runtime"
 	"strings"
 	"sync"
 	"sync/atomic"
 	"time"
 )
 
+// lockPollInterval is how often a waiting deployment retries the project lock
+const lockPollInterval = 100 * time.Millisecond
+
 // DeployResult represents the result of a deployment
 type DeployResult struct {
+	BuildID   string
 	Success   bool
 	Skipped   bool
+	Recovered bool // succeeded after the project's previous build failed
 	Output    string
 	Error     string
+	ErrorKind ErrorKind // failure category; empty on success
 	StartTime time.Time
 	EndTime   time.Time
+	CommitSHA string // local_path HEAD the command ran against; empty without a checkout
+	// BuildLogPath is the final build log file; empty if there is none
+	BuildLogPath string
+	// Phases holds the time spent in each build phase that ran, keyed by
+	// phase name (preflight, git, chown, command)
+	Phases map[string]time.Duration
 }
 
 // Duration returns the deployment duration
@@ -34,28 +53,206 @@ type Deployer struct {
 	locks         map[string]*sync.Mutex
 	locksMu       sync.Mutex
 	notifier      *EmailNotifier
+	teams         *TeamsNotifier
+	clock         clock
 	configManager *ConfigManager
+	metrics       *Metrics
 	activeBuilds  int32 // atomic counter for active builds
+	notifyRetry   notifyRetryPolicy
+	notifying     int32 // atomic counter for notifications still being sent
+	state         *stateStore
+	queue         *buildQueue
+	shaLength     int
+	// Global secret values and token patterns masked in every build log
+	redactSecrets  []string
+	redactPatterns []*regexp.Regexp
+	// Remote default branch by git_repo, for projects without git_branch
+	remoteBranches   map[string]string
+	remoteBranchesMu sync.Mutex
+	// Current config, used to look up dependent_projects after a build
+	config   *Config
+	configMu sync.Mutex
+	fanOut   sync.WaitGroup
 }
 
 // NewDeployer creates a new deployer instance
 func NewDeployer(logger *Logger) *Deployer {
 	return &Deployer{
-		logger: logger,
-		locks:  make(map[string]*sync.Mutex),
+		logger:         logger,
+		locks:          make(map[string]*sync.Mutex),
+		remoteBranches: make(map[string]string),
+		metrics:        NewMetrics(),
+		state:          newStateStore(),
+		queue:          newBuildQueue(realClock{}),
+		shaLength:      Defaults.SHALength,
+		redactPatterns: defaultRedactPatterns,
+		clock:          realClock{},
+		notifyRetry: notifyRetryPolicy{
+			Retries: Defaults.NotifyRetryCount,
+			Base:    time.Duration(Defaults.NotifyRetryBaseMS) * time.Millisecond,
+		},
 	}
 }
 
+// SetClock replaces the time source used for build timestamps, rate limits,
+// breaker cooldowns and debouncing (see clock)
+func (d *Deployer) SetClock(c clock) {
+	d.clock = c
+	d.queue.setClock(c)
+}
+
 // SetNotifier sets the email notifier
 func (d *Deployer) SetNotifier(notifier *EmailNotifier) {
 	d.notifier = notifier
 }
 
+// SetTeamsNotifier sets the Microsoft Teams notifier; nil disables it
+func (d *Deployer) SetTeamsNotifier(notifier *TeamsNotifier) {
+	d.teams = notifier
+}
+
+// SetNotifyRetry sets how often and how quickly failed notifications are retried
+func (d *Deployer) SetNotifyRetry(retries int, base time.Duration) {
+	d.notifyRetry = notifyRetryPolicy{Retries: retries, Base: base}
+}
+
+// SetSHALength sets how many characters of commit SHAs are shown in logs and
+// SDEPLOY_COMMIT_SHORT
+func (d *Deployer) SetSHALength(length int) {
+	d.shaLength = length
+}
+
+// SetRedaction sets the global secret values and token patterns masked in
+// build logs; each build adds its project's own secrets
+func (d *Deployer) SetRedaction(secrets []string, patterns []*regexp.Regexp) {
+	d.redactSecrets = secrets
+	d.redactPatterns = patterns
+}
+
+// redactorFor returns the redactor for a build of project
+func (d *Deployer) redactorFor(project *ProjectConfig) *redactor {
+	secrets := append([]string{project.WebhookSecret, project.AuthBearerToken}, d.redactSecrets...)
+	if token, err := project.gitToken(); err == nil {
+		secrets = append(secrets, token)
+	}
+	return newRedactor(secrets, d.redactPatterns)
+}
+
+// buildIntervalRemaining returns how much longer new webhook builds of project
+// are held back by min_build_interval_seconds, counted from the end of its
+// last completed build. Zero means a build may start.
+func (d *Deployer) buildIntervalRemaining(project *ProjectConfig, now time.Time) time.Duration {
+	if project.MinBuildInterval <= 0 {
+		return 0
+	}
+	last, ok := d.state.last(project.DeployKey())
+	if !ok {
+		return 0
+	}
+	remaining := last.EndTime.Add(time.Duration(project.MinBuildInterval) * time.Second).Sub(now)
+	if remaining < 0 {
+		return 0
+	}
+	return remaining
+}
+
+// breakerState reports whether the circuit breaker holds back webhook builds
+// of project at now, without changing any state: it opens after
+// failure_threshold consecutive failures and stays open for
+// breaker_cooldown_seconds from the end of the last build. Once the cooldown
+// has passed it is open only while a trial build runs; otherwise trialDue is
+// set and the next webhook runs as the trial. remaining is the cooldown left.
+func (d *Deployer) breakerState(project *ProjectConfig, now time.Time) (open bool, remaining time.Duration, trialDue bool) {
+	if project.FailureThreshold <= 0 {
+		return false, 0, false
+	}
+	state := d.state.snapshot(project.DeployKey())
+	if state.ConsecutiveFailures < project.FailureThreshold {
+		return false, 0, false
+	}
+	remaining = state.Last.EndTime.Add(time.Duration(project.BreakerCooldown) * time.Second).Sub(now)
+	if remaining > 0 {
+		return true, remaining, false
+	}
+	return state.TrialRunning, 0, !state.TrialRunning
+}
+
+// breakerOpen is breakerState for a webhook about to build: when a trial is
+// due it starts the trial build, holding back later webhooks until it ends; a
+// success closes the breaker. trial reports that this call started the trial
+// build; its DeployOptions.Trial must be set.
+func (d *Deployer) breakerOpen(project *ProjectConfig, now time.Time) (open bool, remaining time.Duration, trial bool) {
+	open, remaining, trialDue := d.breakerState(project, now)
+	if !trialDue {
+		return open, remaining, false
+	}
+	if !d.state.startTrial(project.DeployKey()) {
+		return true, 0, false
+	}
+	return false, 0, true
+}
+
+// SetConfig sets the configuration dependent_projects are looked up in
+func (d *Deployer) SetConfig(cfg *Config) {
+	d.configMu.Lock()
+	defer d.configMu.Unlock()
+	d.config = cfg
+}
+
+// deployDependents starts background deploys of project's dependent_projects
+// with trigger INTERNAL (fan-out from <project>). Each runs under its own
+// lock; config validation rules out cycles.
+func (d *Deployer) deployDependents(project *ProjectConfig, buildLogger *BuildLogger) {
+	if len(project.DependentProjects) == 0 {
+		return
+	}
+	d.configMu.Lock()
+	cfg := d.config
+	d.configMu.Unlock()
+
+	triggerSource := fmt.Sprintf("INTERNAL (fan-out from %s)", project.Name)
+	for _, name := range project.DependentProjects {
+		var dependent *ProjectConfig
+		if cfg != nil {
+			dependent = cfg.FindProjectByName(name)
+		}
+		if dependent == nil {
+			if d.logger != nil {
+				d.logger.Warnf(project.Name, "Fan-out: dependent project %q not found, skipping", name)
+			}
+			continue
+		}
+		if buildLogger != nil {
+			buildLogger.Infof(project.Name, "Fan-out: deploying dependent project %s", name)
+		}
+		if d.logger != nil {
+			d.logger.Infof(project.Name, "Fan-out: deploying dependent project %s", name)
+		}
+
+		d.fanOut.Add(1)
+		go func() {
+			defer d.fanOut.Done()
+			d.Deploy(context.Background(), dependent, triggerSource)
+		}()
+	}
+}
+
+// WaitForFanOut blocks until all dependent_projects deploys started so far,
+// including those they started in turn, have finished
+func (d *Deployer) WaitForFanOut() {
+	d.fanOut.Wait()
+}
+
 // SetConfigManager sets the config manager for deferred reload support
 func (d *Deployer) SetConfigManager(cm *ConfigManager) {
 	d.configManager = cm
 }
 
+// Metrics returns the deployer's runtime metrics
+func (d *Deployer) Metrics() *Metrics {
+	return d.metrics
+}
+
 // getProjectLock gets or creates a lock for a project
 func (d *Deployer) getProjectLock(projectPath string) *sync.Mutex {
 	d.locksMu.Lock()
@@ -70,40 +267,182 @@ func (d *Deployer) getProjectLock(projectPath string) *sync.Mutex {
 	return lock
 }
 
+// acquireLock tries to acquire the project lock. If the lock is busy and wait is
+// positive, it polls until the lock is free, the wait elapses, or ctx is done.
+func (d *Deployer) acquireLock(ctx context.Context, lock *sync.Mutex, wait time.Duration, projectName string) bool {
+	if lock.TryLock() {
+		return true
+	}
+	if wait <= 0 {
+		return false
+	}
+
+	if d.logger != nil {
+		d.logger.Infof(projectName, "Deployment in progress, waiting up to %v for it to finish", wait)
+	}
+
+	deadline := d.clock.Now().Add(wait)
+	ticker := time.NewTicker(lockPollInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return false
+		case <-ticker.C:
+			if lock.TryLock() {
+				return true
+			}
+			if d.clock.Now().After(deadline) {
+				return false
+			}
+		}
+	}
+}
+
 // HasActiveBuilds returns true if there are any active builds in progress
 func (d *Deployer) HasActiveBuilds() bool {
 	return atomic.LoadInt32(&d.activeBuilds) > 0
 }
 
+// ActiveBuilds returns the number of builds currently in progress
+func (d *Deployer) ActiveBuilds() int {
+	return int(atomic.LoadInt32(&d.activeBuilds))
+}
+
+// WaitForActiveBuilds blocks until no builds are in progress or the timeout elapses.
+// Returns true if all builds finished within the timeout.
+func (d *Deployer) WaitForActiveBuilds(timeout time.Duration) bool {
+	deadline := time.Now().Add(timeout)
+	for d.HasActiveBuilds() {
+		if time.Now().After(deadline) {
+			return false
+		}
+		time.Sleep(100 * time.Millisecond)
+	}
+	return true
+}
+
+// WaitForNotifications blocks until queued notifications have been sent or
+// given up on and result hooks have exited, or the timeout elapses. Returns true if none are left.
+func (d *Deployer) WaitForNotifications(timeout time.Duration) bool {
+	deadline := time.Now().Add(timeout)
+	for atomic.LoadInt32(&d.notifying) > 0 {
+		if time.Now().After(deadline) {
+			return false
+		}
+		time.Sleep(100 * time.Millisecond)
+	}
+	return true
+}
+
+// DeployOptions carries per-request settings for a single deployment
+type DeployOptions struct {
+	// BuildID identifies the build in logs and responses; generated if empty
+	BuildID string
+	// Force runs the build even when git reports no new commits
+	Force bool
+	// Commit is the SHA that triggered the build; projects with
+	// deploy_exact_commit check it out instead of pulling
+	Commit string
+	// Push holds fields of the webhook payload passed to the command as
+	// environment variables; empty for other triggers
+	Push PushInfo
+	// Trial marks the build the circuit breaker let through after its
+	// cooldown; the trial ends with the build, whether it ran or was skipped
+	Trial bool
+}
+
+// PushInfo holds the webhook payload fields exposed to execute_command
+type PushInfo struct {
+	Pusher        string // SDEPLOY_PUSHER
+	CommitMessage string // SDEPLOY_COMMIT_MESSAGE
+	CompareURL    string // SDEPLOY_COMPARE_URL
+}
+
+// newBuildID returns a short, sortable build identifier: the start minute
+// followed by a random suffix, e.g. 2024-01-15-1430-a1b2c3
+func newBuildID(t time.Time) string {
+	suffix := make([]byte, 3)
+	if _, err := rand.Read(suffix); err != nil {
+		// Fall back to the sub-minute clock if the random source fails
+		return fmt.Sprintf("%s-%06x", t.Format("2006-01-02-1504"), t.Nanosecond()&0xffffff)
+	}
+	return t.Format("2006-01-02-1504") + "-" + hex.EncodeToString(suffix)
+}
+
 // Deploy executes a deployment for the given project
 func (d *Deployer) Deploy(ctx context.Context, project *ProjectConfig, triggerSource string) DeployResult {
-	result := DeployResult{
-		StartTime: time.Now(),
+	return d.DeployWithOptions(ctx, project, triggerSource, DeployOptions{})
+}
+
+// DeployWithOptions executes a deployment for the given project using per-request options
+func (d *Deployer) DeployWithOptions(ctx context.Context, project *ProjectConfig, triggerSource string, opts DeployOptions) (result DeployResult) {
+	result = DeployResult{
+		BuildID:   opts.BuildID,
+		StartTime: d.clock.Now(),
+	}
+	if result.BuildID == "" {
+		result.BuildID = newBuildID(result.StartTime)
+	}
+	// A trial build that is skipped or rejected records no result, so the
+	// trial mark is cleared here rather than left holding the breaker open
+	if opts.Trial {
+		defer d.state.endTrial(project.DeployKey())
 	}
 
-	// Get project lock
-	lock := d.getProjectLock(project.WebhookPath)
+	// allowed_triggers restricts where deploys may come from; a rejected
+	// trigger never takes the lock or starts a build
+	if !project.AllowsTrigger(triggerSource) {
+		result.EndTime = d.clock.Now()
+		result.Error = fmt.Sprintf("trigger %s is not in allowed_triggers", triggerSource)
+		result.ErrorKind = ErrorKindTriggerNotAllowed
+		if d.logger != nil {
+			d.logger.Warnf(project.Name, "Rejected - trigger not allowed (event=trigger_rejected build_id=%s trigger=%q allowed=%q)",
+				result.BuildID, triggerSource, project.AllowedTriggers)
+		}
+		return result
+	}
 
-	// Try to acquire lock (non-blocking)
-	if !lock.TryLock() {
+	// Get project lock
+	lock := d.getProjectLock(project.LockKey())
+
+	// Try to acquire lock, waiting up to lock_wait_seconds if configured
+	lockWait := time.Duration(project.LockWaitSeconds) * time.Second
+	lockWaitStart := d.clock.Now()
+	d.queue.enqueue(project.DeployKey(), result.BuildID, triggerSource)
+	defer d.queue.remove(result.BuildID)
+	if !d.acquireLock(ctx, lock, lockWait, project.Name) {
 		result.Skipped = true
-		result.EndTime = time.Now()
+		result.EndTime = d.clock.Now()
+		d.metrics.SkippedBusy.Inc(project.Name)
+		// key=value fields so skips can be counted from main.log
 		if d.logger != nil {
-			d.logger.Warnf(project.Name, "Skipped - deployment already in progress")
+			d.logger.Warnf(project.Name, "Skipped - deployment already in progress (event=skipped_busy build_id=%s trigger=%q waited=%s)",
+				result.BuildID, triggerSource, d.clock.Now().Sub(lockWaitStart).Round(time.Millisecond))
 		}
 		return result
 	}
+	d.metrics.LockWait.Observe(d.clock.Now().Sub(lockWaitStart).Seconds())
+	d.queue.start(result.BuildID)
 	
 	// Create a build logger for this deployment
 	var buildLogger *BuildLogger
 	if d.logger != nil {
-		buildLogger = d.logger.NewBuildLogger(project.Name)
+		buildLogger = d.logger.NewBuildLoggerInDir(project.LogPath, project.Name, result.BuildID)
+		buildLogger.SetRedactor(d.redactorFor(project))
+		d.logBuildEnvironment(ctx, project, buildLogger)
 	}
 	
 	defer func() {
+		// Start dependent_projects before the log is closed so it records them
+		if result.Success && !result.Skipped {
+			d.deployDependents(project, buildLogger)
+		}
+
 		// Close the build logger with the result status
 		if buildLogger != nil {
 			buildLogger.Close(result.Success && !result.Skipped)
+			result.BuildLogPath = buildLogger.GetFinalPath()
 			
 			// Log final status to main.log after build logger is closed
 			if d.logger != nil && !result.Skipped {
@@ -123,6 +462,7 @@ func (d *Deployer) Deploy(ctx context.Context, project *ProjectConfig, triggerSo
 				}
 			}
 		}
+		d.runResultHook(project, &result, triggerSource, result.BuildLogPath)
 		lock.Unlock()
 		// Track active builds and process pending reload when all builds complete
 		if atomic.AddInt32(&d.activeBuilds, -1) == 0 && d.configManager != nil {
@@ -135,37 +475,91 @@ func (d *Deployer) Deploy(ctx context.Context, project *ProjectConfig, triggerSo
 
 	// Log to both service logger and build logger
 	if d.logger != nil {
-		d.logger.Infof(project.Name, "Starting deployment (trigger: %s)", triggerSource)
+		d.logger.Infof(project.Name, "Starting deployment (trigger: %s, build: %s)", triggerSource, result.BuildID)
 	}
 	if buildLogger != nil {
-		buildLogger.Infof(project.Name, "Starting deployment (trigger: %s)", triggerSource)
+		buildLogger.Infof(project.Name, "Starting deployment (trigger: %s, build: %s)", triggerSource, result.BuildID)
+	}
+	if opts.Force {
+		if d.logger != nil {
+			d.logger.Infof(project.Name, "Forced build: no-change skipping disabled")
+		}
+		if buildLogger != nil {
+			buildLogger.Infof(project.Name, "Forced build: no-change skipping disabled")
+		}
+	}
+
+	// deploy_timeout_seconds bounds everything from here on: preflight, git
+	// and the command. Processes still running when it expires are stopped
+	// like on timeout_seconds.
+	parentCtx := ctx
+	if project.DeployTimeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, time.Duration(project.DeployTimeout)*time.Second)
+		defer cancel()
+	}
+
+	// Surface config edits that have not been loaded yet
+	if d.configManager != nil && d.configManager.HasConfigDrift() {
+		const driftWarning = "WARNING: config on disk differs from running config; reload pending"
+		if d.logger != nil {
+			d.logger.Warn(project.Name, driftWarning)
+		}
+		if buildLogger != nil {
+			buildLogger.Warn(project.Name, driftWarning)
+		}
 	}
 
+	// Follow the remote's default branch when git_branch is not set
+	project = d.withRemoteBranch(ctx, project)
+
 	// Log build config
 	d.logBuildConfig(project, buildLogger)
 
 	// Run preflight checks (directory existence, ownership, permissions)
-	if err := runPreflightChecks(ctx, project, buildLogger); err != nil {
+	endPhase := startPhase(project, &result, "preflight", buildLogger)
+	err := runPreflightChecks(ctx, project, buildLogger)
+	endPhase()
+	if err != nil {
+		err = deployTimeoutError(ctx, parentCtx, project, "preflight checks", err)
 		result.Error = err.Error()
-		result.EndTime = time.Now()
+		result.ErrorKind = errorKindOf(err, ErrorKindPreflightFailed)
+		result.EndTime = d.clock.Now()
 		if buildLogger != nil {
 			buildLogger.Errorf(project.Name, "Preflight checks failed: %v", err)
 		}
-		d.sendNotification(project, &result, triggerSource)
+		d.sendNotification(project, &result, triggerSource, buildLogger)
 		return result
 	}
 
 	// Git operations (if git_repo is configured)
 	hasChanges := true // Default to true for non-git projects
 	if project.GitRepo != "" {
-		var err error
-		hasChanges, err = d.handleGitOperations(ctx, project, buildLogger)
+		endPhase := startPhase(project, &result, "git", buildLogger)
+		hasChanges, err = d.runGitOperations(ctx, project, opts.Commit, buildLogger)
+		endPhase()
 		if err != nil {
+			err = deployTimeoutError(ctx, parentCtx, project, "git operations", err)
 			result.Error = err.Error()
-			result.EndTime = time.Now()
-			d.sendNotification(project, &result, triggerSource)
+			result.ErrorKind = errorKindOf(err, ErrorKindGitPullFailed)
+			result.EndTime = d.clock.Now()
+			d.sendNotification(project, &result, triggerSource, buildLogger)
 			return result
 		}
+
+		// Hand the checkout to chown_to, e.g. the web server user
+		if project.ChownTo != "" {
+			endPhase := startPhase(project, &result, "chown", buildLogger)
+			err := d.applyChownTo(project, buildLogger)
+			endPhase()
+			if err != nil {
+				result.Error = err.Error()
+				result.ErrorKind = ErrorKindChownFailed
+				result.EndTime = d.clock.Now()
+				d.sendNotification(project, &result, triggerSource, buildLogger)
+				return result
+			}
+		}
 		
 		// Check if we should skip build due to no changes
 		// Only skip if:
@@ -173,9 +567,17 @@ func (d *Deployer) Deploy(ctx context.Context, project *ProjectConfig, triggerSo
 		// 2. Trigger is from GitHub push webhook OR trigger source is unknown
 		if !hasChanges {
 			shouldSkip := shouldSkipBuildOnNoChanges(triggerSource)
-			if shouldSkip {
+			if opts.Force {
+				if buildLogger != nil {
+					buildLogger.Infof(project.Name, "No changes detected, but proceeding with build (forced, trigger: %s)", triggerSource)
+				}
+			} else if project.DeployOnNoChange {
+				if buildLogger != nil {
+					buildLogger.Infof(project.Name, "No changes detected, but proceeding with build (deploy_on_no_change enabled, trigger: %s)", triggerSource)
+				}
+			} else if shouldSkip {
 				result.Skipped = true
-				result.EndTime = time.Now()
+				result.EndTime = d.clock.Now()
 				if buildLogger != nil {
 					buildLogger.Infof(project.Name, "Build ignored: no changes in the configured branch (trigger: %s)", triggerSource)
 				}
@@ -193,20 +595,59 @@ func (d *Deployer) Deploy(ctx context.Context, project *ProjectConfig, triggerSo
 		}
 	}
 
+	if isGitRepo(project.LocalPath) {
+		if sha, err := getCurrentCommitSHA(ctx, project.LocalPath); err == nil {
+			result.CommitSHA = sha
+		}
+	}
+
+	// deploy_strategy atomic builds in a fresh worktree of the checkout
+	runProject := project
+	release := ""
+	if project.DeployStrategy == DeployStrategyAtomic {
+		endPhase := startPhase(project, &result, "release", buildLogger)
+		release, err = d.prepareRelease(ctx, project, result.BuildID, buildLogger)
+		endPhase()
+		if err != nil {
+			err = deployTimeoutError(ctx, parentCtx, project, "release", err)
+			result.Error = err.Error()
+			result.ErrorKind = errorKindOf(err, ErrorKindReleaseFailed)
+			result.EndTime = d.clock.Now()
+			if buildLogger != nil {
+				buildLogger.Errorf(project.Name, "Failed to prepare release: %v", err)
+			}
+			d.sendNotification(project, &result, triggerSource, buildLogger)
+			return result
+		}
+		variant := *project
+		variant.ExecutePath = release
+		runProject = &variant
+	}
+
 	// Execute deployment command
-	output, err := d.executeCommand(ctx, project, triggerSource, buildLogger)
+	endPhase = startPhase(project, &result, "command", buildLogger)
+	output, err := d.executeCommand(ctx, runProject, triggerSource, opts.Push, buildLogger)
+	endPhase()
+	if release != "" {
+		err = d.finishRelease(ctx, project, release, err, buildLogger)
+	}
 	result.Output = output
-	result.EndTime = time.Now()
+	result.EndTime = d.clock.Now()
 
 	if err != nil {
+		err = deployTimeoutError(ctx, parentCtx, project, "command", err)
 		result.Success = false
 		result.Error = err.Error()
+		result.ErrorKind = errorKindOf(err, ErrorKindCommandFailed)
 		if buildLogger != nil {
 			buildLogger.Errorf(project.Name, "Deployment failed: %v", err)
 			d.logCommandOutput(project.Name, output, true, buildLogger)
 		}
 	} else {
 		result.Success = true
+		if project.GitRepo != "" && result.CommitSHA != "" {
+			d.recordDeployedCommit(ctx, project, result.CommitSHA, triggerSource == rollbackTriggerSource, buildLogger)
+		}
 		if buildLogger != nil {
 			// Log command output BEFORE "Deployment completed" message
 			d.logCommandOutput(project.Name, output, false, buildLogger)
@@ -214,10 +655,29 @@ func (d *Deployer) Deploy(ctx context.Context, project *ProjectConfig, triggerSo
 		}
 	}
 
-	d.sendNotification(project, &result, triggerSource)
+	d.sendNotification(project, &result, triggerSource, buildLogger)
 	return result
 }
 
+// startPhase marks the start of a build phase in the build log. The returned
+// function records the phase's duration in result.Phases and logs it.
+func startPhase(project *ProjectConfig, result *DeployResult, phase string, buildLogger *BuildLogger) func() {
+	if buildLogger != nil {
+		buildLogger.Infof(project.Name, "=== Phase: %s ===", phase)
+	}
+	start := time.Now()
+	return func() {
+		elapsed := time.Since(start)
+		if result.Phases == nil {
+			result.Phases = make(map[string]time.Duration)
+		}
+		result.Phases[phase] = elapsed
+		if buildLogger != nil {
+			buildLogger.Infof(project.Name, "=== Phase: %s finished in %v ===", phase, elapsed.Round(time.Millisecond))
+		}
+	}
+}
+
 // logCommandOutput logs the command output if it's not empty
 func (d *Deployer) logCommandOutput(projectName, output string, isError bool, buildLogger *BuildLogger) {
 	if buildLogger == nil {
@@ -242,43 +702,122 @@ func (d *Deployer) logBuildConfig(project *ProjectConfig, buildLogger *BuildLogg
 	if project.GitSSHKeyPath != "" {
 		sshKeyStatus = "configured"
 	}
-	buildLogger.Infof(project.Name, "Build config: name=%s, local_path=%s, git_repo=%s, git_branch=%s, git_update=%t, git_ssh_key=%s, execute_path=%s, execute_command=%s, env_variables=%d",
+	// Same for the HTTPS token
+	tokenStatus := "none"
+	if project.GitToken != "" || project.GitTokenFile != "" {
+		tokenStatus = "configured"
+	}
+	buildLogger.Infof(project.Name, "Build config: name=%s, local_path=%s, git_repo=%s, git_branch=%s, git_update=%t, git_ssh_key=%s, git_token=%s, execute_path=%s, execute_command=%s, env_variables=%d",
 		project.Name,
 		project.LocalPath,
 		project.GitRepo,
 		project.GitBranch,
 		project.GitUpdate,
 		sshKeyStatus,
+		tokenStatus,
 		project.ExecutePath,
-		project.ExecuteCommand,
+		project.CommandSummary(),
 		len(project.EnvVariables),
 	)
 }
 
-// handleGitOperations handles git clone/pull based on configuration
+// logBuildEnvironment writes a header describing the runtime a build runs in,
+// so a build log can be reproduced: SDeploy and Go versions, host, git
+// version, the resolved shell and the exact command line (one per step of a
+// list-form execute_command). The command line goes through the build log's
+// redactor like every other message.
+func (d *Deployer) logBuildEnvironment(ctx context.Context, project *ProjectConfig, buildLogger *BuildLogger) {
+	if buildLogger == nil {
+		return
+	}
+	hostname, err := os.Hostname()
+	if err != nil {
+		hostname = "unknown"
+	}
+	cmd := buildCommand(ctx, project.Shell, project.Umask, project.ExecuteCommand)
+	shell, shellStatus := cmd.Path, cmd.Path
+	if cmd.Err != nil {
+		shell = cmd.Args[0]
+		shellStatus = fmt.Sprintf("%s (not found: %v)", shell, cmd.Err)
+	}
+
+	buildLogger.Infof(project.Name, "Build environment:")
+	buildLogger.Infof(project.Name, "  SDeploy: %s %s", ServiceName, Version)
+	buildLogger.Infof(project.Name, "  Go: %s %s/%s", runtime.Version(), runtime.GOOS, runtime.GOARCH)
+	buildLogger.Infof(project.Name, "  Host: %s", hostname)
+	buildLogger.Infof(project.Name, "  Git: %s", gitVersion(ctx))
+	buildLogger.Infof(project.Name, "  Shell: %s", shellStatus)
+	if len(project.ExecuteSteps) == 0 {
+		buildLogger.Infof(project.Name, "  Command: %s %s %q", shell, strings.Join(cmd.Args[1:len(cmd.Args)-1], " "), cmd.Args[len(cmd.Args)-1])
+		return
+	}
+	for i, step := range project.ExecuteSteps {
+		cmd := buildCommand(ctx, project.Shell, project.Umask, step.Command)
+		buildLogger.Infof(project.Name, "  Step %d: %s %s %q", i+1, shell, strings.Join(cmd.Args[1:len(cmd.Args)-1], " "), cmd.Args[len(cmd.Args)-1])
+	}
+}
+
+// gitVersion returns the output of git --version, or why it is unavailable
+func gitVersion(ctx context.Context) string {
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+	output, err := exec.CommandContext(ctx, "git", "--version").Output()
+	if err != nil {
+		return fmt.Sprintf("unavailable (%v)", err)
+	}
+	return strings.TrimSpace(string(output))
+}
+
+// handleGitOperations handles git clone/pull based on configuration. With
+// deploy_exact_commit and a non-empty commit, the checkout is moved to that
+// commit instead of the branch head.
 // Returns true if there were changes, false if no changes detected
-func (d *Deployer) handleGitOperations(ctx context.Context, project *ProjectConfig, buildLogger *BuildLogger) (bool, error) {
+func (d *Deployer) handleGitOperations(ctx context.Context, project *ProjectConfig, commit string, buildLogger *BuildLogger) (bool, error) {
+	exactCommit := ""
+	if project.DeployExactCommit {
+		exactCommit = commit
+	}
+
 	// Validate SSH key if configured
 	if project.GitSSHKeyPath != "" {
 		if err := validateSSHKeyPath(project.GitSSHKeyPath); err != nil {
 			if buildLogger != nil {
 				buildLogger.Errorf(project.Name, "SSH key validation failed: %v", err)
 			}
-			return false, fmt.Errorf("SSH key validation failed: %v", err)
+			return false, newDeployError(ErrorKindSSHKeyInvalid, fmt.Errorf("SSH key validation failed: %v", err))
 		}
 		if buildLogger != nil {
 			buildLogger.Infof(project.Name, "Using SSH key for git operations")
 		}
 	}
+	if project.GitKnownHostsPath != "" && buildLogger != nil {
+		buildLogger.Infof(project.Name, "Using pinned known_hosts file for SSH host verification")
+	}
+
+	// Check the HTTPS token is readable before git runs without it
+	if project.GitToken != "" || project.GitTokenFile != "" {
+		if _, err := project.gitToken(); err != nil {
+			if buildLogger != nil {
+				buildLogger.Errorf(project.Name, "Git token validation failed: %v", err)
+			}
+			return false, newDeployError(ErrorKindGitTokenInvalid, fmt.Errorf("git token validation failed: %v", err))
+		}
+		if buildLogger != nil {
+			buildLogger.Infof(project.Name, "Using access token for HTTPS git operations")
+		}
+	}
 
 	// Check if local_path exists and is a git repo
 	if !isGitRepo(project.LocalPath) {
 		// Need to clone
-		if err := d.gitClone(ctx, project, buildLogger); err != nil {
+		err := d.retryGit(ctx, project, "clone", buildLogger, func() error {
+			return d.gitClone(ctx, project, buildLogger)
+		})
+		if err != nil {
 			if buildLogger != nil {
 				buildLogger.Errorf(project.Name, "Git clone failed: %v", err)
 			}
-			return false, fmt.Errorf("git clone failed: %v", err)
+			return false, newDeployError(ErrorKindGitCloneFailed, fmt.Errorf("git clone failed: %v", err))
 		}
 		if buildLogger != nil {
 			buildLogger.Infof(project.Name, "Cloned repository to %s", project.LocalPath)
@@ -290,7 +829,18 @@ func (d *Deployer) handleGitOperations(ctx context.Context, project *ProjectConf
 			if buildLogger != nil {
 				buildLogger.Errorf(project.Name, "Failed to checkout configured branch after clone: %v", err)
 			}
-			return false, fmt.Errorf("failed to checkout configured branch after clone: %v", err)
+			return false, newDeployError(ErrorKindBranchCheckoutFailed, fmt.Errorf("failed to checkout configured branch after clone: %v", err))
+		}
+		if exactCommit != "" {
+			err := d.retryGit(ctx, project, "fetch", buildLogger, func() error {
+				return d.gitCheckoutCommit(ctx, project, exactCommit, buildLogger)
+			})
+			if err != nil {
+				if buildLogger != nil {
+					buildLogger.Errorf(project.Name, "Checkout of commit %s failed: %v", truncateSHA(exactCommit, d.shaLength), err)
+				}
+				return false, newDeployError(ErrorKindCommitCheckoutFailed, fmt.Errorf("checkout of commit %s failed: %v", exactCommit, err))
+			}
 		}
 		// Clone always brings new code, so consider it as having changes
 		return true, nil
@@ -298,36 +848,90 @@ func (d *Deployer) handleGitOperations(ctx context.Context, project *ProjectConf
 		if buildLogger != nil {
 			buildLogger.Infof(project.Name, "Repository already cloned at %s", project.LocalPath)
 		}
+
+		// Refuse (or stash) local modifications before touching the checkout
+		if project.RequireCleanTree {
+			if err := d.ensureCleanTree(ctx, project, buildLogger); err != nil {
+				if buildLogger != nil {
+					buildLogger.Errorf(project.Name, "%v", err)
+				}
+				return false, newDeployError(ErrorKindDirtyTree, err)
+			}
+		}
 		
-		// Ensure we're on the correct branch before pulling or executing commands
-		if err := d.ensureCorrectBranch(ctx, project, buildLogger); err != nil {
+		// Fail fast if the configured branch does not exist on the remote
+		if err := d.verifyRemoteBranch(ctx, project, buildLogger); err != nil {
 			if buildLogger != nil {
-				buildLogger.Errorf(project.Name, "Failed to checkout configured branch: %v", err)
+				buildLogger.Errorf(project.Name, "%v", err)
 			}
-			return false, fmt.Errorf("failed to checkout configured branch: %v", err)
+			return false, newDeployError(ErrorKindBranchCheckoutFailed, err)
 		}
-		
-		// Check if we should do git pull
+
+		// Record HEAD before switching branches, so a push to another branch
+		// sharing this checkout (branch_commands, --branch) counts as a change
+		var beforeSHA string
 		if project.GitUpdate {
-			// Get current commit SHA before pull
-			beforeSHA, err := getCurrentCommitSHA(ctx, project.LocalPath)
+			sha, err := getCurrentCommitSHA(ctx, project.LocalPath)
 			if err != nil {
 				if buildLogger != nil {
 					buildLogger.Warnf(project.Name, "Failed to get commit SHA before pull: %v", err)
 				}
 				// Continue with pull even if we can't get SHA
-				beforeSHA = ""
 			}
-			
-			if err := d.gitPull(ctx, project, buildLogger); err != nil {
+			beforeSHA = sha
+		}
+
+		// Ensure we're on the correct branch before pulling or executing commands.
+		// Exact-commit deploys detach HEAD anyway.
+		if exactCommit == "" || !project.GitUpdate {
+			if err := d.ensureCorrectBranch(ctx, project, buildLogger); err != nil {
 				if buildLogger != nil {
-					buildLogger.Errorf(project.Name, "Git pull failed: %v", err)
+					buildLogger.Errorf(project.Name, "Failed to checkout configured branch: %v", err)
 				}
-				return false, fmt.Errorf("git pull failed: %v", err)
+				return false, newDeployError(ErrorKindBranchCheckoutFailed, fmt.Errorf("failed to checkout configured branch: %v", err))
 			}
-			if buildLogger != nil {
-				buildLogger.Infof(project.Name, "Executed git pull")
+		}
+		
+		// Check if we should do git pull
+		if project.GitUpdate {
+			if exactCommit != "" {
+				err := d.retryGit(ctx, project, "fetch", buildLogger, func() error {
+					return d.gitCheckoutCommit(ctx, project, exactCommit, buildLogger)
+				})
+				if err != nil {
+					if buildLogger != nil {
+						buildLogger.Errorf(project.Name, "Checkout of commit %s failed: %v", truncateSHA(exactCommit, d.shaLength), err)
+					}
+					return false, newDeployError(ErrorKindCommitCheckoutFailed, fmt.Errorf("checkout of commit %s failed: %v", exactCommit, err))
+				}
+			} else {
+				err := d.retryGit(ctx, project, "pull", buildLogger, func() error {
+					return d.gitPull(ctx, project, buildLogger)
+				})
+				if err != nil {
+					if !project.AutoRecover || !isPullConflict(err.Error()) {
+						if buildLogger != nil {
+							buildLogger.Errorf(project.Name, "Git pull failed: %v", err)
+						}
+						return false, newDeployError(ErrorKindGitPullFailed, fmt.Errorf("git pull failed: %v", err))
+					}
+					if buildLogger != nil {
+						buildLogger.Warnf(project.Name, "AUTO-RECOVER: git pull conflicted, resetting to origin/%s (local commits are discarded)", project.GitBranch)
+					}
+					if err := d.gitRecover(ctx, project, buildLogger); err != nil {
+						if buildLogger != nil {
+							buildLogger.Errorf(project.Name, "Auto-recover failed: %v", err)
+						}
+						return false, newDeployError(ErrorKindGitPullFailed, fmt.Errorf("git pull conflicted and auto-recover failed: %v", err))
+					}
+					if buildLogger != nil {
+						buildLogger.Warnf(project.Name, "AUTO-RECOVER: checkout reset to origin/%s", project.GitBranch)
+					}
+				} else if buildLogger != nil {
+					buildLogger.Infof(project.Name, "Executed git pull")
+				}
 			}
+			d.runGitMaintenance(ctx, project, buildLogger)
 			
 			// Get current commit SHA after pull
 			afterSHA, err := getCurrentCommitSHA(ctx, project.LocalPath)
@@ -343,11 +947,14 @@ func (d *Deployer) handleGitOperations(ctx context.Context, project *ProjectConf
 			hasChanges := beforeSHA != afterSHA
 			if buildLogger != nil {
 				if hasChanges {
-					buildLogger.Infof(project.Name, "Changes detected: %s -> %s", truncateSHA(beforeSHA), truncateSHA(afterSHA))
+					buildLogger.Infof(project.Name, "Changes detected: %s -> %s", truncateSHA(beforeSHA, d.shaLength), truncateSHA(afterSHA, d.shaLength))
 				} else {
-					buildLogger.Infof(project.Name, "No changes detected (commit: %s)", truncateSHA(afterSHA))
+					buildLogger.Infof(project.Name, "No changes detected (commit: %s)", truncateSHA(afterSHA, d.shaLength))
 				}
 			}
+			if hasChanges && beforeSHA != "" && (len(project.BuildPaths) > 0 || len(project.IgnorePaths) > 0 || len(project.TriggerFiles) > 0) {
+				hasChanges = d.filterChangedPaths(ctx, project, beforeSHA, afterSHA, buildLogger)
+			}
 			return hasChanges, nil
 		} else {
 			if buildLogger != nil {
@@ -359,6 +966,90 @@ func (d *Deployer) handleGitOperations(ctx context.Context, project *ProjectConf
 	}
 }
 
+// deployTimeoutError replaces err with a timeout error naming the step that
+// was running if deploy_timeout_seconds expired (and not the caller's context)
+func deployTimeoutError(ctx, parentCtx context.Context, project *ProjectConfig, step string, err error) error {
+	if !errors.Is(ctx.Err(), context.DeadlineExceeded) || parentCtx.Err() != nil {
+		return err
+	}
+	return newDeployError(ErrorKindTimeout, fmt.Errorf("deploy timed out after %d seconds during %s: %v", project.DeployTimeout, step, err))
+}
+
+// runGitOperations runs handleGitOperations under the project's git timeout
+// (git_timeout_seconds, falling back to timeout_seconds) and reports an
+// expired deadline as a git timeout rather than a command failure
+func (d *Deployer) runGitOperations(ctx context.Context, project *ProjectConfig, commit string, buildLogger *BuildLogger) (bool, error) {
+	timeout := project.GitTimeoutSeconds
+	if timeout == 0 {
+		timeout = project.TimeoutSeconds
+	}
+	if timeout <= 0 {
+		return d.handleGitOperations(ctx, project, commit, buildLogger)
+	}
+
+	gitCtx, cancel := context.WithTimeout(ctx, time.Duration(timeout)*time.Second)
+	defer cancel()
+
+	hasChanges, err := d.handleGitOperations(gitCtx, project, commit, buildLogger)
+	if err != nil && errors.Is(gitCtx.Err(), context.DeadlineExceeded) && ctx.Err() == nil {
+		if buildLogger != nil {
+			buildLogger.Errorf(project.Name, "Git operations timed out after %d seconds", timeout)
+		}
+		return false, newDeployError(ErrorKindTimeout, fmt.Errorf("git timed out after %d seconds: %v", timeout, err))
+	}
+	return hasChanges, err
+}
+
+// runGitMaintenance runs git gc --auto on every git_maintenance-th update of
+// the checkout. gc --auto only repacks and prunes once git's own thresholds
+// are exceeded, so most runs return immediately. Failures are logged and do
+// not fail the deployment.
+func (d *Deployer) runGitMaintenance(ctx context.Context, project *ProjectConfig, buildLogger *BuildLogger) {
+	if project.GitMaintenance <= 0 {
+		return
+	}
+	count := d.state.countPull(project.LockKey())
+	if count%project.GitMaintenance != 0 {
+		return
+	}
+	if buildLogger != nil {
+		buildLogger.Infof(project.Name, "Running git maintenance (update %d, every %d): git gc --auto", count, project.GitMaintenance)
+	}
+
+	// Use exec.CommandContext directly with separate arguments to avoid shell injection
+	cmd := exec.CommandContext(ctx, "git", "gc", "--auto")
+	setProcessGroup(cmd)
+	stopKill := setGroupCancel(cmd)
+	defer stopKill()
+	cmd.Dir = project.LocalPath
+
+	output, err := combinedOutputWithUmask(cmd, project.Umask)
+	if buildLogger != nil && len(output) > 0 {
+		buildLogger.Infof(project.Name, "Output: %s", strings.TrimSpace(string(output)))
+	}
+	if err != nil && buildLogger != nil {
+		buildLogger.Warnf(project.Name, "Git maintenance failed (continuing): %v", err)
+	}
+}
+
+// applyChownTo recursively changes ownership of local_path to chown_to
+func (d *Deployer) applyChownTo(project *ProjectConfig, buildLogger *BuildLogger) error {
+	uid, gid, err := lookupOwner(project.ChownTo)
+	if err == nil {
+		if buildLogger != nil {
+			buildLogger.Infof(project.Name, "Changing ownership of %s to %s (%d:%d)", project.LocalPath, project.ChownTo, uid, gid)
+		}
+		err = chownTree(project.LocalPath, uid, gid)
+	}
+	if err != nil {
+		err = fmt.Errorf("chown_to %s failed: %v", project.ChownTo, err)
+		if buildLogger != nil {
+			buildLogger.Errorf(project.Name, "%v", err)
+		}
+	}
+	return err
+}
+
 // isGitRepo checks if the given path is a git repository
 func isGitRepo(path string) bool {
 	if path == "" {
@@ -402,25 +1093,128 @@ func getCurrentCommitSHA(ctx context.Context, repoPath string) (string, error) {
 	return sha, nil
 }
 
-// truncateSHA safely truncates a commit SHA to 8 characters for logging
-func truncateSHA(sha string) string {
-	if len(sha) < 8 {
-		return sha
+// Refs in the checkout recording the last two distinct successful deploys,
+// read by sdeploy rollback. Keeping them in the repository makes them survive
+// restarts, follow the checkout and keep the commits from being pruned.
+const (
+	deployedRef = "refs/sdeploy/deployed"
+	previousRef = "refs/sdeploy/previous"
+)
+
+// recordDeployedCommit moves deployedRef to sha after a successful deploy,
+// shifting the commit it pointed at to previousRef. A rollback only moves
+// deployedRef: previousRef keeps the good commit it rolled back to, so
+// rolling back again never returns to the release that was rolled back from.
+// Redeploying the same commit changes nothing. Failures are logged and do not
+// fail the deployment.
+func (d *Deployer) recordDeployedCommit(ctx context.Context, project *ProjectConfig, sha string, rollback bool, buildLogger *BuildLogger) {
+	current, _ := resolveRef(ctx, project.LocalPath, deployedRef)
+	if current == sha {
+		return
+	}
+	updates := [][]string{{"update-ref", deployedRef, sha}}
+	if current != "" && !rollback {
+		updates = append([][]string{{"update-ref", previousRef, current}}, updates...)
+	}
+	for _, args := range updates {
+		// Use exec.CommandContext directly with separate arguments to avoid shell injection
+		cmd := exec.CommandContext(ctx, "git", args...)
+		cmd.Dir = project.LocalPath
+		if output, err := cmd.CombinedOutput(); err != nil {
+			if buildLogger != nil {
+				buildLogger.Warnf(project.Name, "Failed to record deployed commit (continuing): %v: %s", err, strings.TrimSpace(string(output)))
+			}
+			return
+		}
 	}
-	return sha[:8]
 }
 
-// isValidGitRepo checks if the path is a valid git repository by running a git command
-func isValidGitRepo(ctx context.Context, repoPath string) bool {
-	if !isGitRepo(repoPath) {
-		return false
-	}
-	// Use a lighter git command to verify repository validity
-	// Use exec.Command directly with separate arguments for consistency and security
-	cmd := exec.CommandContext(ctx, "git", "rev-parse", "--git-dir")
+// resolveRef returns the commit a ref in the repository at repoPath points at
+func resolveRef(ctx context.Context, repoPath, ref string) (string, error) {
+	cmd := exec.CommandContext(ctx, "git", "rev-parse", "--verify", "--quiet", ref+"^{commit}")
 	cmd.Dir = repoPath
-	err := cmd.Run()
-	return err == nil
+
+	output, err := cmd.Output()
+	if err != nil {
+		return "", fmt.Errorf("%s not found", ref)
+	}
+	return strings.TrimSpace(string(output)), nil
+}
+
+// filterChangedPaths applies trigger_files or build_paths / ignore_paths to the
+// files changed between two commits and reports whether any of them should trigger a build.
+// If the diff cannot be computed it assumes a build is needed.
+func (d *Deployer) filterChangedPaths(ctx context.Context, project *ProjectConfig, beforeSHA, afterSHA string, buildLogger *BuildLogger) bool {
+	files, err := getChangedFiles(ctx, project.LocalPath, beforeSHA, afterSHA)
+	if err != nil {
+		if buildLogger != nil {
+			buildLogger.Warnf(project.Name, "Failed to list changed files, skipping path filters: %v", err)
+		}
+		return true
+	}
+
+	relevant := relevantChanges(project, files)
+	if buildLogger != nil {
+		buildLogger.Infof(project.Name, "Changed files (%d): %s", len(files), strings.Join(files, ", "))
+		if len(project.TriggerFiles) > 0 {
+			if len(relevant) > 0 {
+				buildLogger.Infof(project.Name, "Trigger files changed: %s", strings.Join(relevant, ", "))
+			} else {
+				buildLogger.Infof(project.Name, "Trigger files: none of %s changed, treating as no changes", strings.Join(project.TriggerFiles, ", "))
+			}
+		} else if len(relevant) > 0 {
+			buildLogger.Infof(project.Name, "Path filters: %d of %d changed files trigger a build", len(relevant), len(files))
+		} else {
+			buildLogger.Infof(project.Name, "Path filters: all changed files are filtered out by build_paths/ignore_paths, treating as no changes")
+		}
+	}
+	return len(relevant) > 0
+}
+
+// getChangedFiles returns the files changed between two commits
+func getChangedFiles(ctx context.Context, repoPath, fromSHA, toSHA string) ([]string, error) {
+	cmd := exec.CommandContext(ctx, "git", "diff", "--name-only", fromSHA+".."+toSHA)
+	cmd.Dir = repoPath
+	stopKill := setGroupCancel(cmd)
+	defer stopKill()
+
+	output, err := cmd.Output()
+	if err != nil {
+		return nil, fmt.Errorf("git diff failed: %v", err)
+	}
+
+	var files []string
+	for _, line := range strings.Split(string(output), "\n") {
+		if line = strings.TrimSpace(line); line != "" {
+			files = append(files, line)
+		}
+	}
+	return files, nil
+}
+
+// truncateSHA safely truncates a commit SHA to length characters for logging
+// (Defaults.SHALength if length is not positive)
+func truncateSHA(sha string, length int) string {
+	if length <= 0 {
+		length = Defaults.SHALength
+	}
+	if len(sha) < length {
+		return sha
+	}
+	return sha[:length]
+}
+
+// isValidGitRepo checks if the path is a valid git repository by running a git command
+func isValidGitRepo(ctx context.Context, repoPath string) bool {
+	if !isGitRepo(repoPath) {
+		return false
+	}
+	// Use a lighter git command to verify repository validity
+	// Use exec.Command directly with separate arguments for consistency and security
+	cmd := exec.CommandContext(ctx, "git", "rev-parse", "--git-dir")
+	cmd.Dir = repoPath
+	err := cmd.Run()
+	return err == nil
 }
 
 // ensureCorrectBranch verifies and checks out the configured branch if needed
@@ -467,8 +1261,191 @@ func (d *Deployer) ensureCorrectBranch(ctx context.Context, project *ProjectConf
 	return nil
 }
 
-// gitCheckout checks out the configured branch
+// verifyRemoteBranch checks that the configured branch exists on the origin remote.
+// If the remote cannot be queried, it logs a warning and lets the later git
+// operations report the underlying problem.
+func (d *Deployer) verifyRemoteBranch(ctx context.Context, project *ProjectConfig, buildLogger *BuildLogger) error {
+	if buildLogger != nil {
+		buildLogger.Infof(project.Name, "Running: git ls-remote --heads origin %s", project.GitBranch)
+	}
+
+	// Use exec.Command directly with separate arguments to avoid shell injection
+	cmd := exec.CommandContext(ctx, "git", "ls-remote", "--heads", "origin", project.GitBranch)
+	setProcessGroup(cmd)
+	stopKill := setGroupCancel(cmd)
+	defer stopKill()
+	cmd.Dir = project.LocalPath
+
+	// Set GIT_SSH_COMMAND if SSH options are configured
+	cmd.Env = gitEnv(project)
+
+	output, err := cmd.Output()
+	if err != nil {
+		if buildLogger != nil {
+			buildLogger.Warnf(project.Name, "Could not verify branch %s on remote: %v", project.GitBranch, err)
+		}
+		return nil
+	}
+
+	// ls-remote matches patterns by suffix, so look for the exact ref
+	wantRef := "refs/heads/" + project.GitBranch
+	for _, line := range strings.Split(string(output), "\n") {
+		fields := strings.Fields(line)
+		if len(fields) == 2 && fields[1] == wantRef {
+			return nil
+		}
+	}
+
+	return fmt.Errorf("configured branch %q does not exist on remote", project.GitBranch)
+}
+
+// remoteBranchTimeout bounds the query for a remote's default branch
+const remoteBranchTimeout = 30 * time.Second
+
+// withRemoteBranch returns project with GitBranch set to the remote's default
+// branch if git_branch was not configured. It runs in the deploy: unless the
+// branch is already known (see knownRemoteBranch) the remote is queried once
+// per git_repo; if that fails, Defaults.GitBranch is kept and the query is
+// retried on the next deploy.
+func (d *Deployer) withRemoteBranch(ctx context.Context, project *ProjectConfig) *ProjectConfig {
+	resolved, known := d.knownRemoteBranch(ctx, project)
+	if known {
+		return resolved
+	}
+
+	branch, err := remoteDefaultBranch(ctx, project)
+	if err != nil {
+		if d.logger != nil {
+			d.logger.Warnf(project.Name, "Could not query remote default branch, using %s: %v", project.GitBranch, err)
+		}
+		return project
+	}
+	d.setRemoteBranch(project, branch)
+	return withGitBranch(project, branch)
+}
+
+// knownRemoteBranch is withRemoteBranch without querying the remote, so the
+// webhook handler can use it: the branch comes from an earlier lookup or from
+// the checkout's origin/HEAD, which git clone records. known is false when
+// git_branch is unset and neither has it yet; project is returned unchanged.
+func (d *Deployer) knownRemoteBranch(ctx context.Context, project *ProjectConfig) (resolved *ProjectConfig, known bool) {
+	if !project.remoteBranch || project.GitRepo == "" {
+		return project, true
+	}
+
+	d.remoteBranchesMu.Lock()
+	branch, ok := d.remoteBranches[project.GitRepo]
+	d.remoteBranchesMu.Unlock()
+	if !ok {
+		var err error
+		if branch, err = checkoutDefaultBranch(ctx, project.LocalPath); err != nil {
+			return project, false
+		}
+		d.setRemoteBranch(project, branch)
+	}
+	return withGitBranch(project, branch), true
+}
+
+// setRemoteBranch remembers branch as the default branch of project's git_repo
+func (d *Deployer) setRemoteBranch(project *ProjectConfig, branch string) {
+	d.remoteBranchesMu.Lock()
+	defer d.remoteBranchesMu.Unlock()
+
+	if _, ok := d.remoteBranches[project.GitRepo]; ok {
+		return
+	}
+	d.remoteBranches[project.GitRepo] = branch
+	if d.logger != nil {
+		d.logger.Infof(project.Name, "git_branch not set, using remote default branch: %s", branch)
+	}
+}
+
+// withGitBranch returns project, or a copy of it deploying branch
+func withGitBranch(project *ProjectConfig, branch string) *ProjectConfig {
+	if branch == project.GitBranch {
+		return project
+	}
+	resolved := *project
+	resolved.GitBranch = branch
+	return &resolved
+}
+
+// checkoutDefaultBranch returns the remote default branch recorded in the
+// checkout at localPath (refs/remotes/origin/HEAD). It only reads the local
+// repository.
+func checkoutDefaultBranch(ctx context.Context, localPath string) (string, error) {
+	if localPath == "" || !isGitRepo(localPath) {
+		return "", fmt.Errorf("no checkout")
+	}
+	// Use exec.Command directly with separate arguments to avoid shell injection
+	cmd := exec.CommandContext(ctx, "git", "symbolic-ref", "--short", "refs/remotes/origin/HEAD")
+	cmd.Dir = localPath
+	output, err := cmd.Output()
+	if err != nil {
+		return "", err
+	}
+	branch, ok := strings.CutPrefix(strings.TrimSpace(string(output)), "origin/")
+	if !ok {
+		return "", fmt.Errorf("origin/HEAD is not a branch of origin")
+	}
+	if err := validateGitBranch(branch); err != nil {
+		return "", err
+	}
+	return branch, nil
+}
+
+// remoteDefaultBranch returns the branch the remote's HEAD points to
+func remoteDefaultBranch(ctx context.Context, project *ProjectConfig) (string, error) {
+	ctx, cancel := context.WithTimeout(ctx, remoteBranchTimeout)
+	defer cancel()
+
+	// Use exec.Command directly with separate arguments to avoid shell injection
+	cmd := exec.CommandContext(ctx, "git", "ls-remote", "--symref", project.GitRepo, "HEAD")
+	setProcessGroup(cmd)
+	stopKill := setGroupCancel(cmd)
+	defer stopKill()
+
+	// Set GIT_SSH_COMMAND if SSH options are configured
+	cmd.Env = gitEnv(project)
+
+	output, err := cmd.Output()
+	if err != nil {
+		return "", err
+	}
+
+	// The symref line looks like "ref: refs/heads/main<TAB>HEAD"
+	for _, line := range strings.Split(string(output), "\n") {
+		ref, name, found := strings.Cut(line, "\t")
+		if !found || name != "HEAD" || !strings.HasPrefix(ref, "ref: refs/heads/") {
+			continue
+		}
+		branch := strings.TrimPrefix(ref, "ref: refs/heads/")
+		if err := validateGitBranch(branch); err != nil {
+			return "", err
+		}
+		return branch, nil
+	}
+	return "", fmt.Errorf("remote HEAD is not a branch")
+}
+
+// gitCheckout checks out the configured branch, fetching it first so a branch
+// pushed after the clone can be checked out
 func (d *Deployer) gitCheckout(ctx context.Context, project *ProjectConfig, buildLogger *BuildLogger) error {
+	if buildLogger != nil {
+		buildLogger.Infof(project.Name, "Running: git fetch origin %s", project.GitBranch)
+	}
+	fetch := exec.CommandContext(ctx, "git", "fetch", "origin", project.GitBranch)
+	setProcessGroup(fetch)
+	stopFetchKill := setGroupCancel(fetch)
+	defer stopFetchKill()
+	fetch.Dir = project.LocalPath
+	fetch.Env = gitEnv(project)
+	// A failed fetch is not fatal: the branch may already exist locally, and
+	// checkout reports the problem if it does not
+	if output, err := fetch.CombinedOutput(); err != nil && buildLogger != nil {
+		buildLogger.Warnf(project.Name, "git fetch origin %s failed: %v: %s", project.GitBranch, err, strings.TrimSpace(string(output)))
+	}
+
 	if buildLogger != nil {
 		buildLogger.Infof(project.Name, "Running: git checkout %s", project.GitBranch)
 	}
@@ -477,12 +1454,12 @@ func (d *Deployer) gitCheckout(ctx context.Context, project *ProjectConfig, buil
 	// Even though branch name is validated, this is an extra layer of protection
 	cmd := exec.CommandContext(ctx, "git", "checkout", project.GitBranch)
 	setProcessGroup(cmd)
+	stopKill := setGroupCancel(cmd)
+	defer stopKill()
 	cmd.Dir = project.LocalPath
 
-	// Set GIT_SSH_COMMAND if git_ssh_key_path is configured
-	if project.GitSSHKeyPath != "" {
-		cmd.Env = append(os.Environ(), fmt.Sprintf("GIT_SSH_COMMAND=%s", buildGitSSHCommand(project.GitSSHKeyPath)))
-	}
+	// Set GIT_SSH_COMMAND if SSH options are configured
+	cmd.Env = gitEnv(project)
 
 	output, err := cmd.CombinedOutput()
 
@@ -497,9 +1474,58 @@ func (d *Deployer) gitCheckout(ctx context.Context, project *ProjectConfig, buil
 	return nil
 }
 
-// buildGitSSHCommand creates the SSH command string for git operations
-func buildGitSSHCommand(sshKeyPath string) string {
-	return fmt.Sprintf("ssh -i %s -o StrictHostKeyChecking=accept-new -o IdentitiesOnly=yes", sshKeyPath)
+// buildGitSSHCommand creates the SSH command string for git operations.
+// With a known_hosts file only pre-approved host keys are accepted;
+// otherwise unknown hosts are trusted on first use (accept-new).
+func buildGitSSHCommand(sshKeyPath, knownHostsPath string) string {
+	var sshCmd strings.Builder
+	sshCmd.WriteString("ssh")
+	if sshKeyPath != "" {
+		sshCmd.WriteString(fmt.Sprintf(" -i %s", sshKeyPath))
+	}
+	if knownHostsPath != "" {
+		sshCmd.WriteString(fmt.Sprintf(" -o StrictHostKeyChecking=yes -o UserKnownHostsFile=%s", knownHostsPath))
+	} else {
+		sshCmd.WriteString(" -o StrictHostKeyChecking=accept-new")
+	}
+	if sshKeyPath != "" {
+		sshCmd.WriteString(" -o IdentitiesOnly=yes")
+	}
+	return sshCmd.String()
+}
+
+// gitEnv returns the environment for git commands, or nil to inherit the
+// daemon's environment when no SSH options or token are configured
+func gitEnv(project *ProjectConfig) []string {
+	var env []string
+	if project.GitSSHKeyPath != "" || project.GitKnownHostsPath != "" {
+		env = append(env, fmt.Sprintf("GIT_SSH_COMMAND=%s", buildGitSSHCommand(project.GitSSHKeyPath, project.GitKnownHostsPath)))
+	}
+	env = append(env, gitTokenEnv(project)...)
+	if env == nil {
+		return nil
+	}
+	return append(os.Environ(), env...)
+}
+
+// gitTokenEnv passes the project's HTTPS token to git as an Authorization
+// header scoped to the git_repo host. It goes through GIT_CONFIG_* variables
+// rather than the URL or -c arguments so it never shows up in logs or ps.
+func gitTokenEnv(project *ProjectConfig) []string {
+	token, err := project.gitToken()
+	if err != nil || token == "" {
+		return nil
+	}
+	u, err := url.Parse(project.GitRepo)
+	if err != nil || u.Scheme != "https" || u.Host == "" {
+		return nil
+	}
+	credentials := base64.StdEncoding.EncodeToString([]byte("x-access-token:" + token))
+	return []string{
+		"GIT_CONFIG_COUNT=1",
+		fmt.Sprintf("GIT_CONFIG_KEY_0=http.https://%s/.extraHeader", u.Host),
+		"GIT_CONFIG_VALUE_0=Authorization: Basic " + credentials,
+	}
 }
 
 // gitResetHard resets the repository to HEAD, discarding all local changes
@@ -511,6 +1537,8 @@ func (d *Deployer) gitResetHard(ctx context.Context, project *ProjectConfig, bui
 	// Use exec.CommandContext directly with separate arguments to avoid shell injection
 	cmd := exec.CommandContext(ctx, "git", "reset", "--hard")
 	setProcessGroup(cmd)
+	stopKill := setGroupCancel(cmd)
+	defer stopKill()
 	cmd.Dir = project.LocalPath
 
 	output, err := cmd.CombinedOutput()
@@ -526,31 +1554,252 @@ func (d *Deployer) gitResetHard(ctx context.Context, project *ProjectConfig, bui
 	return nil
 }
 
+// ensureCleanTree checks the working tree with git status --porcelain and logs
+// any dirty files. A dirty tree is an error unless dirty_tree_action is stash,
+// in which case the changes (including untracked files) are stashed.
+func (d *Deployer) ensureCleanTree(ctx context.Context, project *ProjectConfig, buildLogger *BuildLogger) error {
+	cmd := exec.CommandContext(ctx, "git", "status", "--porcelain")
+	setProcessGroup(cmd)
+	stopKill := setGroupCancel(cmd)
+	defer stopKill()
+	cmd.Dir = project.LocalPath
+
+	output, err := cmd.Output()
+	if err != nil {
+		return fmt.Errorf("failed to check working tree: %v", err)
+	}
+
+	if len(output) == 0 {
+		if buildLogger != nil {
+			buildLogger.Infof(project.Name, "Working tree is clean")
+		}
+		return nil
+	}
+
+	dirty := strings.Split(strings.TrimRight(string(output), "\n"), "\n")
+
+	if buildLogger != nil {
+		buildLogger.Warnf(project.Name, "Working tree has %d uncommitted change(s):", len(dirty))
+		for _, line := range dirty {
+			buildLogger.Warnf(project.Name, "  %s", line)
+		}
+	}
+
+	if project.DirtyTreeAction != DirtyTreeStash {
+		return fmt.Errorf("working tree is not clean: %d uncommitted change(s) in %s", len(dirty), project.LocalPath)
+	}
+
+	// Supply an identity so stashing works on hosts without a git user configured
+	cmd = exec.CommandContext(ctx, "git", "-c", "user.name=SDeploy", "-c", "user.email=sdeploy@localhost",
+		"stash", "push", "--include-untracked", "-m", "sdeploy: auto-stash before deployment")
+	setProcessGroup(cmd)
+	stopStashKill := setGroupCancel(cmd)
+	defer stopStashKill()
+	cmd.Dir = project.LocalPath
+
+	if output, err := cmd.CombinedOutput(); err != nil {
+		return fmt.Errorf("failed to stash local changes: %v: %s", err, strings.TrimSpace(string(output)))
+	}
+	if buildLogger != nil {
+		buildLogger.Infof(project.Name, "Stashed local changes (git stash list to inspect)")
+	}
+	return nil
+}
+
+// pullConflictPatterns are git pull outputs that auto_recover resolves by
+// resetting to the remote branch. Other failures (network, auth) are left as is.
+var pullConflictPatterns = []string{
+	"CONFLICT",
+	"Automatic merge failed",
+	"would be overwritten by merge",
+	"divergent branches",
+	"Not possible to fast-forward",
+	"refusing to merge unrelated histories",
+}
+
+// gitNetworkErrorPatterns are git outputs of failures that may pass on a
+// retry: the remote could not be reached or the transfer broke off.
+// Authentication errors and missing refs are not retried.
+var gitNetworkErrorPatterns = []string{
+	"Could not resolve host",
+	"Temporary failure in name resolution",
+	"Connection refused",
+	"Failed to connect to",
+	"Couldn't connect to server",
+	"Connection reset",
+	"Connection timed out",
+	"Operation timed out",
+	"Network is unreachable",
+	"No route to host",
+	"ssh: connect to host",
+	"The remote end hung up unexpectedly",
+	"early EOF",
+	"RPC failed",
+	"gnutls_handshake() failed",
+	"The requested URL returned error: 502",
+	"The requested URL returned error: 503",
+	"The requested URL returned error: 504",
+}
+
+// isGitNetworkError reports whether git output shows a network failure
+func isGitNetworkError(output string) bool {
+	for _, pattern := range gitNetworkErrorPatterns {
+		if strings.Contains(output, pattern) {
+			return true
+		}
+	}
+	return false
+}
+
+// maxGitRetryDelay caps the wait between retries of a git step
+const maxGitRetryDelay = 5 * time.Minute
+
+// retryGit runs a git step and retries it up to git_retry_count times while
+// it fails with a network error, waiting git_retry_delay_seconds before the
+// first retry and doubling the wait for each further one. Waiting ends early
+// with the last error when ctx (the git or deploy timeout) expires.
+func (d *Deployer) retryGit(ctx context.Context, project *ProjectConfig, step string, buildLogger *BuildLogger, run func() error) error {
+	err := run()
+	wait := project.GitRetryBaseDelay()
+	for retry := 1; err != nil && retry <= project.GitRetryCount && isGitNetworkError(err.Error()); retry++ {
+		if buildLogger != nil {
+			buildLogger.Warnf(project.Name, "Git %s failed with a network error, retrying in %s (retry %d of %d)", step, wait, retry, project.GitRetryCount)
+		}
+		if !d.sleep(ctx, wait) {
+			return err
+		}
+		err = run()
+		wait = min(wait*2, maxGitRetryDelay)
+	}
+	return err
+}
+
+// sleep blocks for wait on the deployer's clock. Returns false if ctx ended first.
+func (d *Deployer) sleep(ctx context.Context, wait time.Duration) bool {
+	done := make(chan struct{})
+	timer := d.clock.AfterFunc(wait, func() { close(done) })
+	select {
+	case <-done:
+		return true
+	case <-ctx.Done():
+		timer.Stop()
+		return false
+	}
+}
+
+// isPullConflict reports whether git pull output shows a conflict with local state
+func isPullConflict(output string) bool {
+	for _, pattern := range pullConflictPatterns {
+		if strings.Contains(output, pattern) {
+			return true
+		}
+	}
+	return false
+}
+
+// gitRecover aborts any half-done merge, fetches the configured branch and
+// hard-resets the checkout to it. Used by auto_recover after a conflicting pull.
+func (d *Deployer) gitRecover(ctx context.Context, project *ProjectConfig, buildLogger *BuildLogger) error {
+	steps := [][]string{
+		{"merge", "--abort"},
+		{"fetch", "origin", project.GitBranch},
+		{"reset", "--hard", "origin/" + project.GitBranch},
+	}
+	for _, args := range steps {
+		if buildLogger != nil {
+			buildLogger.Infof(project.Name, "Running: git %s", strings.Join(args, " "))
+		}
+
+		// Use exec.CommandContext directly with separate arguments to avoid shell injection
+		cmd := exec.CommandContext(ctx, "git", args...)
+		setProcessGroup(cmd)
+		stopKill := setGroupCancel(cmd)
+		cmd.Dir = project.LocalPath
+		cmd.Env = gitEnv(project)
+
+		output, err := combinedOutputWithUmask(cmd, project.Umask)
+		stopKill()
+		if buildLogger != nil && len(output) > 0 {
+			buildLogger.Infof(project.Name, "Output: %s", strings.TrimSpace(string(output)))
+		}
+		// merge --abort fails when the pull stopped before merging; that is fine
+		if err != nil && args[0] != "merge" {
+			return fmt.Errorf("%v: %s", err, strings.TrimSpace(string(output)))
+		}
+	}
+	return nil
+}
+
+// gitCheckoutCommit fetches origin and checks out commit (detached), after
+// verifying it is on the configured branch. The next regular deploy returns
+// the checkout to the branch.
+func (d *Deployer) gitCheckoutCommit(ctx context.Context, project *ProjectConfig, commit string, buildLogger *BuildLogger) error {
+	if err := d.gitResetHard(ctx, project, buildLogger); err != nil {
+		return fmt.Errorf("failed to reset local changes: %v", err)
+	}
+
+	steps := [][]string{
+		{"fetch", "origin"},
+		{"merge-base", "--is-ancestor", commit, "origin/" + project.GitBranch},
+		{"checkout", "--detach", commit},
+	}
+	for _, args := range steps {
+		if buildLogger != nil {
+			buildLogger.Infof(project.Name, "Running: git %s", strings.Join(args, " "))
+		}
+
+		// Use exec.CommandContext directly with separate arguments to avoid shell injection
+		cmd := exec.CommandContext(ctx, "git", args...)
+		setProcessGroup(cmd)
+		stopKill := setGroupCancel(cmd)
+		cmd.Dir = project.LocalPath
+		cmd.Env = gitEnv(project)
+
+		output, err := cmd.CombinedOutput()
+		stopKill()
+		if buildLogger != nil && len(output) > 0 {
+			buildLogger.Infof(project.Name, "Output: %s", strings.TrimSpace(string(output)))
+		}
+		if err != nil {
+			if args[0] == "merge-base" {
+				return fmt.Errorf("commit %s is not on branch %s", commit, project.GitBranch)
+			}
+			return fmt.Errorf("%v: %s", err, strings.TrimSpace(string(output)))
+		}
+	}
+
+	if buildLogger != nil {
+		buildLogger.Infof(project.Name, "Checked out commit %s", truncateSHA(commit, d.shaLength))
+	}
+	return nil
+}
+
 // gitClone clones a git repository to the specified local path
 func (d *Deployer) gitClone(ctx context.Context, project *ProjectConfig, buildLogger *BuildLogger) error {
 	// Create parent directories if they don't exist
 	parentDir := filepath.Dir(project.LocalPath)
-	if err := ensureParentDirExists(ctx, parentDir, buildLogger, project.Name); err != nil {
+	if err := ensureParentDirExists(ctx, parentDir, project.DirPerm(), buildLogger, project.Name); err != nil {
 		return fmt.Errorf("failed to create parent directory: %v", err)
 	}
 
-	gitCmd := fmt.Sprintf("git clone --branch %s %s %s", project.GitBranch, project.GitRepo, project.LocalPath)
+	args := append([]string{"clone", "--branch", project.GitBranch}, project.GitCloneArgs...)
+	args = append(args, project.GitRepo, project.LocalPath)
 	if buildLogger != nil {
-		buildLogger.Infof(project.Name, "Running: %s", gitCmd)
+		buildLogger.Infof(project.Name, "Running: git %s", strings.Join(args, " "))
 	}
 
-	// Build the command
-	cmd := buildCommand(ctx, gitCmd)
+	// Use exec.Command directly with separate arguments to avoid shell injection
+	cmd := exec.CommandContext(ctx, "git", args...)
 
-	// Set process group so we can kill all child processes
+	// Set process group so a git timeout stops all child processes (ssh, etc.)
 	setProcessGroup(cmd)
+	stopKill := setGroupCancel(cmd)
+	defer stopKill()
 
-	// Set GIT_SSH_COMMAND if git_ssh_key_path is configured
-	if project.GitSSHKeyPath != "" {
-		cmd.Env = append(os.Environ(), fmt.Sprintf("GIT_SSH_COMMAND=%s", buildGitSSHCommand(project.GitSSHKeyPath)))
-	}
+	// Set GIT_SSH_COMMAND if SSH options are configured
+	cmd.Env = gitEnv(project)
 
-	output, err := cmd.CombinedOutput()
+	output, err := combinedOutputWithUmask(cmd, project.Umask)
 
 	if buildLogger != nil && len(output) > 0 {
 		buildLogger.Infof(project.Name, "Output: %s", strings.TrimSpace(string(output)))
@@ -570,25 +1819,26 @@ func (d *Deployer) gitPull(ctx context.Context, project *ProjectConfig, buildLog
 		return fmt.Errorf("failed to reset local changes: %v", err)
 	}
 
+	args := append([]string{"pull"}, project.GitPullArgs...)
 	if buildLogger != nil {
-		buildLogger.Infof(project.Name, "Running: git pull")
+		buildLogger.Infof(project.Name, "Running: git %s", strings.Join(args, " "))
 		buildLogger.Infof(project.Name, "Path: %s", project.LocalPath)
 	}
 
-	// Build the command
-	cmd := buildCommand(ctx, "git pull")
+	// Use exec.Command directly with separate arguments to avoid shell injection
+	cmd := exec.CommandContext(ctx, "git", args...)
 
-	// Set process group so we can kill all child processes
+	// Set process group so a git timeout stops all child processes (ssh, etc.)
 	setProcessGroup(cmd)
+	stopKill := setGroupCancel(cmd)
+	defer stopKill()
 
 	cmd.Dir = project.LocalPath
 
-	// Set GIT_SSH_COMMAND if git_ssh_key_path is configured
-	if project.GitSSHKeyPath != "" {
-		cmd.Env = append(os.Environ(), fmt.Sprintf("GIT_SSH_COMMAND=%s", buildGitSSHCommand(project.GitSSHKeyPath)))
-	}
+	// Set GIT_SSH_COMMAND if SSH options are configured
+	cmd.Env = gitEnv(project)
 
-	output, err := cmd.CombinedOutput()
+	output, err := combinedOutputWithUmask(cmd, project.Umask)
 
 	if buildLogger != nil && len(output) > 0 {
 		buildLogger.Infof(project.Name, "Output: %s", strings.TrimSpace(string(output)))
@@ -601,8 +1851,9 @@ func (d *Deployer) gitPull(ctx context.Context, project *ProjectConfig, buildLog
 	return nil
 }
 
-// executeCommand runs the deployment command
-func (d *Deployer) executeCommand(ctx context.Context, project *ProjectConfig, triggerSource string, buildLogger *BuildLogger) (string, error) {
+// executeCommand runs the deployment command. A list-form execute_command is
+// handed to runSteps; timeout_seconds covers all of its steps.
+func (d *Deployer) executeCommand(ctx context.Context, project *ProjectConfig, triggerSource string, push PushInfo, buildLogger *BuildLogger) (string, error) {
 	// Create context with timeout if configured
 	var cancel context.CancelFunc
 	if project.TimeoutSeconds > 0 {
@@ -619,27 +1870,84 @@ func (d *Deployer) executeCommand(ctx context.Context, project *ProjectConfig, t
 	if buildLogger != nil {
 		buildLogger.Infof(project.Name, "Executing command:")
 		buildLogger.Infof(project.Name, "  Path: %s", executePath)
-		buildLogger.Infof(project.Name, "  Command: %s", project.ExecuteCommand)
+		if len(project.ExecuteSteps) > 0 {
+			for i, step := range project.ExecuteSteps {
+				buildLogger.Infof(project.Name, "  Step %d: %s", i+1, step)
+			}
+		} else {
+			buildLogger.Infof(project.Name, "  Command: %s", project.ExecuteCommand)
+		}
+		if project.Shell != "" {
+			buildLogger.Infof(project.Name, "  Shell: %s", project.Shell)
+		}
+		if project.RunAsUser != "" {
+			buildLogger.Infof(project.Name, "  User: %s", project.RunAsUser)
+		}
+	}
+
+	// Set environment variables
+	env := append(os.Environ(),
+		fmt.Sprintf("SDEPLOY_VERSION=%s", Version),
+		fmt.Sprintf("SDEPLOY_PROJECT_NAME=%s", project.Name),
+		fmt.Sprintf("SDEPLOY_TRIGGER_SOURCE=%s", triggerSource),
+		fmt.Sprintf("SDEPLOY_GIT_BRANCH=%s", project.GitBranch),
+		// Webhook payload fields; a NUL byte would make the exec fail
+		"SDEPLOY_PUSHER="+strings.ReplaceAll(push.Pusher, "\x00", ""),
+		"SDEPLOY_COMMIT_MESSAGE="+strings.ReplaceAll(push.CommitMessage, "\x00", ""),
+		"SDEPLOY_COMPARE_URL="+strings.ReplaceAll(push.CompareURL, "\x00", ""),
+	)
+	// Expose the deployed commit when local_path is a git checkout
+	if isGitRepo(project.LocalPath) {
+		if sha, err := getCurrentCommitSHA(ctx, project.LocalPath); err == nil {
+			env = append(env,
+				fmt.Sprintf("SDEPLOY_COMMIT=%s", sha),
+				fmt.Sprintf("SDEPLOY_COMMIT_SHORT=%s", truncateSHA(sha, d.shaLength)),
+			)
+		}
+	}
+
+	var output string
+	var err error
+	if len(project.ExecuteSteps) > 0 {
+		output, err = d.runSteps(ctx, project, executePath, env, buildLogger)
+	} else {
+		output, err = d.runCommand(ctx, project, project.ExecuteCommand, executePath, env, buildLogger)
+	}
+	// require_output catches scripts that silently do nothing
+	if err == nil && project.RequireOutput && strings.TrimSpace(output) == "" {
+		return output, fmt.Errorf("command exited successfully but produced no output (require_output is set)")
 	}
+	return output, err
+}
 
+// runCommand runs one command in executePath with env and returns its stdout
+// followed by its stderr. When ctx is done the command's process group gets
+// SIGTERM, then SIGKILL after timeout_grace_seconds.
+func (d *Deployer) runCommand(ctx context.Context, project *ProjectConfig, command, executePath string, env []string, buildLogger *BuildLogger) (string, error) {
 	// Build the command
-	cmd := buildCommand(ctx, project.ExecuteCommand)
+	cmd := buildCommand(ctx, project.Shell, project.Umask, command)
 
 	// Set process group so we can kill all child processes
 	setProcessGroup(cmd)
+	// On timeout, ask the whole group to exit first; escalation to SIGKILL
+	// after timeout_grace_seconds happens below. WaitDelay stops Wait blocking
+	// forever on output pipes held open by children that escaped the group.
+	grace := project.TimeoutGracePeriod()
+	cmd.Cancel = func() error { return terminateProcessGroup(cmd) }
+	cmd.WaitDelay = 2 * grace
 
 	// Set working directory to effective execute_path
 	if executePath != "." {
 		cmd.Dir = executePath
 	}
 
-	// Set environment variables
-	cmd.Env = append(os.Environ(),
-		fmt.Sprintf("SDEPLOY_VERSION=%s", Version),
-		fmt.Sprintf("SDEPLOY_PROJECT_NAME=%s", project.Name),
-		fmt.Sprintf("SDEPLOY_TRIGGER_SOURCE=%s", triggerSource),
-		fmt.Sprintf("SDEPLOY_GIT_BRANCH=%s", project.GitBranch),
-	)
+	cmd.Env = append([]string(nil), env...)
+	// Switch to run_as_user; its HOME/USER/LOGNAME replace the daemon's
+	if project.RunAsUser != "" {
+		if err := setCommandUser(cmd, project.RunAsUser); err != nil {
+			return "", err
+		}
+	}
 	// Append project-level env_variables (later values take precedence over duplicates at shell level)
 	cmd.Env = append(cmd.Env, project.EnvVariables...)
 
@@ -661,10 +1969,32 @@ func (d *Deployer) executeCommand(ctx context.Context, project *ProjectConfig, t
 
 	select {
 	case <-ctx.Done():
-		// Kill the entire process group
-		killProcessGroup(cmd)
-		<-done // Wait for the process to actually exit
-		return stdout.String() + stderr.String(), fmt.Errorf("command timed out after %d seconds", project.TimeoutSeconds)
+		// SIGTERM has been sent to the process group via cmd.Cancel
+		stopped := errors.Is(context.Cause(ctx), errStepFailed)
+		if buildLogger != nil {
+			if stopped {
+				buildLogger.Warnf(project.Name, "Stopping %q after a parallel step failed, sent SIGTERM to process group (SIGKILL in %v)", command, grace)
+			} else {
+				buildLogger.Warnf(project.Name, "Command timed out, sent SIGTERM to process group (SIGKILL in %v)", grace)
+			}
+		}
+		select {
+		case <-done:
+		case <-time.After(grace):
+			if buildLogger != nil {
+				buildLogger.Warnf(project.Name, "Process group still running after %v, sending SIGKILL", grace)
+			}
+			killProcessGroup(cmd)
+			<-done // Wait for the process to actually exit
+		}
+		if stopped {
+			return stdout.String() + stderr.String(), errStepFailed
+		}
+		if project.TimeoutSeconds <= 0 {
+			// Stopped by deploy_timeout_seconds or shutdown, not timeout_seconds
+			return stdout.String() + stderr.String(), newDeployError(ErrorKindTimeout, fmt.Errorf("command stopped: %v", ctx.Err()))
+		}
+		return stdout.String() + stderr.String(), newDeployError(ErrorKindTimeout, fmt.Errorf("command timed out after %d seconds", project.TimeoutSeconds))
 	case err := <-done:
 		output := stdout.String()
 		if stderr.Len() > 0 {
@@ -677,22 +2007,77 @@ func (d *Deployer) executeCommand(ctx context.Context, project *ProjectConfig, t
 	}
 }
 
-// sendNotification sends email notification if configured
-func (d *Deployer) sendNotification(project *ProjectConfig, result *DeployResult, triggerSource string) {
-	if d.notifier == nil {
+// sendNotification records the deployment outcome and sends an email
+// notification if configured
+func (d *Deployer) sendNotification(project *ProjectConfig, result *DeployResult, triggerSource string, buildLogger *BuildLogger) {
+	// The build log is renamed after this; tell the notification its final name
+	result.BuildLogPath = buildLogger.PathFor(result.Success)
+
+	// Errors often embed git or command output; mask secrets before they are
+	// stored, mailed or handed to the result hook
+	result.Error = d.redactorFor(project).Redact(result.Error)
+
+	// Track outcomes so a success after a failure is reported as a recovery
+	if previous, ok := d.state.record(project.DeployKey(), *result); ok && !previous.Success && result.Success {
+		result.Recovered = true
+	}
+	if project.FailureThreshold > 0 && !result.Success && d.logger != nil {
+		if failures := d.state.consecutiveFailures(project.DeployKey()); failures >= project.FailureThreshold {
+			d.logger.Warnf(project.Name, "Circuit breaker open after %d consecutive failures: webhook builds paused for %ds", failures, project.BreakerCooldown)
+		}
+	}
+
+	if !shouldNotify(project.NotifyOn, result) {
 		return
 	}
 
-	if err := d.notifier.SendNotification(project, result, triggerSource); err != nil {
-		if d.logger != nil {
-			d.logger.Errorf(project.Name, "Failed to send email notification: %v", err)
+	snapshot := *result
+	if notifier := d.notifier; notifier != nil {
+		d.notifyAsync(project, "email", func() error { return notifier.SendNotification(project, &snapshot, triggerSource) })
+	}
+	if teams := d.teams; teams != nil {
+		d.notifyAsync(project, "Teams", func() error { return teams.SendNotification(project, &snapshot, triggerSource) })
+	}
+}
+
+// notifyAsync runs send in the background with the retry policy, so retries
+// never hold up the deploy result. channel names the notifier in log
+// messages ("email", "Teams").
+func (d *Deployer) notifyAsync(project *ProjectConfig, channel string, send func() error) {
+	policy := d.notifyRetry
+	atomic.AddInt32(&d.notifying, 1)
+	go func() {
+		defer atomic.AddInt32(&d.notifying, -1)
+
+		onRetry := func(retry int, err error, wait time.Duration) {
+			if d.logger != nil {
+				d.logger.Warnf(project.Name, "%s notification failed (retry %d/%d in %v): %v", strings.ToUpper(channel[:1])+channel[1:], retry, policy.Retries, wait.Round(time.Millisecond), err)
+			}
 		}
+		if err := sendWithRetry(policy, send, onRetry); err != nil {
+			if d.logger != nil {
+				d.logger.Errorf(project.Name, "Failed to send %s notification: %v", channel, err)
+			}
+		}
+	}()
+}
+
+// shouldNotify applies the project's notify_on policy to a deployment result.
+// An empty policy behaves like "always".
+func shouldNotify(policy string, result *DeployResult) bool {
+	switch policy {
+	case NotifyFailure:
+		return !result.Success
+	case NotifyChange:
+		return !result.Skipped
+	default:
+		return true
 	}
 }
 
 // shouldSkipBuildOnNoChanges determines if a build should be skipped when no changes are detected
 // Logic:
-// 1. If trigger source is "WEBHOOK (Github)" -> skip build (GitHub push webhook)
+// 1. If trigger source is "WEBHOOK (Github)" or "WEBHOOK (Gitea)" -> skip build (push webhook)
 // 2. If trigger source is "WEBHOOK (unknown)" or just "WEBHOOK" -> skip build (unknown source, be safe)
 // 3. For "INTERNAL" or any other trigger -> don't skip (always build)
 // 4. For "WEBHOOK (<other_source>)" -> don't skip (always build for non-GitHub webhooks)
@@ -708,11 +2093,16 @@ func shouldSkipBuildOnNoChanges(triggerSource string) bool {
 	}
 	
 	// It's a WEBHOOK trigger, check the specific source
-	if strings.Contains(triggerSource, "(Github)") {
-		// GitHub push webhook - skip on no changes
+	if strings.Contains(triggerSource, "(Github)") || strings.Contains(triggerSource, "(Gitea)") {
+		// GitHub/Gitea push webhook - skip on no changes
 		return true
 	}
 	
+	if strings.Contains(triggerSource, "("+testWebhookTriggeredBy+")") {
+		// sdeploy test-webhook stands in for a git host push
+		return true
+	}
+
 	if strings.Contains(triggerSource, "(unknown)") || triggerSource == "WEBHOOK" {
 		// Unknown source or no source specified - skip for safety
 		return true
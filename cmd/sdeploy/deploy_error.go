@@ -0,0 +1,49 @@
+package main
+
+import "errors"
+
+// ErrorKind categorizes why a deployment failed, so callers (the result hook,
+// /status) can tell failures apart without matching on the error text
+type ErrorKind string
+
+// Deployment failure categories reported in DeployResult.ErrorKind
+const (
+	ErrorKindNone                 ErrorKind = ""
+	ErrorKindPreflightFailed      ErrorKind = "preflight_failed"       // directory, ownership or permission checks
+	ErrorKindSSHKeyInvalid        ErrorKind = "ssh_key_invalid"        // git_ssh_key_path missing or unusable
+	ErrorKindGitTokenInvalid      ErrorKind = "git_token_invalid"      // git_token_file unreadable or empty
+	ErrorKindGitCloneFailed       ErrorKind = "git_clone_failed"       // initial clone of git_repo
+	ErrorKindGitPullFailed        ErrorKind = "git_pull_failed"        // fetch/pull of an existing checkout
+	ErrorKindBranchCheckoutFailed ErrorKind = "branch_checkout_failed" // git_branch missing on the remote or not checked out
+	ErrorKindCommitCheckoutFailed ErrorKind = "commit_checkout_failed" // deploy_exact_commit checkout
+	ErrorKindDirtyTree            ErrorKind = "dirty_tree"             // require_clean_tree found local changes
+	ErrorKindChownFailed          ErrorKind = "chown_failed"           // chown_to could not change ownership of local_path
+	ErrorKindCommandFailed        ErrorKind = "command_failed"         // execute_command exited non-zero
+	ErrorKindReleaseFailed        ErrorKind = "release_failed"         // deploy_strategy atomic worktree or symlink switch
+	ErrorKindTimeout              ErrorKind = "timeout"                // git or command timeout expired
+	ErrorKindTriggerNotAllowed    ErrorKind = "trigger_not_allowed"    // trigger source not in allowed_triggers
+)
+
+// deployError is an error tagged with its failure category
+type deployError struct {
+	kind ErrorKind
+	err  error
+}
+
+// newDeployError tags err with kind
+func newDeployError(kind ErrorKind, err error) error {
+	return &deployError{kind: kind, err: err}
+}
+
+func (e *deployError) Error() string { return e.err.Error() }
+
+func (e *deployError) Unwrap() error { return e.err }
+
+// errorKindOf returns the category of err, or fallback if it is untagged
+func errorKindOf(err error, fallback ErrorKind) ErrorKind {
+	var de *deployError
+	if errors.As(err, &de) {
+		return de.kind
+	}
+	return fallback
+}
@@ -1,11 +1,18 @@
 package main
 
 import (
+	"bytes"
 	"context"
+	"errors"
 	"fmt"
+	"io/fs"
 	"os"
 	"os/exec"
+	"os/user"
+	"path/filepath"
+	"strconv"
 	"syscall"
+	"time"
 )
 
 // setProcessGroup sets the command to run in its own process group (Unix only)
@@ -18,6 +25,40 @@ func setProcessGroup(cmd *exec.Cmd) {
 	}
 }
 
+// processKillGracePeriod is how long a cancelled git or hook process group
+// gets to exit after SIGTERM before it is sent SIGKILL; execute_command uses
+// timeout_grace_seconds instead
+const processKillGracePeriod = 5 * time.Second
+
+// terminateProcessGroup asks the process group to exit with SIGTERM (Unix only)
+func terminateProcessGroup(cmd *exec.Cmd) error {
+	if cmd.Process == nil {
+		return nil
+	}
+	return syscall.Kill(-cmd.Process.Pid, syscall.SIGTERM)
+}
+
+// setGroupCancel makes context cancellation send SIGTERM to the command's
+// process group, escalating to SIGKILL after processKillGracePeriod.
+// WaitDelay stops Wait blocking forever on output pipes held open by
+// children that escaped the group. The returned stop func cancels a pending
+// SIGKILL; call it once the command has exited, so a group that stopped in
+// time is not signalled after its ID may have been reused.
+func setGroupCancel(cmd *exec.Cmd) (stop func()) {
+	// Cancel runs before Wait returns, so stop sees kill without locking
+	var kill *time.Timer
+	cmd.Cancel = func() error {
+		kill = time.AfterFunc(processKillGracePeriod, func() { killProcessGroup(cmd) })
+		return terminateProcessGroup(cmd)
+	}
+	cmd.WaitDelay = 2 * processKillGracePeriod
+	return func() {
+		if kill != nil {
+			kill.Stop()
+		}
+	}
+}
+
 // killProcessGroup kills the process group (Unix only)
 func killProcessGroup(cmd *exec.Cmd) {
 	if cmd.Process != nil {
@@ -25,6 +66,76 @@ func killProcessGroup(cmd *exec.Cmd) {
 	}
 }
 
+// setCommandUser makes cmd run as the named user, with the user's primary and
+// supplementary groups and HOME/USER/LOGNAME (Unix only). Switching to another
+// user requires SDeploy to run as root; naming the current user is a no-op.
+// setProcessGroup settings are preserved.
+func setCommandUser(cmd *exec.Cmd, name string) error {
+	u, err := user.Lookup(name)
+	if err != nil {
+		return fmt.Errorf("run_as_user: unknown user %s", name)
+	}
+	uid, err := strconv.ParseUint(u.Uid, 10, 32)
+	if err != nil {
+		return fmt.Errorf("run_as_user %s: invalid uid %s", name, u.Uid)
+	}
+	gid, err := strconv.ParseUint(u.Gid, 10, 32)
+	if err != nil {
+		return fmt.Errorf("run_as_user %s: invalid gid %s", name, u.Gid)
+	}
+
+	euid := os.Geteuid()
+	if int(uid) == euid {
+		return nil
+	}
+	if euid != 0 {
+		return fmt.Errorf("run_as_user %s: switching users requires root (running as uid %d)", name, euid)
+	}
+
+	var groups []uint32
+	if ids, err := u.GroupIds(); err == nil {
+		for _, id := range ids {
+			if g, err := strconv.ParseUint(id, 10, 32); err == nil {
+				groups = append(groups, uint32(g))
+			}
+		}
+	}
+
+	if cmd.SysProcAttr == nil {
+		cmd.SysProcAttr = &syscall.SysProcAttr{}
+	}
+	cmd.SysProcAttr.Credential = &syscall.Credential{Uid: uint32(uid), Gid: uint32(gid), Groups: groups}
+	cmd.Env = append(cmd.Env, "HOME="+u.HomeDir, "USER="+u.Username, "LOGNAME="+u.Username)
+	return nil
+}
+
+// chownTree changes the owner of everything below the checkout root to
+// uid:gid (Unix only). root itself and root/.git keep their owner: git refuses
+// to work in repositories owned by another user ("dubious ownership"), which
+// would break the next pull. Symlinks are changed themselves, never their
+// targets. Giving files to another user requires SDeploy to run as root.
+func chownTree(root string, uid, gid int) error {
+	gitDir := filepath.Join(root, ".git")
+	return filepath.WalkDir(root, func(path string, _ fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if path == gitDir {
+			return filepath.SkipDir
+		}
+		if path == root {
+			return nil
+		}
+		if err := os.Lchown(path, uid, gid); err != nil {
+			if errors.Is(err, os.ErrPermission) && os.Geteuid() != 0 {
+				return fmt.Errorf("%v (changing ownership requires root, running as uid %d)", err, os.Geteuid())
+			}
+			return err
+		}
+		return nil
+	})
+}
+
 // getShellPath returns the path to the shell executable (Unix implementation)
 // It first tries to find "sh" in PATH, then falls back to common shell locations
 func getShellPath() string {
@@ -50,18 +161,73 @@ func getShellArgs() string {
 	return "-c"
 }
 
-// buildCommand creates an exec.Cmd for the given command string
-// Sets umask 0022 to ensure created files are readable
-func buildCommand(ctx context.Context, command string) *exec.Cmd {
+// buildCommand creates an exec.Cmd that runs the command string with the given
+// shell, or the default shell from getShellPath if shell is empty.
+// Sets the umask (Defaults.Umask if empty) to ensure created files are
+// readable; UmaskNone runs the command unwrapped.
+func buildCommand(ctx context.Context, shell, umask, command string) *exec.Cmd {
 	// Wrap command with umask to ensure proper file permissions for generated files
 	// umask 0022 means: owner gets full permissions, group and others get read/execute
-	wrappedCommand := "umask 0022 && " + command
+	if umask == "" {
+		umask = Defaults.Umask
+	}
+	wrappedCommand := command
+	if umask != UmaskNone {
+		wrappedCommand = "umask " + umask + " && " + command
+	}
+
+	if shell == "" {
+		shell = getShellPath()
+	}
+	return exec.CommandContext(ctx, shell, getShellArgs(), wrappedCommand)
+}
+
+// umaskExecScript sets the umask passed as $1 and replaces the shell with the
+// remaining arguments. They are passed positionally, never interpolated into
+// the script.
+const umaskExecScript = `umask "$1" && shift && exec "$@"`
 
-	return exec.CommandContext(ctx, getShellPath(), getShellArgs(), wrappedCommand)
+// startWithUmask starts cmd with the given umask (Defaults.Umask if empty,
+// inherited for "none"). The daemon's own umask is process-wide and shared
+// with every goroutine creating files, so it is never changed: cmd is instead
+// started through sh, which sets the umask and execs the original program
+// with its arguments unchanged. The exec keeps the pid, so process-group
+// handling is unaffected.
+func startWithUmask(cmd *exec.Cmd, umask string) error {
+	if umask == "" {
+		umask = Defaults.Umask
+	}
+	if umask == UmaskNone || cmd.Err != nil {
+		return cmd.Start()
+	}
+	if _, err := strconv.ParseUint(umask, 8, 32); err != nil {
+		return fmt.Errorf("invalid umask: %s", umask)
+	}
+
+	shell, err := exec.LookPath(getShellPath())
+	if err != nil {
+		return err
+	}
+	cmd.Args = append([]string{shell, "-c", umaskExecScript, "sh", umask, cmd.Path}, cmd.Args[1:]...)
+	cmd.Path = shell
+	return cmd.Start()
+}
+
+// combinedOutputWithUmask is cmd.CombinedOutput with the umask applied as in
+// startWithUmask
+func combinedOutputWithUmask(cmd *exec.Cmd, umask string) ([]byte, error) {
+	var output bytes.Buffer
+	cmd.Stdout = &output
+	cmd.Stderr = &output
+	if err := startWithUmask(cmd, umask); err != nil {
+		return nil, err
+	}
+	err := cmd.Wait()
+	return output.Bytes(), err
 }
 
-// ensureParentDirExists creates parent directories if they don't exist
-func ensureParentDirExists(ctx context.Context, parentDir string, logger LogWriter, projectName string) error {
+// ensureParentDirExists creates parent directories with mode if they don't exist
+func ensureParentDirExists(ctx context.Context, parentDir string, mode os.FileMode, logger LogWriter, projectName string) error {
 	// Check if parent directory already exists
 	if info, err := os.Stat(parentDir); err == nil {
 		if info.IsDir() {
@@ -73,11 +239,11 @@ func ensureParentDirExists(ctx context.Context, parentDir string, logger LogWrit
 
 	// Log the directory creation
 	if logger != nil {
-		logger.Infof(projectName, "Creating parent directory: %s", parentDir)
+		logger.Infof(projectName, "Creating parent directory: %s (mode %s)", parentDir, formatDirMode(mode))
 	}
 
-	// Create the directory with standard permissions
-	if err := os.MkdirAll(parentDir, 0755); err != nil {
+	// Create the directory with the project's dir_mode
+	if err := mkdirAllMode(parentDir, mode); err != nil {
 		return fmt.Errorf("failed to create directory: %v", err)
 	}
 
@@ -3,8 +3,12 @@ package main
 import (
 	"crypto/tls"
 	"fmt"
+	"io"
+	"net"
 	"net/smtp"
 	"strings"
+	"text/template"
+	"time"
 )
 
 // Email represents an email message
@@ -40,6 +44,7 @@ func (n *EmailNotifier) SendNotification(project *ProjectConfig, result *DeployR
 	}
 
 	email := composeDeploymentEmail(project, result, triggerSource)
+	n.applyTemplates(email, project, result, triggerSource)
 	email.To = project.EmailRecipients
 
 	return n.send(email)
@@ -47,10 +52,7 @@ func (n *EmailNotifier) SendNotification(project *ProjectConfig, result *DeployR
 
 // composeDeploymentEmail creates the email content for a deployment result
 func composeDeploymentEmail(project *ProjectConfig, result *DeployResult, triggerSource string) *Email {
-	status := "SUCCESS"
-	if !result.Success {
-		status = "FAILED"
-	}
+	status := resultStatus(result)
 
 	subject := fmt.Sprintf("[SDeploy] %s - Deployment %s", project.Name, status)
 
@@ -59,6 +61,9 @@ func composeDeploymentEmail(project *ProjectConfig, result *DeployResult, trigge
 	body.WriteString(fmt.Sprintf("Trigger Source: %s\n", triggerSource))
 	body.WriteString(fmt.Sprintf("Branch: %s\n", project.GitBranch))
 	body.WriteString(fmt.Sprintf("Status: %s\n", status))
+	if result.Recovered {
+		body.WriteString("Previous deployment failed; this build succeeded.\n")
+	}
 	body.WriteString(fmt.Sprintf("Start Time: %s\n", result.StartTime.Format("2006-01-02 15:04:05")))
 	body.WriteString(fmt.Sprintf("End Time: %s\n", result.EndTime.Format("2006-01-02 15:04:05")))
 	body.WriteString(fmt.Sprintf("Duration: %v\n", result.Duration()))
@@ -82,6 +87,97 @@ func composeDeploymentEmail(project *ProjectConfig, result *DeployResult, trigge
 	}
 }
 
+// resultStatus returns SUCCESS, FAILED or RECOVERED for a deployment result
+func resultStatus(result *DeployResult) string {
+	if !result.Success {
+		return "FAILED"
+	}
+	if result.Recovered {
+		return "RECOVERED"
+	}
+	return "SUCCESS"
+}
+
+// emailTemplateData is what email_subject_template and email_body_template
+// are executed with
+type emailTemplateData struct {
+	Project       string
+	Result        string // SUCCESS, FAILED or RECOVERED
+	Branch        string
+	BuildID       string
+	TriggerSource string
+	StartTime     time.Time
+	EndTime       time.Time
+	Duration      time.Duration
+	CommitSHA     string
+	Error         string
+	Output        string
+	BuildLogPath  string
+}
+
+// parseEmailTemplate parses a notification template and executes it once
+// with empty data, so references to unknown fields fail at config load
+// instead of on the first notification
+func parseEmailTemplate(name, text string) (*template.Template, error) {
+	tmpl, err := template.New(name).Parse(text)
+	if err != nil {
+		return nil, err
+	}
+	if err := tmpl.Execute(io.Discard, emailTemplateData{}); err != nil {
+		return nil, err
+	}
+	return tmpl, nil
+}
+
+// applyTemplates replaces the built-in subject and body with the configured
+// templates. A template that fails to execute keeps the built-in text.
+func (n *EmailNotifier) applyTemplates(email *Email, project *ProjectConfig, result *DeployResult, triggerSource string) {
+	if n.config.subjectTmpl == nil && n.config.bodyTmpl == nil {
+		return
+	}
+	data := emailTemplateData{
+		Project:       project.Name,
+		Result:        resultStatus(result),
+		Branch:        project.GitBranch,
+		BuildID:       result.BuildID,
+		TriggerSource: triggerSource,
+		StartTime:     result.StartTime,
+		EndTime:       result.EndTime,
+		Duration:      result.Duration(),
+		CommitSHA:     result.CommitSHA,
+		Error:         result.Error,
+		Output:        result.Output,
+		BuildLogPath:  result.BuildLogPath,
+	}
+
+	var out strings.Builder
+	if n.config.subjectTmpl != nil {
+		if err := n.config.subjectTmpl.Execute(&out, data); err != nil {
+			n.warnTemplate(project.Name, err)
+		} else {
+			// A newline would end the Subject header and start another
+			email.Subject = strings.NewReplacer("\r", " ", "\n", " ").Replace(strings.TrimSpace(out.String()))
+		}
+	}
+	out.Reset()
+	if n.config.bodyTmpl != nil {
+		if err := n.config.bodyTmpl.Execute(&out, data); err != nil {
+			n.warnTemplate(project.Name, err)
+		} else {
+			email.Body = out.String()
+		}
+	}
+}
+
+func (n *EmailNotifier) warnTemplate(projectName string, err error) {
+	if n.logger != nil {
+		n.logger.Warnf(projectName, "Email template failed, using the built-in format: %v", err)
+	}
+}
+
+// smtpDialTimeout bounds how long connecting to the SMTP server may take
+const smtpDialTimeout = 30 * time.Second
+
 // send sends an email using SMTP
 func (n *EmailNotifier) send(email *Email) error {
 	if n.config == nil {
@@ -100,29 +196,19 @@ func (n *EmailNotifier) send(email *Email) error {
 
 	message := headers + email.Body
 
-	// Set up TLS config
-	tlsConfig := &tls.Config{
-		ServerName: n.config.SMTPHost,
-	}
-
-	// Connect to SMTP server
-	conn, err := tls.Dial("tcp", addr, tlsConfig)
-	if err != nil {
-		// Try without TLS (STARTTLS)
-		return n.sendWithSTARTTLS(addr, email, message)
-	}
-	defer conn.Close()
-
-	client, err := smtp.NewClient(conn, n.config.SMTPHost)
+	client, err := n.dial(addr)
 	if err != nil {
-		return fmt.Errorf("failed to create SMTP client: %w", err)
+		return err
 	}
 	defer client.Close()
 
-	// Authenticate
-	auth := smtp.PlainAuth("", n.config.SMTPUser, n.config.SMTPPass, n.config.SMTPHost)
-	if err := client.Auth(auth); err != nil {
-		return fmt.Errorf("SMTP authentication failed: %w", err)
+	// Authenticate if the server offers it. net/smtp refuses to send
+	// credentials over an unencrypted connection to a non-local host.
+	if ok, _ := client.Extension("AUTH"); ok {
+		auth := smtp.PlainAuth("", n.config.SMTPUser, n.config.SMTPPass, n.config.SMTPHost)
+		if err := client.Auth(auth); err != nil {
+			return fmt.Errorf("SMTP authentication failed: %w", err)
+		}
 	}
 
 	// Set sender and recipients
@@ -153,9 +239,45 @@ func (n *EmailNotifier) send(email *Email) error {
 	return client.Quit()
 }
 
-// sendWithSTARTTLS attempts to send using STARTTLS
-func (n *EmailNotifier) sendWithSTARTTLS(addr string, email *Email, message string) error {
-	auth := smtp.PlainAuth("", n.config.SMTPUser, n.config.SMTPPass, n.config.SMTPHost)
+// dial connects to the SMTP server using the configured smtp_tls mode
+func (n *EmailNotifier) dial(addr string) (*smtp.Client, error) {
+	tlsConfig := &tls.Config{
+		ServerName: n.config.SMTPHost,
+	}
+	dialer := &net.Dialer{Timeout: smtpDialTimeout}
+
+	mode := n.config.SMTPTLS
+	if mode == "" {
+		mode = defaultSMTPTLS(n.config.SMTPPort)
+	}
+
+	var conn net.Conn
+	var err error
+	if mode == SMTPTLSImplicit {
+		conn, err = tls.DialWithDialer(dialer, "tcp", addr, tlsConfig)
+	} else {
+		conn, err = dialer.Dial("tcp", addr)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to SMTP server %s (smtp_tls: %s): %w", addr, mode, err)
+	}
+
+	client, err := smtp.NewClient(conn, n.config.SMTPHost)
+	if err != nil {
+		conn.Close()
+		return nil, fmt.Errorf("failed to create SMTP client: %w", err)
+	}
+
+	if mode == SMTPTLSStartTLS {
+		if ok, _ := client.Extension("STARTTLS"); !ok {
+			client.Close()
+			return nil, fmt.Errorf("SMTP server %s does not support STARTTLS", addr)
+		}
+		if err := client.StartTLS(tlsConfig); err != nil {
+			client.Close()
+			return nil, fmt.Errorf("STARTTLS failed: %w", err)
+		}
+	}
 
-	return smtp.SendMail(addr, auth, n.config.EmailSender, email.To, []byte(message))
+	return client, nil
 }
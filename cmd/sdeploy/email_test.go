@@ -1,6 +1,8 @@
 package main
 
 import (
+	"bufio"
+	"net"
 	"strings"
 	"testing"
 	"time"
@@ -39,6 +41,29 @@ func TestEmailComposition(t *testing.T) {
 	}
 }
 
+// TestEmailCompositionRecovered tests email for a success following a failure
+func TestEmailCompositionRecovered(t *testing.T) {
+	result := &DeployResult{
+		Success:   true,
+		Recovered: true,
+		StartTime: time.Now(),
+		EndTime:   time.Now(),
+	}
+
+	project := &ProjectConfig{
+		Name: "Backend",
+	}
+
+	email := composeDeploymentEmail(project, result, "INTERNAL")
+
+	if !strings.Contains(email.Subject, "Deployment RECOVERED") {
+		t.Errorf("Expected email subject to contain RECOVERED, got %q", email.Subject)
+	}
+	if !strings.Contains(email.Body, "Status: RECOVERED") {
+		t.Error("Expected email body to contain RECOVERED status")
+	}
+}
+
 // TestEmailCompositionFailure tests email for failed deployment
 func TestEmailCompositionFailure(t *testing.T) {
 	result := &DeployResult{
@@ -262,3 +287,161 @@ func TestEmailEnhancedTriggerSource(t *testing.T) {
 		t.Errorf("INTERNAL trigger should not contain WEBHOOK, got: %s", email3.Body)
 	}
 }
+
+// startFakeSMTPServer runs a minimal plaintext SMTP server that accepts one
+// message without STARTTLS or AUTH. The received DATA is sent on the channel.
+func startFakeSMTPServer(t *testing.T) (int, <-chan string) {
+	t.Helper()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Failed to listen: %v", err)
+	}
+	t.Cleanup(func() { ln.Close() })
+
+	received := make(chan string, 1)
+	go func() {
+		conn, err := ln.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+
+		r := bufio.NewReader(conn)
+		reply := func(line string) { conn.Write([]byte(line + "\r\n")) }
+		reply("220 localhost ESMTP")
+		for {
+			line, err := r.ReadString('\n')
+			if err != nil {
+				return
+			}
+			cmd := strings.ToUpper(strings.TrimSpace(line))
+			switch {
+			case strings.HasPrefix(cmd, "EHLO"), strings.HasPrefix(cmd, "HELO"):
+				reply("250 localhost")
+			case cmd == "DATA":
+				reply("354 go ahead")
+				var data strings.Builder
+				for {
+					l, err := r.ReadString('\n')
+					if err != nil {
+						return
+					}
+					if l == ".\r\n" {
+						break
+					}
+					data.WriteString(l)
+				}
+				received <- data.String()
+				reply("250 queued")
+			case cmd == "QUIT":
+				reply("221 bye")
+				return
+			default:
+				reply("250 ok")
+			}
+		}
+	}()
+
+	return ln.Addr().(*net.TCPAddr).Port, received
+}
+
+// TestEmailSendPlaintext tests delivery with smtp_tls: none
+func TestEmailSendPlaintext(t *testing.T) {
+	port, received := startFakeSMTPServer(t)
+
+	notifier := NewEmailNotifier(&EmailConfig{
+		SMTPHost:    "127.0.0.1",
+		SMTPPort:    port,
+		SMTPUser:    "user",
+		SMTPPass:    "pass",
+		EmailSender: "sdeploy@example.com",
+		SMTPTLS:     SMTPTLSNone,
+	}, nil)
+
+	err := notifier.send(&Email{To: []string{"team@example.com"}, Subject: "Hello", Body: "Body text"})
+	if err != nil {
+		t.Fatalf("Expected plaintext send to succeed, got: %v", err)
+	}
+
+	select {
+	case data := <-received:
+		if !strings.Contains(data, "Subject: Hello") || !strings.Contains(data, "Body text") {
+			t.Errorf("Unexpected message data: %s", data)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("Timed out waiting for message")
+	}
+}
+
+// TestEmailSendRequiresSTARTTLS tests that starttls mode fails when the server lacks STARTTLS
+func TestEmailSendRequiresSTARTTLS(t *testing.T) {
+	port, _ := startFakeSMTPServer(t)
+
+	notifier := NewEmailNotifier(&EmailConfig{
+		SMTPHost:    "127.0.0.1",
+		SMTPPort:    port,
+		SMTPUser:    "user",
+		SMTPPass:    "pass",
+		EmailSender: "sdeploy@example.com",
+		SMTPTLS:     SMTPTLSStartTLS,
+	}, nil)
+
+	err := notifier.send(&Email{To: []string{"team@example.com"}, Subject: "Hello", Body: "Body"})
+	if err == nil || !strings.Contains(err.Error(), "does not support STARTTLS") {
+		t.Errorf("Expected STARTTLS error, got: %v", err)
+	}
+}
+
+// TestEmailTemplates tests that email_subject_template and email_body_template
+// replace the built-in format
+func TestEmailTemplates(t *testing.T) {
+	config := &EmailConfig{
+		SMTPPort:        587,
+		SubjectTemplate: "[{{.Result}}] {{.Project}}\n{{.CommitSHA}}",
+		BodyTemplate:    "{{.Project}} on {{.Branch}} took {{.Duration}} ({{.TriggerSource}}): {{.BuildLogPath}}",
+	}
+	if err := validateEmailConfig(config); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	result := &DeployResult{
+		Success:      false,
+		CommitSHA:    "abc123",
+		StartTime:    time.Date(2024, 1, 15, 10, 30, 0, 0, time.UTC),
+		EndTime:      time.Date(2024, 1, 15, 10, 30, 45, 0, time.UTC),
+		BuildLogPath: "/var/log/sdeploy/Frontend-1-fail.log",
+	}
+	project := &ProjectConfig{Name: "Frontend", GitBranch: "main"}
+
+	notifier := NewEmailNotifier(config, nil)
+	email := composeDeploymentEmail(project, result, "WEBHOOK")
+	notifier.applyTemplates(email, project, result, "WEBHOOK")
+
+	// The newline is flattened so it cannot start another header
+	if email.Subject != "[FAILED] Frontend abc123" {
+		t.Errorf("Unexpected subject: %q", email.Subject)
+	}
+	if want := "Frontend on main took 45s (WEBHOOK): /var/log/sdeploy/Frontend-1-fail.log"; email.Body != want {
+		t.Errorf("Expected body %q, got %q", want, email.Body)
+	}
+}
+
+// TestEmailTemplatesInvalid tests that bad templates fail config validation
+func TestEmailTemplatesInvalid(t *testing.T) {
+	tests := []struct {
+		name   string
+		config EmailConfig
+		want   string
+	}{
+		{"bad syntax", EmailConfig{SubjectTemplate: "{{.Project"}, "invalid email_subject_template"},
+		{"unknown field", EmailConfig{BodyTemplate: "{{.Status}}"}, "invalid email_body_template"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := validateEmailConfig(&tt.config)
+			if err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Errorf("Expected error containing %q, got %v", tt.want, err)
+			}
+		})
+	}
+}
@@ -0,0 +1,91 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+// resultHookTimeout bounds how long a result hook may run
+const resultHookTimeout = 5 * time.Minute
+
+// resultHookPayload is the JSON document written to result_hook_command's stdin
+type resultHookPayload struct {
+	SDeployVersion string    `json:"sdeploy_version"`
+	BuildID        string    `json:"build_id"`
+	Project        string    `json:"project"`
+	WebhookPath    string    `json:"webhook_path"`
+	GitBranch      string    `json:"git_branch"`
+	TriggerSource  string    `json:"trigger_source"`
+	Success        bool      `json:"success"`
+	Skipped        bool      `json:"skipped"`
+	Error          string    `json:"error"`
+	ErrorKind      ErrorKind `json:"error_kind"`
+	Output         string    `json:"output"`
+	StartTime      time.Time `json:"start_time"`
+	EndTime        time.Time `json:"end_time"`
+	DurationMs     int64     `json:"duration_ms"`
+	BuildLogPath   string    `json:"build_log_path"`
+}
+
+// newResultHookPayload builds the hook payload for a finished deployment
+func newResultHookPayload(project *ProjectConfig, result *DeployResult, triggerSource, buildLogPath string) resultHookPayload {
+	return resultHookPayload{
+		SDeployVersion: Version,
+		BuildID:        result.BuildID,
+		Project:        project.Name,
+		WebhookPath:    project.WebhookPath,
+		GitBranch:      project.GitBranch,
+		TriggerSource:  triggerSource,
+		Success:        result.Success,
+		Skipped:        result.Skipped,
+		Error:          result.Error,
+		ErrorKind:      result.ErrorKind,
+		Output:         result.Output,
+		StartTime:      result.StartTime,
+		EndTime:        result.EndTime,
+		DurationMs:     result.Duration().Milliseconds(),
+		BuildLogPath:   buildLogPath,
+	}
+}
+
+// runResultHook starts the project's result_hook_command in the background,
+// passing the deployment result as JSON on stdin. Failures are logged only.
+// The hook counts as a pending notification, so shutdown waits for it.
+func (d *Deployer) runResultHook(project *ProjectConfig, result *DeployResult, triggerSource, buildLogPath string) {
+	if project.ResultHookCommand == "" {
+		return
+	}
+
+	payload, err := json.Marshal(newResultHookPayload(project, result, triggerSource, buildLogPath))
+	if err != nil {
+		if d.logger != nil {
+			d.logger.Errorf(project.Name, "Failed to encode result hook payload: %v", err)
+		}
+		return
+	}
+
+	projectName := project.Name
+	hookCommand := project.ResultHookCommand
+	shell, umask := project.Shell, project.Umask
+	atomic.AddInt32(&d.notifying, 1)
+	go func() {
+		defer atomic.AddInt32(&d.notifying, -1)
+		ctx, cancel := context.WithTimeout(context.Background(), resultHookTimeout)
+		defer cancel()
+
+		cmd := buildCommand(ctx, shell, umask, hookCommand)
+		setProcessGroup(cmd)
+		stopKill := setGroupCancel(cmd)
+		defer stopKill()
+		cmd.Stdin = bytes.NewReader(payload)
+
+		output, err := cmd.CombinedOutput()
+		if err != nil && d.logger != nil {
+			d.logger.Errorf(projectName, "Result hook failed: %v: %s", err, strings.TrimSpace(string(output)))
+		}
+	}()
+}
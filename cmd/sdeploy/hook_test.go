@@ -0,0 +1,142 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// waitForFile polls until path exists with content or the timeout elapses
+func waitForFile(t *testing.T, path string, timeout time.Duration) []byte {
+	t.Helper()
+	deadline := time.Now().Add(timeout)
+	for time.Now().Before(deadline) {
+		if data, err := os.ReadFile(path); err == nil && len(data) > 0 {
+			return data
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+	t.Fatalf("Timed out waiting for %s", path)
+	return nil
+}
+
+// TestResultHookReceivesJSON tests that the hook reads the deploy result from stdin
+func TestResultHookReceivesJSON(t *testing.T) {
+	tmpDir := t.TempDir()
+	outFile := filepath.Join(tmpDir, "hook.json")
+
+	deployer := NewDeployer(nil)
+	project := &ProjectConfig{
+		Name:              "HookProject",
+		WebhookPath:       "/hooks/hook",
+		GitBranch:         "main",
+		ExecuteCommand:    "echo built",
+		ResultHookCommand: "cat > " + outFile,
+	}
+
+	result := deployer.Deploy(context.Background(), project, "INTERNAL")
+	if !result.Success {
+		t.Fatalf("Expected deployment to succeed, got error: %s", result.Error)
+	}
+
+	var payload resultHookPayload
+	if err := json.Unmarshal(waitForFile(t, outFile, 5*time.Second), &payload); err != nil {
+		t.Fatalf("Failed to decode hook payload: %v", err)
+	}
+
+	if payload.Project != "HookProject" || payload.WebhookPath != "/hooks/hook" || payload.GitBranch != "main" {
+		t.Errorf("Unexpected project fields in payload: %+v", payload)
+	}
+	if payload.TriggerSource != "INTERNAL" {
+		t.Errorf("Expected trigger source INTERNAL, got %s", payload.TriggerSource)
+	}
+	if !payload.Success || payload.Skipped {
+		t.Errorf("Expected success=true skipped=false, got success=%v skipped=%v", payload.Success, payload.Skipped)
+	}
+	if !strings.Contains(payload.Output, "built") {
+		t.Errorf("Expected output to contain 'built', got %q", payload.Output)
+	}
+	if payload.SDeployVersion != Version {
+		t.Errorf("Expected version %s, got %s", Version, payload.SDeployVersion)
+	}
+	if payload.StartTime.IsZero() || payload.EndTime.Before(payload.StartTime) {
+		t.Errorf("Expected valid start/end times, got %v / %v", payload.StartTime, payload.EndTime)
+	}
+}
+
+// TestResultHookFailureIsNonFatal tests that a failing hook is logged but does not fail the deploy
+func TestResultHookFailureIsNonFatal(t *testing.T) {
+	var buf syncBuffer
+	logger := NewLogger(&buf, "", false)
+	deployer := NewDeployer(logger)
+	project := &ProjectConfig{
+		Name:              "HookFailProject",
+		WebhookPath:       "/hooks/hook-fail",
+		ExecuteCommand:    "echo built",
+		ResultHookCommand: "echo hook-broke; exit 3",
+	}
+
+	result := deployer.Deploy(context.Background(), project, "INTERNAL")
+	if !result.Success {
+		t.Fatalf("Expected deployment to succeed despite hook failure, got error: %s", result.Error)
+	}
+
+	deadline := time.Now().Add(5 * time.Second)
+	for !strings.Contains(buf.String(), "Result hook failed") && time.Now().Before(deadline) {
+		time.Sleep(20 * time.Millisecond)
+	}
+	if !strings.Contains(buf.String(), "hook-broke") {
+		t.Errorf("Expected hook failure to be logged with output, got: %s", buf.String())
+	}
+}
+
+// TestResultHookTrackedAsNotification tests that WaitForNotifications waits
+// for a running result hook
+func TestResultHookTrackedAsNotification(t *testing.T) {
+	outFile := filepath.Join(t.TempDir(), "hook-done")
+	deployer := NewDeployer(nil)
+	project := &ProjectConfig{
+		Name:              "HookWaitProject",
+		WebhookPath:       "/hooks/hook-wait",
+		ExecuteCommand:    "echo built",
+		ResultHookCommand: "sleep 0.5; echo done > " + outFile,
+	}
+
+	result := deployer.Deploy(context.Background(), project, "INTERNAL")
+	if !result.Success {
+		t.Fatalf("Expected deployment to succeed, got error: %s", result.Error)
+	}
+	if deployer.WaitForNotifications(50 * time.Millisecond) {
+		t.Error("Expected the running hook to be pending")
+	}
+	if !deployer.WaitForNotifications(5 * time.Second) {
+		t.Fatal("Expected the hook to finish")
+	}
+	if _, err := os.Stat(outFile); err != nil {
+		t.Errorf("Expected the hook to have run to completion: %v", err)
+	}
+}
+
+// syncBuffer is a bytes.Buffer safe for concurrent writes and reads
+type syncBuffer struct {
+	mu  sync.Mutex
+	buf bytes.Buffer
+}
+
+func (b *syncBuffer) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.Write(p)
+}
+
+func (b *syncBuffer) String() string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.String()
+}
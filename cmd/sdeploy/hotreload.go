@@ -1,6 +1,11 @@
 package main
 
 import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"reflect"
 	"sync"
 	"sync/atomic"
 	"time"
@@ -17,6 +22,7 @@ type ConfigManager struct {
 	watcher       *fsnotify.Watcher
 	stopChan      chan struct{}
 	reloadPending atomic.Bool
+	fingerprint   string // hash of the config files the running config was loaded from
 
 	// Callback functions for notifying dependent components
 	onReload func(*Config)
@@ -30,10 +36,11 @@ func NewConfigManager(configPath string, logger *Logger) (*ConfigManager, error)
 	}
 
 	cm := &ConfigManager{
-		config:     cfg,
-		configPath: configPath,
-		logger:     logger,
-		stopChan:   make(chan struct{}),
+		config:      cfg,
+		configPath:  configPath,
+		logger:      logger,
+		stopChan:    make(chan struct{}),
+		fingerprint: configFingerprint(configPath, cfg.IncludedFiles()),
 	}
 
 	return cm, nil
@@ -84,10 +91,25 @@ func (cm *ConfigManager) StartWatcher() error {
 		cm.logger.Infof("", "Hot reload enabled for config file: %s", cm.configPath)
 	}
 
+	// Also watch files merged in via include
+	cm.watchIncludedFiles(cm.GetConfig())
+
 	go cm.watchLoop()
 	return nil
 }
 
+// watchIncludedFiles adds the config's included files to the watcher
+func (cm *ConfigManager) watchIncludedFiles(cfg *Config) {
+	if cm.watcher == nil {
+		return
+	}
+	for _, path := range cfg.IncludedFiles() {
+		if err := cm.watcher.Add(path); err != nil && cm.logger != nil {
+			cm.logger.Warnf("", "Failed to watch included config file %s: %v", path, err)
+		}
+	}
+}
+
 // watchLoop handles file system events for the config file
 func (cm *ConfigManager) watchLoop() {
 	// Debounce timer to handle multiple rapid file changes
@@ -150,9 +172,17 @@ func (cm *ConfigManager) reloadConfig() {
 		return
 	}
 
-	// Check if listen_port changed (not hot-reloadable)
+	cm.applyConfig(newConfig)
+}
+
+// applyConfig swaps in a validated configuration and notifies dependents
+func (cm *ConfigManager) applyConfig(newConfig *Config) {
+	// Check if listen_port, listen_addr, pid_file or TLS files changed (not hot-reloadable)
 	cm.mu.RLock()
 	oldPort := cm.config.ListenPort
+	oldAddr := cm.config.ListenAddr
+	oldCert, oldKey := cm.config.TLSCertFile, cm.config.TLSKeyFile
+	oldPIDFile := cm.config.PIDFile
 	cm.mu.RUnlock()
 
 	if newConfig.ListenPort != oldPort {
@@ -160,13 +190,39 @@ func (cm *ConfigManager) reloadConfig() {
 			cm.logger.Warnf("", "listen_port changed from %d to %d. Restart required for this change to take effect.", oldPort, newConfig.ListenPort)
 		}
 	}
+	if newConfig.ListenAddr != oldAddr {
+		if cm.logger != nil {
+			cm.logger.Warnf("", "listen_addr changed from %q to %q. Restart required for this change to take effect.", oldAddr, newConfig.ListenAddr)
+		}
+	}
+	if newConfig.PIDFile != oldPIDFile {
+		if cm.logger != nil {
+			cm.logger.Warnf("", "pid_file changed from %q to %q. Restart required for this change to take effect.", oldPIDFile, newConfig.PIDFile)
+		}
+	}
+	if newConfig.TLSCertFile != oldCert || newConfig.TLSKeyFile != oldKey {
+		if cm.logger != nil {
+			cm.logger.Warn("", "tls_cert_file/tls_key_file changed. Restart required for this change to take effect.")
+		}
+	}
+
+	if cm.logger != nil {
+		for _, warning := range newConfig.PathWarnings() {
+			cm.logger.Warnf("", "strict_paths: %s", warning)
+		}
+	}
 
 	// Apply the new configuration
+	fingerprint := configFingerprint(cm.configPath, newConfig.IncludedFiles())
 	cm.mu.Lock()
 	cm.config = newConfig
+	cm.fingerprint = fingerprint
 	onReload := cm.onReload
 	cm.mu.Unlock()
 
+	// Pick up any newly included files
+	cm.watchIncludedFiles(newConfig)
+
 	if cm.logger != nil {
 		cm.logger.Info("", "Configuration reloaded successfully")
 		logConfigSummary(cm.logger, newConfig, cm.logger.IsDaemonMode())
@@ -178,6 +234,130 @@ func (cm *ConfigManager) reloadConfig() {
 	}
 }
 
+// ReloadResult describes the outcome of a validated reload request
+type ReloadResult struct {
+	Applied  bool     `json:"applied"`
+	Deferred bool     `json:"deferred"`
+	Added    []string `json:"added"`
+	Removed  []string `json:"removed"`
+	Modified []string `json:"modified"`
+}
+
+// ValidateAndReload re-reads and validates the config file, keeping the current
+// configuration if it is invalid. A valid config is swapped in immediately, or
+// deferred to ProcessPendingReload when builds are active.
+func (cm *ConfigManager) ValidateAndReload(buildsActive bool) (*ReloadResult, error) {
+	newConfig, err := LoadConfig(cm.configPath)
+	if err != nil {
+		if cm.logger != nil {
+			cm.logger.Errorf("", "Reload request rejected: %v", err)
+		}
+		return nil, err
+	}
+
+	result := diffConfigs(cm.GetConfig(), newConfig)
+
+	if buildsActive {
+		cm.SetReloadPending(true)
+		result.Deferred = true
+		if cm.logger != nil {
+			cm.logger.Info("", "Reload requested; deferring until active builds finish")
+		}
+		return result, nil
+	}
+
+	if cm.logger != nil {
+		cm.logger.Info("", "Reloading configuration (requested)...")
+	}
+	cm.applyConfig(newConfig)
+	result.Applied = true
+	return result, nil
+}
+
+// ReloadOnSignal handles a reload signal (SIGHUP): it validates and reloads
+// the config like POST /reload and logs the outcome. An invalid config is
+// logged by ValidateAndReload and the current configuration stays in effect.
+func (cm *ConfigManager) ReloadOnSignal(buildsActive bool) {
+	if cm.logger != nil {
+		cm.logger.Info("", "Reload requested by signal")
+	}
+	result, err := cm.ValidateAndReload(buildsActive)
+	if err != nil || cm.logger == nil {
+		return
+	}
+	if result.Deferred {
+		cm.logger.Info("", "Signal reload deferred until active builds finish")
+		return
+	}
+	cm.logger.Infof("", "Signal reload applied (added: %d, removed: %d, modified: %d)", len(result.Added), len(result.Removed), len(result.Modified))
+}
+
+// diffConfigs lists projects added, removed or modified between two configs.
+// Projects are matched by webhook_path (and match_repo) and reported by name.
+func diffConfigs(oldCfg, newCfg *Config) *ReloadResult {
+	result := &ReloadResult{Added: []string{}, Removed: []string{}, Modified: []string{}}
+
+	oldProjects := make(map[string]*ProjectConfig)
+	for i := range oldCfg.Projects {
+		oldProjects[oldCfg.Projects[i].DeployKey()] = &oldCfg.Projects[i]
+	}
+
+	for i := range newCfg.Projects {
+		project := &newCfg.Projects[i]
+		old, ok := oldProjects[project.DeployKey()]
+		switch {
+		case !ok:
+			result.Added = append(result.Added, projectLabel(project))
+		case !reflect.DeepEqual(old, project):
+			result.Modified = append(result.Modified, projectLabel(project))
+		}
+		delete(oldProjects, project.DeployKey())
+	}
+
+	for i := range oldCfg.Projects {
+		if _, ok := oldProjects[oldCfg.Projects[i].DeployKey()]; ok {
+			result.Removed = append(result.Removed, projectLabel(&oldCfg.Projects[i]))
+		}
+	}
+
+	return result
+}
+
+// projectLabel returns a project's name, or its webhook path if unnamed
+func projectLabel(project *ProjectConfig) string {
+	if project.Name != "" {
+		return project.Name
+	}
+	return project.WebhookPath
+}
+
+// HasConfigDrift reports whether the config files on disk differ from the
+// ones the running configuration was loaded from
+func (cm *ConfigManager) HasConfigDrift() bool {
+	cm.mu.RLock()
+	loaded := cm.fingerprint
+	includes := cm.config.IncludedFiles()
+	cm.mu.RUnlock()
+
+	return configFingerprint(cm.configPath, includes) != loaded
+}
+
+// configFingerprint hashes the contents of the main config and its included
+// files. Unreadable files contribute a marker so that deletions count as changes.
+func configFingerprint(configPath string, includedFiles []string) string {
+	h := sha256.New()
+	for _, path := range append([]string{configPath}, includedFiles...) {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			fmt.Fprintf(h, "unreadable:%s\n", path)
+			continue
+		}
+		fmt.Fprintf(h, "%s:%d\n", path, len(data))
+		h.Write(data)
+	}
+	return hex.EncodeToString(h.Sum(nil))
+}
+
 // SetReloadPending marks that a reload is pending (called when deployment starts)
 func (cm *ConfigManager) SetReloadPending(pending bool) {
 	cm.reloadPending.Store(pending)
@@ -2,6 +2,7 @@ package main
 
 import (
 	"bytes"
+	"context"
 	"os"
 	"path/filepath"
 	"strings"
@@ -521,3 +522,198 @@ projects:
 	}
 	wg.Wait()
 }
+
+// TestDiffConfigs tests reporting of added, removed and modified projects
+func TestDiffConfigs(t *testing.T) {
+	oldCfg := &Config{Projects: []ProjectConfig{
+		{Name: "Keep", WebhookPath: "/hooks/keep", ExecuteCommand: "echo keep"},
+		{Name: "Change", WebhookPath: "/hooks/change", ExecuteCommand: "echo old"},
+		{Name: "Drop", WebhookPath: "/hooks/drop", ExecuteCommand: "echo drop"},
+	}}
+	newCfg := &Config{Projects: []ProjectConfig{
+		{Name: "Keep", WebhookPath: "/hooks/keep", ExecuteCommand: "echo keep"},
+		{Name: "Change", WebhookPath: "/hooks/change", ExecuteCommand: "echo new"},
+		{WebhookPath: "/hooks/new", ExecuteCommand: "echo new"},
+	}}
+
+	result := diffConfigs(oldCfg, newCfg)
+	if strings.Join(result.Added, ",") != "/hooks/new" {
+		t.Errorf("Expected added [/hooks/new], got %v", result.Added)
+	}
+	if strings.Join(result.Removed, ",") != "Drop" {
+		t.Errorf("Expected removed [Drop], got %v", result.Removed)
+	}
+	if strings.Join(result.Modified, ",") != "Change" {
+		t.Errorf("Expected modified [Change], got %v", result.Modified)
+	}
+}
+
+// TestConfigManagerValidateAndReload tests validation before swap and deferral during builds
+func TestConfigManagerValidateAndReload(t *testing.T) {
+	tmpDir := t.TempDir()
+	configPath := filepath.Join(tmpDir, "sdeploy.conf")
+
+	writeConfig := func(command string) {
+		config := `
+projects:
+  - name: App
+    webhook_path: /hooks/app
+    webhook_secret: secret123
+    execute_command: ` + command + "\n"
+		if err := os.WriteFile(configPath, []byte(config), 0644); err != nil {
+			t.Fatalf("Failed to write config: %v", err)
+		}
+	}
+
+	writeConfig("echo v1")
+	cm, err := NewConfigManager(configPath, nil)
+	if err != nil {
+		t.Fatalf("NewConfigManager failed: %v", err)
+	}
+	defer cm.Stop()
+
+	// Invalid config is rejected and the old one kept
+	if err := os.WriteFile(configPath, []byte("projects:\n  - name: Broken\n"), 0644); err != nil {
+		t.Fatalf("Failed to write config: %v", err)
+	}
+	if _, err := cm.ValidateAndReload(false); err == nil {
+		t.Error("Expected validation error")
+	}
+	if cm.GetProject("/hooks/app").ExecuteCommand != "echo v1" {
+		t.Error("Expected old config to be kept after a failed reload")
+	}
+
+	// Active builds defer the swap
+	writeConfig("echo v2")
+	result, err := cm.ValidateAndReload(true)
+	if err != nil {
+		t.Fatalf("ValidateAndReload failed: %v", err)
+	}
+	if !result.Deferred || result.Applied {
+		t.Errorf("Expected deferred reload, got %+v", result)
+	}
+	if cm.GetProject("/hooks/app").ExecuteCommand != "echo v1" {
+		t.Error("Expected config swap to wait for active builds")
+	}
+	cm.ProcessPendingReload()
+	if cm.GetProject("/hooks/app").ExecuteCommand != "echo v2" {
+		t.Error("Expected deferred reload to apply once builds finish")
+	}
+
+	// Without active builds the swap is immediate
+	writeConfig("echo v3")
+	result, err = cm.ValidateAndReload(false)
+	if err != nil {
+		t.Fatalf("ValidateAndReload failed: %v", err)
+	}
+	if !result.Applied || strings.Join(result.Modified, ",") != "App" {
+		t.Errorf("Expected applied reload modifying App, got %+v", result)
+	}
+	if cm.GetProject("/hooks/app").ExecuteCommand != "echo v3" {
+		t.Error("Expected config to be swapped")
+	}
+}
+
+// TestConfigManagerReloadOnSignal tests that a reload signal applies or defers the config and logs the outcome
+func TestConfigManagerReloadOnSignal(t *testing.T) {
+	tmpDir := t.TempDir()
+	configPath := filepath.Join(tmpDir, "sdeploy.conf")
+
+	writeConfig := func(command string) {
+		config := `
+projects:
+  - name: App
+    webhook_path: /hooks/app
+    webhook_secret: secret123
+    execute_command: ` + command + "\n"
+		if err := os.WriteFile(configPath, []byte(config), 0644); err != nil {
+			t.Fatalf("Failed to write config: %v", err)
+		}
+	}
+
+	writeConfig("echo v1")
+	var buf syncBuffer
+	cm, err := NewConfigManager(configPath, NewLogger(&buf, "", false))
+	if err != nil {
+		t.Fatalf("NewConfigManager failed: %v", err)
+	}
+	defer cm.Stop()
+
+	writeConfig("echo v2")
+	cm.ReloadOnSignal(true)
+	if cm.GetProject("/hooks/app").ExecuteCommand != "echo v1" || !cm.IsReloadPending() {
+		t.Error("Expected signal reload to wait for active builds")
+	}
+	cm.ProcessPendingReload()
+
+	writeConfig("echo v3")
+	cm.ReloadOnSignal(false)
+	if cm.GetProject("/hooks/app").ExecuteCommand != "echo v3" {
+		t.Error("Expected signal reload to apply the new config")
+	}
+
+	if err := os.WriteFile(configPath, []byte("projects:\n  - name: Broken\n"), 0644); err != nil {
+		t.Fatalf("Failed to write config: %v", err)
+	}
+	cm.ReloadOnSignal(false)
+	if cm.GetProject("/hooks/app").ExecuteCommand != "echo v3" {
+		t.Error("Expected invalid config to be rejected")
+	}
+
+	logs := buf.String()
+	for _, want := range []string{"Reload requested by signal", "Signal reload deferred", "Signal reload applied (added: 0, removed: 0, modified: 1)", "Reload request rejected"} {
+		if !strings.Contains(logs, want) {
+			t.Errorf("Expected log %q, got: %s", want, logs)
+		}
+	}
+}
+
+// TestConfigManagerDriftDetection tests detection of unloaded config edits
+func TestConfigManagerDriftDetection(t *testing.T) {
+	tmpDir := t.TempDir()
+	configPath := filepath.Join(tmpDir, "sdeploy.conf")
+	config := `
+projects:
+  - name: App
+    webhook_path: /hooks/app
+    webhook_secret: secret123
+    execute_command: echo v1
+`
+	if err := os.WriteFile(configPath, []byte(config), 0644); err != nil {
+		t.Fatalf("Failed to write config: %v", err)
+	}
+
+	var buf bytes.Buffer
+	logger := NewLogger(&buf, tmpDir, false)
+	cm, err := NewConfigManager(configPath, logger)
+	if err != nil {
+		t.Fatalf("NewConfigManager failed: %v", err)
+	}
+	defer cm.Stop()
+
+	if cm.HasConfigDrift() {
+		t.Error("Expected no drift right after loading")
+	}
+
+	// Edit the file without reloading
+	if err := os.WriteFile(configPath, []byte(strings.Replace(config, "echo v1", "echo v2", 1)), 0644); err != nil {
+		t.Fatalf("Failed to write config: %v", err)
+	}
+	if !cm.HasConfigDrift() {
+		t.Fatal("Expected drift after editing the config file")
+	}
+
+	// Deploys warn about the drift
+	deployer := NewDeployer(logger)
+	deployer.SetConfigManager(cm)
+	deployer.Deploy(context.Background(), cm.GetProject("/hooks/app"), "INTERNAL")
+	if !strings.Contains(buf.String(), "config on disk differs from running config") {
+		t.Errorf("Expected drift warning in service log, got: %s", buf.String())
+	}
+
+	// Reloading clears the drift
+	cm.reloadConfig()
+	if cm.HasConfigDrift() {
+		t.Error("Expected no drift after reload")
+	}
+}
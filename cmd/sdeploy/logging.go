@@ -9,6 +9,9 @@ import (
 	"strings"
 	"sync"
 	"time"
+	"unicode/utf8"
+
+	"golang.org/x/term"
 )
 
 // LogWriter is an interface that both Logger and BuildLogger implement
@@ -26,9 +29,16 @@ type LogWriter interface {
 type Logger struct {
 	mu         sync.Mutex
 	writer     io.Writer // for testing or service logs
+	console    io.Writer // console copy of service logs (stderr in console mode)
+	color      bool      // colorize log levels on the console (log_color)
 	file       *os.File
 	logPath    string // base directory for logs
 	daemonMode bool
+	writeError bool   // a write to the log destination failed and was reported
+	timeFormat string // timestamp layout (log_timestamp_format); empty uses the default
+	passSuffix string // build log filename suffix of successful builds (log_success_suffix); empty uses the default
+	failSuffix string // build log filename suffix of failed builds (log_fail_suffix); empty uses the default
+	buildMax   int64  // size limit of build logs (build_log_max_bytes); 0 is unlimited
 }
 
 // BuildLogger handles logging for a specific project build
@@ -37,13 +47,25 @@ type BuildLogger struct {
 	writer      io.Writer
 	file        *os.File
 	projectName string
+	buildID     string // optional build ID used in place of the timestamp in filenames
 	logDir      string // base directory for log files
 	startTime   time.Time
 	logPath     string // temporary path without status
 	finalPath   string // final path with success/fail status
 	daemonMode  bool
+	redactor    *redactor // masks secrets in every message; nil logs verbatim
+	writeError  bool      // a write to the build log failed and was reported
+	timeFormat  string    // timestamp layout inherited from the service logger
+	passSuffix  string    // filename suffix used by Close(true)
+	failSuffix  string    // filename suffix used by Close(false)
+	maxBytes    int64     // stop writing once this many bytes are logged; 0 is unlimited
+	written     int64     // bytes written so far, counted when maxBytes is set
+	truncated   bool      // the size limit was reached and the marker written
 }
 
+// pendingLogSuffix marks build logs of builds still in progress
+const pendingLogSuffix = "-pending"
+
 // NewLogger creates a new logger instance
 // Service logs are always written to {log_path}/main.log regardless of mode
 // If writer is provided, logs go to that writer (used for testing)
@@ -63,7 +85,7 @@ func NewLogger(writer io.Writer, logPath string, daemonMode bool) *Logger {
 		if logPath != "" {
 			l.logPath = logPath
 		} else {
-			l.logPath = Defaults.LogPath
+			l.logPath = defaultLogPath()
 		}
 		return l
 	}
@@ -72,7 +94,7 @@ func NewLogger(writer io.Writer, logPath string, daemonMode bool) *Logger {
 	if logPath != "" {
 		l.logPath = logPath
 	} else {
-		l.logPath = Defaults.LogPath
+		l.logPath = defaultLogPath()
 	}
 
 	// Ensure log directory exists
@@ -95,12 +117,10 @@ func NewLogger(writer io.Writer, logPath string, daemonMode bool) *Logger {
 
 	// In console mode: logs go to both main.log and stderr
 	// In daemon mode: logs go only to main.log
+	l.writer = file
 	if !daemonMode {
-		// Console mode: use MultiWriter to write to both file and stderr
-		l.writer = io.MultiWriter(file, os.Stderr)
-	} else {
-		// Daemon mode: write only to file
-		l.writer = file
+		// Console mode: stderr gets its own copy so it can be colorized
+		l.console = os.Stderr
 	}
 
 	return l
@@ -111,16 +131,36 @@ func NewLogger(writer io.Writer, logPath string, daemonMode bool) *Logger {
 // Filename format: {project_name}-{yyyy-mm-dd}-{HHMM}-{status}.log
 // Status is set when Close is called
 func (l *Logger) NewBuildLogger(projectName string) *BuildLogger {
+	return l.NewBuildLoggerWithID(projectName, "")
+}
+
+// NewBuildLoggerWithID creates a build logger whose filename carries the build ID
+// Filename format: {project_name}-{build_id}-{status}.log
+// An empty buildID falls back to the NewBuildLogger format
+func (l *Logger) NewBuildLoggerWithID(projectName, buildID string) *BuildLogger {
+	return l.NewBuildLoggerInDir("", projectName, buildID)
+}
+
+// NewBuildLoggerInDir creates a build logger like NewBuildLoggerWithID that
+// writes to logDir instead of the service log directory (a project's
+// log_path override). An empty logDir uses the service log directory.
+func (l *Logger) NewBuildLoggerInDir(logDir, projectName, buildID string) *BuildLogger {
 	bl := &BuildLogger{
 		projectName: projectName,
+		buildID:     buildID,
 		startTime:   time.Now(),
 		daemonMode:  l.daemonMode,
+		timeFormat:  l.timestampFormat(),
 	}
+	bl.passSuffix, bl.failSuffix = l.buildLogSuffixes()
+	bl.maxBytes = l.buildLogMaxBytes()
 
 	// Determine log directory
-	logDir := l.logPath
 	if logDir == "" {
-		logDir = Defaults.LogPath
+		logDir = l.logPath
+	}
+	if logDir == "" {
+		logDir = defaultLogPath()
 	}
 
 	// Store the log directory for later use
@@ -136,10 +176,7 @@ func (l *Logger) NewBuildLogger(projectName string) *BuildLogger {
 
 	// Create temporary filename (without status)
 	// Format: {project_name}-{yyyy-mm-dd}-{HHMM}-pending.log
-	// Sanitize project name to prevent nested directories
-	sanitizedName := sanitizeProjectName(projectName)
-	timestamp := bl.startTime.Format("2006-01-02-1504")
-	tempFilename := fmt.Sprintf("%s-%s-pending.log", sanitizedName, timestamp)
+	tempFilename := bl.filename(pendingLogSuffix)
 	bl.logPath = filepath.Join(logDir, tempFilename)
 
 	// Open the build log file
@@ -173,17 +210,13 @@ func (bl *BuildLogger) Close(success bool) {
 
 	// Rename the file to include success/fail status
 	if bl.logPath != "" {
-		status := "fail"
+		suffix := bl.failSuffix
 		if success {
-			status = "success"
+			suffix = bl.passSuffix
 		}
 
 		// Determine final filename using stored logDir
-		// Sanitize project name to prevent nested directories
-		sanitizedName := sanitizeProjectName(bl.projectName)
-		timestamp := bl.startTime.Format("2006-01-02-1504")
-		finalFilename := fmt.Sprintf("%s-%s-%s.log", sanitizedName, timestamp, status)
-		bl.finalPath = filepath.Join(bl.logDir, finalFilename)
+		bl.finalPath = filepath.Join(bl.logDir, bl.filename(suffix))
 
 		// Rename the file
 		if err := os.Rename(bl.logPath, bl.finalPath); err != nil {
@@ -192,6 +225,17 @@ func (bl *BuildLogger) Close(success bool) {
 	}
 }
 
+// filename returns the build log filename for the given status suffix
+// Sanitize project name to prevent nested directories
+func (bl *BuildLogger) filename(suffix string) string {
+	sanitizedName := sanitizeProjectName(bl.projectName)
+	id := bl.buildID
+	if id == "" {
+		id = bl.startTime.Format("2006-01-02-1504")
+	}
+	return fmt.Sprintf("%s-%s%s.log", sanitizedName, id, suffix)
+}
+
 // GetFinalPath returns the final path of the build log file after Close is called
 func (bl *BuildLogger) GetFinalPath() string {
 	if bl == nil {
@@ -202,6 +246,30 @@ func (bl *BuildLogger) GetFinalPath() string {
 	return bl.finalPath
 }
 
+// PathFor returns the path the build log will have once closed with the given status
+func (bl *BuildLogger) PathFor(success bool) string {
+	if bl == nil || bl.logPath == "" {
+		return ""
+	}
+	bl.mu.Lock()
+	defer bl.mu.Unlock()
+	suffix := bl.failSuffix
+	if success {
+		suffix = bl.passSuffix
+	}
+	return filepath.Join(bl.logDir, bl.filename(suffix))
+}
+
+// SetRedactor sets the redactor applied to every message of this build log
+func (bl *BuildLogger) SetRedactor(r *redactor) {
+	if bl == nil {
+		return
+	}
+	bl.mu.Lock()
+	defer bl.mu.Unlock()
+	bl.redactor = r
+}
+
 // log writes a log message to the build logger
 func (bl *BuildLogger) log(level, project, message string) {
 	if bl == nil {
@@ -211,7 +279,9 @@ func (bl *BuildLogger) log(level, project, message string) {
 	bl.mu.Lock()
 	defer bl.mu.Unlock()
 
-	timestamp := time.Now().Format("2006-01-02 15:04:05")
+	message = bl.redactor.Redact(message)
+
+	timestamp := formatLogTimestamp(time.Now(), bl.timeFormat)
 	var logLine string
 	if project == "" {
 		logLine = fmt.Sprintf("[%s] [%s] %s\n", timestamp, level, message)
@@ -219,11 +289,41 @@ func (bl *BuildLogger) log(level, project, message string) {
 		logLine = fmt.Sprintf("[%s] [%s] [%s] %s\n", timestamp, level, project, message)
 	}
 	
-	if bl.writer != nil {
-		_, _ = bl.writer.Write([]byte(logLine))
+	logLine = bl.limit(logLine)
+	if bl.writer != nil && logLine != "" {
+		writeLogLine(bl.writer, logLine, bl.logPath, &bl.writeError)
 	}
 }
 
+// limit applies build_log_max_bytes to a log line: lines are passed through
+// until the limit, the line reaching it is cut and followed by a truncation
+// marker, and everything after that is dropped. The build itself carries on.
+func (bl *BuildLogger) limit(line string) string {
+	if bl.maxBytes <= 0 {
+		return line
+	}
+	if bl.truncated {
+		return ""
+	}
+	remaining := bl.maxBytes - bl.written
+	if int64(len(line)) <= remaining {
+		bl.written += int64(len(line))
+		return line
+	}
+
+	bl.truncated = true
+	cut := int(remaining)
+	// Don't split a multi-byte character
+	for cut > 0 && !utf8.RuneStart(line[cut]) {
+		cut--
+	}
+	marker := fmt.Sprintf("... log truncated: build_log_max_bytes (%d) reached ...\n", bl.maxBytes)
+	if cut == 0 {
+		return marker
+	}
+	return line[:cut] + "\n" + marker
+}
+
 // Info logs an informational message to the build log
 func (bl *BuildLogger) Info(project, message string) {
 	bl.log("INFO", project, message)
@@ -254,6 +354,25 @@ func (bl *BuildLogger) Errorf(project, format string, args ...interface{}) {
 	bl.Error(project, fmt.Sprintf(format, args...))
 }
 
+// writeLogLine writes a log line to w. If the write fails (disk full, file
+// removed or permissions changed after startup) the line goes to stderr
+// instead, so it is not lost, and the first failure is reported in detail.
+// The destination is retried on every line and recovers once writable again.
+func writeLogLine(w io.Writer, line, path string, reported *bool) {
+	_, err := w.Write([]byte(line))
+	if err == nil || w == io.Writer(os.Stderr) {
+		return
+	}
+	if !*reported {
+		*reported = true
+		if path == "" {
+			path = "(log writer)"
+		}
+		reportLogFileError("write", path, err, "0644")
+	}
+	_, _ = os.Stderr.Write([]byte(line))
+}
+
 // reportLogFileError outputs a detailed error message to stderr when log file operations fail
 func reportLogFileError(operation, path string, err error, attemptedPerms string) {
 	fmt.Fprintf(os.Stderr, "\n[SDeploy] Log file error: failed to %s\n", operation)
@@ -323,6 +442,112 @@ func sanitizeProjectName(projectName string) string {
 	return sanitized
 }
 
+// LogDir returns the directory service and build logs are written to
+func (l *Logger) LogDir() string {
+	return l.logPath
+}
+
+// SetTimestampFormat sets the time layout used for log timestamps of the
+// service log and build loggers created afterwards. Empty restores the default.
+func (l *Logger) SetTimestampFormat(layout string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.timeFormat = layout
+}
+
+// SetColor sets when log levels on the console are colorized (log_color):
+// LogColorAlways, LogColorNever, or LogColorAuto (the default) when the
+// console is a terminal and NO_COLOR is unset. main.log and build logs are
+// always plain.
+func (l *Logger) SetColor(mode string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	switch mode {
+	case LogColorAlways:
+		l.color = l.console != nil
+	case LogColorNever:
+		l.color = false
+	default:
+		l.color = isTerminal(l.console) && os.Getenv("NO_COLOR") == ""
+	}
+}
+
+// isTerminal reports whether w is a file connected to a terminal
+func isTerminal(w io.Writer) bool {
+	f, ok := w.(*os.File)
+	return ok && term.IsTerminal(int(f.Fd()))
+}
+
+// levelColors are the ANSI colors of log levels on the console
+var levelColors = map[string]string{
+	"INFO":  "\x1b[32m", // green
+	"WARN":  "\x1b[33m", // yellow
+	"ERROR": "\x1b[31m", // red
+}
+
+// formatLogLine formats a service log line
+func formatLogLine(timestamp, level, project, message string) string {
+	if project == "" {
+		// No project specified, use simpler format without empty brackets
+		return fmt.Sprintf("[%s] [%s] %s\n", timestamp, level, message)
+	}
+	return fmt.Sprintf("[%s] [%s] [%s] %s\n", timestamp, level, project, message)
+}
+
+// SetBuildLogSuffixes sets the filename suffixes (log_success_suffix,
+// log_fail_suffix) of build loggers created afterwards. Empty values restore
+// the defaults.
+func (l *Logger) SetBuildLogSuffixes(success, fail string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.passSuffix = success
+	l.failSuffix = fail
+}
+
+// SetBuildLogMaxBytes sets the size limit (build_log_max_bytes) of build
+// loggers created afterwards; 0 removes the limit
+func (l *Logger) SetBuildLogMaxBytes(n int64) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.buildMax = n
+}
+
+// buildLogMaxBytes returns the configured build log size limit
+func (l *Logger) buildLogMaxBytes() int64 {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.buildMax
+}
+
+// buildLogSuffixes returns the configured success and fail suffixes
+func (l *Logger) buildLogSuffixes() (success, fail string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	success, fail = l.passSuffix, l.failSuffix
+	if success == "" {
+		success = Defaults.LogSuccessSuffix
+	}
+	if fail == "" {
+		fail = Defaults.LogFailSuffix
+	}
+	return success, fail
+}
+
+// timestampFormat returns the configured timestamp layout
+func (l *Logger) timestampFormat() string {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.timeFormat
+}
+
+// formatLogTimestamp formats t with layout, or the default layout if empty
+func formatLogTimestamp(t time.Time, layout string) string {
+	if layout == "" {
+		layout = Defaults.LogTimestampFormat
+	}
+	return t.Format(layout)
+}
+
 // IsDaemonMode returns whether the logger is in daemon mode
 func (l *Logger) IsDaemonMode() bool {
 	return l.daemonMode
@@ -343,15 +568,27 @@ func (l *Logger) log(level, project, message string) {
 	l.mu.Lock()
 	defer l.mu.Unlock()
 
-	timestamp := time.Now().Format("2006-01-02 15:04:05")
-	var logLine string
-	if project == "" {
-		// No project specified, use simpler format without empty brackets
-		logLine = fmt.Sprintf("[%s] [%s] %s\n", timestamp, level, message)
-	} else {
-		logLine = fmt.Sprintf("[%s] [%s] [%s] %s\n", timestamp, level, project, message)
+	timestamp := formatLogTimestamp(time.Now(), l.timeFormat)
+	logLine := formatLogLine(timestamp, level, project, message)
+	mainLogPath := ""
+	if l.file != nil {
+		mainLogPath = l.file.Name()
+	}
+	if l.console == nil {
+		writeLogLine(l.writer, logLine, mainLogPath, &l.writeError)
+		return
+	}
+
+	// Console mode: main.log stays plain, only the console copy is colorized
+	if _, err := l.writer.Write([]byte(logLine)); err != nil && !l.writeError {
+		l.writeError = true
+		reportLogFileError("write", mainLogPath, err, "0644")
+	}
+	consoleLine := logLine
+	if color, ok := levelColors[level]; ok && l.color {
+		consoleLine = formatLogLine(timestamp, color+level+"\x1b[0m", project, message)
 	}
-	_, _ = l.writer.Write([]byte(logLine))
+	_, _ = io.WriteString(l.console, consoleLine)
 }
 
 // Info logs an informational message
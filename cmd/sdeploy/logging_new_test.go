@@ -1,6 +1,7 @@
 package main
 
 import (
+	"context"
 	"os"
 	"path/filepath"
 	"strings"
@@ -110,6 +111,38 @@ func TestBuildLoggerFailureStatus(t *testing.T) {
 	}
 }
 
+// TestBuildLoggerCustomSuffixes tests log_success_suffix and log_fail_suffix
+func TestBuildLoggerCustomSuffixes(t *testing.T) {
+	tmpDir := t.TempDir()
+
+	logger := NewLogger(nil, tmpDir, true)
+	defer logger.Close()
+	logger.SetBuildLogSuffixes(".ok", "_FAILED")
+
+	passed := logger.NewBuildLoggerWithID("app", "2024-01-15-1430-a1b2c3")
+	passed.Close(true)
+	failed := logger.NewBuildLoggerWithID("app", "2024-01-15-1431-d4e5f6")
+	failed.Close(false)
+
+	if want := filepath.Join(tmpDir, "app-2024-01-15-1430-a1b2c3.ok.log"); passed.GetFinalPath() != want {
+		t.Errorf("Expected %s, got %s", want, passed.GetFinalPath())
+	}
+	if want := filepath.Join(tmpDir, "app-2024-01-15-1431-d4e5f6_FAILED.log"); failed.GetFinalPath() != want {
+		t.Errorf("Expected %s, got %s", want, failed.GetFinalPath())
+	}
+	if findBuildLog(tmpDir, "2024-01-15-1430-a1b2c3") != passed.GetFinalPath() {
+		t.Error("Expected /builds lookup to find a log with a custom suffix")
+	}
+
+	// Empty suffixes restore the defaults
+	logger.SetBuildLogSuffixes("", "")
+	restored := logger.NewBuildLoggerWithID("app", "2024-01-15-1432-0a1b2c")
+	restored.Close(true)
+	if !strings.HasSuffix(restored.GetFinalPath(), "-0a1b2c-success.log") {
+		t.Errorf("Expected default success suffix, got %s", restored.GetFinalPath())
+	}
+}
+
 // TestLogPathDirectoryCreation tests that log directory is created if it doesn't exist
 func TestLogPathDirectoryCreation(t *testing.T) {
 	tmpDir := t.TempDir()
@@ -557,3 +590,203 @@ func TestAlwaysCreatesMainLog(t *testing.T) {
 		})
 	}
 }
+
+// TestBuildLoggerWithIDFileNaming tests that the build ID replaces the timestamp in the filename
+func TestBuildLoggerWithIDFileNaming(t *testing.T) {
+	tmpDir := t.TempDir()
+
+	logger := NewLogger(nil, tmpDir, true)
+	defer logger.Close()
+
+	buildLogger := logger.NewBuildLoggerWithID("test-project", "2024-01-15-1430-a1b2c3")
+	buildLogger.Info("test-project", "Build started")
+	buildLogger.Close(false)
+
+	expected := filepath.Join(tmpDir, "test-project-2024-01-15-1430-a1b2c3-fail.log")
+	if buildLogger.GetFinalPath() != expected {
+		t.Errorf("Expected final path %s, got %s", expected, buildLogger.GetFinalPath())
+	}
+	if _, err := os.Stat(expected); err != nil {
+		t.Errorf("Expected build log file to exist: %v", err)
+	}
+}
+
+// TestLogWriteErrorFallsBackToStderr tests that log lines are not lost when the log file stops accepting writes
+func TestLogWriteErrorFallsBackToStderr(t *testing.T) {
+	tmpDir := t.TempDir()
+	stderrPath := filepath.Join(tmpDir, "stderr")
+	stderr, err := os.Create(stderrPath)
+	if err != nil {
+		t.Fatalf("Failed to create stderr capture: %v", err)
+	}
+	defer stderr.Close()
+	origStderr := os.Stderr
+	os.Stderr = stderr
+	defer func() { os.Stderr = origStderr }()
+
+	logger := NewLogger(nil, filepath.Join(tmpDir, "logs"), true)
+	defer logger.Close()
+	buildLogger := logger.NewBuildLoggerWithID("TestProject", "build-1")
+
+	// Simulate the log files becoming unwritable mid-run
+	logger.file.Close()
+	buildLogger.file.Close()
+
+	logger.Info("", "service line 1")
+	logger.Info("", "service line 2")
+	buildLogger.Info("TestProject", "build line")
+	buildLogger.Close(true)
+
+	data, err := os.ReadFile(stderrPath)
+	if err != nil {
+		t.Fatalf("Failed to read stderr capture: %v", err)
+	}
+	out := string(data)
+	for _, want := range []string{"service line 1", "service line 2", "build line", "failed to write", "main.log", "TestProject-build-1-pending.log"} {
+		if !strings.Contains(out, want) {
+			t.Errorf("Expected stderr to contain %q, got: %s", want, out)
+		}
+	}
+	if n := strings.Count(out, "failed to write"); n != 2 {
+		t.Errorf("Expected one write error report per log destination, got %d", n)
+	}
+}
+
+// TestBuildLoggerInDir tests that a project log_path override receives the build log while main.log stays global
+func TestBuildLoggerInDir(t *testing.T) {
+	tmpDir := t.TempDir()
+	globalDir := filepath.Join(tmpDir, "global")
+	projectDir := filepath.Join(tmpDir, "disk2", "frontend")
+
+	logger := NewLogger(nil, globalDir, true)
+	defer logger.Close()
+
+	bl := logger.NewBuildLoggerInDir(projectDir, "Frontend", "2024-01-15-1430-a1b2c3")
+	bl.Info("Frontend", "isolated build")
+	bl.Close(true)
+
+	want := filepath.Join(projectDir, "Frontend-2024-01-15-1430-a1b2c3-success.log")
+	if bl.GetFinalPath() != want {
+		t.Errorf("Expected build log at %s, got %s", want, bl.GetFinalPath())
+	}
+	if _, err := os.Stat(want); err != nil {
+		t.Errorf("Expected build log in project directory: %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(globalDir, "main.log")); err != nil {
+		t.Errorf("Expected main.log in global directory: %v", err)
+	}
+	if matches, _ := filepath.Glob(filepath.Join(globalDir, "Frontend-*.log")); len(matches) != 0 {
+		t.Errorf("Expected no build logs in global directory, got %v", matches)
+	}
+}
+
+// TestLoggerTimestampFormat tests that log_timestamp_format applies to service and build logs
+func TestLoggerTimestampFormat(t *testing.T) {
+	tmpDir := t.TempDir()
+	var buf strings.Builder
+	logger := NewLogger(&buf, tmpDir, false)
+	logger.SetTimestampFormat(time.RFC3339)
+
+	logger.Info("", "service line")
+	line := strings.TrimSpace(buf.String())
+	stamp := strings.TrimPrefix(line[:strings.Index(line, "]")], "[")
+	if _, err := time.Parse(time.RFC3339, stamp); err != nil {
+		t.Errorf("Expected RFC 3339 timestamp in service log, got %q", line)
+	}
+
+	bl := logger.NewBuildLoggerWithID("TestProject", "2024-01-15-1430-a1b2c3")
+	bl.Info("TestProject", "build line")
+	bl.Close(true)
+	data, err := os.ReadFile(bl.GetFinalPath())
+	if err != nil {
+		t.Fatalf("Failed to read build log: %v", err)
+	}
+	line = strings.TrimSpace(string(data))
+	stamp = strings.TrimPrefix(line[:strings.Index(line, "]")], "[")
+	if _, err := time.Parse(time.RFC3339, stamp); err != nil {
+		t.Errorf("Expected RFC 3339 timestamp in build log, got %q", line)
+	}
+}
+
+// TestLoggerColor tests that log_color colorizes levels on the console only
+func TestLoggerColor(t *testing.T) {
+	tmpDir := t.TempDir()
+	logger := NewLogger(nil, tmpDir, false)
+	defer logger.Close()
+	var console strings.Builder
+	logger.console = &console
+
+	logger.SetColor(LogColorAlways)
+	logger.Info("", "info line")
+	logger.Warn("Frontend", "warn line")
+	logger.Error("", "error line")
+	for _, want := range []string{"[\x1b[32mINFO\x1b[0m] info line", "[\x1b[33mWARN\x1b[0m] [Frontend] warn line", "[\x1b[31mERROR\x1b[0m] error line"} {
+		if !strings.Contains(console.String(), want) {
+			t.Errorf("Expected console output to contain %q, got %q", want, console.String())
+		}
+	}
+
+	content, err := os.ReadFile(filepath.Join(tmpDir, "main.log"))
+	if err != nil {
+		t.Fatalf("Failed to read main.log: %v", err)
+	}
+	if strings.Contains(string(content), "\x1b") || !strings.Contains(string(content), "[WARN] [Frontend] warn line") {
+		t.Errorf("Expected plain main.log, got %q", content)
+	}
+
+	// auto only colorizes terminals, and a strings.Builder is not one
+	for _, mode := range []string{LogColorAuto, LogColorNever} {
+		console.Reset()
+		logger.SetColor(mode)
+		logger.Info("", "plain line")
+		if strings.Contains(console.String(), "\x1b") {
+			t.Errorf("log_color %s: expected plain console output, got %q", mode, console.String())
+		}
+	}
+}
+
+// TestBuildLoggerMaxBytes tests that build_log_max_bytes truncates build logs
+// without failing the build
+func TestBuildLoggerMaxBytes(t *testing.T) {
+	tmpDir := t.TempDir()
+	logger := NewLogger(nil, tmpDir, true)
+	defer logger.Close()
+	logger.SetBuildLogMaxBytes(200)
+
+	bl := logger.NewBuildLoggerWithID("app", "2024-01-15-1430-a1b2c3")
+	for i := 0; i < 20; i++ {
+		bl.Infof("app", "line %02d", i)
+	}
+	bl.Close(true)
+
+	data, err := os.ReadFile(bl.GetFinalPath())
+	if err != nil {
+		t.Fatalf("Failed to read build log: %v", err)
+	}
+	content := string(data)
+	marker := "... log truncated: build_log_max_bytes (200) reached ...\n"
+	if strings.Count(content, marker) != 1 || !strings.HasSuffix(content, marker) {
+		t.Errorf("Expected one truncation marker at the end, got %q", content)
+	}
+	if len(content) > 200+1+len(marker) {
+		t.Errorf("Expected log of at most 200 bytes plus marker, got %d bytes", len(content))
+	}
+	if !strings.Contains(content, "line 00") || strings.Contains(content, "line 19") {
+		t.Errorf("Expected only the first lines to be kept, got %q", content)
+	}
+
+	// The build itself is unaffected by the limit
+	deployer := NewDeployer(logger)
+	project := &ProjectConfig{Name: "Verbose", WebhookPath: "/hooks/verbose", ExecuteCommand: "yes | head -c 100000"}
+	result := deployer.Deploy(context.Background(), project, "INTERNAL")
+	if !result.Success || len(result.Output) != 100000 {
+		t.Fatalf("Expected build to succeed with full output, got success=%v output=%d bytes", result.Success, len(result.Output))
+	}
+	info, err := os.Stat(result.BuildLogPath)
+	if err != nil {
+		t.Fatalf("Failed to stat build log: %v", err)
+	}
+	if info.Size() > 200+1+int64(len(marker)) {
+		t.Errorf("Expected truncated build log, got %d bytes", info.Size())
+	}
+}
@@ -1,23 +1,31 @@
 package main
 
 import (
+	"context"
+	"errors"
 	"flag"
 	"fmt"
+	"io"
 	"net/http"
 	"os"
 	"os/signal"
+	"strings"
+	"time"
 )
 
-const (
-	Version     = "v1.0"
-	ServiceName = "SDeploy"
-)
+// ServiceName is the product name used in logs and notifications
+const ServiceName = "SDeploy"
 
 func main() {
 	// Parse command line flags
 	configPath := flag.String("c", "", "Path to config file")
 	daemonMode := flag.Bool("d", false, "Run as daemon (background service)")
 	showHelp := flag.Bool("h", false, "Show help")
+	showVersion := flag.Bool("version", false, "Print version and build information")
+	onceProject := flag.String("once", "", "Deploy the named project once and exit")
+	sourceLabel := flag.String("source", "", "Trigger source label for --once (e.g. cron, ci)")
+	jsonOutput := flag.Bool("json", false, "Print the --once result as JSON")
+	branchOverride := flag.String("branch", "", "Branch to deploy with --once instead of git_branch")
 	flag.Parse()
 
 	// Note: daemonMode flag controls logging behavior:
@@ -29,6 +37,39 @@ func main() {
 		os.Exit(0)
 	}
 
+	// Version needs no config, so it is handled before the config is loaded
+	if *showVersion || (flag.NArg() == 1 && flag.Arg(0) == "version") {
+		fmt.Println(versionString())
+		os.Exit(0)
+	}
+
+	if *jsonOutput && *onceProject == "" {
+		fmt.Fprintln(os.Stderr, "Error: --json requires --once")
+		os.Exit(2)
+	}
+
+	if *branchOverride != "" {
+		if *onceProject == "" {
+			fmt.Fprintln(os.Stderr, "Error: --branch requires --once")
+			os.Exit(2)
+		}
+		if err := validateGitBranch(*branchOverride); err != nil {
+			fmt.Fprintf(os.Stderr, "Error: --branch: %v\n", err)
+			os.Exit(2)
+		}
+	}
+
+	if *sourceLabel != "" {
+		if *onceProject == "" {
+			fmt.Fprintln(os.Stderr, "Error: --source requires --once")
+			os.Exit(2)
+		}
+		if err := validateSourceLabel(*sourceLabel); err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(2)
+		}
+	}
+
 	// Find config file
 	cfgPath := FindConfigFile(*configPath)
 	if cfgPath == "" {
@@ -44,6 +85,11 @@ func main() {
 		os.Exit(1)
 	}
 
+	// Run a CLI subcommand instead of the daemon if one was given
+	if args := flag.Args(); len(args) > 0 {
+		os.Exit(runSubcommand(cfg, args, os.Stdout))
+	}
+
 	// Initialize logger
 	// Service logs always written to main.log regardless of mode
 	// Console mode: service logs also go to stderr for real-time visibility
@@ -51,15 +97,55 @@ func main() {
 	// Build logs always go to files in both modes
 	logPath := cfg.LogPath
 	if logPath == "" {
-		logPath = Defaults.LogPath
+		logPath = defaultLogPath()
 	}
 	logger := NewLogger(nil, logPath, *daemonMode)
+	logger.SetTimestampFormat(cfg.LogTimestampFormat)
+	logger.SetBuildLogSuffixes(cfg.LogSuccessSuffix, cfg.LogFailSuffix)
+	logger.SetColor(cfg.LogColor)
+	logger.SetBuildLogMaxBytes(cfg.BuildLogMaxBytes)
 	defer logger.Close()
 
+	// The config holds secrets; refuse to run with it exposed under strict_perms
+	if warnings := cfg.PermissionWarnings(cfgPath); len(warnings) > 0 {
+		for _, warning := range warnings {
+			if cfg.StrictPerms {
+				logger.Errorf("", "strict_perms: %s", warning)
+			} else {
+				logger.Warnf("", "WARNING: %s", warning)
+			}
+		}
+		if cfg.StrictPerms {
+			os.Exit(1)
+		}
+	}
+
+	// Run a single deployment without starting the HTTP listener
+	if *onceProject != "" {
+		os.Exit(runOnceWithLogger(cfg, *onceProject, onceTriggerSourceFor(*sourceLabel), *branchOverride, *jsonOutput, logger))
+	}
+
+	// Refuse to start a second daemon on the same PID file
+	if cfg.PIDFile != PIDFileNone {
+		pid, err := acquirePIDFile(cfg.PIDFile)
+		if errors.Is(err, errPIDFileLocked) {
+			logger.Errorf("", "Another %s daemon is already running: %v", ServiceName, err)
+			os.Exit(1)
+		}
+		if err != nil {
+			logger.Warnf("", "%v (continuing without PID file)", err)
+		}
+		defer pid.Release()
+	}
+
 	logger.Infof("", "%s %s - Service started", ServiceName, Version)
+	logger.Infof("", "Build: %s", versionString())
 
 	// Log configuration summary
 	logConfigSummary(logger, cfg, *daemonMode)
+	for _, warning := range cfg.PathWarnings() {
+		logger.Warnf("", "strict_paths: %s", warning)
+	}
 
 	// Create ConfigManager for hot reload
 	configManager, err := NewConfigManager(cfgPath, logger)
@@ -80,6 +166,7 @@ func main() {
 	// Initialize deployer
 	deployer := NewDeployer(logger)
 	deployer.SetNotifier(notifier)
+	applyDeployerSettings(deployer, cfg)
 	deployer.SetConfigManager(configManager)
 
 	// Initialize webhook handler with hot reload support
@@ -94,6 +181,11 @@ func main() {
 		} else {
 			deployer.SetNotifier(nil)
 		}
+		applyDeployerSettings(deployer, newCfg)
+		logger.SetTimestampFormat(newCfg.LogTimestampFormat)
+		logger.SetBuildLogSuffixes(newCfg.LogSuccessSuffix, newCfg.LogFailSuffix)
+		logger.SetColor(newCfg.LogColor)
+		logger.SetBuildLogMaxBytes(newCfg.BuildLogMaxBytes)
 	})
 
 	// Start config file watcher for hot reload
@@ -106,16 +198,45 @@ func main() {
 	sigChan := make(chan os.Signal, 1)
 	signal.Notify(sigChan, getShutdownSignals()...)
 
+	// Toggle maintenance mode on SIGUSR1
+	maintenanceChan := make(chan os.Signal, 1)
+	signal.Notify(maintenanceChan, getMaintenanceSignal())
+	go func() {
+		for range maintenanceChan {
+			if handler.ToggleMaintenance() {
+				logger.Warn("", "Maintenance mode enabled by signal: webhooks are acknowledged but builds are deferred")
+			} else {
+				logger.Info("", "Maintenance mode disabled by signal")
+			}
+		}
+	}()
+
+	// Reload the configuration on SIGHUP, deferred while builds are running
+	reloadChan := make(chan os.Signal, 1)
+	signal.Notify(reloadChan, getReloadSignal())
+	go func() {
+		for range reloadChan {
+			configManager.ReloadOnSignal(deployer.HasActiveBuilds())
+		}
+	}()
+
 	// Start HTTP server in goroutine
-	addr := fmt.Sprintf(":%d", cfg.ListenPort)
+	addr := cfg.ListenAddress()
 	server := &http.Server{
 		Addr:    addr,
 		Handler: handler,
 	}
 
 	go func() {
-		logger.Infof("", "Server starting on %s", addr)
-		if err := server.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+		var err error
+		if cfg.TLSEnabled() {
+			logger.Infof("", "Server starting on %s (HTTPS)", addr)
+			err = server.ListenAndServeTLS(cfg.TLSCertFile, cfg.TLSKeyFile)
+		} else {
+			logger.Infof("", "Server starting on %s", addr)
+			err = server.ListenAndServe()
+		}
+		if err != nil && err != http.ErrServerClosed {
 			logger.Errorf("", "Server error: %v", err)
 			os.Exit(1)
 		}
@@ -125,10 +246,29 @@ func main() {
 	sig := <-sigChan
 	logger.Infof("", "Received signal %v, shutting down...", sig)
 
-	// Graceful shutdown
-	if err := server.Close(); err != nil {
+	// Graceful shutdown: stop accepting new webhooks first
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	if err := server.Shutdown(shutdownCtx); err != nil {
 		logger.Errorf("", "Error during shutdown: %v", err)
 	}
+	cancel()
+
+	// Drain active builds so repositories are not left half-updated
+	if active := deployer.ActiveBuilds(); active > 0 {
+		grace := time.Duration(configManager.GetConfig().ShutdownGraceSeconds) * time.Second
+		logger.Infof("", "Waiting up to %v for %d active build(s) to finish...", grace, active)
+		if deployer.WaitForActiveBuilds(grace) {
+			logger.Info("", "All active builds finished")
+		} else {
+			logger.Warnf("", "Shutdown grace period expired with %d build(s) still running, forcing exit", deployer.ActiveBuilds())
+		}
+	}
+
+	// Give queued notifications (and their retries) and result hooks a chance to finish
+	grace := time.Duration(configManager.GetConfig().ShutdownGraceSeconds) * time.Second
+	if !deployer.WaitForNotifications(grace) {
+		logger.Warn("", "Shutdown grace period expired with notifications or result hooks still pending")
+	}
 
 	logger.Infof("", "%s %s - Service terminated", ServiceName, Version)
 }
@@ -137,10 +277,17 @@ func main() {
 func logConfigSummary(logger *Logger, cfg *Config, daemonMode bool) {
 	logger.Info("", "Configuration loaded:")
 	logger.Infof("", "  Listen Port: %d", cfg.ListenPort)
+	if cfg.ListenAddr != "" {
+		logger.Infof("", "  Listen Address: %s", cfg.ListenAddr)
+	}
+	if cfg.TLSEnabled() {
+		logger.Infof("", "  TLS: enabled (certificate: %s)", cfg.TLSCertFile)
+	}
+	logger.Infof("", "  Shutdown Grace: %ds", cfg.ShutdownGraceSeconds)
 	
 	logPath := cfg.LogPath
 	if logPath == "" {
-		logPath = Defaults.LogPath
+		logPath = defaultLogPath()
 	}
 	
 	if daemonMode {
@@ -152,23 +299,42 @@ func logConfigSummary(logger *Logger, cfg *Config, daemonMode bool) {
 		logger.Infof("", "  Service Log: %s/main.log + stderr (console)", logPath)
 		logger.Infof("", "  Build Logs: %s/{project}-{date}-{time}-{status}.log", logPath)
 	}
+	if cfg.PIDFile != PIDFileNone {
+		logger.Infof("", "  PID File: %s", cfg.PIDFile)
+	}
 	if IsEmailConfigValid(cfg.EmailConfig) {
 		logger.Info("", "  Email Notifications: enabled")
 	} else {
 		logger.Info("", "  Email Notifications: disabled")
 	}
+	if cfg.MaintenanceMode {
+		logger.Warn("", "  Maintenance Mode: enabled (builds are deferred)")
+	}
 
 	for i, project := range cfg.Projects {
 		logger.Infof("", "Project [%d]: %s", i+1, project.Name)
 		logger.Infof("", "  - Webhook Path: %s", project.WebhookPath)
+		if !project.IsEnabled() {
+			logger.Info("", "  - Enabled: false (deploys are skipped)")
+		}
 		// Print Webhook URL with curl example
-		logger.Infof("", "  - Webhook URL: curl -X POST \"http://<YOUR_HOST>:%d%s?secret=%s\" -d '{\"ref\":\"refs/heads/%s\"}'",
-			cfg.ListenPort, project.WebhookPath, project.WebhookSecret, project.GitBranch)
+		if project.MatchRepo != "" {
+			logger.Infof("", "  - Webhook URL: curl -X POST \"%s://<YOUR_HOST>:%d%s?secret=%s\" -d '{\"ref\":\"refs/heads/%s\",\"repository\":{\"full_name\":\"%s\"}}'",
+				webhookScheme(cfg), cfg.ListenPort, project.WebhookPath, project.WebhookSecret, project.GitBranch, project.MatchRepo)
+			logger.Infof("", "  - Match Repo: %s", project.MatchRepo)
+		} else {
+			logger.Infof("", "  - Webhook URL: curl -X POST \"%s://<YOUR_HOST>:%d%s?secret=%s\" -d '{\"ref\":\"refs/heads/%s\"}'",
+				webhookScheme(cfg), cfg.ListenPort, project.WebhookPath, project.WebhookSecret, project.GitBranch)
+		}
 		// Order: Git Repo, Git Branch, Git Update, Local Path, Execute Path, Execute Command
 		if project.GitRepo != "" {
 			logger.Infof("", "  - Git Repo: %s", project.GitRepo)
 		}
-		logger.Infof("", "  - Git Branch: %s", project.GitBranch)
+		if project.remoteBranch && project.GitRepo != "" {
+			logger.Infof("", "  - Git Branch: remote default (fallback %s)", project.GitBranch)
+		} else {
+			logger.Infof("", "  - Git Branch: %s", project.GitBranch)
+		}
 		logger.Infof("", "  - Git Update: %t", project.GitUpdate)
 		if project.LocalPath != "" {
 			logger.Infof("", "  - Local Path: %s", project.LocalPath)
@@ -176,28 +342,132 @@ func logConfigSummary(logger *Logger, cfg *Config, daemonMode bool) {
 		if project.ExecutePath != "" {
 			logger.Infof("", "  - Execute Path: %s", project.ExecutePath)
 		}
-		logger.Infof("", "  - Execute Command: %s", project.ExecuteCommand)
+		logger.Infof("", "  - Execute Command: %s", project.CommandSummary())
+		if project.LogPath != "" {
+			logger.Infof("", "  - Build Logs: %s", project.LogPath)
+		}
+		for _, bd := range project.BranchDeploys {
+			logger.Infof("", "  - Branch Deploy: %s -> %s", bd.GitBranch, bd.LocalPath)
+		}
+		for branch, command := range project.BranchCommands {
+			logger.Infof("", "  - Branch Command: %s -> %s", branch, command)
+		}
+		if project.DeployStrategy == DeployStrategyAtomic {
+			logger.Infof("", "  - Deploy Strategy: %s", project.DeployStrategy)
+		}
+		if len(project.AllowedTriggers) > 0 {
+			logger.Infof("", "  - Allowed Triggers: %s", strings.Join(project.AllowedTriggers, ", "))
+		}
 		if len(project.EnvVariables) > 0 {
 			logger.Infof("", "  - Env Variables: %d configured", len(project.EnvVariables))
 		}
 		if project.TimeoutSeconds > 0 {
 			logger.Infof("", "  - Timeout: %ds", project.TimeoutSeconds)
 		}
+		if project.TimeoutGrace > 0 {
+			logger.Infof("", "  - Timeout Grace: %ds", project.TimeoutGrace)
+		}
+		if project.GitTimeoutSeconds > 0 && project.GitTimeoutSeconds != project.TimeoutSeconds {
+			logger.Infof("", "  - Git Timeout: %ds", project.GitTimeoutSeconds)
+		}
+		if project.GitRetryCount > 0 {
+			logger.Infof("", "  - Git Retries: %d (delay %s, doubling)", project.GitRetryCount, project.GitRetryBaseDelay())
+		}
 		logger.Infof("", "  - Email Recipients: %d", len(project.EmailRecipients))
 		logger.Infof("", "-------------------------------------------------------")
 	}
 }
 
+// runOnceWithLogger sets up a deployer like the daemon does and runs --once
+func runOnceWithLogger(cfg *Config, projectName, triggerSource, branch string, jsonOutput bool, logger *Logger) int {
+	defer logger.Close()
+
+	deployer := newCLIDeployer(cfg, logger)
+	code := runOnce(cfg, projectName, triggerSource, branch, jsonOutput, deployer, os.Stdout)
+	finishCLIDeployer(cfg, deployer, logger)
+	return code
+}
+
+// runRollbackWithLogger runs the rollback command with a console logger
+// writing to the configured log_path
+func runRollbackWithLogger(cfg *Config, projectName string, out io.Writer) int {
+	logPath := cfg.LogPath
+	if logPath == "" {
+		logPath = defaultLogPath()
+	}
+	logger := NewLogger(nil, logPath, false)
+	logger.SetTimestampFormat(cfg.LogTimestampFormat)
+	logger.SetBuildLogSuffixes(cfg.LogSuccessSuffix, cfg.LogFailSuffix)
+	logger.SetColor(cfg.LogColor)
+	logger.SetBuildLogMaxBytes(cfg.BuildLogMaxBytes)
+	defer logger.Close()
+
+	deployer := newCLIDeployer(cfg, logger)
+	code := runRollback(cfg, projectName, deployer, out)
+	finishCLIDeployer(cfg, deployer, logger)
+	return code
+}
+
+// newCLIDeployer creates the deployer for deploys run from the command line
+func newCLIDeployer(cfg *Config, logger *Logger) *Deployer {
+	deployer := NewDeployer(logger)
+	if IsEmailConfigValid(cfg.EmailConfig) {
+		deployer.SetNotifier(NewEmailNotifier(cfg.EmailConfig, logger))
+	}
+	applyDeployerSettings(deployer, cfg)
+	return deployer
+}
+
+// finishCLIDeployer waits for background work of a command line deploy
+// before the process exits
+func finishCLIDeployer(cfg *Config, deployer *Deployer, logger *Logger) {
+	// dependent_projects deploys run in the background; finish them before exiting
+	deployer.WaitForFanOut()
+	if !deployer.WaitForNotifications(time.Duration(cfg.ShutdownGraceSeconds) * time.Second) {
+		logger.Warn("", "Gave up waiting for email notifications to be sent")
+	}
+}
+
+// webhookScheme returns the URL scheme clients use to reach the listener
+func webhookScheme(cfg *Config) string {
+	if cfg.TLSEnabled() {
+		return "https"
+	}
+	return "http"
+}
+
+// applyDeployerSettings passes global deployment settings to the deployer
+func applyDeployerSettings(deployer *Deployer, cfg *Config) {
+	deployer.SetNotifyRetry(cfg.NotifyRetryCount, time.Duration(cfg.NotifyRetryBaseMS)*time.Millisecond)
+	deployer.SetSHALength(cfg.SHALength)
+	deployer.SetTeamsNotifier(NewTeamsNotifier(cfg.TeamsConfig))
+	deployer.SetRedaction(cfg.RedactSecrets(), cfg.RedactRegexps())
+	deployer.SetConfig(cfg)
+}
+
 // printUsage prints the help message
 func printUsage() {
 	fmt.Printf("%s %s - Simple Webhook Deployment Daemon\n", ServiceName, Version)
 	fmt.Println()
-	fmt.Println("Usage: sdeploy [options]")
+	fmt.Println("Usage: sdeploy [options] [command]")
 	fmt.Println()
 	fmt.Println("Options:")
 	fmt.Println("  -c <path>  Path to config file (YAML format)")
 	fmt.Println("  -d         Run as daemon (background service)")
 	fmt.Println("  -h         Show this help message")
+	fmt.Println("  -version   Print version, commit and build date")
+	fmt.Println("  --once <project>  Deploy one project and exit (0 success, 1 failure, 3 skipped)")
+	fmt.Println("  --source <label>  Trigger source for --once, recorded as INTERNAL (<label>)")
+	fmt.Println("  --json            Print the --once result as JSON (exit codes unchanged)")
+	fmt.Println("  --branch <name>   Deploy this branch with --once instead of git_branch")
+	fmt.Println()
+	fmt.Println("Commands:")
+	fmt.Println("  test-email <project>  Send a sample notification to a project's email_recipients")
+	fmt.Println("  doctor                Check git, the shell, directory permissions and SSH keys")
+	fmt.Println("  rollback <project>    Redeploy the commit of the previous successful deploy")
+	fmt.Println("  test-webhook <project> [--branch <name>] [--insecure]")
+	fmt.Println("                        Send a signed push webhook to the running daemon")
+	fmt.Println("  version               Print version, commit and build date")
 	fmt.Println()
 	fmt.Println("Config file search order:")
 	fmt.Println("  1. Path from -c flag")
@@ -212,4 +482,12 @@ func printUsage() {
 	fmt.Println("  sdeploy              # Run in console mode")
 	fmt.Println("  sdeploy -d           # Run as daemon")
 	fmt.Println("  sdeploy -c /path/to/sdeploy.conf -d")
+	fmt.Println("  sdeploy --once \"Frontend App\"  # Deploy one project (e.g. from cron) and exit")
+	fmt.Println("  sdeploy --once \"Frontend App\" --source cron")
+	fmt.Println("  sdeploy --once \"Frontend App\" --json")
+	fmt.Println("  sdeploy --once \"Frontend App\" --branch hotfix/login  # One-off deploy of another branch")
+	fmt.Println("  sdeploy -c /path/to/sdeploy.conf test-email \"Frontend App\"")
+	fmt.Println("  sudo -u sdeploy sdeploy doctor  # Check the install as the service user")
+	fmt.Println("  sdeploy rollback \"Frontend App\"  # Go back to the previous successful deploy")
+	fmt.Println("  sdeploy test-webhook \"Frontend App\" --branch main  # Check signature, routing and branch match")
 }
@@ -0,0 +1,177 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// MetricsPath is the HTTP path serving metrics in Prometheus text format
+const MetricsPath = "/metrics"
+
+// lockWaitBuckets are the histogram upper bounds (in seconds) for lock waits
+var lockWaitBuckets = []float64{0.005, 0.01, 0.05, 0.1, 0.5, 1, 5, 10, 30, 60, 120, 300}
+
+// Histogram is a thread-safe cumulative histogram in the Prometheus style
+type Histogram struct {
+	mu      sync.Mutex
+	name    string
+	help    string
+	buckets []float64
+	counts  []uint64 // per-bucket counts (non-cumulative)
+	sum     float64
+	count   uint64
+}
+
+// NewHistogram creates a histogram with the given ascending bucket bounds
+func NewHistogram(name, help string, buckets []float64) *Histogram {
+	return &Histogram{
+		name:    name,
+		help:    help,
+		buckets: buckets,
+		counts:  make([]uint64, len(buckets)),
+	}
+}
+
+// Observe records a single value
+func (h *Histogram) Observe(v float64) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	for i, bound := range h.buckets {
+		if v <= bound {
+			h.counts[i]++
+			break
+		}
+	}
+	h.sum += v
+	h.count++
+}
+
+// Count returns the number of observations
+func (h *Histogram) Count() uint64 {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return h.count
+}
+
+// Sum returns the sum of all observed values
+func (h *Histogram) Sum() float64 {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return h.sum
+}
+
+// WritePrometheus writes the histogram in Prometheus text exposition format
+func (h *Histogram) WritePrometheus(w io.Writer) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	fmt.Fprintf(w, "# HELP %s %s\n", h.name, h.help)
+	fmt.Fprintf(w, "# TYPE %s histogram\n", h.name)
+
+	var cumulative uint64
+	for i, bound := range h.buckets {
+		cumulative += h.counts[i]
+		fmt.Fprintf(w, "%s_bucket{le=\"%s\"} %d\n", h.name, strconv.FormatFloat(bound, 'g', -1, 64), cumulative)
+	}
+	fmt.Fprintf(w, "%s_bucket{le=\"+Inf\"} %d\n", h.name, h.count)
+	fmt.Fprintf(w, "%s_sum %s\n", h.name, strconv.FormatFloat(h.sum, 'g', -1, 64))
+	fmt.Fprintf(w, "%s_count %d\n", h.name, h.count)
+}
+
+// labelValueEscaper escapes label values for the Prometheus text format
+var labelValueEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+// CounterVec is a thread-safe counter partitioned by the value of one label
+type CounterVec struct {
+	mu     sync.Mutex
+	name   string
+	help   string
+	label  string
+	values map[string]uint64
+}
+
+// NewCounterVec creates a counter with one label
+func NewCounterVec(name, help, label string) *CounterVec {
+	return &CounterVec{
+		name:   name,
+		help:   help,
+		label:  label,
+		values: make(map[string]uint64),
+	}
+}
+
+// Inc increments the counter for a label value
+func (c *CounterVec) Inc(value string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.values[value]++
+}
+
+// Get returns the counter for a label value
+func (c *CounterVec) Get(value string) uint64 {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.values[value]
+}
+
+// WritePrometheus writes the counter in Prometheus text exposition format,
+// one sample per label value in sorted order
+func (c *CounterVec) WritePrometheus(w io.Writer) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	fmt.Fprintf(w, "# HELP %s %s\n", c.name, c.help)
+	fmt.Fprintf(w, "# TYPE %s counter\n", c.name)
+
+	keys := make([]string, 0, len(c.values))
+	for k := range c.values {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		fmt.Fprintf(w, "%s{%s=\"%s\"} %d\n", c.name, c.label, labelValueEscaper.Replace(k), c.values[k])
+	}
+}
+
+// Metrics holds the daemon's runtime metrics
+type Metrics struct {
+	LockWait    *Histogram
+	SkippedBusy *CounterVec
+}
+
+// NewMetrics creates the metrics registry
+func NewMetrics() *Metrics {
+	return &Metrics{
+		LockWait: NewHistogram("sdeploy_lock_wait_seconds",
+			"Time deployments waited to acquire their project lock.", lockWaitBuckets),
+		SkippedBusy: NewCounterVec("sdeploy_builds_skipped_busy_total",
+			"Deployments skipped because a build of the project was in progress.", "project"),
+	}
+}
+
+// WritePrometheus writes all metrics in Prometheus text exposition format
+func (m *Metrics) WritePrometheus(w io.Writer) {
+	m.LockWait.WritePrometheus(w)
+	m.SkippedBusy.WritePrometheus(w)
+}
+
+// serveMetrics handles GET requests to the metrics endpoint
+func (h *WebhookHandler) serveMetrics(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if h.deployer == nil {
+		http.Error(w, "Not found", http.StatusNotFound)
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	h.deployer.Metrics().WritePrometheus(w)
+}
@@ -0,0 +1,148 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// TestHistogramObserve tests bucket placement and cumulative output
+func TestHistogramObserve(t *testing.T) {
+	h := NewHistogram("test_seconds", "Test histogram.", []float64{0.1, 1, 10})
+	h.Observe(0.05)
+	h.Observe(0.5)
+	h.Observe(5)
+	h.Observe(50)
+
+	if h.Count() != 4 {
+		t.Errorf("Expected 4 observations, got %d", h.Count())
+	}
+	if h.Sum() != 55.55 {
+		t.Errorf("Expected sum 55.55, got %v", h.Sum())
+	}
+
+	var buf bytes.Buffer
+	h.WritePrometheus(&buf)
+	out := buf.String()
+
+	expected := []string{
+		"# TYPE test_seconds histogram",
+		`test_seconds_bucket{le="0.1"} 1`,
+		`test_seconds_bucket{le="1"} 2`,
+		`test_seconds_bucket{le="10"} 3`,
+		`test_seconds_bucket{le="+Inf"} 4`,
+		"test_seconds_count 4",
+	}
+	for _, e := range expected {
+		if !strings.Contains(out, e) {
+			t.Errorf("Expected output to contain %q, got:\n%s", e, out)
+		}
+	}
+}
+
+// TestDeployRecordsLockWait tests that Deploy observes its lock wait
+func TestDeployRecordsLockWait(t *testing.T) {
+	deployer := NewDeployer(nil)
+	project := &ProjectConfig{
+		Name:           "TestProject",
+		WebhookPath:    "/hooks/test",
+		ExecuteCommand: "echo hello",
+	}
+
+	deployer.Deploy(context.Background(), project, "WEBHOOK")
+	deployer.Deploy(context.Background(), project, "WEBHOOK")
+
+	if got := deployer.Metrics().LockWait.Count(); got != 2 {
+		t.Errorf("Expected 2 lock wait observations, got %d", got)
+	}
+}
+
+// TestMetricsEndpoint tests the /metrics endpoint output
+func TestMetricsEndpoint(t *testing.T) {
+	cfg := &Config{
+		Projects: []ProjectConfig{
+			{
+				Name:           "TestProject",
+				WebhookPath:    "/hooks/test",
+				WebhookSecret:  "secret",
+				ExecuteCommand: "echo test",
+			},
+		},
+	}
+
+	handler := NewWebhookHandler(cfg, nil)
+	handler.SetDeployer(NewDeployer(nil))
+
+	req := httptest.NewRequest("GET", MetricsPath, nil)
+	rr := httptest.NewRecorder()
+	handler.ServeHTTP(rr, req)
+
+	if rr.Code != http.StatusOK {
+		t.Fatalf("Expected status 200, got %d", rr.Code)
+	}
+	if !strings.Contains(rr.Body.String(), "sdeploy_lock_wait_seconds_count 0") {
+		t.Errorf("Expected lock wait histogram in output, got:\n%s", rr.Body.String())
+	}
+
+	// Metrics are read-only
+	req = httptest.NewRequest("POST", MetricsPath, nil)
+	rr = httptest.NewRecorder()
+	handler.ServeHTTP(rr, req)
+	if rr.Code != http.StatusMethodNotAllowed {
+		t.Errorf("Expected status 405 for POST, got %d", rr.Code)
+	}
+}
+
+// TestCounterVec tests per-label counts and escaped, sorted output
+func TestCounterVec(t *testing.T) {
+	c := NewCounterVec("test_total", "Test counter.", "project")
+	c.Inc("b")
+	c.Inc("b")
+	c.Inc(`a "quoted"`)
+
+	if got := c.Get("b"); got != 2 {
+		t.Errorf("Expected 2 for b, got %d", got)
+	}
+
+	var buf bytes.Buffer
+	c.WritePrometheus(&buf)
+	expected := "# HELP test_total Test counter.\n" +
+		"# TYPE test_total counter\n" +
+		`test_total{project="a \"quoted\""} 1` + "\n" +
+		`test_total{project="b"} 2` + "\n"
+	if buf.String() != expected {
+		t.Errorf("Expected:\n%s\ngot:\n%s", expected, buf.String())
+	}
+}
+
+// TestDeploySkippedBusy tests that a deploy skipped on a held lock is counted
+// and logged with its build ID and trigger
+func TestDeploySkippedBusy(t *testing.T) {
+	var buf syncBuffer
+	logger := NewLogger(&buf, t.TempDir(), false)
+	deployer := NewDeployer(logger)
+	project := &ProjectConfig{
+		Name:           "BusyProject",
+		WebhookPath:    "/hooks/busy",
+		ExecuteCommand: "echo hello",
+	}
+
+	lock := deployer.getProjectLock(project.LockKey())
+	lock.Lock()
+	result := deployer.Deploy(context.Background(), project, "WEBHOOK (Github)")
+	lock.Unlock()
+
+	if !result.Skipped {
+		t.Fatalf("Expected deploy to be skipped, got %+v", result)
+	}
+	if got := deployer.Metrics().SkippedBusy.Get("BusyProject"); got != 1 {
+		t.Errorf("Expected 1 busy skip, got %d", got)
+	}
+	want := `event=skipped_busy build_id=` + result.BuildID + ` trigger="WEBHOOK (Github)"`
+	if !strings.Contains(buf.String(), want) {
+		t.Errorf("Expected %q in log, got:\n%s", want, buf.String())
+	}
+}
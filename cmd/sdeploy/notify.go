@@ -0,0 +1,61 @@
+package main
+
+import (
+	"errors"
+	"math/rand/v2"
+	"net/http"
+	"net/textproto"
+	"time"
+)
+
+// notifyRetryPolicy controls how failed notifications are retried
+type notifyRetryPolicy struct {
+	Retries int           // attempts after the first one
+	Base    time.Duration // delay before the first retry, doubled for each further retry
+}
+
+// backoff returns the delay before the given retry (1-based): Base doubled per
+// previous retry, with jitter picking a point in the upper half of that window
+func (p notifyRetryPolicy) backoff(retry int) time.Duration {
+	if p.Base <= 0 {
+		return 0
+	}
+	d := p.Base << (retry - 1)
+	if d <= 0 || d > maxNotifyBackoff {
+		d = maxNotifyBackoff
+	}
+	return d/2 + rand.N(d/2+1)
+}
+
+// maxNotifyBackoff caps the delay between notification attempts
+const maxNotifyBackoff = 5 * time.Minute
+
+// sendWithRetry calls send until it succeeds, the policy's retries are used up,
+// or send fails permanently. onRetry is called before each wait.
+func sendWithRetry(policy notifyRetryPolicy, send func() error, onRetry func(retry int, err error, wait time.Duration)) error {
+	err := send()
+	for retry := 1; err != nil && retry <= policy.Retries && !isPermanentNotifyError(err); retry++ {
+		wait := policy.backoff(retry)
+		if onRetry != nil {
+			onRetry(retry, err, wait)
+		}
+		time.Sleep(wait)
+		err = send()
+	}
+	return err
+}
+
+// isPermanentNotifyError reports whether retrying cannot help, i.e. the SMTP
+// server rejected the message with a 5xx reply or the Teams webhook answered
+// with a 4xx other than 429 Too Many Requests
+func isPermanentNotifyError(err error) bool {
+	var protoErr *textproto.Error
+	if errors.As(err, &protoErr) {
+		return protoErr.Code >= 500
+	}
+	var statusErr *teamsStatusError
+	if errors.As(err, &statusErr) {
+		return statusErr.Code >= 400 && statusErr.Code < 500 && statusErr.Code != http.StatusTooManyRequests
+	}
+	return false
+}
@@ -0,0 +1,74 @@
+package main
+
+import (
+	"errors"
+	"net/textproto"
+	"testing"
+	"time"
+)
+
+// TestNotifyRetryBackoff tests exponential growth and jitter bounds of retry delays
+func TestNotifyRetryBackoff(t *testing.T) {
+	policy := notifyRetryPolicy{Retries: 5, Base: 100 * time.Millisecond}
+
+	for retry := 1; retry <= 5; retry++ {
+		window := policy.Base << (retry - 1)
+		for i := 0; i < 20; i++ {
+			d := policy.backoff(retry)
+			if d < window/2 || d > window {
+				t.Fatalf("backoff(%d) = %v, expected within [%v, %v]", retry, d, window/2, window)
+			}
+		}
+	}
+
+	if d := policy.backoff(100); d > maxNotifyBackoff {
+		t.Errorf("Expected backoff to be capped at %v, got %v", maxNotifyBackoff, d)
+	}
+	if d := (notifyRetryPolicy{Retries: 3}).backoff(1); d != 0 {
+		t.Errorf("Expected zero base to retry immediately, got %v", d)
+	}
+}
+
+// TestSendWithRetry tests retrying transient failures and stopping on permanent ones
+func TestSendWithRetry(t *testing.T) {
+	policy := notifyRetryPolicy{Retries: 3, Base: time.Millisecond}
+	transient := &textproto.Error{Code: 451, Msg: "try again later"}
+	permanent := &textproto.Error{Code: 550, Msg: "mailbox unavailable"}
+
+	tests := []struct {
+		name          string
+		failures      []error
+		expectErr     bool
+		expectedCalls int
+	}{
+		{"first attempt succeeds", nil, false, 1},
+		{"transient then success", []error{transient, transient}, false, 3},
+		{"retries exhausted", []error{transient, transient, transient, transient}, true, 4},
+		{"permanent error", []error{permanent}, true, 1},
+		{"wrapped permanent error", []error{errors.Join(errors.New("failed to set recipient"), permanent)}, true, 1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			calls, retries := 0, 0
+			send := func() error {
+				calls++
+				if calls <= len(tt.failures) {
+					return tt.failures[calls-1]
+				}
+				return nil
+			}
+			err := sendWithRetry(policy, send, func(int, error, time.Duration) { retries++ })
+
+			if (err != nil) != tt.expectErr {
+				t.Errorf("Expected error=%v, got %v", tt.expectErr, err)
+			}
+			if calls != tt.expectedCalls {
+				t.Errorf("Expected %d attempts, got %d", tt.expectedCalls, calls)
+			}
+			if retries != calls-1 {
+				t.Errorf("Expected onRetry before each of %d retries, got %d", calls-1, retries)
+			}
+		})
+	}
+}
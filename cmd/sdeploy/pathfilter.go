@@ -0,0 +1,132 @@
+package main
+
+import (
+	"fmt"
+	"path"
+	"regexp"
+	"strings"
+)
+
+// validatePathPatterns checks build_paths / ignore_paths entries. Negation
+// ("!pattern") is not supported, use build_paths and ignore_paths together.
+func validatePathPatterns(field string, patterns []string) error {
+	for _, p := range patterns {
+		if strings.TrimSpace(p) == "" || p == "/" {
+			return fmt.Errorf("%s entries cannot be empty", field)
+		}
+		if strings.HasPrefix(p, "!") {
+			return fmt.Errorf("%s does not support negated patterns: %s", field, p)
+		}
+	}
+	return nil
+}
+
+// validateTriggerFiles checks trigger_files entries: repository-relative
+// file paths, matched exactly. They replace the pattern filters, so a project
+// cannot combine them with build_paths or ignore_paths.
+func validateTriggerFiles(project *ProjectConfig) error {
+	if len(project.TriggerFiles) == 0 {
+		return nil
+	}
+	if len(project.BuildPaths) > 0 || len(project.IgnorePaths) > 0 {
+		return fmt.Errorf("trigger_files cannot be combined with build_paths or ignore_paths")
+	}
+	for _, file := range project.TriggerFiles {
+		name := strings.TrimPrefix(file, "/")
+		if strings.TrimSpace(name) == "" || strings.HasSuffix(name, "/") {
+			return fmt.Errorf("invalid trigger_files entry %q: must be a file path such as package.json", file)
+		}
+		if path.Clean(name) != name || strings.HasPrefix(name, "../") {
+			return fmt.Errorf("invalid trigger_files entry %q: must be a clean path inside the repository", file)
+		}
+	}
+	return nil
+}
+
+// compilePathPattern compiles a .gitignore-style pattern into a regexp
+// matched against repository-relative paths:
+//   - "*" matches within one path segment, "?" one character, "**" any depth
+//   - a pattern without "/" (e.g. "*.md") matches in any directory
+//   - a leading "/" anchors the pattern to the repository root
+//   - a pattern matching a directory matches everything below it ("docs/")
+func compilePathPattern(pattern string) *regexp.Regexp {
+	p := strings.TrimSuffix(pattern, "/")
+	anchored := strings.Contains(p, "/")
+	p = strings.TrimPrefix(p, "/")
+
+	var b strings.Builder
+	b.WriteString("^")
+	if !anchored {
+		b.WriteString("(?:.*/)?")
+	}
+	for i := 0; i < len(p); i++ {
+		switch {
+		case strings.HasPrefix(p[i:], "**/"):
+			b.WriteString("(?:.*/)?")
+			i += 2
+		case strings.HasPrefix(p[i:], "**"):
+			b.WriteString(".*")
+			i++
+		case p[i] == '*':
+			b.WriteString("[^/]*")
+		case p[i] == '?':
+			b.WriteString("[^/]")
+		default:
+			b.WriteString(regexp.QuoteMeta(p[i : i+1]))
+		}
+	}
+	b.WriteString("(?:/.*)?$")
+	return regexp.MustCompile(b.String())
+}
+
+// matchesAny reports whether file matches one of the patterns
+func matchesAny(patterns []*regexp.Regexp, file string) bool {
+	for _, re := range patterns {
+		if re.MatchString(file) {
+			return true
+		}
+	}
+	return false
+}
+
+// compilePathPatterns compiles a list of patterns
+func compilePathPatterns(patterns []string) []*regexp.Regexp {
+	compiled := make([]*regexp.Regexp, 0, len(patterns))
+	for _, p := range patterns {
+		compiled = append(compiled, compilePathPattern(p))
+	}
+	return compiled
+}
+
+// relevantChanges returns the changed files that should trigger a build: those
+// listed in trigger_files if set, otherwise those matching build_paths (all
+// files if it is empty) and not matching ignore_paths
+func relevantChanges(project *ProjectConfig, files []string) []string {
+	if len(project.TriggerFiles) > 0 {
+		var relevant []string
+		for _, f := range files {
+			for _, trigger := range project.TriggerFiles {
+				if f == strings.TrimPrefix(trigger, "/") {
+					relevant = append(relevant, f)
+					break
+				}
+			}
+		}
+		return relevant
+	}
+
+	build := compilePathPatterns(project.BuildPaths)
+	ignore := compilePathPatterns(project.IgnorePaths)
+
+	var relevant []string
+	for _, f := range files {
+		if len(build) > 0 && !matchesAny(build, f) {
+			continue
+		}
+		if matchesAny(ignore, f) {
+			continue
+		}
+		relevant = append(relevant, f)
+	}
+	return relevant
+}
@@ -0,0 +1,70 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+// TestCompilePathPattern tests .gitignore-style matching of changed file paths
+func TestCompilePathPattern(t *testing.T) {
+	tests := []struct {
+		pattern string
+		path    string
+		want    bool
+	}{
+		{"*.md", "README.md", true},
+		{"*.md", "docs/guide/intro.md", true},
+		{"*.md", "main.go", false},
+		{"docs/", "docs/guide/intro.md", true},
+		{"docs", "docs/index.html", true},
+		{"docs", "src/docs/index.html", true},
+		{"/docs", "src/docs/index.html", false},
+		{"docs/*.md", "docs/a.md", true},
+		{"docs/*.md", "docs/guide/a.md", false},
+		{"docs/**/*.md", "docs/guide/a.md", true},
+		{"docs/**/*.md", "docs/a.md", true},
+		{"**/testdata", "pkg/x/testdata/in.txt", true},
+		{"src/**", "src/a/b.go", true},
+		{"go.?od", "go.mod", true},
+		{"a.b", "axb", false},
+	}
+
+	for _, tt := range tests {
+		if got := compilePathPattern(tt.pattern).MatchString(tt.path); got != tt.want {
+			t.Errorf("pattern %q on %q: got %v, want %v", tt.pattern, tt.path, got, tt.want)
+		}
+	}
+}
+
+// TestRelevantChanges tests combining build_paths and ignore_paths
+func TestRelevantChanges(t *testing.T) {
+	files := []string{"README.md", "docs/setup.md", "src/main.go", "src/README.md", "go.mod"}
+
+	tests := []struct {
+		name   string
+		build  []string
+		ignore []string
+		want   []string
+	}{
+		{"no filters", nil, nil, files},
+		{"ignore docs", nil, []string{"*.md", "docs/"}, []string{"src/main.go", "go.mod"}},
+		{"build src", []string{"src/"}, nil, []string{"src/main.go", "src/README.md"}},
+		{"build src without docs", []string{"src/"}, []string{"*.md"}, []string{"src/main.go"}},
+		{"nothing relevant", []string{"deploy/"}, nil, nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			project := &ProjectConfig{BuildPaths: tt.build, IgnorePaths: tt.ignore}
+			if got := relevantChanges(project, files); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("got %v, want %v", got, tt.want)
+			}
+		})
+	}
+
+	// trigger_files match exact repository-relative paths
+	project := &ProjectConfig{TriggerFiles: []string{"/go.mod", "README.md", "go.sum"}}
+	if got, want := relevantChanges(project, files), []string{"README.md", "go.mod"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("trigger_files: got %v, want %v", got, want)
+	}
+}
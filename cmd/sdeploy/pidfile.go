@@ -0,0 +1,80 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"syscall"
+)
+
+// pidFile is the daemon's PID file, held under an exclusive flock for the
+// life of the process so a second daemon on the same config refuses to start.
+// The kernel drops the lock when the process exits, so a file left behind by
+// a crash does not block the next start.
+type pidFile struct {
+	path string
+	file *os.File
+}
+
+// errPIDFileLocked is returned when another live process holds the PID file
+var errPIDFileLocked = errors.New("PID file is locked by another process")
+
+// acquirePIDFile creates or opens path, locks it and writes the current PID.
+// If another process holds the lock the error names that process's PID.
+func acquirePIDFile(path string) (*pidFile, error) {
+	if err := ensureParentDir(path); err != nil {
+		return nil, fmt.Errorf("failed to create PID file directory: %v", err)
+	}
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_RDWR, 0644)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open PID file: %v", err)
+	}
+
+	if err := syscall.Flock(int(file.Fd()), syscall.LOCK_EX|syscall.LOCK_NB); err != nil {
+		file.Close()
+		if errors.Is(err, syscall.EWOULDBLOCK) {
+			if pid := readPIDFile(path); pid > 0 {
+				return nil, fmt.Errorf("%w (pid %d): %s", errPIDFileLocked, pid, path)
+			}
+			return nil, fmt.Errorf("%w: %s", errPIDFileLocked, path)
+		}
+		return nil, fmt.Errorf("failed to lock PID file: %v", err)
+	}
+
+	if err := file.Truncate(0); err != nil {
+		file.Close()
+		return nil, fmt.Errorf("failed to write PID file: %v", err)
+	}
+	if _, err := file.WriteAt([]byte(strconv.Itoa(os.Getpid())+"\n"), 0); err != nil {
+		file.Close()
+		return nil, fmt.Errorf("failed to write PID file: %v", err)
+	}
+
+	return &pidFile{path: path, file: file}, nil
+}
+
+// Release removes the PID file and drops the lock. The file is removed while
+// still locked so a daemon starting concurrently never sees it half-released.
+func (p *pidFile) Release() {
+	if p == nil || p.file == nil {
+		return
+	}
+	_ = os.Remove(p.path)
+	p.file.Close()
+	p.file = nil
+}
+
+// readPIDFile returns the PID recorded in path, or 0 if it cannot be read
+func readPIDFile(path string) int {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return 0
+	}
+	pid, err := strconv.Atoi(strings.TrimSpace(string(data)))
+	if err != nil {
+		return 0
+	}
+	return pid
+}
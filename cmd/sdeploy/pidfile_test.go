@@ -0,0 +1,51 @@
+package main
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+// TestAcquirePIDFile tests that a held PID file blocks a second daemon until released
+func TestAcquirePIDFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "run", "sdeploy.pid")
+
+	first, err := acquirePIDFile(path)
+	if err != nil {
+		t.Fatalf("acquirePIDFile failed: %v", err)
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("Failed to read PID file: %v", err)
+	}
+	if got := strings.TrimSpace(string(data)); got != strconv.Itoa(os.Getpid()) {
+		t.Errorf("Expected PID %d in file, got %q", os.Getpid(), got)
+	}
+
+	// A second acquire fails while the first holds the lock
+	_, err = acquirePIDFile(path)
+	if !errors.Is(err, errPIDFileLocked) {
+		t.Fatalf("Expected errPIDFileLocked, got %v", err)
+	}
+	if !strings.Contains(err.Error(), "pid "+strconv.Itoa(os.Getpid())) {
+		t.Errorf("Expected error to name the holding PID, got %v", err)
+	}
+
+	first.Release()
+	if _, err := os.Stat(path); !os.IsNotExist(err) {
+		t.Errorf("Expected PID file to be removed on release, got %v", err)
+	}
+
+	// A stale file without a lock does not block startup
+	if err := os.WriteFile(path, []byte("999999\n"), 0644); err != nil {
+		t.Fatalf("Failed to write stale PID file: %v", err)
+	}
+	second, err := acquirePIDFile(path)
+	if err != nil {
+		t.Fatalf("Expected stale PID file to be taken over, got %v", err)
+	}
+	second.Release()
+}
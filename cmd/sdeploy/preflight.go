@@ -4,6 +4,7 @@ import (
 	"context"
 	"fmt"
 	"os"
+	"path/filepath"
 )
 
 // getEffectiveExecutePath returns the effective execute_path for a project.
@@ -16,7 +17,7 @@ func getEffectiveExecutePath(localPath, executePath string) string {
 }
 
 // runPreflightChecks performs pre-flight directory checks before deployment.
-// It verifies and creates directories with standard permissions.
+// It verifies and creates directories with the project's dir_mode.
 func runPreflightChecks(ctx context.Context, project *ProjectConfig, logger LogWriter) error {
 	if logger != nil {
 		logger.Infof(project.Name, "Running preflight checks")
@@ -27,14 +28,19 @@ func runPreflightChecks(ctx context.Context, project *ProjectConfig, logger LogW
 
 	// Check and create local_path if needed
 	if project.LocalPath != "" {
-		if err := ensureDirectoryExists(project.LocalPath, logger, project.Name); err != nil {
+		if err := ensureProjectDir(project, project.LocalPath, logger); err != nil {
 			return fmt.Errorf("failed to ensure local_path exists: %w", err)
 		}
 	}
 
-	// Check and create execute_path if needed (and different from local_path)
-	if effectiveExecutePath != "" && effectiveExecutePath != project.LocalPath {
-		if err := ensureDirectoryExists(effectiveExecutePath, logger, project.Name); err != nil {
+	// Atomic deploys switch execute_path as a symlink instead of creating it
+	if project.DeployStrategy == DeployStrategyAtomic {
+		if err := checkReleaseLink(project, logger); err != nil {
+			return fmt.Errorf("failed to check execute_path: %w", err)
+		}
+	} else if effectiveExecutePath != "" && effectiveExecutePath != project.LocalPath {
+		// Check and create execute_path if needed (and different from local_path)
+		if err := ensureProjectDir(project, effectiveExecutePath, logger); err != nil {
 			return fmt.Errorf("failed to ensure execute_path exists: %w", err)
 		}
 	}
@@ -46,8 +52,28 @@ func runPreflightChecks(ctx context.Context, project *ProjectConfig, logger LogW
 	return nil
 }
 
-// ensureDirectoryExists ensures a directory exists with standard permissions (0755).
-func ensureDirectoryExists(dirPath string, logger LogWriter, projectName string) error {
+// ensureProjectDir ensures a project directory exists, creating it unless the
+// project sets create_dirs: false for externally provisioned directories
+func ensureProjectDir(project *ProjectConfig, dirPath string, logger LogWriter) error {
+	if project.CreatesDirs() {
+		return ensureDirectoryExists(dirPath, project.DirPerm(), logger, project.Name)
+	}
+	info, err := os.Stat(dirPath)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return fmt.Errorf("directory does not exist: %s (create_dirs is false)", dirPath)
+		}
+		return fmt.Errorf("failed to stat directory: %w", err)
+	}
+	if !info.IsDir() {
+		return fmt.Errorf("path exists but is not a directory: %s", dirPath)
+	}
+	return nil
+}
+
+// ensureDirectoryExists ensures a directory exists, creating it and any
+// missing parents with mode.
+func ensureDirectoryExists(dirPath string, mode os.FileMode, logger LogWriter, projectName string) error {
 	// Check if directory already exists
 	info, err := os.Stat(dirPath)
 	if err == nil {
@@ -66,12 +92,50 @@ func ensureDirectoryExists(dirPath string, logger LogWriter, projectName string)
 
 	// Directory does not exist, create it
 	if logger != nil {
-		logger.Infof(projectName, "Creating directory: %s", dirPath)
+		logger.Infof(projectName, "Creating directory: %s (mode %s)", dirPath, formatDirMode(mode))
 	}
 
-	if err := os.MkdirAll(dirPath, 0755); err != nil {
+	if err := mkdirAllMode(dirPath, mode); err != nil {
 		return fmt.Errorf("failed to create directory: %w", err)
 	}
 
 	return nil
 }
+
+// mkdirAllMode creates dirPath and any missing parents like os.MkdirAll, then
+// sets each directory it created to exactly mode: MkdirAll is subject to the
+// process umask, and Linux ignores the setgid bit passed to mkdir
+func mkdirAllMode(dirPath string, mode os.FileMode) error {
+	dirPath = filepath.Clean(dirPath)
+	existing, err := nearestExistingDir(dirPath)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(dirPath, mode.Perm()); err != nil {
+		return err
+	}
+	for dir := dirPath; dir != existing; dir = filepath.Dir(dir) {
+		if err := os.Chmod(dir, mode); err != nil {
+			return err
+		}
+		if filepath.Dir(dir) == dir {
+			break
+		}
+	}
+	return nil
+}
+
+// formatDirMode renders mode in the octal form dir_mode is written in, e.g. 2775
+func formatDirMode(mode os.FileMode) string {
+	bits := uint32(mode.Perm())
+	if mode&os.ModeSetuid != 0 {
+		bits |= 04000
+	}
+	if mode&os.ModeSetgid != 0 {
+		bits |= 02000
+	}
+	if mode&os.ModeSticky != 0 {
+		bits |= 01000
+	}
+	return fmt.Sprintf("%04o", bits)
+}
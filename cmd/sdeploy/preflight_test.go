@@ -44,6 +44,49 @@ func TestPreflightDirCreation(t *testing.T) {
 	}
 }
 
+// TestPreflightCreateDirsFalse tests that create_dirs: false only verifies
+// directories and never creates them
+func TestPreflightCreateDirsFalse(t *testing.T) {
+	tmpDir := t.TempDir()
+	localPath := filepath.Join(tmpDir, "repo")
+	executePath := filepath.Join(tmpDir, "www")
+	createDirs := false
+
+	project := &ProjectConfig{
+		Name:        "TestProject",
+		LocalPath:   localPath,
+		ExecutePath: executePath,
+		CreateDirs:  &createDirs,
+	}
+
+	err := runPreflightChecks(context.Background(), project, nil)
+	if err == nil || !strings.Contains(err.Error(), "directory does not exist: "+localPath) {
+		t.Fatalf("Expected missing local_path error, got %v", err)
+	}
+	if _, err := os.Stat(localPath); !os.IsNotExist(err) {
+		t.Error("Expected local_path not to be created")
+	}
+
+	if err := os.Mkdir(localPath, 0750); err != nil {
+		t.Fatalf("Failed to create localPath: %v", err)
+	}
+	err = runPreflightChecks(context.Background(), project, nil)
+	if err == nil || !strings.Contains(err.Error(), "failed to ensure execute_path exists") {
+		t.Fatalf("Expected missing execute_path error, got %v", err)
+	}
+
+	if err := os.Mkdir(executePath, 0750); err != nil {
+		t.Fatalf("Failed to create executePath: %v", err)
+	}
+	if err := runPreflightChecks(context.Background(), project, nil); err != nil {
+		t.Fatalf("Expected preflight to pass with pre-created directories, got %v", err)
+	}
+	// Pre-created directories keep their permissions
+	if info, _ := os.Stat(localPath); info.Mode().Perm() != 0750 {
+		t.Errorf("Expected local_path to keep mode 0750, got %v", info.Mode().Perm())
+	}
+}
+
 // TestPreflightExistingDirs tests that preflight handles existing directories
 func TestPreflightExistingDirs(t *testing.T) {
 	tmpDir := t.TempDir()
@@ -238,6 +281,45 @@ func TestPreflightPermissions(t *testing.T) {
 	}
 }
 
+// TestPreflightDirMode tests that directories, including missing parents, are
+// created with exactly dir_mode regardless of the process umask
+func TestPreflightDirMode(t *testing.T) {
+	tmpDir := t.TempDir()
+	localPath := filepath.Join(tmpDir, "srv", "repo")
+
+	var buf bytes.Buffer
+	logger := NewLogger(&buf, "", false)
+
+	project := &ProjectConfig{
+		Name:      "TestProject",
+		LocalPath: localPath,
+		DirMode:   "2775",
+	}
+
+	if err := runPreflightChecks(context.Background(), project, logger); err != nil {
+		t.Fatalf("Preflight checks failed: %v", err)
+	}
+
+	want := os.ModeDir | os.ModeSetgid | 0775
+	for _, dir := range []string{filepath.Dir(localPath), localPath} {
+		info, err := os.Stat(dir)
+		if err != nil {
+			t.Fatalf("Failed to stat %s: %v", dir, err)
+		}
+		if info.Mode() != want {
+			t.Errorf("Expected %s to have mode %v, got %v", dir, want, info.Mode())
+		}
+	}
+	if !strings.Contains(buf.String(), "(mode 2775)") {
+		t.Errorf("Expected the mode to be logged, got: %s", buf.String())
+	}
+
+	// The existing ancestor keeps its own mode
+	if info, err := os.Stat(tmpDir); err != nil || info.Mode()&os.ModeSetgid != 0 {
+		t.Errorf("Expected %s to be left unchanged, got %v (%v)", tmpDir, info.Mode(), err)
+	}
+}
+
 // TestGetEffectiveExecutePath tests the helper function for execute_path defaulting
 func TestGetEffectiveExecutePath(t *testing.T) {
 	tests := []struct {
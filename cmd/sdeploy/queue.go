@@ -0,0 +1,99 @@
+package main
+
+import (
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// States of a build in the deploy queue, as reported by GET /status
+const (
+	QueueStateRunning   = "running"   // holds the project lock and is deploying
+	QueueStateWaiting   = "waiting"   // waiting for the lock (lock_wait_seconds)
+	QueueStateDebounced = "debounced" // scheduled, waiting out debounce_seconds
+)
+
+// queuedBuild is one build known to the deploy queue
+type queuedBuild struct {
+	BuildID       string     `json:"build_id"`
+	TriggerSource string     `json:"trigger_source"`
+	State         string     `json:"state"`
+	EnqueuedAt    time.Time  `json:"enqueued_at"`
+	StartedAt     *time.Time `json:"started_at,omitempty"`
+	// key is the deploy key the build belongs to
+	key string
+}
+
+// buildQueue tracks builds from the moment they are requested until they
+// finish, keyed by ProjectConfig.DeployKey, so operators can see why a deploy
+// is delayed. It is bookkeeping only; locking is done by the Deployer.
+type buildQueue struct {
+	mu     sync.Mutex
+	builds map[string]*queuedBuild // by build ID
+	clock  clock                   // stamps enqueue and start times
+}
+
+// newBuildQueue creates an empty build queue that reads the time from c
+func newBuildQueue(c clock) *buildQueue {
+	return &buildQueue{builds: make(map[string]*queuedBuild), clock: c}
+}
+
+// setClock replaces the queue's time source
+func (q *buildQueue) setClock(c clock) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	q.clock = c
+}
+
+// enqueue records a build that is waiting for its project lock
+func (q *buildQueue) enqueue(key, buildID, triggerSource string) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	q.builds[buildID] = &queuedBuild{
+		BuildID:       buildID,
+		TriggerSource: triggerSource,
+		State:         QueueStateWaiting,
+		EnqueuedAt:    q.clock.Now(),
+		key:           key,
+	}
+}
+
+// start marks a queued build as running
+func (q *buildQueue) start(buildID string) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	if b, ok := q.builds[buildID]; ok {
+		now := q.clock.Now()
+		b.State = QueueStateRunning
+		b.StartedAt = &now
+	}
+}
+
+// remove drops a build that finished or gave up waiting
+func (q *buildQueue) remove(buildID string) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	delete(q.builds, buildID)
+}
+
+// snapshot returns copies of the builds for a project, including its
+// branch_deploys variants, ordered by enqueue time
+func (q *buildQueue) snapshot(project *ProjectConfig) []queuedBuild {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	key := project.DeployKey()
+	var builds []queuedBuild
+	for _, b := range q.builds {
+		if b.key == key || strings.HasPrefix(b.key, key+"@") {
+			builds = append(builds, *b)
+		}
+	}
+	sort.Slice(builds, func(i, j int) bool { return builds[i].EnqueuedAt.Before(builds[j].EnqueuedAt) })
+	return builds
+}
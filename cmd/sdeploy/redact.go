@@ -0,0 +1,84 @@
+package main
+
+import (
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// redactMask replaces secret values in build logs
+const redactMask = "***"
+
+// minRedactSecretLength keeps very short secrets from masking unrelated text
+const minRedactSecretLength = 4
+
+// defaultRedactPatterns match common token formats. When a pattern has a
+// capture group only the first group is masked, so surrounding context
+// (e.g. the URL around embedded credentials) stays readable.
+var defaultRedactPatterns = []*regexp.Regexp{
+	regexp.MustCompile(`\bgh[pousr]_[A-Za-z0-9]{36,}`),                  // GitHub tokens
+	regexp.MustCompile(`\bgithub_pat_[A-Za-z0-9_]{22,}`),                // GitHub fine-grained tokens
+	regexp.MustCompile(`\bglpat-[A-Za-z0-9_-]{20,}`),                    // GitLab personal access tokens
+	regexp.MustCompile(`\bxox[abprs]-[A-Za-z0-9-]{10,}`),                // Slack tokens
+	regexp.MustCompile(`\bAKIA[0-9A-Z]{16}\b`),                          // AWS access key IDs
+	regexp.MustCompile(`://[^/\s:@]+:([^/\s@]+)@`),                      // user:password in URLs
+	regexp.MustCompile(`://([^/\s:@]{20,})@`),                           // bare tokens in URLs
+	regexp.MustCompile(`(?i)authorization:\s*(?:bearer|basic)\s+(\S+)`), // HTTP auth headers
+}
+
+// redactor masks configured secret values and token patterns in log text
+type redactor struct {
+	secrets  []string
+	patterns []*regexp.Regexp
+}
+
+// newRedactor creates a redactor for the given secret values and patterns.
+// Empty and very short secrets are ignored.
+func newRedactor(secrets []string, patterns []*regexp.Regexp) *redactor {
+	r := &redactor{patterns: patterns}
+	for _, s := range secrets {
+		if len(s) >= minRedactSecretLength {
+			r.secrets = append(r.secrets, s)
+		}
+	}
+	// Longest first, so a secret containing another is masked whole
+	sort.Slice(r.secrets, func(i, j int) bool { return len(r.secrets[i]) > len(r.secrets[j]) })
+	return r
+}
+
+// Redact returns s with every secret value and pattern match masked
+func (r *redactor) Redact(s string) string {
+	if r == nil || s == "" {
+		return s
+	}
+	for _, secret := range r.secrets {
+		s = strings.ReplaceAll(s, secret, redactMask)
+	}
+	for _, re := range r.patterns {
+		s = redactPattern(re, s)
+	}
+	return s
+}
+
+// redactPattern masks matches of re in s: the first capture group if the
+// pattern has one, otherwise the whole match
+func redactPattern(re *regexp.Regexp, s string) string {
+	if re.NumSubexp() == 0 {
+		return re.ReplaceAllLiteralString(s, redactMask)
+	}
+	var b strings.Builder
+	last := 0
+	for _, m := range re.FindAllStringSubmatchIndex(s, -1) {
+		if m[2] < 0 {
+			continue
+		}
+		b.WriteString(s[last:m[2]])
+		b.WriteString(redactMask)
+		last = m[3]
+	}
+	if last == 0 {
+		return s
+	}
+	b.WriteString(s[last:])
+	return b.String()
+}
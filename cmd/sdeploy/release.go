@@ -0,0 +1,141 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+)
+
+// releasesDir returns the directory holding the release worktrees of an
+// atomic project: <execute_path>.releases
+func releasesDir(project *ProjectConfig) string {
+	return filepath.Clean(project.ExecutePath) + ".releases"
+}
+
+// checkReleaseLink verifies execute_path can be switched atomically: it must
+// be a symlink or not exist yet, and its parent directory is created if
+// missing (unless create_dirs is false). A real directory is never replaced.
+func checkReleaseLink(project *ProjectConfig, logger LogWriter) error {
+	info, err := os.Lstat(project.ExecutePath)
+	if err == nil && info.Mode()&os.ModeSymlink == 0 {
+		return fmt.Errorf("execute_path %s exists and is not a symlink; move it away to use deploy_strategy atomic", project.ExecutePath)
+	}
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return ensureProjectDir(project, filepath.Dir(filepath.Clean(project.ExecutePath)), logger)
+}
+
+// prepareRelease adds a detached worktree of the checkout's HEAD for this
+// build under releasesDir and returns its path
+func (d *Deployer) prepareRelease(ctx context.Context, project *ProjectConfig, buildID string, buildLogger *BuildLogger) (string, error) {
+	dir := releasesDir(project)
+	if err := ensureDirectoryExists(dir, project.DirPerm(), buildLogger, project.Name); err != nil {
+		return "", newDeployError(ErrorKindReleaseFailed, fmt.Errorf("failed to create releases directory: %v", err))
+	}
+	release := filepath.Join(dir, buildID)
+	if buildLogger != nil {
+		buildLogger.Infof(project.Name, "Creating release worktree: %s", release)
+	}
+
+	// Use exec.CommandContext directly with separate arguments to avoid shell injection
+	cmd := exec.CommandContext(ctx, "git", "worktree", "add", "--detach", release, "HEAD")
+	setProcessGroup(cmd)
+	stopKill := setGroupCancel(cmd)
+	defer stopKill()
+	cmd.Dir = project.LocalPath
+
+	output, err := combinedOutputWithUmask(cmd, project.Umask)
+	if buildLogger != nil && len(output) > 0 {
+		buildLogger.Infof(project.Name, "Output: %s", strings.TrimSpace(string(output)))
+	}
+	if err != nil {
+		return "", newDeployError(ErrorKindReleaseFailed, fmt.Errorf("git worktree add failed: %v: %s", err, string(output)))
+	}
+	return release, nil
+}
+
+// activateRelease points execute_path at release. The new link is created
+// next to it and renamed over it, so the switch is atomic. Returns the
+// previous target, or "" if there was none.
+func activateRelease(project *ProjectConfig, release string) (string, error) {
+	link := filepath.Clean(project.ExecutePath)
+	previous, _ := os.Readlink(link)
+
+	tmp := link + ".sdeploy-new"
+	_ = os.Remove(tmp)
+	if err := os.Symlink(release, tmp); err != nil {
+		return "", newDeployError(ErrorKindReleaseFailed, fmt.Errorf("failed to create release symlink: %v", err))
+	}
+	if err := os.Rename(tmp, link); err != nil {
+		_ = os.Remove(tmp)
+		return "", newDeployError(ErrorKindReleaseFailed, fmt.Errorf("failed to switch execute_path to the release: %v", err))
+	}
+	return previous, nil
+}
+
+// removeRelease deletes a release worktree and its git metadata. Failures
+// are logged and do not fail the deployment.
+func (d *Deployer) removeRelease(ctx context.Context, project *ProjectConfig, release string, buildLogger *BuildLogger) {
+	if buildLogger != nil {
+		buildLogger.Infof(project.Name, "Removing release worktree: %s", release)
+	}
+	cmd := exec.CommandContext(ctx, "git", "worktree", "remove", "--force", release)
+	setProcessGroup(cmd)
+	stopKill := setGroupCancel(cmd)
+	defer stopKill()
+	cmd.Dir = project.LocalPath
+
+	output, err := combinedOutputWithUmask(cmd, project.Umask)
+	if err != nil && buildLogger != nil {
+		buildLogger.Warnf(project.Name, "Failed to remove release worktree %s (continuing): %v: %s", release, err, strings.TrimSpace(string(output)))
+	}
+}
+
+// pruneReleases removes every release worktree except the live one and the
+// one it replaced, which is kept for rollback
+func (d *Deployer) pruneReleases(ctx context.Context, project *ProjectConfig, live, previous string, buildLogger *BuildLogger) {
+	dir := releasesDir(project)
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		if buildLogger != nil {
+			buildLogger.Warnf(project.Name, "Failed to list releases (continuing): %v", err)
+		}
+		return
+	}
+	for _, entry := range entries {
+		release := filepath.Join(dir, entry.Name())
+		if !entry.IsDir() || release == live || release == previous {
+			continue
+		}
+		d.removeRelease(ctx, project, release, buildLogger)
+	}
+}
+
+// finishRelease makes the release of a successful build live and prunes old
+// releases, or discards the release of a failed build. Returns buildErr, or
+// the error switching execute_path.
+func (d *Deployer) finishRelease(ctx context.Context, project *ProjectConfig, release string, buildErr error, buildLogger *BuildLogger) error {
+	// Clean up even when the build ran into its timeout
+	ctx = context.WithoutCancel(ctx)
+
+	if buildErr == nil {
+		previous, err := activateRelease(project, release)
+		if err == nil {
+			if buildLogger != nil {
+				buildLogger.Infof(project.Name, "Activated release: %s -> %s", project.ExecutePath, release)
+			}
+			d.pruneReleases(ctx, project, release, previous, buildLogger)
+			return nil
+		}
+		if buildLogger != nil {
+			buildLogger.Errorf(project.Name, "Failed to activate release: %v", err)
+		}
+		buildErr = err
+	}
+	d.removeRelease(ctx, project, release, buildLogger)
+	return buildErr
+}
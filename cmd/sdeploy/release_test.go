@@ -0,0 +1,119 @@
+package main
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// TestDeployAtomicStrategy tests building in release worktrees and switching
+// the execute_path symlink only after a successful build
+func TestDeployAtomicStrategy(t *testing.T) {
+	remoteDir, workDir, targetPath, branch := setupTestRemote(t)
+	current := filepath.Join(t.TempDir(), "current")
+
+	deployer := NewDeployer(nil)
+	project := &ProjectConfig{
+		Name:             "AtomicProject",
+		WebhookPath:      "/hooks/atomic",
+		GitRepo:          "file://" + remoteDir,
+		LocalPath:        targetPath,
+		ExecutePath:      current,
+		GitBranch:        branch,
+		GitUpdate:        true,
+		DeployOnNoChange: true,
+		DeployStrategy:   DeployStrategyAtomic,
+		ExecuteCommand:   "cat test.txt > built.txt",
+	}
+	releases := filepath.Join(filepath.Dir(current), "current.releases")
+
+	deploy := func() (*DeployResult, string) {
+		t.Helper()
+		result := deployer.Deploy(context.Background(), project, "INTERNAL")
+		return &result, filepath.Join(releases, result.BuildID)
+	}
+	assertLive := func(release, content string) {
+		t.Helper()
+		if target, err := os.Readlink(current); err != nil || target != release {
+			t.Fatalf("Expected %s -> %s, got %q (%v)", current, release, target, err)
+		}
+		if data, _ := os.ReadFile(filepath.Join(current, "built.txt")); string(data) != content {
+			t.Errorf("Expected live build output %q, got %q", content, data)
+		}
+	}
+
+	result, first := deploy()
+	if !result.Success {
+		t.Fatalf("Expected first deploy to succeed: %s", result.Error)
+	}
+	assertLive(first, "test")
+	if _, err := os.Stat(filepath.Join(targetPath, "built.txt")); !os.IsNotExist(err) {
+		t.Error("Expected the build to run in the release, not in local_path")
+	}
+
+	pushTestCommit(t, workDir, "test.txt", "v2")
+	result, second := deploy()
+	if !result.Success {
+		t.Fatalf("Expected second deploy to succeed: %s", result.Error)
+	}
+	assertLive(second, "v2")
+
+	// A failed build leaves the live release alone and is discarded
+	pushTestCommit(t, workDir, "test.txt", "v3")
+	project.ExecuteCommand = "cat test.txt > built.txt; exit 1"
+	result, failed := deploy()
+	if result.Success {
+		t.Fatal("Expected failing build to fail")
+	}
+	assertLive(second, "v2")
+	if _, err := os.Stat(failed); !os.IsNotExist(err) {
+		t.Errorf("Expected failed release %s to be removed", failed)
+	}
+
+	// Only the live release and the previous one are kept
+	project.ExecuteCommand = "cat test.txt > built.txt"
+	result, fourth := deploy()
+	if !result.Success {
+		t.Fatalf("Expected fourth deploy to succeed: %s", result.Error)
+	}
+	assertLive(fourth, "v3")
+	entries, _ := os.ReadDir(releases)
+	var kept []string
+	for _, entry := range entries {
+		kept = append(kept, filepath.Join(releases, entry.Name()))
+	}
+	if len(kept) != 2 || !strings.Contains(strings.Join(kept, " "), second) {
+		t.Errorf("Expected releases %s and %s to be kept, got %v", second, fourth, kept)
+	}
+	if worktrees := runTestGit(t, targetPath, "worktree", "list"); strings.Count(worktrees, "\n") != 2 {
+		t.Errorf("Expected the checkout and two release worktrees, got:\n%s", worktrees)
+	}
+}
+
+// TestDeployAtomicRefusesDirectory tests that a real directory at execute_path
+// is never replaced
+func TestDeployAtomicRefusesDirectory(t *testing.T) {
+	remoteDir, _, targetPath, branch := setupTestRemote(t)
+	current := filepath.Join(t.TempDir(), "current")
+	if err := os.Mkdir(current, 0755); err != nil {
+		t.Fatalf("Failed to create directory: %v", err)
+	}
+
+	deployer := NewDeployer(nil)
+	project := &ProjectConfig{
+		Name:           "AtomicProject",
+		WebhookPath:    "/hooks/atomic",
+		GitRepo:        "file://" + remoteDir,
+		LocalPath:      targetPath,
+		ExecutePath:    current,
+		GitBranch:      branch,
+		DeployStrategy: DeployStrategyAtomic,
+		ExecuteCommand: "true",
+	}
+	result := deployer.Deploy(context.Background(), project, "INTERNAL")
+	if result.Success || result.ErrorKind != ErrorKindPreflightFailed || !strings.Contains(result.Error, "is not a symlink") {
+		t.Errorf("Expected preflight failure for a directory at execute_path, got kind=%q error=%q", result.ErrorKind, result.Error)
+	}
+}
@@ -9,3 +9,13 @@ import (
 func getShutdownSignals() []os.Signal {
 	return []os.Signal{syscall.SIGINT, syscall.SIGTERM}
 }
+
+// getReloadSignal returns the signal that reloads the configuration
+func getReloadSignal() os.Signal {
+	return syscall.SIGHUP
+}
+
+// getMaintenanceSignal returns the signal that toggles maintenance mode
+func getMaintenanceSignal() os.Signal {
+	return syscall.SIGUSR1
+}
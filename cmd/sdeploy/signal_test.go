@@ -41,3 +41,17 @@ func TestGetShutdownSignalsNonEmpty(t *testing.T) {
 		t.Errorf("Expected at least 2 shutdown signals (SIGINT, SIGTERM), got %d", len(signals))
 	}
 }
+
+// TestGetMaintenanceSignal tests that SIGUSR1 toggles maintenance mode
+func TestGetMaintenanceSignal(t *testing.T) {
+	if sig := getMaintenanceSignal(); sig != syscall.SIGUSR1 {
+		t.Errorf("Expected SIGUSR1, got %v", sig)
+	}
+}
+
+// TestGetReloadSignal tests that SIGHUP reloads the configuration
+func TestGetReloadSignal(t *testing.T) {
+	if sig := getReloadSignal(); sig != syscall.SIGHUP {
+		t.Errorf("Expected SIGHUP, got %v", sig)
+	}
+}
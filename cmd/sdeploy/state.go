@@ -0,0 +1,116 @@
+package main
+
+import "sync"
+
+// stateStore keeps the latest completed deployment result per project, keyed
+// by ProjectConfig.DeployKey, along with its run of consecutive failures. It
+// only lives in memory and starts empty.
+type stateStore struct {
+	mu       sync.Mutex
+	results  map[string]DeployResult
+	failures map[string]int
+	// trials marks projects whose circuit breaker let a trial build through
+	trials map[string]bool
+	// pulls counts checkout updates per lock key, for git_maintenance
+	pulls map[string]int
+}
+
+// newStateStore creates an empty state store
+func newStateStore() *stateStore {
+	return &stateStore{
+		results:  make(map[string]DeployResult),
+		failures: make(map[string]int),
+		trials:   make(map[string]bool),
+		pulls:    make(map[string]int),
+	}
+}
+
+// record stores result as the latest for key and returns the one it replaced.
+// Skipped results are not outcomes and leave the stored result unchanged.
+func (s *stateStore) record(key string, result DeployResult) (previous DeployResult, ok bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	previous, ok = s.results[key]
+	if !result.Skipped {
+		s.results[key] = result
+		if result.Success {
+			s.failures[key] = 0
+		} else {
+			s.failures[key]++
+		}
+		delete(s.trials, key)
+	}
+	return previous, ok
+}
+
+// projectState is a consistent snapshot of one project's deployment state
+type projectState struct {
+	Last                DeployResult // latest completed result, if HasLast
+	HasLast             bool
+	ConsecutiveFailures int
+	TrialRunning        bool // the circuit breaker let a trial build through
+}
+
+// snapshot returns the state stored for key, read under a single lock
+func (s *stateStore) snapshot(key string) projectState {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	last, ok := s.results[key]
+	return projectState{
+		Last:                last,
+		HasLast:             ok,
+		ConsecutiveFailures: s.failures[key],
+		TrialRunning:        s.trials[key],
+	}
+}
+
+// consecutiveFailures returns how many builds for key failed in a row
+func (s *stateStore) consecutiveFailures(key string) int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.failures[key]
+}
+
+// startTrial marks a trial build for key as started. It returns false if one
+// is already running; the mark is cleared when the next result is recorded or
+// by endTrial.
+func (s *stateStore) startTrial(key string) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.trials[key] {
+		return false
+	}
+	s.trials[key] = true
+	return true
+}
+
+// endTrial clears the trial build mark for key
+func (s *stateStore) endTrial(key string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	delete(s.trials, key)
+}
+
+// countPull records an update of the checkout for key and returns the number
+// of updates since startup
+func (s *stateStore) countPull(key string) int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.pulls[key]++
+	return s.pulls[key]
+}
+
+// last returns the latest stored result for key
+func (s *stateStore) last(key string) (DeployResult, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	result, ok := s.results[key]
+	return result, ok
+}
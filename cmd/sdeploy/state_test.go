@@ -0,0 +1,88 @@
+package main
+
+import (
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"testing"
+)
+
+// TestStateStoreRecord tests latest results and consecutive failure counts
+func TestStateStoreRecord(t *testing.T) {
+	s := newStateStore()
+
+	if _, ok := s.record("a", DeployResult{BuildID: "1", Success: false}); ok {
+		t.Error("Expected no previous result for the first build")
+	}
+	s.record("a", DeployResult{BuildID: "2", Success: false})
+	s.record("a", DeployResult{BuildID: "3", Skipped: true})
+
+	state := s.snapshot("a")
+	if !state.HasLast || state.Last.BuildID != "2" || state.ConsecutiveFailures != 2 {
+		t.Errorf("Expected build 2 after 2 failures (skips ignored), got %+v", state)
+	}
+
+	previous, ok := s.record("a", DeployResult{BuildID: "4", Success: true})
+	if !ok || previous.BuildID != "2" {
+		t.Errorf("Expected build 2 to be replaced, got %+v", previous)
+	}
+	if failures := s.consecutiveFailures("a"); failures != 0 {
+		t.Errorf("Expected a success to reset failures, got %d", failures)
+	}
+	if state := s.snapshot("b"); state.HasLast || state.ConsecutiveFailures != 0 {
+		t.Errorf("Expected empty state for an unknown key, got %+v", state)
+	}
+}
+
+// TestStateStoreConcurrentUpdates tests that concurrent records, reads and
+// trial starts stay consistent
+func TestStateStoreConcurrentUpdates(t *testing.T) {
+	s := newStateStore()
+	const workers, perWorker = 8, 100
+
+	var wg sync.WaitGroup
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func(w int) {
+			defer wg.Done()
+			for i := 0; i < perWorker; i++ {
+				s.record("failing", DeployResult{BuildID: fmt.Sprintf("%d-%d", w, i)})
+				s.record(fmt.Sprintf("project-%d", w), DeployResult{Success: true})
+				_ = s.snapshot("failing")
+			}
+		}(w)
+	}
+	wg.Wait()
+
+	if failures := s.consecutiveFailures("failing"); failures != workers*perWorker {
+		t.Errorf("Expected %d consecutive failures, got %d", workers*perWorker, failures)
+	}
+	for w := 0; w < workers; w++ {
+		if state := s.snapshot(fmt.Sprintf("project-%d", w)); !state.HasLast || !state.Last.Success {
+			t.Errorf("Expected a successful result for project-%d, got %+v", w, state)
+		}
+	}
+
+	// Only one of many concurrent callers may start the trial build
+	var started int32
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if s.startTrial("failing") {
+				atomic.AddInt32(&started, 1)
+			}
+		}()
+	}
+	wg.Wait()
+	if started != 1 {
+		t.Errorf("Expected exactly one trial build to start, got %d", started)
+	}
+	if !s.snapshot("failing").TrialRunning {
+		t.Error("Expected the trial build to be reported as running")
+	}
+	s.record("failing", DeployResult{Success: false})
+	if s.snapshot("failing").TrialRunning {
+		t.Error("Expected the trial mark to clear with the next result")
+	}
+}
@@ -0,0 +1,171 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+
+	"gopkg.in/yaml.v3"
+)
+
+// CommandStep is one entry of a list-form execute_command. Consecutive
+// entries with parallel: true run concurrently as one group; the other
+// entries run one at a time, in order.
+type CommandStep struct {
+	Command  string `yaml:"command"`
+	Parallel bool   `yaml:"parallel"`
+}
+
+// errStepFailed is the cancel cause for the siblings of a failed parallel
+// step, and the error they report once stopped
+var errStepFailed = errors.New("stopped after a parallel step failed")
+
+// UnmarshalYAML accepts a plain string as a sequential step
+func (s *CommandStep) UnmarshalYAML(node *yaml.Node) error {
+	if node.Kind == yaml.ScalarNode {
+		*s = CommandStep{Command: node.Value}
+		return nil
+	}
+	type plain CommandStep
+	return node.Decode((*plain)(s))
+}
+
+// String describes the step for logs and the startup summary
+func (s CommandStep) String() string {
+	if s.Parallel {
+		return s.Command + " (parallel)"
+	}
+	return s.Command
+}
+
+// UnmarshalYAML decodes a project. execute_command may be a string or a list
+// of steps; a list is stored in ExecuteSteps and ExecuteCommand stays empty.
+func (p *ProjectConfig) UnmarshalYAML(node *yaml.Node) error {
+	type plain ProjectConfig
+	if node.Kind != yaml.MappingNode {
+		return node.Decode((*plain)(p))
+	}
+	for i := 0; i+1 < len(node.Content); i += 2 {
+		key, value := node.Content[i], node.Content[i+1]
+		if key.Value != "execute_command" || value.Kind != yaml.SequenceNode {
+			continue
+		}
+		var steps []CommandStep
+		if err := value.Decode(&steps); err != nil {
+			return err
+		}
+		rest := *node
+		rest.Content = append(append([]*yaml.Node{}, node.Content[:i]...), node.Content[i+2:]...)
+		if err := rest.Decode((*plain)(p)); err != nil {
+			return err
+		}
+		p.ExecuteSteps = steps
+		return nil
+	}
+	return node.Decode((*plain)(p))
+}
+
+// CommandSummary returns execute_command for logs: the command, or the steps
+// of a list-form execute_command joined with "; "
+func (p *ProjectConfig) CommandSummary() string {
+	if len(p.ExecuteSteps) == 0 {
+		return p.ExecuteCommand
+	}
+	steps := make([]string, len(p.ExecuteSteps))
+	for i, step := range p.ExecuteSteps {
+		steps[i] = step.String()
+	}
+	return strings.Join(steps, "; ")
+}
+
+// validateExecuteSteps checks a list-form execute_command: every step needs
+// a command
+func validateExecuteSteps(steps []CommandStep) error {
+	for i, step := range steps {
+		if strings.TrimSpace(step.Command) == "" {
+			return fmt.Errorf("execute_command step %d: command is required", i+1)
+		}
+	}
+	return nil
+}
+
+// stepGroups splits steps into the groups runSteps runs one after another: a
+// run of consecutive parallel steps forms one group, every other step is a
+// group of its own
+func stepGroups(steps []CommandStep) [][]int {
+	var groups [][]int
+	for i, step := range steps {
+		last := len(groups) - 1
+		if step.Parallel && last >= 0 && steps[groups[last][0]].Parallel {
+			groups[last] = append(groups[last], i)
+			continue
+		}
+		groups = append(groups, []int{i})
+	}
+	return groups
+}
+
+// runSteps runs a list-form execute_command. Groups run in order and the
+// first failing group ends the deploy; when a step of a parallel group fails
+// its still-running siblings are stopped like a timed-out command. The
+// output of every step that ran is returned in step order, each under a
+// "$ command" header, whatever order they finished in.
+func (d *Deployer) runSteps(ctx context.Context, project *ProjectConfig, executePath string, env []string, buildLogger *BuildLogger) (string, error) {
+	steps := project.ExecuteSteps
+	outputs := make([]string, len(steps))
+	ran := make([]bool, len(steps))
+	combined := func() string {
+		var b strings.Builder
+		for i, step := range steps {
+			if !ran[i] {
+				continue
+			}
+			if b.Len() > 0 {
+				b.WriteString("\n")
+			}
+			b.WriteString("$ " + step.Command + "\n")
+			b.WriteString(outputs[i])
+		}
+		return b.String()
+	}
+
+	for _, group := range stepGroups(steps) {
+		groupCtx, cancel := context.WithCancelCause(ctx)
+		errs := make([]error, len(steps))
+		var wg sync.WaitGroup
+		for _, i := range group {
+			ran[i] = true
+			if buildLogger != nil {
+				buildLogger.Infof(project.Name, "Running step %d/%d: %s", i+1, len(steps), steps[i])
+			}
+			wg.Add(1)
+			go func(i int) {
+				defer wg.Done()
+				outputs[i], errs[i] = d.runCommand(groupCtx, project, steps[i].Command, executePath, env, buildLogger)
+				if errs[i] != nil {
+					cancel(errStepFailed)
+				}
+			}(i)
+		}
+		wg.Wait()
+		cancel(nil)
+
+		// Report the step that failed, not the siblings it stopped
+		var failed error
+		for _, i := range group {
+			if errs[i] == nil {
+				continue
+			}
+			err := fmt.Errorf("step %d (%s): %w", i+1, steps[i].Command, errs[i])
+			if failed == nil || errors.Is(failed, errStepFailed) {
+				failed = err
+			}
+		}
+		if failed != nil {
+			return combined(), failed
+		}
+	}
+	return combined(), nil
+}
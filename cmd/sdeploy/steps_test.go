@@ -0,0 +1,165 @@
+package main
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+// TestLoadConfigExecuteSteps tests the list form of execute_command next to
+// the string form
+func TestLoadConfigExecuteSteps(t *testing.T) {
+	tmpDir := t.TempDir()
+	configPath := filepath.Join(tmpDir, "sdeploy.conf")
+
+	config := `
+projects:
+  - name: Steps
+    webhook_path: /hooks/steps
+    webhook_secret: secret
+    git_repo: https://example.com/app.git
+    execute_command:
+      - npm ci
+      - command: npm run lint
+        parallel: true
+      - {command: npm test, parallel: true}
+      - command: ./deploy.sh
+    branch_commands:
+      develop: make staging
+  - name: Single
+    webhook_path: /hooks/single
+    webhook_secret: secret
+    execute_command: echo test
+`
+	if err := os.WriteFile(configPath, []byte(config), 0644); err != nil {
+		t.Fatalf("Failed to create test config file: %v", err)
+	}
+	cfg, err := LoadConfig(configPath)
+	if err != nil {
+		t.Fatalf("LoadConfig failed: %v", err)
+	}
+
+	project := &cfg.Projects[0]
+	want := []CommandStep{
+		{Command: "npm ci"},
+		{Command: "npm run lint", Parallel: true},
+		{Command: "npm test", Parallel: true},
+		{Command: "./deploy.sh"},
+	}
+	if !reflect.DeepEqual(project.ExecuteSteps, want) || project.ExecuteCommand != "" {
+		t.Fatalf("Expected steps %+v, got %+v (command %q)", want, project.ExecuteSteps, project.ExecuteCommand)
+	}
+	if project.GitBranch != "main" || project.WebhookSecret != "secret" {
+		t.Errorf("Expected the other fields to be decoded, got %+v", project)
+	}
+	if got := project.CommandSummary(); got != "npm ci; npm run lint (parallel); npm test (parallel); ./deploy.sh" {
+		t.Errorf("Unexpected command summary %q", got)
+	}
+	if variant := project.ForBranch("develop"); variant.ExecuteSteps != nil || variant.ExecuteCommand != "make staging" {
+		t.Errorf("Expected branch_commands to replace the steps, got %+v / %q", variant.ExecuteSteps, variant.ExecuteCommand)
+	}
+
+	if single := cfg.Projects[1]; single.ExecuteCommand != "echo test" || single.ExecuteSteps != nil {
+		t.Errorf("Expected the string form to be kept, got %q / %+v", single.ExecuteCommand, single.ExecuteSteps)
+	}
+
+	for _, tt := range []struct {
+		name    string
+		command string
+		wantErr string
+	}{
+		{"empty list", "[]", "execute_command is required"},
+		{"empty step", "[make, '']", "execute_command step 2: command is required"},
+		{"step without command", "[{parallel: true}]", "execute_command step 1: command is required"},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			config := `
+projects:
+  - name: Steps
+    webhook_path: /hooks/steps
+    webhook_secret: secret
+    execute_command: ` + tt.command + "\n"
+			if err := os.WriteFile(configPath, []byte(config), 0644); err != nil {
+				t.Fatalf("Failed to create test config file: %v", err)
+			}
+			if _, err := LoadConfig(configPath); err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Fatalf("Expected error containing %q, got %v", tt.wantErr, err)
+			}
+		})
+	}
+}
+
+// TestStepGroups tests that consecutive parallel steps are grouped
+func TestStepGroups(t *testing.T) {
+	steps := []CommandStep{
+		{Command: "a"},
+		{Command: "b", Parallel: true},
+		{Command: "c", Parallel: true},
+		{Command: "d"},
+		{Command: "e", Parallel: true},
+	}
+	want := [][]int{{0}, {1, 2}, {3}, {4}}
+	if got := stepGroups(steps); !reflect.DeepEqual(got, want) {
+		t.Errorf("Expected groups %v, got %v", want, got)
+	}
+}
+
+// TestDeployExecuteSteps tests that parallel steps run concurrently, that the
+// output is combined in step order and that a failing step stops its
+// siblings and the steps after it
+func TestDeployExecuteSteps(t *testing.T) {
+	tmpDir := t.TempDir()
+	deployer := NewDeployer(nil)
+
+	// Each parallel step waits for the other's marker, so they only finish
+	// when run at the same time
+	project := &ProjectConfig{
+		Name:           "StepsProject",
+		WebhookPath:    "/hooks/steps",
+		ExecutePath:    tmpDir,
+		TimeoutSeconds: 10,
+		ExecuteSteps: []CommandStep{
+			{Command: "echo first"},
+			{Command: "touch a; while [ ! -f b ]; do sleep 0.05; done; echo lint", Parallel: true},
+			{Command: "touch b; while [ ! -f a ]; do sleep 0.05; done; echo test >&2", Parallel: true},
+			{Command: "echo last"},
+		},
+	}
+	result := deployer.Deploy(context.Background(), project, "INTERNAL")
+	if !result.Success {
+		t.Fatalf("Expected steps to succeed, got error: %s", result.Error)
+	}
+	want := "$ echo first\nfirst\n\n$ touch a; while [ ! -f b ]; do sleep 0.05; done; echo lint\nlint\n\n" +
+		"$ touch b; while [ ! -f a ]; do sleep 0.05; done; echo test >&2\ntest\n\n$ echo last\nlast\n"
+	if result.Output != want {
+		t.Errorf("Unexpected combined output:\n%s", result.Output)
+	}
+
+	marker := filepath.Join(tmpDir, "marker")
+	project.ExecuteSteps = []CommandStep{
+		{Command: "sleep 30; touch marker", Parallel: true},
+		{Command: "echo broken; exit 3", Parallel: true},
+		{Command: "touch marker"},
+	}
+	start := time.Now()
+	result = deployer.Deploy(context.Background(), project, "INTERNAL")
+	if result.Success || result.ErrorKind != ErrorKindCommandFailed {
+		t.Fatalf("Expected a command_failed result, got %+v", result)
+	}
+	if !strings.Contains(result.Error, "step 2 (echo broken; exit 3): exit status 3") {
+		t.Errorf("Expected the failing step in the error, got %q", result.Error)
+	}
+	if elapsed := time.Since(start); elapsed > 5*time.Second {
+		t.Errorf("Expected the sibling step to be stopped, deploy took %v", elapsed)
+	}
+	if !strings.Contains(result.Output, "broken") {
+		t.Errorf("Expected the failing step's output, got %q", result.Output)
+	}
+	if _, err := os.Stat(marker); !os.IsNotExist(err) {
+		t.Error("Expected neither the stopped sibling nor the next step to run to completion")
+	}
+}
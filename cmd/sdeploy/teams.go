@@ -0,0 +1,146 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"time"
+)
+
+// teamsRequestTimeout bounds a single post to the Teams webhook
+const teamsRequestTimeout = 30 * time.Second
+
+// TeamsNotifier posts deployment results to a Microsoft Teams incoming webhook
+type TeamsNotifier struct {
+	webhookURL string
+	client     *http.Client
+}
+
+// NewTeamsNotifier creates a Teams notifier, or returns nil if teams_config
+// is not set
+func NewTeamsNotifier(config *TeamsConfig) *TeamsNotifier {
+	if config == nil || config.WebhookURL == "" {
+		return nil
+	}
+	return &TeamsNotifier{
+		webhookURL: config.WebhookURL,
+		client:     &http.Client{Timeout: teamsRequestTimeout},
+	}
+}
+
+// teamsMessage is the envelope Teams webhooks accept for Adaptive Cards
+type teamsMessage struct {
+	Type        string            `json:"type"`
+	Attachments []teamsAttachment `json:"attachments"`
+}
+
+type teamsAttachment struct {
+	ContentType string    `json:"contentType"`
+	ContentURL  *string   `json:"contentUrl"`
+	Content     teamsCard `json:"content"`
+}
+
+type teamsCard struct {
+	Schema  string           `json:"$schema"`
+	Type    string           `json:"type"`
+	Version string           `json:"version"`
+	Body    []teamsCardBlock `json:"body"`
+}
+
+// teamsCardBlock is a TextBlock or FactSet element of an Adaptive Card
+type teamsCardBlock struct {
+	Type   string      `json:"type"`
+	Text   string      `json:"text,omitempty"`
+	Weight string      `json:"weight,omitempty"`
+	Size   string      `json:"size,omitempty"`
+	Color  string      `json:"color,omitempty"`
+	Wrap   bool        `json:"wrap,omitempty"`
+	Facts  []teamsFact `json:"facts,omitempty"`
+}
+
+type teamsFact struct {
+	Title string `json:"title"`
+	Value string `json:"value"`
+}
+
+// teamsStatusError is a non-2xx reply from the Teams webhook
+type teamsStatusError struct {
+	Code int
+	Body string
+}
+
+func (e *teamsStatusError) Error() string {
+	return fmt.Sprintf("teams webhook returned %d: %s", e.Code, e.Body)
+}
+
+// SendNotification posts a deployment result card to the Teams webhook
+func (n *TeamsNotifier) SendNotification(project *ProjectConfig, result *DeployResult, triggerSource string) error {
+	payload, err := json.Marshal(composeTeamsMessage(project, result, triggerSource))
+	if err != nil {
+		return err
+	}
+
+	resp, err := n.client.Post(n.webhookURL, "application/json", bytes.NewReader(payload))
+	if err != nil {
+		// The URL carries the webhook's credentials; keep it out of the error
+		var urlErr *url.Error
+		if errors.As(err, &urlErr) {
+			err = urlErr.Err
+		}
+		return fmt.Errorf("teams webhook request failed: %v", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return &teamsStatusError{Code: resp.StatusCode, Body: string(bytes.TrimSpace(body))}
+	}
+	return nil
+}
+
+// composeTeamsMessage builds an Adaptive Card (schema 1.4, the newest Teams
+// renders everywhere) with the same fields as the email notification
+func composeTeamsMessage(project *ProjectConfig, result *DeployResult, triggerSource string) teamsMessage {
+	status := resultStatus(result)
+	color := "Good"
+	if !result.Success {
+		color = "Attention"
+	}
+
+	facts := []teamsFact{
+		{Title: "Project", Value: project.Name},
+		{Title: "Status", Value: status},
+		{Title: "Trigger Source", Value: triggerSource},
+		{Title: "Branch", Value: project.GitBranch},
+		{Title: "Build ID", Value: result.BuildID},
+		{Title: "Duration", Value: result.Duration().Round(time.Millisecond).String()},
+	}
+	if result.CommitSHA != "" {
+		facts = append(facts, teamsFact{Title: "Commit", Value: result.CommitSHA})
+	}
+
+	body := []teamsCardBlock{
+		{Type: "TextBlock", Text: fmt.Sprintf("[SDeploy] %s - Deployment %s", project.Name, status), Weight: "Bolder", Size: "Medium", Color: color, Wrap: true},
+		{Type: "FactSet", Facts: facts},
+	}
+	if result.Error != "" {
+		body = append(body, teamsCardBlock{Type: "TextBlock", Text: "Error: " + result.Error, Color: "Attention", Wrap: true})
+	}
+
+	return teamsMessage{
+		Type: "message",
+		Attachments: []teamsAttachment{{
+			ContentType: "application/vnd.microsoft.card.adaptive",
+			Content: teamsCard{
+				Schema:  "http://adaptivecards.io/schemas/adaptive-card.json",
+				Type:    "AdaptiveCard",
+				Version: "1.4",
+				Body:    body,
+			},
+		}},
+	}
+}
@@ -0,0 +1,184 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// TestComposeTeamsMessage tests the Adaptive Card envelope Teams requires
+func TestComposeTeamsMessage(t *testing.T) {
+	project := &ProjectConfig{Name: "Frontend", GitBranch: "main"}
+	result := &DeployResult{
+		BuildID:   "2024-01-15-1430-a1b2c3",
+		Error:     "exit status 1",
+		CommitSHA: "abc123",
+		StartTime: time.Date(2024, 1, 15, 14, 30, 0, 0, time.UTC),
+		EndTime:   time.Date(2024, 1, 15, 14, 30, 5, 0, time.UTC),
+	}
+
+	data, err := json.Marshal(composeTeamsMessage(project, result, "WEBHOOK (Github)"))
+	if err != nil {
+		t.Fatalf("Failed to marshal: %v", err)
+	}
+
+	// Decode generically so the test checks the wire format, not the Go types
+	var msg map[string]any
+	if err := json.Unmarshal(data, &msg); err != nil {
+		t.Fatalf("Failed to unmarshal: %v", err)
+	}
+	if msg["type"] != "message" {
+		t.Errorf("Expected type message, got %v", msg["type"])
+	}
+	attachments, _ := msg["attachments"].([]any)
+	if len(attachments) != 1 {
+		t.Fatalf("Expected one attachment, got %s", data)
+	}
+	attachment := attachments[0].(map[string]any)
+	if attachment["contentType"] != "application/vnd.microsoft.card.adaptive" {
+		t.Errorf("Unexpected contentType: %v", attachment["contentType"])
+	}
+	if url, ok := attachment["contentUrl"]; !ok || url != nil {
+		t.Errorf("Expected contentUrl: null, got %s", data)
+	}
+	card := attachment["content"].(map[string]any)
+	if card["$schema"] != "http://adaptivecards.io/schemas/adaptive-card.json" || card["type"] != "AdaptiveCard" || card["version"] != "1.4" {
+		t.Errorf("Unexpected card header: %s", data)
+	}
+
+	body := card["body"].([]any)
+	if len(body) != 3 {
+		t.Fatalf("Expected title, facts and error blocks, got %s", data)
+	}
+	title := body[0].(map[string]any)
+	if title["type"] != "TextBlock" || title["text"] != "[SDeploy] Frontend - Deployment FAILED" || title["color"] != "Attention" {
+		t.Errorf("Unexpected title block: %v", title)
+	}
+	factSet := body[1].(map[string]any)
+	if factSet["type"] != "FactSet" {
+		t.Errorf("Expected FactSet, got %v", factSet["type"])
+	}
+	facts := make(map[string]string)
+	for _, f := range factSet["facts"].([]any) {
+		fact := f.(map[string]any)
+		facts[fact["title"].(string)] = fact["value"].(string)
+	}
+	expected := map[string]string{
+		"Project":        "Frontend",
+		"Status":         "FAILED",
+		"Trigger Source": "WEBHOOK (Github)",
+		"Branch":         "main",
+		"Build ID":       "2024-01-15-1430-a1b2c3",
+		"Duration":       "5s",
+		"Commit":         "abc123",
+	}
+	for title, value := range expected {
+		if facts[title] != value {
+			t.Errorf("Expected fact %s=%q, got %q", title, value, facts[title])
+		}
+	}
+	if errBlock := body[2].(map[string]any); errBlock["text"] != "Error: exit status 1" {
+		t.Errorf("Unexpected error block: %v", errBlock)
+	}
+}
+
+// TestTeamsNotifierSend tests posting to the webhook and classifying failures
+func TestTeamsNotifierSend(t *testing.T) {
+	var mu sync.Mutex
+	var contentType, received string
+	status := http.StatusOK
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		mu.Lock()
+		defer mu.Unlock()
+		contentType, received = r.Header.Get("Content-Type"), string(body)
+		w.WriteHeader(status)
+	}))
+	defer server.Close()
+
+	notifier := NewTeamsNotifier(&TeamsConfig{WebhookURL: server.URL + "/webhook"})
+	project := &ProjectConfig{Name: "Frontend"}
+	result := &DeployResult{Success: true, StartTime: time.Now(), EndTime: time.Now()}
+
+	if err := notifier.SendNotification(project, result, "INTERNAL"); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	mu.Lock()
+	if contentType != "application/json" || !strings.Contains(received, "Deployment SUCCESS") {
+		t.Errorf("Unexpected request: %s %s", contentType, received)
+	}
+	mu.Unlock()
+
+	tests := []struct {
+		code      int
+		permanent bool
+	}{
+		{http.StatusBadRequest, true},
+		{http.StatusTooManyRequests, false},
+		{http.StatusBadGateway, false},
+	}
+	for _, tt := range tests {
+		mu.Lock()
+		status = tt.code
+		mu.Unlock()
+		err := notifier.SendNotification(project, result, "INTERNAL")
+		if err == nil {
+			t.Fatalf("Expected error for status %d", tt.code)
+		}
+		if got := isPermanentNotifyError(err); got != tt.permanent {
+			t.Errorf("Status %d: expected permanent=%t, got %t", tt.code, tt.permanent, got)
+		}
+	}
+}
+
+// TestDeployTeamsNotification tests that deploys post to Teams under notify_on
+func TestDeployTeamsNotification(t *testing.T) {
+	var mu sync.Mutex
+	var posts []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		mu.Lock()
+		posts = append(posts, string(body))
+		mu.Unlock()
+	}))
+	defer server.Close()
+
+	deployer := NewDeployer(nil)
+	deployer.SetTeamsNotifier(NewTeamsNotifier(&TeamsConfig{WebhookURL: server.URL}))
+	project := &ProjectConfig{Name: "TeamsProject", WebhookPath: "/hooks/teams", ExecuteCommand: "true", NotifyOn: NotifyFailure}
+
+	deployer.Deploy(context.Background(), project, "INTERNAL")
+	project.ExecuteCommand = "false"
+	deployer.Deploy(context.Background(), project, "INTERNAL")
+	if !deployer.WaitForNotifications(5 * time.Second) {
+		t.Fatal("Timed out waiting for notifications")
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	if len(posts) != 1 || !strings.Contains(posts[0], "Deployment FAILED") {
+		t.Errorf("Expected one failure card, got %v", posts)
+	}
+}
+
+// TestValidateTeamsConfig tests webhook_url validation
+func TestValidateTeamsConfig(t *testing.T) {
+	valid := []string{"https://example.webhook.office.com/webhookb2/abc", "http://localhost:8080/hook"}
+	for _, u := range valid {
+		if err := validateTeamsConfig(&TeamsConfig{WebhookURL: u}); err != nil {
+			t.Errorf("Expected %q to be valid, got %v", u, err)
+		}
+	}
+	invalid := []string{"", "example.com/hook", "ftp://example.com/hook", "https://"}
+	for _, u := range invalid {
+		if err := validateTeamsConfig(&TeamsConfig{WebhookURL: u}); err == nil {
+			t.Errorf("Expected %q to be rejected", u)
+		}
+	}
+}
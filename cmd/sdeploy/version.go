@@ -0,0 +1,50 @@
+package main
+
+import (
+	"fmt"
+	"runtime"
+	"runtime/debug"
+)
+
+// Build information. Release builds set these with -ldflags, e.g.
+//
+//	go build -ldflags "-X main.Version=v1.1 -X main.Commit=$(git rev-parse --short HEAD) -X main.BuildDate=$(date -u +%Y-%m-%dT%H:%M:%SZ)" ./cmd/sdeploy
+//
+// Without them, Commit and BuildDate fall back to the VCS information Go
+// embeds when building from a git checkout.
+var (
+	Version   = "v1.0"
+	Commit    = ""
+	BuildDate = ""
+)
+
+// buildInfo returns the commit and build date, filling in what -ldflags did
+// not set from the embedded VCS information, or "unknown"
+func buildInfo() (commit, buildDate string) {
+	commit, buildDate = Commit, BuildDate
+	if info, ok := debug.ReadBuildInfo(); ok {
+		for _, s := range info.Settings {
+			switch {
+			case s.Key == "vcs.revision" && commit == "":
+				commit = truncateSHA(s.Value, Defaults.SHALength)
+			case s.Key == "vcs.time" && buildDate == "":
+				buildDate = s.Value
+			}
+		}
+	}
+	if commit == "" {
+		commit = "unknown"
+	}
+	if buildDate == "" {
+		buildDate = "unknown"
+	}
+	return commit, buildDate
+}
+
+// versionString describes the running binary, e.g.
+// "SDeploy v1.0 (commit 1a2b3c4d, built 2024-01-15T14:30:00Z, go1.24.0 linux/amd64)"
+func versionString() string {
+	commit, buildDate := buildInfo()
+	return fmt.Sprintf("%s %s (commit %s, built %s, %s %s/%s)",
+		ServiceName, Version, commit, buildDate, runtime.Version(), runtime.GOOS, runtime.GOARCH)
+}
@@ -0,0 +1,27 @@
+package main
+
+import (
+	"runtime"
+	"strings"
+	"testing"
+)
+
+// TestVersionString tests that -ldflags build information is reported
+func TestVersionString(t *testing.T) {
+	origCommit, origDate := Commit, BuildDate
+	defer func() { Commit, BuildDate = origCommit, origDate }()
+
+	Commit, BuildDate = "1a2b3c4d", "2024-01-15T14:30:00Z"
+	got := versionString()
+	for _, want := range []string{ServiceName + " " + Version, "commit 1a2b3c4d", "built 2024-01-15T14:30:00Z", runtime.Version()} {
+		if !strings.Contains(got, want) {
+			t.Errorf("Expected %q in version string, got %q", want, got)
+		}
+	}
+
+	// Without ldflags the fields are never empty
+	Commit, BuildDate = "", ""
+	if commit, buildDate := buildInfo(); commit == "" || buildDate == "" {
+		t.Errorf("Expected fallback build info, got commit=%q date=%q", commit, buildDate)
+	}
+}
@@ -3,12 +3,23 @@ package main
 import (
 	"context"
 	"crypto/hmac"
+	"crypto/sha1"
 	"crypto/sha256"
+	"crypto/subtle"
 	"encoding/hex"
 	"encoding/json"
+	"errors"
+	"hash"
 	"io"
+	"net"
 	"net/http"
+	"net/netip"
+	"regexp"
+	"strconv"
 	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
 )
 
 // TriggerSource represents the source of a deployment trigger
@@ -27,6 +38,23 @@ type WebhookHandler struct {
 	// Legacy fields for backward compatibility when ConfigManager is not used
 	config   *Config
 	projects map[string]*ProjectConfig
+
+	// debounced holds deploys waiting out debounce_seconds, keyed by deploy key
+	debounceMu sync.Mutex
+	debounced  map[string]*debouncedDeploy
+
+	// maintenance is the runtime maintenance switch toggled by SIGUSR1,
+	// in effect in addition to maintenance_mode from the config
+	maintenance atomic.Bool
+}
+
+// debouncedDeploy is a deployment scheduled to run once webhooks stop arriving
+type debouncedDeploy struct {
+	timer         clockTimer
+	enqueuedAt    time.Time
+	opts          DeployOptions
+	project       *ProjectConfig
+	triggerSource string
 }
 
 // NewWebhookHandler creates a new webhook handler
@@ -58,6 +86,26 @@ func (h *WebhookHandler) SetDeployer(deployer *Deployer) {
 	h.deployer = deployer
 }
 
+// ToggleMaintenance flips the runtime maintenance switch and returns its new state
+func (h *WebhookHandler) ToggleMaintenance() bool {
+	for {
+		old := h.maintenance.Load()
+		if h.maintenance.CompareAndSwap(old, !old) {
+			return !old
+		}
+	}
+}
+
+// inMaintenance reports whether builds are currently deferred, either by
+// maintenance_mode in the config or by the runtime switch
+func (h *WebhookHandler) inMaintenance() bool {
+	if h.maintenance.Load() {
+		return true
+	}
+	cfg := h.currentConfig()
+	return cfg != nil && cfg.MaintenanceMode
+}
+
 // getProject looks up a project by webhook path, supporting both hot reload and legacy modes
 func (h *WebhookHandler) getProject(path string) *ProjectConfig {
 	if h.configManager != nil {
@@ -67,8 +115,42 @@ func (h *WebhookHandler) getProject(path string) *ProjectConfig {
 	return h.projects[path]
 }
 
+// projectForRepo looks up the project on a shared webhook path by the
+// payload's repository full name
+func (h *WebhookHandler) projectForRepo(path, repo string) *ProjectConfig {
+	cfg := h.currentConfig()
+	if cfg == nil {
+		return nil
+	}
+	return cfg.ProjectForRepo(path, repo)
+}
+
 // ServeHTTP implements http.Handler
 func (h *WebhookHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	// Serve metrics unless a project explicitly claims the path
+	if r.URL.Path == MetricsPath && h.getProject(r.URL.Path) == nil {
+		h.serveMetrics(w, r)
+		return
+	}
+
+	// Serve the reload endpoint unless a project claims the path
+	if r.URL.Path == ReloadPath && h.getProject(r.URL.Path) == nil {
+		h.serveReload(w, r)
+		return
+	}
+
+	// Serve the status endpoint unless a project claims the path
+	if r.URL.Path == StatusPath && h.getProject(r.URL.Path) == nil {
+		h.serveStatus(w, r)
+		return
+	}
+
+	// Serve build administration endpoints unless a project claims the path
+	if (r.URL.Path == BuildsPath || strings.HasPrefix(r.URL.Path, BuildsPathPrefix)) && h.getProject(r.URL.Path) == nil {
+		h.serveBuilds(w, r)
+		return
+	}
+
 	// Only allow POST
 	if r.Method != http.MethodPost {
 		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
@@ -78,13 +160,25 @@ func (h *WebhookHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	// Find project by path (supports hot reload)
 	project := h.getProject(r.URL.Path)
 	if project == nil {
+		if h.logger != nil {
+			h.logger.Warnf("", "Unknown webhook path: %s %s from %s", r.Method, r.URL.Path, h.clientIP(r))
+		}
 		http.Error(w, "Not found", http.StatusNotFound)
 		return
 	}
 
-	// Read body
+	// Read body once, bounded by max_payload_bytes; HMAC and parsing reuse this copy
+	r.Body = http.MaxBytesReader(w, r.Body, h.maxPayloadBytes())
 	body, err := io.ReadAll(r.Body)
 	if err != nil {
+		var maxBytesErr *http.MaxBytesError
+		if errors.As(err, &maxBytesErr) {
+			if h.logger != nil {
+				h.logger.Warnf(project.Name, "Rejected payload larger than %d bytes", maxBytesErr.Limit)
+			}
+			http.Error(w, "Payload too large", http.StatusRequestEntityTooLarge)
+			return
+		}
 		http.Error(w, "Failed to read request body", http.StatusBadRequest)
 		return
 	}
@@ -97,6 +191,21 @@ func (h *WebhookHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	// Projects with match_repo can share a webhook_path; the payload's
+	// repository picks the one to authenticate and deploy
+	if project.MatchRepo != "" {
+		repo := extractRepoFromPayload(body)
+		matched := h.projectForRepo(r.URL.Path, repo)
+		if matched == nil {
+			if h.logger != nil {
+				h.logger.Warnf("", "No project on webhook path %s matches repository %q from %s", r.URL.Path, repo, h.clientIP(r))
+			}
+			http.Error(w, "Not found", http.StatusNotFound)
+			return
+		}
+		project = matched
+	}
+
 	// Authenticate and determine trigger source
 	triggerSource, authenticated := h.authenticate(r, body, project)
 	if !authenticated {
@@ -104,6 +213,25 @@ func (h *WebhookHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	// Filter GitHub events: answer pings, ignore events the project doesn't deploy on
+	if event := r.Header.Get("X-GitHub-Event"); event != "" {
+		if event == "ping" {
+			if h.logger != nil {
+				h.logger.Infof(project.Name, "Received GitHub ping")
+			}
+			writeJSON(w, http.StatusOK, pingResponse{Zen: extractZenFromPayload(body)})
+			return
+		}
+		if !acceptsGitHubEvent(project, event) {
+			if h.logger != nil {
+				h.logger.Infof(project.Name, "Ignored GitHub event: %s", event)
+			}
+			w.WriteHeader(http.StatusOK)
+			_, _ = w.Write([]byte("Ignored (event: " + event + ")"))
+			return
+		}
+	}
+
 	// Extract branch from payload
 	branch := extractBranchFromPayload(body)
 
@@ -111,6 +239,9 @@ func (h *WebhookHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	var enhancedTriggerSource string
 	if triggerSource == TriggerWebhook {
 		source := determineTriggerSource(body)
+		if source == "unknown" && isGiteaRequest(r) {
+			source = "Gitea"
+		}
 		enhancedTriggerSource = string(triggerSource) + " (" + source + ")"
 	} else if triggerSource == TriggerInternal {
 		// For INTERNAL triggers, check if triggered_by is present in payload
@@ -128,12 +259,62 @@ func (h *WebhookHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	// Log the webhook receipt
 	if h.logger != nil {
 		h.logger.Infof(project.Name, "Received %s trigger for branch: %s", enhancedTriggerSource, branch)
-		//print the full payload
-		h.logger.Infof(project.Name, "Payload: %s", string(body))
+		// Payloads can carry private repository details, so they are only
+		// logged on request and with known secrets masked
+		if project.LogsPayloads() {
+			h.logger.Infof(project.Name, "Payload: %s", h.payloadRedactor(project).Redact(string(body)))
+		}
+	}
+
+	// Disabled projects accept webhooks so senders don't retry, but never deploy
+	if !project.IsEnabled() {
+		if h.logger != nil {
+			h.logger.Infof(project.Name, "Project disabled, skipping")
+		}
+		w.WriteHeader(http.StatusAccepted)
+		_, _ = w.Write([]byte("Accepted (project disabled, skipped)"))
+		return
+	}
+
+	// In maintenance mode webhooks are acknowledged but nothing is built or queued
+	if h.inMaintenance() {
+		if h.logger != nil {
+			h.logger.Infof(project.Name, "Deferred: maintenance mode")
+		}
+		w.WriteHeader(http.StatusAccepted)
+		_, _ = w.Write([]byte("Accepted (deferred: maintenance mode)"))
+		return
+	}
+
+	// Branch deletions arrive as push events but have nothing to deploy
+	if isBranchDeletePayload(body) {
+		if h.logger != nil {
+			h.logger.Infof(project.Name, "Branch %s deleted, ignoring", branch)
+		}
+		w.WriteHeader(http.StatusAccepted)
+		_, _ = w.Write([]byte("Accepted (branch deleted, skipped)"))
+		return
+	}
+
+	// Projects without git_branch follow the remote's default branch. The
+	// handler never queries the remote; until the deploy has looked the
+	// branch up, pushes are not filtered by branch and the deploy builds the
+	// default branch
+	branchKnown := true
+	if h.deployer != nil {
+		project, branchKnown = h.deployer.knownRemoteBranch(r.Context(), project)
+		if !branchKnown && h.logger != nil {
+			h.logger.Infof(project.Name, "Remote default branch not known yet, not filtering push to %s by branch", branch)
+		}
+	}
+
+	// Select the branch_deploys entry for the pushed branch, if any
+	if target := project.ForBranch(branch); target != nil {
+		project = target
 	}
 
 	// Check branch match (for WEBHOOK triggers, we validate branch)
-	if triggerSource == TriggerWebhook && project.GitBranch != "" && branch != "" && branch != project.GitBranch {
+	if triggerSource == TriggerWebhook && branchKnown && project.GitBranch != "" && branch != "" && branch != project.GitBranch {
 		if h.logger != nil {
 			h.logger.Warnf(project.Name, "Branch mismatch: expected %s, got %s. Skipping.", project.GitBranch, branch)
 		}
@@ -142,25 +323,256 @@ func (h *WebhookHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// Trigger deployment asynchronously
+	// Hold back builds from noisy sources until min_build_interval_seconds has
+	// passed since the last build; internal and CLI triggers are not limited
+	if triggerSource == TriggerWebhook && h.deployer != nil {
+		if remaining := h.deployer.buildIntervalRemaining(project, h.deployer.clock.Now()); remaining > 0 {
+			if h.logger != nil {
+				h.logger.Infof(project.Name, "Rate-limited: next build allowed in %v (min_build_interval_seconds: %d)", remaining.Round(time.Second), project.MinBuildInterval)
+			}
+			w.WriteHeader(http.StatusAccepted)
+			_, _ = w.Write([]byte("Accepted (rate-limited, skipped)"))
+			return
+		}
+	}
+
+	// Stop building on every push once a project keeps failing; after the
+	// cooldown a single trial build decides whether the breaker closes
+	trial := false
+	if triggerSource == TriggerWebhook && h.deployer != nil {
+		var open bool
+		var remaining time.Duration
+		if open, remaining, trial = h.deployer.breakerOpen(project, h.deployer.clock.Now()); open {
+			if h.logger != nil {
+				if remaining > 0 {
+					h.logger.Infof(project.Name, "Circuit breaker open: next trial build allowed in %v", remaining.Round(time.Second))
+				} else {
+					h.logger.Infof(project.Name, "Circuit breaker open: trial build in progress")
+				}
+			}
+			w.WriteHeader(http.StatusAccepted)
+			_, _ = w.Write([]byte("Accepted (circuit breaker open, skipped)"))
+			return
+		}
+	}
+
+	// Assign the build ID now so the caller can correlate the response with the build log
+	opts := DeployOptions{
+		BuildID: newBuildID(h.timeSource().Now()),
+		Force:   isForceRequested(r),
+		Commit:  extractCommitFromPayload(body),
+		Trial:   trial,
+	}
+	if triggerSource == TriggerWebhook {
+		opts.Push = extractPushInfo(body)
+	}
+
+	buildID := opts.BuildID
+	if project.DebounceSeconds > 0 {
+		buildID = h.debounceDeploy(project, enhancedTriggerSource, opts)
+	} else {
+		h.startDeploy(project, enhancedTriggerSource, opts)
+	}
+
+	writeJSON(w, http.StatusAccepted, acceptedResponse{BuildID: buildID})
+}
+
+// startDeploy runs a deployment in the background
+func (h *WebhookHandler) startDeploy(project *ProjectConfig, triggerSource string, opts DeployOptions) {
 	go func() {
 		if h.deployer != nil {
 			// Use a background context since HTTP request context is canceled after response
 			// Deploy already logs start/completion/failure, so no extra logging needed here
-			h.deployer.Deploy(context.Background(), project, enhancedTriggerSource)
+			h.deployer.DeployWithOptions(context.Background(), project, triggerSource, opts)
 		}
 	}()
+}
+
+// debounceDeploy schedules a deployment after debounce_seconds. Webhooks arriving
+// while one is pending restart the timer and are coalesced into the pending
+// build, which deploys with the latest request's settings and is forced if any
+// of the coalesced requests asked for it. Returns the build ID that will run.
+func (h *WebhookHandler) debounceDeploy(project *ProjectConfig, triggerSource string, opts DeployOptions) string {
+	key := project.DeployKey()
+	delay := time.Duration(project.DebounceSeconds) * time.Second
+
+	h.debounceMu.Lock()
+	defer h.debounceMu.Unlock()
+
+	if h.debounced == nil {
+		h.debounced = make(map[string]*debouncedDeploy)
+	}
+
+	// Coalesce into the pending deploy unless its timer has already fired
+	if pending, ok := h.debounced[key]; ok && pending.timer.Stop() {
+		pending.project = project
+		pending.triggerSource = triggerSource
+		pending.opts.Force = pending.opts.Force || opts.Force
+		pending.opts.Commit = opts.Commit
+		pending.opts.Push = opts.Push
+		pending.opts.Trial = pending.opts.Trial || opts.Trial
+		pending.timer.Reset(delay)
+		if h.logger != nil {
+			h.logger.Infof(project.Name, "Coalesced webhook into pending build %s (debounce: %v)", pending.opts.BuildID, delay)
+		}
+		return pending.opts.BuildID
+	}
+
+	c := h.timeSource()
+	pending := &debouncedDeploy{opts: opts, project: project, triggerSource: triggerSource, enqueuedAt: c.Now()}
+	pending.timer = c.AfterFunc(delay, func() {
+		h.debounceMu.Lock()
+		if h.debounced[key] == pending {
+			delete(h.debounced, key)
+		}
+		project, triggerSource, opts := pending.project, pending.triggerSource, pending.opts
+		h.debounceMu.Unlock()
+
+		h.startDeploy(project, triggerSource, opts)
+	})
+	h.debounced[key] = pending
+
+	if h.logger != nil {
+		h.logger.Infof(project.Name, "Deploy scheduled in %v as build %s (debounce)", delay, opts.BuildID)
+	}
+	return opts.BuildID
+}
 
-	w.WriteHeader(http.StatusAccepted)
-	_, _ = w.Write([]byte("Accepted"))
+// timeSource returns the deployer's clock, or the wall clock without a deployer
+func (h *WebhookHandler) timeSource() clock {
+	if h.deployer != nil {
+		return h.deployer.clock
+	}
+	return realClock{}
+}
+
+// debouncedBuilds returns the builds of project (and its branch_deploys
+// variants) still waiting out debounce_seconds
+func (h *WebhookHandler) debouncedBuilds(project *ProjectConfig) []queuedBuild {
+	h.debounceMu.Lock()
+	defer h.debounceMu.Unlock()
+
+	key := project.DeployKey()
+	var builds []queuedBuild
+	for k, pending := range h.debounced {
+		if k == key || strings.HasPrefix(k, key+"@") {
+			builds = append(builds, queuedBuild{
+				BuildID:       pending.opts.BuildID,
+				TriggerSource: pending.triggerSource,
+				State:         QueueStateDebounced,
+				EnqueuedAt:    pending.enqueuedAt,
+			})
+		}
+	}
+	return builds
+}
+
+// clientIP returns the IP address of the client that sent r, for logging.
+// With trust_proxy the rightmost valid X-Forwarded-For entry (the address the
+// proxy saw) is used; otherwise, or if the header has none, RemoteAddr.
+func (h *WebhookHandler) clientIP(r *http.Request) string {
+	if cfg := h.currentConfig(); cfg != nil && cfg.TrustProxy {
+		entries := strings.Split(strings.Join(r.Header.Values("X-Forwarded-For"), ","), ",")
+		for i := len(entries) - 1; i >= 0; i-- {
+			if ip, ok := parseClientIP(entries[i]); ok {
+				return ip
+			}
+		}
+	}
+	if ip, ok := parseClientIP(r.RemoteAddr); ok {
+		return ip
+	}
+	return r.RemoteAddr
+}
+
+// parseClientIP extracts the IP from an address as found in RemoteAddr or
+// X-Forwarded-For: "1.2.3.4", "1.2.3.4:80", "::1", "[::1]" or "[::1]:80".
+// IPv4-mapped IPv6 addresses are reported as IPv4.
+func parseClientIP(addr string) (string, bool) {
+	addr = strings.TrimSpace(addr)
+	if host, _, err := net.SplitHostPort(addr); err == nil {
+		addr = host
+	}
+	addr = strings.TrimSuffix(strings.TrimPrefix(addr, "["), "]")
+	ip, err := netip.ParseAddr(addr)
+	if err != nil {
+		return "", false
+	}
+	return ip.Unmap().String(), true
+}
+
+// acceptedResponse is the JSON body returned when a deployment is queued
+type acceptedResponse struct {
+	BuildID string `json:"build_id"`
+}
+
+// pingResponse is the JSON body returned for GitHub ping events
+type pingResponse struct {
+	Zen string `json:"zen"`
+}
+
+// writeJSON writes v as a JSON response with the given status code
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(v)
+}
+
+// payloadRedactor returns the redactor for logged payloads of project: the
+// same secrets and patterns masked in its build logs
+func (h *WebhookHandler) payloadRedactor(project *ProjectConfig) *redactor {
+	if h.deployer != nil {
+		return h.deployer.redactorFor(project)
+	}
+	return newRedactor([]string{project.WebhookSecret}, defaultRedactPatterns)
+}
+
+// maxPayloadBytes returns the configured webhook body limit
+func (h *WebhookHandler) maxPayloadBytes() int64 {
+	if cfg := h.currentConfig(); cfg != nil && cfg.MaxPayloadBytes > 0 {
+		return cfg.MaxPayloadBytes
+	}
+	return Defaults.MaxPayloadBytes
 }
 
 // authenticate checks request authentication
 func (h *WebhookHandler) authenticate(r *http.Request, body []byte, project *ProjectConfig) (TriggerSource, bool) {
-	// First check HMAC signature (X-Hub-Signature-256)
-	signature := r.Header.Get("X-Hub-Signature-256")
+	// A gateway in front of SDeploy may vouch for the webhook with a bearer
+	// token (auth_bearer_token); when the project has one, the header decides
+	if project.AuthBearerToken != "" {
+		if token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer "); ok {
+			if compareSecret(token, project.AuthBearerToken) {
+				return TriggerWebhook, true
+			}
+			return "", false
+		}
+	}
+
+	// Then check the HMAC-SHA256 signature (X-Hub-Signature-256 unless the
+	// project sets signature_header / signature_prefix)
+	header, prefix := project.SignatureScheme()
+	signature := r.Header.Get(header)
 	if signature != "" {
-		if validateHMAC(body, signature, project.WebhookSecret) {
+		if validateHMACWithPrefix(body, signature, prefix, project.WebhookSecret) {
+			return TriggerWebhook, true
+		}
+		return "", false
+	}
+
+	// Legacy senders only sign with SHA-1 (X-Hub-Signature); it is ignored
+	// whenever the SHA-256 header is present
+	signature = r.Header.Get("X-Hub-Signature")
+	if signature != "" {
+		if validateHMACSHA1(body, signature, project.WebhookSecret) {
+			return TriggerWebhook, true
+		}
+		return "", false
+	}
+
+	// Gitea/Forgejo send the bare hex digest in X-Gitea-Signature
+	signature = r.Header.Get("X-Gitea-Signature")
+	if signature != "" {
+		if validateHMACHex(body, signature, project.WebhookSecret) {
 			return TriggerWebhook, true
 		}
 		return "", false
@@ -169,7 +581,7 @@ func (h *WebhookHandler) authenticate(r *http.Request, body []byte, project *Pro
 	// Fallback to secret query parameter
 	secret := r.URL.Query().Get("secret")
 	if secret != "" {
-		if secret == project.WebhookSecret {
+		if compareSecret(secret, project.WebhookSecret) {
 			return TriggerInternal, true
 		}
 		return "", false
@@ -178,25 +590,176 @@ func (h *WebhookHandler) authenticate(r *http.Request, body []byte, project *Pro
 	return "", false
 }
 
+// compareSecret reports whether provided matches expected in constant time.
+// An empty expected secret never matches.
+func compareSecret(provided, expected string) bool {
+	if expected == "" {
+		return false
+	}
+	return subtle.ConstantTimeCompare([]byte(provided), []byte(expected)) == 1
+}
+
 // validateHMAC validates HMAC-SHA256 signature
 func validateHMAC(payload []byte, signature, secret string) bool {
 	// Signature format: sha256=<hex>
-	if !strings.HasPrefix(signature, "sha256=") {
+	return validateHMACWithPrefix(payload, signature, "sha256=", secret)
+}
+
+// validateHMACWithPrefix validates an HMAC-SHA256 signature formatted as
+// prefix followed by the hex digest; the prefix is required when not empty
+func validateHMACWithPrefix(payload []byte, signature, prefix, secret string) bool {
+	if !strings.HasPrefix(signature, prefix) {
 		return false
 	}
 
-	providedMAC, err := hex.DecodeString(strings.TrimPrefix(signature, "sha256="))
+	return validateHMACHex(payload, strings.TrimPrefix(signature, prefix), secret)
+}
+
+// validateHMACSHA1 validates a legacy X-Hub-Signature HMAC-SHA1 signature
+func validateHMACSHA1(payload []byte, signature, secret string) bool {
+	// Signature format: sha1=<hex>
+	if !strings.HasPrefix(signature, "sha1=") {
+		return false
+	}
+
+	return hmacMatches(sha1.New, payload, strings.TrimPrefix(signature, "sha1="), secret)
+}
+
+// validateHMACHex validates a hex-encoded HMAC-SHA256 digest without a prefix
+func validateHMACHex(payload []byte, signature, secret string) bool {
+	return hmacMatches(sha256.New, payload, signature, secret)
+}
+
+// hmacMatches reports whether the hex-encoded signature is the payload's HMAC
+// under secret, using the given hash
+func hmacMatches(newHash func() hash.Hash, payload []byte, signature, secret string) bool {
+	providedMAC, err := hex.DecodeString(signature)
 	if err != nil {
 		return false
 	}
 
-	mac := hmac.New(sha256.New, []byte(secret))
+	mac := hmac.New(newHash, []byte(secret))
 	mac.Write(payload)
 	expectedMAC := mac.Sum(nil)
 
 	return hmac.Equal(providedMAC, expectedMAC)
 }
 
+// acceptsGitHubEvent reports whether the project deploys on the given X-GitHub-Event.
+// Projects without github_events accept only push.
+func acceptsGitHubEvent(project *ProjectConfig, event string) bool {
+	events := project.GitHubEvents
+	if len(events) == 0 {
+		events = Defaults.GitHubEvents
+	}
+	for _, e := range events {
+		if e == event {
+			return true
+		}
+	}
+	return false
+}
+
+// isBranchDeletePayload reports whether a push payload describes a branch
+// deletion (deleted: true, or an all-zero "after" SHA)
+func isBranchDeletePayload(payload []byte) bool {
+	var data struct {
+		Deleted bool   `json:"deleted"`
+		After   string `json:"after"`
+	}
+	if err := json.Unmarshal(payload, &data); err != nil {
+		return false
+	}
+	return data.Deleted || (data.After != "" && strings.Trim(data.After, "0") == "")
+}
+
+// commitSHAPattern matches full SHA-1 and SHA-256 git object names
+var commitSHAPattern = regexp.MustCompile(`^[0-9a-f]{40}([0-9a-f]{24})?$`)
+
+// extractCommitFromPayload returns the pushed commit (after) from a push
+// payload, or "" if it is missing, malformed or a branch deletion
+func extractCommitFromPayload(payload []byte) string {
+	var data struct {
+		After string `json:"after"`
+	}
+	if err := json.Unmarshal(payload, &data); err != nil {
+		return ""
+	}
+	if !commitSHAPattern.MatchString(data.After) || strings.Trim(data.After, "0") == "" {
+		return ""
+	}
+	return data.After
+}
+
+// extractPushInfo returns the pusher, head commit message and compare URL of
+// a push payload. GitHub sends pusher.name and compare; Gitea and Forgejo
+// send pusher.login and compare_url. Missing fields are left empty.
+func extractPushInfo(payload []byte) PushInfo {
+	var data struct {
+		Pusher struct {
+			Name  string `json:"name"`
+			Login string `json:"login"`
+		} `json:"pusher"`
+		HeadCommit struct {
+			Message string `json:"message"`
+		} `json:"head_commit"`
+		Compare    string `json:"compare"`
+		CompareURL string `json:"compare_url"`
+	}
+	if err := json.Unmarshal(payload, &data); err != nil {
+		return PushInfo{}
+	}
+	info := PushInfo{
+		Pusher:        data.Pusher.Name,
+		CommitMessage: data.HeadCommit.Message,
+		CompareURL:    data.Compare,
+	}
+	if info.Pusher == "" {
+		info.Pusher = data.Pusher.Login
+	}
+	if info.CompareURL == "" {
+		info.CompareURL = data.CompareURL
+	}
+	return info
+}
+
+// isForceRequested reports whether the request asks to build even without new
+// commits, via ?force=true or the X-SDeploy-Force header
+func isForceRequested(r *http.Request) bool {
+	for _, v := range []string{r.URL.Query().Get("force"), r.Header.Get("X-SDeploy-Force")} {
+		if force, err := strconv.ParseBool(v); err == nil && force {
+			return true
+		}
+	}
+	return false
+}
+
+// isGiteaRequest reports whether the request was sent by Gitea or Forgejo
+func isGiteaRequest(r *http.Request) bool {
+	return r.Header.Get("X-Gitea-Event") != "" || r.Header.Get("X-Gitea-Signature") != ""
+}
+
+// extractZenFromPayload extracts the zen message from a GitHub ping payload
+func extractZenFromPayload(payload []byte) string {
+	var data struct {
+		Zen string `json:"zen"`
+	}
+	_ = json.Unmarshal(payload, &data)
+	return data.Zen
+}
+
+// extractRepoFromPayload returns the repository full name (owner/name) from
+// a GitHub or Gitea payload, or "" if it has none
+func extractRepoFromPayload(payload []byte) string {
+	var data struct {
+		Repository struct {
+			FullName string `json:"full_name"`
+		} `json:"repository"`
+	}
+	_ = json.Unmarshal(payload, &data)
+	return data.Repository.FullName
+}
+
 // extractBranchFromPayload extracts branch name from webhook payload
 func extractBranchFromPayload(payload []byte) string {
 	var data struct {
@@ -2,13 +2,19 @@ package main
 
 import (
 	"bytes"
+	"context"
 	"crypto/hmac"
+	"crypto/sha1"
 	"crypto/sha256"
 	"encoding/hex"
+	"encoding/json"
 	"net/http"
 	"net/http/httptest"
+	"os"
+	"path/filepath"
 	"strings"
 	"testing"
+	"time"
 )
 
 // TestWebhookRouting tests routing requests by webhook_path to correct project
@@ -507,3 +513,1349 @@ func TestWebhookInternalTriggerWithTriggeredBy(t *testing.T) {
 		t.Errorf("Expected log to contain 'Received INTERNAL trigger', got: %s", logOutput2)
 	}
 }
+
+// TestWebhookResponseBuildID tests that accepted requests return the build ID used for the build log
+func TestWebhookResponseBuildID(t *testing.T) {
+	tmpDir := t.TempDir()
+	cfg := &Config{
+		Projects: []ProjectConfig{
+			{
+				Name:           "TestProject",
+				WebhookPath:    "/hooks/test",
+				WebhookSecret:  "secret",
+				GitBranch:      "main",
+				ExecuteCommand: "echo test",
+			},
+		},
+	}
+
+	var buf syncBuffer
+	logger := NewLogger(&buf, tmpDir, false)
+	handler := NewWebhookHandler(cfg, logger)
+	handler.SetDeployer(NewDeployer(logger))
+
+	req := httptest.NewRequest("POST", "/hooks/test?secret=secret", strings.NewReader(`{"ref":"refs/heads/main"}`))
+	rr := httptest.NewRecorder()
+	handler.ServeHTTP(rr, req)
+
+	if rr.Code != http.StatusAccepted {
+		t.Fatalf("Expected status 202, got %d", rr.Code)
+	}
+	if ct := rr.Header().Get("Content-Type"); ct != "application/json" {
+		t.Errorf("Expected JSON content type, got %q", ct)
+	}
+
+	var resp acceptedResponse
+	if err := json.Unmarshal(rr.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("Failed to decode response: %v", err)
+	}
+	if resp.BuildID == "" {
+		t.Fatal("Expected build_id in response")
+	}
+
+	logFile := filepath.Join(tmpDir, "TestProject-"+resp.BuildID+"-success.log")
+	waitForFile(t, logFile, 5*time.Second)
+}
+
+// TestWebhookGitHubEvents tests ping handling and filtering of non-push GitHub events
+func TestWebhookGitHubEvents(t *testing.T) {
+	cfg := &Config{
+		Projects: []ProjectConfig{
+			{
+				Name:           "Default",
+				WebhookPath:    "/hooks/default",
+				WebhookSecret:  "secret",
+				GitBranch:      "main",
+				ExecuteCommand: "echo test",
+			},
+			{
+				Name:           "Releases",
+				WebhookPath:    "/hooks/releases",
+				WebhookSecret:  "secret",
+				GitBranch:      "main",
+				ExecuteCommand: "echo test",
+				GitHubEvents:   []string{"release"},
+			},
+		},
+	}
+
+	var buf bytes.Buffer
+	handler := NewWebhookHandler(cfg, NewLogger(&buf, "", false))
+
+	tests := []struct {
+		name    string
+		path    string
+		event   string
+		payload string
+		status  int
+		body    string
+	}{
+		{"ping", "/hooks/default", "ping", `{"zen":"Keep it logically awesome."}`, http.StatusOK, "Keep it logically awesome."},
+		{"push accepted", "/hooks/default", "push", `{"ref":"refs/heads/main"}`, http.StatusAccepted, "build_id"},
+		{"issues ignored", "/hooks/default", "issues", `{}`, http.StatusOK, "Ignored"},
+		{"no header", "/hooks/default", "", `{"ref":"refs/heads/main"}`, http.StatusAccepted, "build_id"},
+		{"custom event accepted", "/hooks/releases", "release", `{}`, http.StatusAccepted, "build_id"},
+		{"push not configured", "/hooks/releases", "push", `{"ref":"refs/heads/main"}`, http.StatusOK, "Ignored"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mac := hmac.New(sha256.New, []byte("secret"))
+			mac.Write([]byte(tt.payload))
+
+			req := httptest.NewRequest("POST", tt.path, strings.NewReader(tt.payload))
+			req.Header.Set("X-Hub-Signature-256", "sha256="+hex.EncodeToString(mac.Sum(nil)))
+			if tt.event != "" {
+				req.Header.Set("X-GitHub-Event", tt.event)
+			}
+			rr := httptest.NewRecorder()
+			handler.ServeHTTP(rr, req)
+
+			if rr.Code != tt.status {
+				t.Errorf("Expected status %d, got %d", tt.status, rr.Code)
+			}
+			if !strings.Contains(rr.Body.String(), tt.body) {
+				t.Errorf("Expected body to contain %q, got %q", tt.body, rr.Body.String())
+			}
+		})
+	}
+
+	// Unauthenticated pings are rejected like any other request
+	req := httptest.NewRequest("POST", "/hooks/default", strings.NewReader(`{"zen":"hi"}`))
+	req.Header.Set("X-GitHub-Event", "ping")
+	rr := httptest.NewRecorder()
+	handler.ServeHTTP(rr, req)
+	if rr.Code != http.StatusUnauthorized {
+		t.Errorf("Expected status 401 for unauthenticated ping, got %d", rr.Code)
+	}
+}
+
+// TestIsBranchDeletePayload tests detection of branch deletion push payloads
+func TestIsBranchDeletePayload(t *testing.T) {
+	tests := []struct {
+		payload  string
+		expected bool
+	}{
+		{`{"ref":"refs/heads/main","deleted":true}`, true},
+		{`{"ref":"refs/heads/main","after":"0000000000000000000000000000000000000000"}`, true},
+		{`{"ref":"refs/heads/main","deleted":false,"after":"a1b2c3d4e5f6"}`, false},
+		{`{"ref":"refs/heads/main"}`, false},
+		{`not json`, false},
+	}
+
+	for _, tt := range tests {
+		if got := isBranchDeletePayload([]byte(tt.payload)); got != tt.expected {
+			t.Errorf("isBranchDeletePayload(%s) = %v, expected %v", tt.payload, got, tt.expected)
+		}
+	}
+}
+
+// TestWebhookBranchDeleteSkipsDeploy tests that branch deletions are acknowledged without deploying
+func TestWebhookBranchDeleteSkipsDeploy(t *testing.T) {
+	tmpDir := t.TempDir()
+	marker := filepath.Join(tmpDir, "deployed")
+	cfg := &Config{
+		Projects: []ProjectConfig{
+			{
+				Name:           "TestProject",
+				WebhookPath:    "/hooks/test",
+				WebhookSecret:  "secret",
+				GitBranch:      "main",
+				ExecuteCommand: "touch " + marker,
+			},
+		},
+	}
+
+	var buf syncBuffer
+	logger := NewLogger(&buf, tmpDir, false)
+	handler := NewWebhookHandler(cfg, logger)
+	handler.SetDeployer(NewDeployer(logger))
+
+	payload := `{"ref":"refs/heads/main","deleted":true,"after":"0000000000000000000000000000000000000000"}`
+	req := httptest.NewRequest("POST", "/hooks/test?secret=secret", strings.NewReader(payload))
+	rr := httptest.NewRecorder()
+	handler.ServeHTTP(rr, req)
+
+	if rr.Code != http.StatusAccepted {
+		t.Errorf("Expected status 202, got %d", rr.Code)
+	}
+	if !strings.Contains(buf.String(), "deleted, ignoring") {
+		t.Errorf("Expected branch deletion to be logged, got: %s", buf.String())
+	}
+
+	time.Sleep(200 * time.Millisecond)
+	if _, err := os.Stat(marker); err == nil {
+		t.Error("Expected no deployment for branch deletion")
+	}
+}
+
+// TestWebhookMaxPayloadBytes tests that oversized bodies are rejected with 413
+func TestWebhookMaxPayloadBytes(t *testing.T) {
+	cfg := &Config{
+		MaxPayloadBytes: 64,
+		Projects: []ProjectConfig{
+			{
+				Name:           "TestProject",
+				WebhookPath:    "/hooks/test",
+				WebhookSecret:  "secret",
+				GitBranch:      "main",
+				ExecuteCommand: "echo test",
+			},
+		},
+	}
+	handler := NewWebhookHandler(cfg, nil)
+
+	small := `{"ref":"refs/heads/main"}`
+	mac := hmac.New(sha256.New, []byte("secret"))
+	mac.Write([]byte(small))
+	req := httptest.NewRequest("POST", "/hooks/test", strings.NewReader(small))
+	req.Header.Set("X-Hub-Signature-256", "sha256="+hex.EncodeToString(mac.Sum(nil)))
+	rr := httptest.NewRecorder()
+	handler.ServeHTTP(rr, req)
+	if rr.Code != http.StatusAccepted {
+		t.Errorf("Expected status 202 for payload within limit, got %d", rr.Code)
+	}
+
+	large := `{"ref":"refs/heads/main","padding":"` + strings.Repeat("x", 100) + `"}`
+	req = httptest.NewRequest("POST", "/hooks/test?secret=secret", strings.NewReader(large))
+	rr = httptest.NewRecorder()
+	handler.ServeHTTP(rr, req)
+	if rr.Code != http.StatusRequestEntityTooLarge {
+		t.Errorf("Expected status 413 for oversized payload, got %d", rr.Code)
+	}
+}
+
+// TestCompareSecret tests constant-time secret comparison used for ?secret=
+func TestCompareSecret(t *testing.T) {
+	tests := []struct {
+		provided string
+		expected string
+		match    bool
+	}{
+		{"mysecret", "mysecret", true},
+		{"wrong", "mysecret", false},
+		{"mysecre", "mysecret", false},
+		{"mysecretx", "mysecret", false},
+		{"", "mysecret", false},
+		{"", "", false},
+	}
+
+	for _, tt := range tests {
+		if got := compareSecret(tt.provided, tt.expected); got != tt.match {
+			t.Errorf("compareSecret(%q, %q) = %v, expected %v", tt.provided, tt.expected, got, tt.match)
+		}
+	}
+}
+
+// TestWebhookBranchDeploys tests that a push to a branch_deploys branch runs that entry
+func TestWebhookBranchDeploys(t *testing.T) {
+	tmpDir := t.TempDir()
+	stagingDir := filepath.Join(tmpDir, "staging")
+	cfg := &Config{
+		Projects: []ProjectConfig{
+			{
+				Name:           "Site",
+				WebhookPath:    "/hooks/site",
+				WebhookSecret:  "secret",
+				GitBranch:      "main",
+				LocalPath:      filepath.Join(tmpDir, "prod"),
+				ExecuteCommand: "pwd > deployed",
+				BranchDeploys: []BranchDeploy{
+					{GitBranch: "staging", LocalPath: stagingDir},
+				},
+			},
+		},
+	}
+
+	var buf syncBuffer
+	logger := NewLogger(&buf, tmpDir, false)
+	handler := NewWebhookHandler(cfg, logger)
+	handler.SetDeployer(NewDeployer(logger))
+
+	payload := `{"ref":"refs/heads/staging"}`
+	mac := hmac.New(sha256.New, []byte("secret"))
+	mac.Write([]byte(payload))
+	req := httptest.NewRequest("POST", "/hooks/site", strings.NewReader(payload))
+	req.Header.Set("X-Hub-Signature-256", "sha256="+hex.EncodeToString(mac.Sum(nil)))
+	rr := httptest.NewRecorder()
+	handler.ServeHTTP(rr, req)
+
+	if rr.Code != http.StatusAccepted || !strings.Contains(rr.Body.String(), "build_id") {
+		t.Fatalf("Expected deployment to be accepted, got %d: %s", rr.Code, rr.Body.String())
+	}
+
+	data := waitForFile(t, filepath.Join(stagingDir, "deployed"), 5*time.Second)
+	if strings.TrimSpace(string(data)) != stagingDir {
+		t.Errorf("Expected command to run in %s, got %s", stagingDir, data)
+	}
+
+	// Branches outside the list are still rejected as mismatches
+	payload = `{"ref":"refs/heads/feature"}`
+	mac = hmac.New(sha256.New, []byte("secret"))
+	mac.Write([]byte(payload))
+	req = httptest.NewRequest("POST", "/hooks/site", strings.NewReader(payload))
+	req.Header.Set("X-Hub-Signature-256", "sha256="+hex.EncodeToString(mac.Sum(nil)))
+	rr = httptest.NewRecorder()
+	handler.ServeHTTP(rr, req)
+	if !strings.Contains(rr.Body.String(), "branch mismatch") {
+		t.Errorf("Expected branch mismatch for unlisted branch, got %s", rr.Body.String())
+	}
+}
+
+// TestWebhookDebounce tests that rapid webhooks are coalesced into one deployment
+func TestWebhookDebounce(t *testing.T) {
+	tmpDir := t.TempDir()
+	counter := filepath.Join(tmpDir, "runs")
+	cfg := &Config{
+		Projects: []ProjectConfig{
+			{
+				Name:            "TestProject",
+				WebhookPath:     "/hooks/test",
+				WebhookSecret:   "secret",
+				GitBranch:       "main",
+				ExecuteCommand:  "echo run >> " + counter,
+				DebounceSeconds: 1,
+			},
+		},
+	}
+
+	var buf syncBuffer
+	logger := NewLogger(&buf, tmpDir, false)
+	handler := NewWebhookHandler(cfg, logger)
+	clock := newFakeClock()
+	deployer := NewDeployer(logger)
+	deployer.SetClock(clock)
+	handler.SetDeployer(deployer)
+
+	var buildIDs []string
+	for i := 0; i < 3; i++ {
+		req := httptest.NewRequest("POST", "/hooks/test?secret=secret", strings.NewReader(`{"ref":"refs/heads/main"}`))
+		rr := httptest.NewRecorder()
+		handler.ServeHTTP(rr, req)
+		if rr.Code != http.StatusAccepted {
+			t.Fatalf("Expected status 202, got %d", rr.Code)
+		}
+		var resp acceptedResponse
+		if err := json.Unmarshal(rr.Body.Bytes(), &resp); err != nil {
+			t.Fatalf("Failed to decode response: %v", err)
+		}
+		buildIDs = append(buildIDs, resp.BuildID)
+		clock.Advance(600 * time.Millisecond)
+	}
+
+	if buildIDs[0] != buildIDs[1] || buildIDs[1] != buildIDs[2] {
+		t.Errorf("Expected coalesced requests to share a build ID, got %v", buildIDs)
+	}
+
+	// Nothing runs until the debounce interval passes without new requests,
+	// even though more than debounce_seconds passed since the first one
+	if _, err := os.Stat(counter); err == nil {
+		t.Error("Expected deploy to wait for the debounce interval")
+	}
+
+	clock.Advance(400 * time.Millisecond)
+
+	waitForFile(t, filepath.Join(tmpDir, "TestProject-"+buildIDs[0]+"-success.log"), 5*time.Second)
+	data, err := os.ReadFile(counter)
+	if err != nil {
+		t.Fatalf("Failed to read run counter: %v", err)
+	}
+	if runs := strings.Count(string(data), "run"); runs != 1 {
+		t.Errorf("Expected exactly 1 deployment, got %d", runs)
+	}
+}
+
+// TestWebhookGiteaSignature tests X-Gitea-Signature validation and Gitea trigger classification
+func TestWebhookGiteaSignature(t *testing.T) {
+	cfg := &Config{
+		Projects: []ProjectConfig{
+			{
+				Name:           "TestProject",
+				WebhookPath:    "/hooks/test",
+				WebhookSecret:  "mysecret",
+				GitBranch:      "main",
+				ExecuteCommand: "echo test",
+			},
+		},
+	}
+
+	// Trimmed Gitea push payload
+	payload := `{
+  "ref": "refs/heads/main",
+  "before": "28e1879d029cb852e4844d9c718537df08844e03",
+  "after": "bffeb74224043ba2feb48d137756c8a9331c449a",
+  "compare_url": "https://gitea.example.com/org/app/compare/28e1879d029c...bffeb7422404",
+  "commits": [{"id": "bffeb74224043ba2feb48d137756c8a9331c449a", "message": "Update README\n"}],
+  "repository": {"id": 140, "name": "app", "full_name": "org/app", "html_url": "https://gitea.example.com/org/app"},
+  "pusher": {"id": 1, "login": "gitea", "email": "gitea@example.com"},
+  "sender": {"id": 1, "login": "gitea", "email": "gitea@example.com"}
+}`
+	mac := hmac.New(sha256.New, []byte("mysecret"))
+	mac.Write([]byte(payload))
+	validSignature := hex.EncodeToString(mac.Sum(nil))
+
+	tests := []struct {
+		name      string
+		signature string
+		expected  int
+	}{
+		{"valid signature", validSignature, http.StatusAccepted},
+		{"prefixed signature", "sha256=" + validSignature, http.StatusUnauthorized},
+		{"invalid signature", "deadbeef", http.StatusUnauthorized},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var buf bytes.Buffer
+			handler := NewWebhookHandler(cfg, NewLogger(&buf, "", false))
+
+			req := httptest.NewRequest("POST", "/hooks/test", strings.NewReader(payload))
+			req.Header.Set("Content-Type", "application/json")
+			req.Header.Set("X-Gitea-Event", "push")
+			req.Header.Set("X-Gitea-Signature", tt.signature)
+			rr := httptest.NewRecorder()
+			handler.ServeHTTP(rr, req)
+
+			if rr.Code != tt.expected {
+				t.Fatalf("Expected status %d, got %d", tt.expected, rr.Code)
+			}
+			if tt.expected == http.StatusAccepted && !strings.Contains(buf.String(), "Received WEBHOOK (Gitea) trigger for branch: main") {
+				t.Errorf("Expected Gitea trigger for branch main, got: %s", buf.String())
+			}
+		})
+	}
+}
+
+// TestIsForceRequested tests the force query parameter and header
+func TestIsForceRequested(t *testing.T) {
+	tests := []struct {
+		target   string
+		header   string
+		expected bool
+	}{
+		{"/hooks/test", "", false},
+		{"/hooks/test?force=true", "", true},
+		{"/hooks/test?force=1", "", true},
+		{"/hooks/test?force=false", "", false},
+		{"/hooks/test?force=yes", "", false},
+		{"/hooks/test", "true", true},
+		{"/hooks/test", "0", false},
+	}
+
+	for _, tt := range tests {
+		req := httptest.NewRequest("POST", tt.target, nil)
+		if tt.header != "" {
+			req.Header.Set("X-SDeploy-Force", tt.header)
+		}
+		if got := isForceRequested(req); got != tt.expected {
+			t.Errorf("isForceRequested(%q, header %q) = %v, expected %v", tt.target, tt.header, got, tt.expected)
+		}
+	}
+}
+
+// TestWebhookForceRequiresAuth tests that force does not bypass authentication
+func TestWebhookForceRequiresAuth(t *testing.T) {
+	cfg := &Config{
+		Projects: []ProjectConfig{
+			{
+				Name:           "TestProject",
+				WebhookPath:    "/hooks/test",
+				WebhookSecret:  "mysecret",
+				ExecuteCommand: "echo test",
+			},
+		},
+	}
+	handler := NewWebhookHandler(cfg, nil)
+
+	req := httptest.NewRequest("POST", "/hooks/test?force=true&secret=wrong", strings.NewReader(`{"ref":"refs/heads/main"}`))
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("X-SDeploy-Force", "true")
+	rr := httptest.NewRecorder()
+	handler.ServeHTTP(rr, req)
+
+	if rr.Code != http.StatusUnauthorized {
+		t.Errorf("Expected status 401, got %d", rr.Code)
+	}
+}
+
+// TestWebhookUnknownPathLogged tests that requests to unknown paths are logged
+func TestWebhookUnknownPathLogged(t *testing.T) {
+	cfg := &Config{
+		Projects: []ProjectConfig{
+			{
+				Name:           "TestProject",
+				WebhookPath:    "/hooks/test",
+				WebhookSecret:  "mysecret",
+				ExecuteCommand: "echo test",
+			},
+		},
+	}
+	var buf bytes.Buffer
+	handler := NewWebhookHandler(cfg, NewLogger(&buf, "", false))
+
+	req := httptest.NewRequest("POST", "/hooks/typo", strings.NewReader(`{}`))
+	req.RemoteAddr = "203.0.113.7:54321"
+	rr := httptest.NewRecorder()
+	handler.ServeHTTP(rr, req)
+
+	if rr.Code != http.StatusNotFound {
+		t.Errorf("Expected status 404, got %d", rr.Code)
+	}
+	logOutput := buf.String()
+	if !strings.Contains(logOutput, "[WARN]") || !strings.Contains(logOutput, "Unknown webhook path: POST /hooks/typo from 203.0.113.7") {
+		t.Errorf("Expected unknown path warning, got: %s", logOutput)
+	}
+}
+
+// TestWebhookSHA1Signature tests the X-Hub-Signature fallback and sha256 precedence
+func TestWebhookSHA1Signature(t *testing.T) {
+	cfg := &Config{
+		Projects: []ProjectConfig{
+			{
+				Name:           "TestProject",
+				WebhookPath:    "/hooks/test",
+				WebhookSecret:  "mysecret",
+				GitBranch:      "main",
+				ExecuteCommand: "echo test",
+			},
+		},
+	}
+	handler := NewWebhookHandler(cfg, nil)
+
+	payload := `{"ref":"refs/heads/main"}`
+	mac1 := hmac.New(sha1.New, []byte("mysecret"))
+	mac1.Write([]byte(payload))
+	sha1Signature := "sha1=" + hex.EncodeToString(mac1.Sum(nil))
+	mac256 := hmac.New(sha256.New, []byte("mysecret"))
+	mac256.Write([]byte(payload))
+	sha256Signature := "sha256=" + hex.EncodeToString(mac256.Sum(nil))
+
+	tests := []struct {
+		name      string
+		sha1Sig   string
+		sha256Sig string
+		expected  int
+	}{
+		{"valid sha1 only", sha1Signature, "", http.StatusAccepted},
+		{"invalid sha1 only", "sha1=deadbeef", "", http.StatusUnauthorized},
+		{"sha256 value in sha1 header", sha256Signature, "", http.StatusUnauthorized},
+		{"valid sha256 wins over invalid sha1", "sha1=deadbeef", sha256Signature, http.StatusAccepted},
+		{"invalid sha256 is not rescued by valid sha1", sha1Signature, "sha256=deadbeef", http.StatusUnauthorized},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest("POST", "/hooks/test", strings.NewReader(payload))
+			req.Header.Set("Content-Type", "application/json")
+			if tt.sha1Sig != "" {
+				req.Header.Set("X-Hub-Signature", tt.sha1Sig)
+			}
+			if tt.sha256Sig != "" {
+				req.Header.Set("X-Hub-Signature-256", tt.sha256Sig)
+			}
+			rr := httptest.NewRecorder()
+			handler.ServeHTTP(rr, req)
+
+			if rr.Code != tt.expected {
+				t.Errorf("Expected status %d, got %d", tt.expected, rr.Code)
+			}
+		})
+	}
+}
+
+// TestExtractCommitFromPayload tests reading the pushed SHA from a payload
+func TestExtractCommitFromPayload(t *testing.T) {
+	sha := "bffeb74224043ba2feb48d137756c8a9331c449a"
+	tests := []struct {
+		payload  string
+		expected string
+	}{
+		{`{"after":"` + sha + `"}`, sha},
+		{`{"after":"` + sha + strings.Repeat("0", 24) + `"}`, sha + strings.Repeat("0", 24)},
+		{`{"after":"0000000000000000000000000000000000000000"}`, ""},
+		{`{"after":"BFFEB74224043BA2FEB48D137756C8A9331C449A"}`, ""},
+		{`{"after":"bffeb742"}`, ""},
+		{`{"after":"--upload-pack=evil"}`, ""},
+		{`{"ref":"refs/heads/main"}`, ""},
+		{`not json`, ""},
+	}
+
+	for _, tt := range tests {
+		if got := extractCommitFromPayload([]byte(tt.payload)); got != tt.expected {
+			t.Errorf("extractCommitFromPayload(%s) = %q, expected %q", tt.payload, got, tt.expected)
+		}
+	}
+}
+
+// TestExtractPushInfo tests reading the pusher, commit message and compare URL
+func TestExtractPushInfo(t *testing.T) {
+	tests := []struct {
+		name     string
+		payload  string
+		expected PushInfo
+	}{
+		{"github", `{"pusher":{"name":"octocat"},"head_commit":{"message":"Fix login"},"compare":"https://github.com/o/r/compare/a...b"}`,
+			PushInfo{Pusher: "octocat", CommitMessage: "Fix login", CompareURL: "https://github.com/o/r/compare/a...b"}},
+		{"gitea", `{"pusher":{"login":"gitea"},"head_commit":{"message":"Fix"},"compare_url":"https://git.example.com/o/r/compare/a...b"}`,
+			PushInfo{Pusher: "gitea", CommitMessage: "Fix", CompareURL: "https://git.example.com/o/r/compare/a...b"}},
+		{"missing fields", `{"ref":"refs/heads/main"}`, PushInfo{}},
+		{"not json", `not json`, PushInfo{}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := extractPushInfo([]byte(tt.payload)); got != tt.expected {
+				t.Errorf("extractPushInfo() = %+v, expected %+v", got, tt.expected)
+			}
+		})
+	}
+}
+
+// TestWebhookDisabledProject tests that disabled projects accept webhooks without deploying
+func TestWebhookDisabledProject(t *testing.T) {
+	tmpDir := t.TempDir()
+	marker := filepath.Join(tmpDir, "deployed")
+	cfg := &Config{
+		Projects: []ProjectConfig{
+			{
+				Name:           "TestProject",
+				WebhookPath:    "/hooks/test",
+				WebhookSecret:  "mysecret",
+				ExecuteCommand: "touch " + marker,
+				Enabled:        new(bool),
+			},
+		},
+	}
+	var buf syncBuffer
+	logger := NewLogger(&buf, "", false)
+	handler := NewWebhookHandler(cfg, logger)
+	handler.SetDeployer(NewDeployer(logger))
+
+	// Authentication still applies
+	req := httptest.NewRequest("POST", "/hooks/test?secret=wrong", strings.NewReader(`{"ref":"refs/heads/main"}`))
+	rr := httptest.NewRecorder()
+	handler.ServeHTTP(rr, req)
+	if rr.Code != http.StatusUnauthorized {
+		t.Errorf("Expected status 401, got %d", rr.Code)
+	}
+
+	req = httptest.NewRequest("POST", "/hooks/test?secret=mysecret", strings.NewReader(`{"ref":"refs/heads/main"}`))
+	rr = httptest.NewRecorder()
+	handler.ServeHTTP(rr, req)
+	if rr.Code != http.StatusAccepted {
+		t.Errorf("Expected status 202, got %d", rr.Code)
+	}
+	if !strings.Contains(buf.String(), "Project disabled, skipping") {
+		t.Errorf("Expected disabled log, got: %s", buf.String())
+	}
+
+	time.Sleep(200 * time.Millisecond)
+	if _, err := os.Stat(marker); !os.IsNotExist(err) {
+		t.Error("Expected disabled project not to deploy")
+	}
+}
+
+// TestWebhookMaintenanceMode tests that maintenance mode acknowledges webhooks without deploying
+func TestWebhookMaintenanceMode(t *testing.T) {
+	tmpDir := t.TempDir()
+	marker := filepath.Join(tmpDir, "deployed")
+	cfg := &Config{
+		MaintenanceMode: true,
+		Projects: []ProjectConfig{
+			{
+				Name:           "TestProject",
+				WebhookPath:    "/hooks/test",
+				WebhookSecret:  "mysecret",
+				LocalPath:      tmpDir,
+				ExecuteCommand: "echo ok > " + marker,
+			},
+		},
+	}
+	var buf syncBuffer
+	logger := NewLogger(&buf, tmpDir, false)
+	handler := NewWebhookHandler(cfg, logger)
+	handler.SetDeployer(NewDeployer(logger))
+
+	send := func() *httptest.ResponseRecorder {
+		req := httptest.NewRequest("POST", "/hooks/test?secret=mysecret", strings.NewReader(`{"ref":"refs/heads/main"}`))
+		rr := httptest.NewRecorder()
+		handler.ServeHTTP(rr, req)
+		return rr
+	}
+
+	rr := send()
+	if rr.Code != http.StatusAccepted {
+		t.Errorf("Expected status 202, got %d", rr.Code)
+	}
+	if !strings.Contains(rr.Body.String(), "maintenance mode") {
+		t.Errorf("Expected maintenance response, got: %s", rr.Body.String())
+	}
+	if !strings.Contains(buf.String(), "Deferred: maintenance mode") {
+		t.Errorf("Expected deferred log, got: %s", buf.String())
+	}
+
+	// The runtime switch applies on top of the config
+	cfg.MaintenanceMode = false
+	if !handler.ToggleMaintenance() {
+		t.Fatal("Expected ToggleMaintenance to enable maintenance")
+	}
+	if rr := send(); !strings.Contains(rr.Body.String(), "maintenance mode") {
+		t.Errorf("Expected maintenance response from runtime switch, got: %s", rr.Body.String())
+	}
+
+	time.Sleep(200 * time.Millisecond)
+	if _, err := os.Stat(marker); !os.IsNotExist(err) {
+		t.Fatal("Expected no deploy in maintenance mode")
+	}
+
+	if handler.ToggleMaintenance() {
+		t.Fatal("Expected ToggleMaintenance to disable maintenance")
+	}
+	if rr := send(); strings.Contains(rr.Body.String(), "maintenance mode") {
+		t.Errorf("Expected deploy after maintenance ended, got: %s", rr.Body.String())
+	}
+	waitForFile(t, marker, 5*time.Second)
+}
+
+// TestParseClientIP tests client IP extraction from IPv4 and IPv6 addresses
+func TestParseClientIP(t *testing.T) {
+	tests := []struct {
+		addr     string
+		expected string
+		ok       bool
+	}{
+		{"203.0.113.7:54321", "203.0.113.7", true},
+		{"203.0.113.7", "203.0.113.7", true},
+		{"[::1]:8080", "::1", true},
+		{"[2001:db8::1]:443", "2001:db8::1", true},
+		{"2001:db8::1", "2001:db8::1", true},
+		{"[2001:db8::1]", "2001:db8::1", true},
+		{"[fe80::1%eth0]:22", "fe80::1%eth0", true},
+		{"[::ffff:192.0.2.1]:80", "192.0.2.1", true},
+		{" 198.51.100.2 ", "198.51.100.2", true},
+		{"unknown", "", false},
+		{"", "", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.addr, func(t *testing.T) {
+			got, ok := parseClientIP(tt.addr)
+			if ok != tt.ok || got != tt.expected {
+				t.Errorf("parseClientIP(%q) = %q, %v; expected %q, %v", tt.addr, got, ok, tt.expected, tt.ok)
+			}
+		})
+	}
+}
+
+// TestClientIP tests RemoteAddr and X-Forwarded-For handling with and without trust_proxy
+func TestClientIP(t *testing.T) {
+	tests := []struct {
+		name       string
+		trustProxy bool
+		remoteAddr string
+		forwarded  []string
+		expected   string
+	}{
+		{"ipv4 remote", false, "192.0.2.10:1234", nil, "192.0.2.10"},
+		{"ipv6 remote", false, "[2001:db8::10]:1234", nil, "2001:db8::10"},
+		{"forwarded ignored without trust_proxy", false, "[::1]:1234", []string{"203.0.113.7"}, "::1"},
+		{"forwarded ipv4", true, "[::1]:1234", []string{"203.0.113.7"}, "203.0.113.7"},
+		{"forwarded ipv6", true, "127.0.0.1:1234", []string{"2001:db8::7"}, "2001:db8::7"},
+		{"rightmost entry of chain", true, "127.0.0.1:1234", []string{"198.51.100.1, [2001:db8::7]:443"}, "2001:db8::7"},
+		{"multiple headers", true, "127.0.0.1:1234", []string{"198.51.100.1", "203.0.113.9"}, "203.0.113.9"},
+		{"invalid entries skipped", true, "127.0.0.1:1234", []string{"203.0.113.7, unknown"}, "203.0.113.7"},
+		{"no header falls back", true, "[::1]:1234", nil, "::1"},
+		{"unparsable remote kept", false, "pipe", nil, "pipe"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			handler := NewWebhookHandler(&Config{TrustProxy: tt.trustProxy}, nil)
+			req := httptest.NewRequest("POST", "/hooks/test", nil)
+			req.RemoteAddr = tt.remoteAddr
+			for _, v := range tt.forwarded {
+				req.Header.Add("X-Forwarded-For", v)
+			}
+			if got := handler.clientIP(req); got != tt.expected {
+				t.Errorf("Expected %q, got %q", tt.expected, got)
+			}
+		})
+	}
+}
+
+// TestWebhookMinBuildInterval tests that webhooks arriving within min_build_interval_seconds are skipped
+func TestWebhookMinBuildInterval(t *testing.T) {
+	tmpDir := t.TempDir()
+	marker := filepath.Join(tmpDir, "deployed")
+	cfg := &Config{
+		Projects: []ProjectConfig{
+			{
+				Name:             "TestProject",
+				WebhookPath:      "/hooks/test",
+				WebhookSecret:    "mysecret",
+				ExecuteCommand:   "echo ok > " + marker,
+				MinBuildInterval: 3600,
+			},
+		},
+	}
+	var buf syncBuffer
+	logger := NewLogger(&buf, "", false)
+	clock := newFakeClock()
+	deployer := NewDeployer(logger)
+	deployer.SetClock(clock)
+	handler := NewWebhookHandler(cfg, logger)
+	handler.SetDeployer(deployer)
+	project := &cfg.Projects[0]
+
+	payload := `{"ref":"refs/heads/main"}`
+	mac := hmac.New(sha256.New, []byte("mysecret"))
+	mac.Write([]byte(payload))
+	signature := "sha256=" + hex.EncodeToString(mac.Sum(nil))
+	send := func() *httptest.ResponseRecorder {
+		req := httptest.NewRequest("POST", "/hooks/test", strings.NewReader(payload))
+		req.Header.Set("X-Hub-Signature-256", signature)
+		rr := httptest.NewRecorder()
+		handler.ServeHTTP(rr, req)
+		return rr
+	}
+
+	// Without a previous build the webhook deploys
+	if rr := send(); rr.Code != http.StatusAccepted || !strings.Contains(rr.Body.String(), "build_id") {
+		t.Fatalf("Expected first webhook to start a build, got %d %q", rr.Code, rr.Body.String())
+	}
+	waitForFile(t, marker, 5*time.Second)
+	deadline := time.Now().Add(5 * time.Second)
+	for deployer.buildIntervalRemaining(project, clock.Now()) == 0 && time.Now().Before(deadline) {
+		time.Sleep(20 * time.Millisecond)
+	}
+
+	rr := send()
+	if rr.Code != http.StatusAccepted || !strings.Contains(rr.Body.String(), "rate-limited") {
+		t.Errorf("Expected rate-limited 202, got %d %q", rr.Code, rr.Body.String())
+	}
+	if !strings.Contains(buf.String(), "Rate-limited: next build allowed in") {
+		t.Errorf("Expected rate-limit log, got: %s", buf.String())
+	}
+
+	// Internal triggers are not limited, whether sent with ?secret= or run directly
+	req := httptest.NewRequest("POST", "/hooks/test?secret=mysecret", strings.NewReader(payload))
+	rr = httptest.NewRecorder()
+	handler.ServeHTTP(rr, req)
+	if rr.Code != http.StatusAccepted || strings.Contains(rr.Body.String(), "rate-limited") {
+		t.Errorf("Expected internal trigger to bypass the rate limit, got %d %q", rr.Code, rr.Body.String())
+	}
+	deployer.WaitForActiveBuilds(5 * time.Second)
+	if result := deployer.Deploy(context.Background(), project, "INTERNAL"); result.Skipped || !result.Success {
+		t.Errorf("Expected internal deploy to run, got skipped=%v error=%s", result.Skipped, result.Error)
+	}
+
+	// The interval counts from the end of the last build
+	clock.Advance(time.Hour - time.Second)
+	if rr := send(); !strings.Contains(rr.Body.String(), "rate-limited") {
+		t.Errorf("Expected webhook a second before the interval ends to be rate-limited, got %q", rr.Body.String())
+	}
+	clock.Advance(time.Second)
+	os.Remove(marker)
+	if rr := send(); rr.Code != http.StatusAccepted || !strings.Contains(rr.Body.String(), "build_id") {
+		t.Fatalf("Expected webhook to build once the interval elapsed, got %d %q", rr.Code, rr.Body.String())
+	}
+	// The build runs in the background; let it finish before TempDir cleanup
+	waitForFile(t, marker, 5*time.Second)
+	deployer.WaitForActiveBuilds(5 * time.Second)
+}
+
+// TestWebhookLogPayloads tests that payloads are only logged with log_payloads
+// and have secrets masked
+func TestWebhookLogPayloads(t *testing.T) {
+	token := "ghp_" + strings.Repeat("a", 36)
+	payload := `{"ref":"refs/heads/main","note":"mysecret","url":"https://` + token + `@example.com"}`
+	enabled := true
+
+	tests := []struct {
+		name        string
+		logPayloads *bool
+	}{
+		{"default", nil},
+		{"enabled", &enabled},
+	}
+
+	for _, tt := range tests {
+		cfg := &Config{
+			MaintenanceMode: true,
+			Projects: []ProjectConfig{
+				{
+					Name:           "TestProject",
+					WebhookPath:    "/hooks/test",
+					WebhookSecret:  "mysecret",
+					ExecuteCommand: "true",
+					LogPayloads:    tt.logPayloads,
+				},
+			},
+		}
+		var buf syncBuffer
+		handler := NewWebhookHandler(cfg, NewLogger(&buf, "", false))
+
+		req := httptest.NewRequest("POST", "/hooks/test?secret=mysecret", strings.NewReader(payload))
+		rr := httptest.NewRecorder()
+		handler.ServeHTTP(rr, req)
+		if rr.Code != http.StatusAccepted {
+			t.Fatalf("%s: expected 202, got %d", tt.name, rr.Code)
+		}
+
+		logs := buf.String()
+		if strings.Contains(logs, "mysecret") || strings.Contains(logs, token) {
+			t.Errorf("%s: expected no secrets in log, got: %s", tt.name, logs)
+		}
+		logged := strings.Contains(logs, "Payload: ")
+		if logged != (tt.logPayloads != nil) {
+			t.Errorf("%s: expected payload logged = %t, got: %s", tt.name, tt.logPayloads != nil, logs)
+		}
+		if logged && !strings.Contains(logs, `"note":"***"`) {
+			t.Errorf("%s: expected masked payload, got: %s", tt.name, logs)
+		}
+	}
+}
+
+// TestWebhookCircuitBreaker tests that repeated failures pause webhook builds
+// until the cooldown, then allow a single trial build
+func TestWebhookCircuitBreaker(t *testing.T) {
+	tmpDir := t.TempDir()
+	okFile := filepath.Join(tmpDir, "ok")
+	cfg := &Config{
+		Projects: []ProjectConfig{
+			{
+				Name:             "TestProject",
+				WebhookPath:      "/hooks/test",
+				WebhookSecret:    "mysecret",
+				ExecuteCommand:   "test -f " + okFile,
+				FailureThreshold: 2,
+				BreakerCooldown:  3600,
+			},
+		},
+	}
+	var buf syncBuffer
+	logger := NewLogger(&buf, "", false)
+	clock := newFakeClock()
+	deployer := NewDeployer(logger)
+	deployer.SetClock(clock)
+	handler := NewWebhookHandler(cfg, logger)
+	handler.SetDeployer(deployer)
+	project := &cfg.Projects[0]
+
+	payload := `{"ref":"refs/heads/main"}`
+	mac := hmac.New(sha256.New, []byte("mysecret"))
+	mac.Write([]byte(payload))
+	signature := "sha256=" + hex.EncodeToString(mac.Sum(nil))
+	send := func() *httptest.ResponseRecorder {
+		req := httptest.NewRequest("POST", "/hooks/test", strings.NewReader(payload))
+		req.Header.Set("X-Hub-Signature-256", signature)
+		rr := httptest.NewRecorder()
+		handler.ServeHTTP(rr, req)
+		return rr
+	}
+
+	// One failure leaves the breaker closed
+	deployer.Deploy(context.Background(), project, "INTERNAL")
+	if open, _, _ := deployer.breakerOpen(project, clock.Now()); open {
+		t.Fatal("Expected breaker closed below failure_threshold")
+	}
+
+	deployer.Deploy(context.Background(), project, "INTERNAL")
+	rr := send()
+	if rr.Code != http.StatusAccepted || !strings.Contains(rr.Body.String(), "circuit breaker open") {
+		t.Errorf("Expected webhook to be skipped by the open breaker, got %d %q", rr.Code, rr.Body.String())
+	}
+	if !strings.Contains(buf.String(), "Circuit breaker open after 2 consecutive failures") {
+		t.Errorf("Expected breaker open warning, got: %s", buf.String())
+	}
+
+	// Internal triggers bypass the open breaker
+	req := httptest.NewRequest("POST", "/hooks/test?secret=mysecret", strings.NewReader(payload))
+	rr = httptest.NewRecorder()
+	handler.ServeHTTP(rr, req)
+	if strings.Contains(rr.Body.String(), "circuit breaker open") {
+		t.Errorf("Expected internal trigger to bypass the breaker, got %q", rr.Body.String())
+	}
+	deployer.WaitForActiveBuilds(5 * time.Second)
+
+	// After the cooldown exactly one trial build is let through
+	clock.Advance(2 * time.Hour)
+	if open, _, _ := deployer.breakerOpen(project, clock.Now()); open {
+		t.Error("Expected a trial build after the cooldown")
+	}
+	if open, remaining, _ := deployer.breakerOpen(project, clock.Now()); !open || remaining != 0 {
+		t.Errorf("Expected breaker held open during the trial build, got open=%t remaining=%v", open, remaining)
+	}
+
+	// A success closes the breaker
+	if err := os.WriteFile(okFile, []byte("ok"), 0644); err != nil {
+		t.Fatalf("Failed to write file: %v", err)
+	}
+	if result := deployer.Deploy(context.Background(), project, "INTERNAL"); !result.Success {
+		t.Fatalf("Expected deploy to succeed, got error: %s", result.Error)
+	}
+	if open, _, _ := deployer.breakerOpen(project, clock.Now()); open {
+		t.Error("Expected a successful build to close the breaker")
+	}
+}
+
+// TestWebhookCircuitBreakerSkippedTrial tests that a trial build which ends
+// without a result, here skipped because the project is busy, does not hold
+// the breaker open for later webhooks
+func TestWebhookCircuitBreakerSkippedTrial(t *testing.T) {
+	cfg := &Config{
+		Projects: []ProjectConfig{
+			{
+				Name:             "TestProject",
+				WebhookPath:      "/hooks/test",
+				WebhookSecret:    "mysecret",
+				ExecuteCommand:   "false",
+				FailureThreshold: 1,
+				BreakerCooldown:  60,
+			},
+		},
+	}
+	var buf syncBuffer
+	logger := NewLogger(&buf, "", false)
+	clock := newFakeClock()
+	deployer := NewDeployer(logger)
+	deployer.SetClock(clock)
+	handler := NewWebhookHandler(cfg, logger)
+	handler.SetDeployer(deployer)
+	project := &cfg.Projects[0]
+
+	payload := `{"ref":"refs/heads/main"}`
+	mac := hmac.New(sha256.New, []byte("mysecret"))
+	mac.Write([]byte(payload))
+	signature := "sha256=" + hex.EncodeToString(mac.Sum(nil))
+	send := func() *httptest.ResponseRecorder {
+		req := httptest.NewRequest("POST", "/hooks/test", strings.NewReader(payload))
+		req.Header.Set("X-Hub-Signature-256", signature)
+		rr := httptest.NewRecorder()
+		handler.ServeHTTP(rr, req)
+		return rr
+	}
+
+	deployer.Deploy(context.Background(), project, "INTERNAL")
+	clock.Advance(2 * time.Minute)
+
+	// The trial build finds the project busy and is skipped
+	lock := deployer.getProjectLock(project.LockKey())
+	lock.Lock()
+	if rr := send(); strings.Contains(rr.Body.String(), "circuit breaker open") {
+		t.Fatalf("Expected the trial build to be let through, got %q", rr.Body.String())
+	}
+	deployer.WaitForActiveBuilds(5 * time.Second)
+	deadline := time.Now().Add(5 * time.Second)
+	for !strings.Contains(buf.String(), "event=skipped_busy") && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+	lock.Unlock()
+	if !strings.Contains(buf.String(), "event=skipped_busy") {
+		t.Fatalf("Expected the trial build to be skipped, got: %s", buf.String())
+	}
+	for deployer.state.snapshot(project.DeployKey()).TrialRunning && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	// The next webhook is the new trial build
+	if rr := send(); strings.Contains(rr.Body.String(), "circuit breaker open") {
+		t.Errorf("Expected the next webhook to get through after a skipped trial, got %q", rr.Body.String())
+	}
+	for deployer.state.consecutiveFailures(project.DeployKey()) < 2 && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+	if failures := deployer.state.consecutiveFailures(project.DeployKey()); failures != 2 {
+		t.Errorf("Expected the new trial build to run and fail, got %d consecutive failures", failures)
+	}
+}
+
+// TestWebhookRemoteDefaultBranch tests that a project without git_branch
+// filters pushes by the remote default branch only once a deploy has looked
+// it up; the handler itself never queries the remote
+func TestWebhookRemoteDefaultBranch(t *testing.T) {
+	remoteDir, workDir, _, _ := setupTestRemote(t)
+	runTestGit(t, workDir, "push", "origin", "HEAD:refs/heads/trunk")
+	runTestGit(t, remoteDir, "symbolic-ref", "HEAD", "refs/heads/trunk")
+
+	cfg := &Config{
+		Projects: []ProjectConfig{
+			{
+				Name:           "TrunkProject",
+				WebhookPath:    "/hooks/trunk",
+				WebhookSecret:  "mysecret",
+				GitRepo:        "file://" + remoteDir,
+				LocalPath:      filepath.Join(t.TempDir(), "repo"),
+				GitBranch:      Defaults.GitBranch,
+				GitUpdate:      true,
+				ExecuteCommand: "true",
+				remoteBranch:   true,
+			},
+		},
+	}
+	var buf syncBuffer
+	logger := NewLogger(&buf, "", false)
+	deployer := NewDeployer(logger)
+	handler := NewWebhookHandler(cfg, logger)
+	handler.SetDeployer(deployer)
+	send := func(branch string) string {
+		payload := `{"ref":"refs/heads/` + branch + `"}`
+		mac := hmac.New(sha256.New, []byte("mysecret"))
+		mac.Write([]byte(payload))
+		req := httptest.NewRequest("POST", "/hooks/trunk", strings.NewReader(payload))
+		req.Header.Set("X-Hub-Signature-256", "sha256="+hex.EncodeToString(mac.Sum(nil)))
+		rr := httptest.NewRecorder()
+		handler.ServeHTTP(rr, req)
+		return rr.Body.String()
+	}
+
+	// Not known yet: the push is let through and its deploy looks it up
+	if body := send("feature"); strings.Contains(body, "branch mismatch") {
+		t.Fatalf("Expected the push not to be filtered before the branch is known, got %q", body)
+	}
+	if !strings.Contains(buf.String(), "Remote default branch not known yet") {
+		t.Errorf("Expected the unfiltered push to be logged, got: %s", buf.String())
+	}
+	deadline := time.Now().Add(10 * time.Second)
+	for !strings.Contains(buf.String(), "Deployment successful") && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+	deployer.WaitForActiveBuilds(5 * time.Second)
+
+	if body := send("feature"); !strings.Contains(body, "branch mismatch") {
+		t.Errorf("Expected a push to another branch to be skipped once trunk is known, got %q", body)
+	}
+	if body := send("trunk"); strings.Contains(body, "branch mismatch") {
+		t.Errorf("Expected a push to trunk to deploy, got %q", body)
+	}
+	for strings.Count(buf.String(), "Starting deployment") < 2 && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+	deployer.WaitForActiveBuilds(5 * time.Second)
+}
+
+// TestWebhookCustomSignatureHeader tests signature_header and signature_prefix
+func TestWebhookCustomSignatureHeader(t *testing.T) {
+	payload := `{"ref":"refs/heads/main"}`
+	mac := hmac.New(sha256.New, []byte("mysecret"))
+	mac.Write([]byte(payload))
+	digest := hex.EncodeToString(mac.Sum(nil))
+
+	tests := []struct {
+		name      string
+		header    string
+		prefix    string
+		sendName  string
+		sendValue string
+		want      int
+	}{
+		{"default scheme", "", "", "X-Hub-Signature-256", "sha256=" + digest, http.StatusAccepted},
+		{"custom header without prefix", "X-MyCompany-Signature", "", "X-MyCompany-Signature", digest, http.StatusAccepted},
+		{"custom header and prefix", "X-MyCompany-Signature", "v1=", "X-MyCompany-Signature", "v1=" + digest, http.StatusAccepted},
+		{"missing custom prefix", "X-MyCompany-Signature", "v1=", "X-MyCompany-Signature", digest, http.StatusUnauthorized},
+		{"wrong digest", "X-MyCompany-Signature", "", "X-MyCompany-Signature", strings.Repeat("0", 64), http.StatusUnauthorized},
+		{"github header ignored", "X-MyCompany-Signature", "", "X-Hub-Signature-256", "sha256=" + digest, http.StatusUnauthorized},
+	}
+
+	for _, tt := range tests {
+		cfg := &Config{
+			MaintenanceMode: true,
+			Projects: []ProjectConfig{
+				{
+					Name:            "TestProject",
+					WebhookPath:     "/hooks/test",
+					WebhookSecret:   "mysecret",
+					ExecuteCommand:  "true",
+					SignatureHeader: tt.header,
+					SignaturePrefix: tt.prefix,
+				},
+			},
+		}
+		handler := NewWebhookHandler(cfg, nil)
+
+		req := httptest.NewRequest("POST", "/hooks/test", strings.NewReader(payload))
+		req.Header.Set(tt.sendName, tt.sendValue)
+		rr := httptest.NewRecorder()
+		handler.ServeHTTP(rr, req)
+		if rr.Code != tt.want {
+			t.Errorf("%s: expected %d, got %d %q", tt.name, tt.want, rr.Code, rr.Body.String())
+		}
+	}
+}
+
+// TestWebhookBearerToken tests auth_bearer_token authentication
+func TestWebhookBearerToken(t *testing.T) {
+	payload := `{"ref":"refs/heads/main"}`
+	mac := hmac.New(sha256.New, []byte("mysecret"))
+	mac.Write([]byte(payload))
+	signature := "sha256=" + hex.EncodeToString(mac.Sum(nil))
+
+	tests := []struct {
+		name          string
+		bearerToken   string
+		authorization string
+		signature     string
+		want          int
+	}{
+		{"valid token", "gateway-token", "Bearer gateway-token", "", http.StatusAccepted},
+		{"wrong token", "gateway-token", "Bearer other-token", "", http.StatusUnauthorized},
+		{"wrong token with valid HMAC", "gateway-token", "Bearer other-token", signature, http.StatusUnauthorized},
+		{"HMAC without token header", "gateway-token", "", signature, http.StatusAccepted},
+		{"token not configured", "", "Bearer gateway-token", "", http.StatusUnauthorized},
+		{"basic auth ignored", "gateway-token", "Basic Z2F0ZXdheS10b2tlbg==", "", http.StatusUnauthorized},
+	}
+
+	for _, tt := range tests {
+		cfg := &Config{
+			MaintenanceMode: true,
+			Projects: []ProjectConfig{
+				{
+					Name:            "TestProject",
+					WebhookPath:     "/hooks/test",
+					WebhookSecret:   "mysecret",
+					ExecuteCommand:  "true",
+					AuthBearerToken: tt.bearerToken,
+				},
+			},
+		}
+		handler := NewWebhookHandler(cfg, nil)
+
+		req := httptest.NewRequest("POST", "/hooks/test", strings.NewReader(payload))
+		if tt.authorization != "" {
+			req.Header.Set("Authorization", tt.authorization)
+		}
+		if tt.signature != "" {
+			req.Header.Set("X-Hub-Signature-256", tt.signature)
+		}
+		rr := httptest.NewRecorder()
+		handler.ServeHTTP(rr, req)
+		if rr.Code != tt.want {
+			t.Errorf("%s: expected %d, got %d %q", tt.name, tt.want, rr.Code, rr.Body.String())
+		}
+	}
+}
+
+// TestWebhookBranchCommands tests that a push to a branch_commands branch
+// checks it out in the shared local_path and runs its command
+func TestWebhookBranchCommands(t *testing.T) {
+	remoteDir, workDir, targetPath, branch := setupTestRemote(t)
+	runTestGit(t, workDir, "checkout", "-b", "develop")
+	pushTestCommit(t, workDir, "develop.txt", "staging")
+
+	outFile := filepath.Join(t.TempDir(), "env")
+	cfg := &Config{
+		Projects: []ProjectConfig{
+			{
+				Name:           "Site",
+				WebhookPath:    "/hooks/site",
+				WebhookSecret:  "mysecret",
+				GitRepo:        "file://" + remoteDir,
+				LocalPath:      targetPath,
+				GitBranch:      branch,
+				GitUpdate:      true,
+				ExecuteCommand: "echo prod > " + outFile,
+				BranchCommands: map[string]string{"develop": "test -f develop.txt && echo staging > " + outFile},
+			},
+		},
+	}
+	var buf syncBuffer
+	logger := NewLogger(&buf, t.TempDir(), false)
+	deployer := NewDeployer(logger)
+	handler := NewWebhookHandler(cfg, logger)
+	handler.SetDeployer(deployer)
+
+	push := func(ref string) {
+		t.Helper()
+		payload := `{"ref":"refs/heads/` + ref + `"}`
+		mac := hmac.New(sha256.New, []byte("mysecret"))
+		mac.Write([]byte(payload))
+		req := httptest.NewRequest("POST", "/hooks/site", strings.NewReader(payload))
+		req.Header.Set("X-Hub-Signature-256", "sha256="+hex.EncodeToString(mac.Sum(nil)))
+		rr := httptest.NewRecorder()
+		handler.ServeHTTP(rr, req)
+		if rr.Code != http.StatusAccepted || !strings.Contains(rr.Body.String(), "build_id") {
+			t.Fatalf("Expected push to %s to start a build, got %d %q", ref, rr.Code, rr.Body.String())
+		}
+		waitForActiveBuilds(t, deployer, 1)
+		deployer.WaitForActiveBuilds(10 * time.Second)
+	}
+
+	push("develop")
+	if data, _ := os.ReadFile(outFile); strings.TrimSpace(string(data)) != "staging" {
+		t.Errorf("Expected develop command to run, got %q: %s", data, buf.String())
+	}
+	if got := runTestGit(t, targetPath, "rev-parse", "--abbrev-ref", "HEAD"); got != "develop" {
+		t.Errorf("Expected checkout on develop, got %s", got)
+	}
+
+	push(branch)
+	if data, _ := os.ReadFile(outFile); strings.TrimSpace(string(data)) != "prod" {
+		t.Errorf("Expected execute_command for %s, got %q", branch, data)
+	}
+	if got := runTestGit(t, targetPath, "rev-parse", "--abbrev-ref", "HEAD"); got != branch {
+		t.Errorf("Expected checkout back on %s, got %s", branch, got)
+	}
+}
+
+// TestWebhookMatchRepo tests that projects sharing a webhook_path are picked
+// by the payload's repository and authenticated with their own secret
+func TestWebhookMatchRepo(t *testing.T) {
+	tmpDir := t.TempDir()
+	cfg := &Config{
+		Projects: []ProjectConfig{
+			{
+				Name:           "Frontend",
+				WebhookPath:    "/hooks/ci",
+				WebhookSecret:  "frontend",
+				MatchRepo:      "myorg/frontend",
+				GitBranch:      "main",
+				ExecuteCommand: "echo ok > " + filepath.Join(tmpDir, "frontend"),
+			},
+			{
+				Name:           "Backend",
+				WebhookPath:    "/hooks/ci",
+				WebhookSecret:  "backend",
+				MatchRepo:      "myorg/backend",
+				GitBranch:      "main",
+				ExecuteCommand: "echo ok > " + filepath.Join(tmpDir, "backend"),
+			},
+		},
+	}
+	var buf syncBuffer
+	logger := NewLogger(&buf, tmpDir, false)
+	deployer := NewDeployer(logger)
+	handler := NewWebhookHandler(cfg, logger)
+	handler.SetDeployer(deployer)
+
+	send := func(repo, secret string) *httptest.ResponseRecorder {
+		t.Helper()
+		payload := `{"ref":"refs/heads/main","repository":{"full_name":"` + repo + `"}}`
+		mac := hmac.New(sha256.New, []byte(secret))
+		mac.Write([]byte(payload))
+		req := httptest.NewRequest("POST", "/hooks/ci", strings.NewReader(payload))
+		req.Header.Set("X-Hub-Signature-256", "sha256="+hex.EncodeToString(mac.Sum(nil)))
+		rr := httptest.NewRecorder()
+		handler.ServeHTTP(rr, req)
+		return rr
+	}
+
+	// Repository names compare case-insensitively, like on GitHub
+	if rr := send("MyOrg/Backend", "backend"); rr.Code != http.StatusAccepted {
+		t.Fatalf("Expected backend deployment to be accepted, got %d: %s", rr.Code, rr.Body.String())
+	}
+	waitForFile(t, filepath.Join(tmpDir, "backend"), 5*time.Second)
+	deployer.WaitForActiveBuilds(5 * time.Second)
+	if _, err := os.Stat(filepath.Join(tmpDir, "frontend")); err == nil {
+		t.Error("Expected only the backend project to deploy")
+	}
+
+	if rr := send("myorg/backend", "frontend"); rr.Code != http.StatusUnauthorized {
+		t.Errorf("Expected another project's secret to be rejected, got %d", rr.Code)
+	}
+	if rr := send("myorg/docs", "frontend"); rr.Code != http.StatusNotFound {
+		t.Errorf("Expected 404 for an unmatched repository, got %d", rr.Code)
+	}
+	if !strings.Contains(buf.String(), `No project on webhook path /hooks/ci matches repository "myorg/docs"`) {
+		t.Errorf("Expected unmatched repository to be logged, got: %s", buf.String())
+	}
+}
@@ -4,7 +4,8 @@ go 1.24.10
 
 require (
 	github.com/fsnotify/fsnotify v1.9.0
+	golang.org/x/term v0.40.0
 	gopkg.in/yaml.v3 v3.0.1
 )
 
-require golang.org/x/sys v0.13.0 // indirect
+require golang.org/x/sys v0.41.0 // indirect